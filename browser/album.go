@@ -1,8 +1,24 @@
 package browser
 
+import "time"
+
 type LocalAlbum struct {
-	Path                string  // As found in the files
-	Title               string  // either the directory base name, or metadata
-	Description         string  // As found in the metadata
-	Latitude, Longitude float64 // As found in the metadata
+	Path                string        // As found in the files
+	Title               string        // either the directory base name, or metadata
+	Description         string        // As found in the metadata
+	Latitude, Longitude float64       // As found in the metadata
+	Sharing             *AlbumSharing // Collaborators and comments when the album is shared
+}
+
+// AlbumSharing gives the collaborators and the comments of a shared album
+type AlbumSharing struct {
+	Collaborators []string // Names of the collaborators, as found in the metadata
+	Comments      []AlbumComment
+}
+
+// AlbumComment is a comment left on a shared album
+type AlbumComment struct {
+	Author string
+	Text   string
+	Date   time.Time
 }
@@ -0,0 +1,289 @@
+// Package applephotos reads the Apple Photos libraries (.photoslibrary bundles) without macOS.
+package applephotos
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/namematcher"
+	"github.com/simulot/immich-go/helpers/sqlitedb"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/immich/metadata"
+)
+
+/*
+	A Photos library is a folder with:
+	- database/Photos.sqlite: the Core Data database of the library
+	- originals/X/UUID.ext: the original files, X being the first character of the UUID,
+	  and UUID_3.mov the video of a live photo
+	- resources/renders/X/UUID_1_201_a.jpeg: the edited versions of the photos (UUID_2_0_a.mov for videos)
+
+	The database is copied before being read. The library is never modified.
+	Only the libraries of Photos 5 (macOS 10.15) and later are supported.
+*/
+
+type Library struct {
+	fsyss          []fs.FS
+	log            *fileevent.Recorder
+	sm             immich.SupportedMedia
+	banned         namematcher.List
+	editedVersions browser.EditedVersions
+
+	assets []libraryAsset
+}
+
+// libraryAsset is an asset as read from the database
+type libraryAsset struct {
+	fsys      fs.FS
+	root      string // path of the library in the fsys
+	uuid      string
+	directory string
+	fileName  string
+	title     string // the original file name, the asset's title is given in metadata
+	favorite  bool
+	hidden    bool
+	trashed   bool
+	edited    bool
+	metadata  metadata.Metadata
+	albums    []browser.LocalAlbum
+}
+
+func NewLibrary(ctx context.Context, l *fileevent.Recorder, sm immich.SupportedMedia, fsyss ...fs.FS) (*Library, error) {
+	return &Library{
+		fsyss: fsyss,
+		log:   l,
+		sm:    sm,
+	}, nil
+}
+
+func (lib *Library) SetBannedFiles(banned namematcher.List) *Library {
+	lib.banned = banned
+	return lib
+}
+
+func (lib *Library) SetEditedVersions(v browser.EditedVersions) *Library {
+	lib.editedVersions = v
+	return lib
+}
+
+// Prepare reads the database of the libraries
+func (lib *Library) Prepare(ctx context.Context) error {
+	for _, fsys := range lib.fsyss {
+		roots, err := findLibraries(fsys)
+		if err != nil {
+			return err
+		}
+		if len(roots) == 0 {
+			return fmt.Errorf("no Photos library found in %s", fsName(fsys))
+		}
+		for _, root := range roots {
+			err = lib.readLibrary(ctx, fsys, root)
+			if err != nil {
+				return fmt.Errorf("can't read the Photos library %s: %w", path.Join(fsName(fsys), root), err)
+			}
+		}
+	}
+	return nil
+}
+
+func fsName(fsys fs.FS) string {
+	if n, ok := fsys.(interface{ Name() string }); ok {
+		return n.Name()
+	}
+	return "the input"
+}
+
+// findLibraries gives the libraries of the fsys: the fsys itself, or its .photoslibrary folders
+func findLibraries(fsys fs.FS) ([]string, error) {
+	if _, err := fs.Stat(fsys, "database/Photos.sqlite"); err == nil {
+		return []string{"."}, nil
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var roots []string
+	for _, e := range entries {
+		if e.IsDir() && strings.HasSuffix(e.Name(), ".photoslibrary") {
+			if _, err := fs.Stat(fsys, path.Join(e.Name(), "database/Photos.sqlite")); err == nil {
+				roots = append(roots, e.Name())
+			}
+		}
+	}
+	return roots, nil
+}
+
+// readLibrary reads a copy of the library's database
+func (lib *Library) readLibrary(ctx context.Context, fsys fs.FS, root string) error {
+	dbName := path.Join(root, "database/Photos.sqlite")
+	db, err := sqlitedb.Open(fsys, dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	lib.log.Record(ctx, fileevent.DiscoveredSidecar, fsys, dbName, "type", "Photos library database")
+
+	s, err := readSchema(ctx, db.DB)
+	if err != nil {
+		return err
+	}
+	assets, err := s.readAssets(ctx, db.DB)
+	if err != nil {
+		return err
+	}
+	keywords, err := s.readKeywords(ctx, db.DB)
+	if err != nil {
+		return err
+	}
+	albums, err := s.readAlbums(ctx, db.DB)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range assets {
+		a.fsys = fsys
+		a.root = root
+		a.metadata.Keywords = keywords[a.attributesPK]
+		a.albums = albums[a.pk]
+		lib.assets = append(lib.assets, a.libraryAsset)
+	}
+	return nil
+}
+
+// Browse gives the assets of the libraries
+func (lib *Library) Browse(ctx context.Context) chan *browser.LocalAssetFile {
+	assetChan := make(chan *browser.LocalAssetFile)
+
+	go func() {
+		defer close(assetChan)
+		for _, la := range lib.assets {
+			for _, a := range lib.makeAssets(ctx, la) {
+				select {
+				case <-ctx.Done():
+					return
+				case assetChan <- a:
+				}
+			}
+		}
+	}()
+	return assetChan
+}
+
+// makeAssets makes the original and the edited version of the library's asset, as selected
+func (lib *Library) makeAssets(ctx context.Context, la libraryAsset) []*browser.LocalAssetFile {
+	dir := path.Join(la.root, "originals", la.directory)
+	original := path.Join(dir, la.fileName)
+	info, err := fs.Stat(la.fsys, original)
+	if err != nil {
+		lib.log.Record(ctx, fileevent.DiscoveredDiscarded, nil, original, "reason", "the original isn't in the library, it may be stored in iCloud only")
+		return nil
+	}
+	t := lib.sm.TypeFromExt(path.Ext(original))
+	switch t {
+	case immich.TypeImage:
+		lib.log.Record(ctx, fileevent.DiscoveredImage, nil, original)
+	case immich.TypeVideo:
+		lib.log.Record(ctx, fileevent.DiscoveredVideo, nil, original)
+	default:
+		lib.log.Record(ctx, fileevent.DiscoveredUnsupported, nil, original, "reason", "unsupported file type")
+		return nil
+	}
+	if lib.banned.Match(original) {
+		lib.log.Record(ctx, fileevent.DiscoveredDiscarded, nil, original, "reason", "banned file")
+		return nil
+	}
+
+	var assets []*browser.LocalAssetFile
+	a := lib.makeAsset(ctx, la, original, la.title, int(info.Size()))
+
+	// The video of a live photo
+	if t == immich.TypeImage {
+		video := path.Join(dir, la.uuid+"_3.mov")
+		if info, err := fs.Stat(la.fsys, video); err == nil {
+			lib.log.Record(ctx, fileevent.DiscoveredVideo, nil, video)
+			title := strings.TrimSuffix(la.title, path.Ext(la.title)) + path.Ext(video)
+			a.LivePhoto = lib.makeAsset(ctx, la, video, title, int(info.Size()))
+		}
+	}
+
+	edited := ""
+	if la.edited {
+		edited = lib.findRender(la, t)
+	}
+	if edited == "" || lib.editedVersions != browser.KeepEditedVersion {
+		assets = append(assets, a)
+	} else {
+		lib.log.Record(ctx, fileevent.UploadNotSelected, a, original, "reason", "original of an edited version")
+	}
+
+	if edited != "" {
+		info, err := fs.Stat(la.fsys, edited)
+		if err != nil {
+			lib.log.Record(ctx, fileevent.Error, nil, edited, "error", err.Error())
+			return assets
+		}
+		if t == immich.TypeVideo {
+			lib.log.Record(ctx, fileevent.DiscoveredVideo, nil, edited)
+		} else {
+			lib.log.Record(ctx, fileevent.DiscoveredImage, nil, edited)
+		}
+		stem := strings.TrimSuffix(la.title, path.Ext(la.title))
+		if lib.editedVersions == browser.KeepOriginalVersion {
+			lib.log.Record(ctx, fileevent.UploadNotSelected, nil, edited, "reason", "edited version")
+			return assets
+		}
+		title := stem + "-edited" + path.Ext(edited)
+		if lib.editedVersions == browser.KeepEditedVersion {
+			title = stem + path.Ext(edited)
+		}
+		assets = append(assets, lib.makeAsset(ctx, la, edited, title, int(info.Size())))
+	}
+	return assets
+}
+
+// findRender returns the edited version of the asset, if any
+func (lib *Library) findRender(la libraryAsset, t string) string {
+	matches, err := fs.Glob(la.fsys, path.Join(la.root, "resources/renders", la.directory, la.uuid+"_*"))
+	if err != nil {
+		return ""
+	}
+	for _, m := range matches {
+		if lib.sm.TypeFromExt(path.Ext(m)) == t {
+			return m
+		}
+	}
+	return ""
+}
+
+func (lib *Library) makeAsset(ctx context.Context, la libraryAsset, name string, title string, size int) *browser.LocalAssetFile {
+	a := &browser.LocalAssetFile{
+		FileName: name,
+		Title:    title,
+		FileSize: size,
+		FSys:     la.fsys,
+		Favorite: la.favorite,
+		Archived: la.hidden,
+		Trashed:  la.trashed,
+		Albums:   la.albums,
+		Metadata: la.metadata,
+	}
+	lib.log.Record(ctx, fileevent.AnalysisAssociatedMetadata, nil, name)
+	if a.Trashed {
+		lib.log.Record(ctx, fileevent.DiscoveredTrashed, nil, name)
+	}
+	if a.Archived {
+		lib.log.Record(ctx, fileevent.DiscoveredArchived, nil, name)
+	}
+	return a
+}
+
+// coreDataTime converts a Core Data timestamp, the number of seconds since 2001-01-01
+func coreDataTime(t float64) time.Time {
+	return time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(t * float64(time.Second)))
+}
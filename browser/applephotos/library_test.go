@@ -0,0 +1,200 @@
+package applephotos
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+// makeLibrary makes a Photos library with the tables and columns read by immich-go
+func makeLibrary(t *testing.T) string {
+	dir := filepath.Join(t.TempDir(), "My Library.photoslibrary")
+	for _, f := range []string{
+		"originals/1/1111.heic",
+		"originals/1/1111_3.mov",
+		"originals/2/2222.jpeg",
+		"originals/3/3333.mov",
+		"resources/renders/2/2222_1_201_a.jpeg",
+		"resources/renders/2/2222.plist",
+	} {
+		name := filepath.Join(dir, f)
+		err := os.MkdirAll(filepath.Dir(name), 0o700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(name, []byte(f), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.MkdirAll(filepath.Join(dir, "database"), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", filepath.Join(dir, "database", "Photos.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// 2023-06-13 17:21:00 UTC is 708369660 seconds after 2001-01-01
+	for _, q := range []string{
+		`CREATE TABLE ZASSET (Z_PK INTEGER PRIMARY KEY, ZUUID VARCHAR, ZDIRECTORY VARCHAR, ZFILENAME VARCHAR, ZDATECREATED TIMESTAMP,
+			ZLATITUDE FLOAT, ZLONGITUDE FLOAT, ZFAVORITE INTEGER, ZHIDDEN INTEGER, ZTRASHEDSTATE INTEGER, ZHASADJUSTMENTS INTEGER)`,
+		`CREATE TABLE ZADDITIONALASSETATTRIBUTES (Z_PK INTEGER PRIMARY KEY, ZASSET INTEGER, ZORIGINALFILENAME VARCHAR, ZTITLE VARCHAR)`,
+		`CREATE TABLE ZASSETDESCRIPTION (Z_PK INTEGER PRIMARY KEY, ZASSETATTRIBUTES INTEGER, ZLONGDESCRIPTION VARCHAR)`,
+		`CREATE TABLE ZKEYWORD (Z_PK INTEGER PRIMARY KEY, ZTITLE VARCHAR)`,
+		`CREATE TABLE Z_1KEYWORDS (Z_1ASSETATTRIBUTES INTEGER, Z_38KEYWORDS INTEGER)`,
+		`CREATE TABLE ZGENERICALBUM (Z_PK INTEGER PRIMARY KEY, ZTITLE VARCHAR, ZKIND INTEGER, ZPARENTFOLDER INTEGER, ZTRASHEDSTATE INTEGER)`,
+		`CREATE TABLE Z_28ASSETS (Z_28ALBUMS INTEGER, Z_3ASSETS INTEGER, Z_FOK_3ASSETS INTEGER)`,
+
+		`INSERT INTO ZASSET VALUES (1, '1111', '1', '1111.heic', 708369660, 48.8584, 2.2945, 1, 0, 0, 0)`,
+		`INSERT INTO ZASSET VALUES (2, '2222', '2', '2222.jpeg', 708369720, -180, -180, 0, 1, 0, 1)`,
+		`INSERT INTO ZASSET VALUES (3, '3333', '3', '3333.mov', 708369780, -180, -180, 0, 0, 1, 0)`,
+		`INSERT INTO ZASSET VALUES (4, '4444', '4', '4444.heic', 708369840, -180, -180, 0, 0, 0, 0)`,
+		`INSERT INTO ZADDITIONALASSETATTRIBUTES VALUES (11, 1, 'IMG_0001.HEIC', 'Eiffel tower')`,
+		`INSERT INTO ZADDITIONALASSETATTRIBUTES VALUES (12, 2, 'IMG_0002.JPG', NULL)`,
+		`INSERT INTO ZADDITIONALASSETATTRIBUTES VALUES (13, 3, 'IMG_0003.MOV', NULL)`,
+		`INSERT INTO ZASSETDESCRIPTION VALUES (1, 11, 'Paris, at night')`,
+		`INSERT INTO ZKEYWORD VALUES (1, 'travel')`,
+		`INSERT INTO ZKEYWORD VALUES (2, 'france')`,
+		`INSERT INTO Z_1KEYWORDS VALUES (11, 1)`,
+		`INSERT INTO Z_1KEYWORDS VALUES (11, 2)`,
+		`INSERT INTO ZGENERICALBUM VALUES (1, NULL, 3999, NULL, 0)`,
+		`INSERT INTO ZGENERICALBUM VALUES (2, 'Trips', 4000, 1, 0)`,
+		`INSERT INTO ZGENERICALBUM VALUES (3, 'Paris', 2, 2, 0)`,
+		`INSERT INTO ZGENERICALBUM VALUES (4, 'Family', 2, 1, 0)`,
+		`INSERT INTO ZGENERICALBUM VALUES (5, 'Old', 2, 1, 1)`,
+		`INSERT INTO Z_28ASSETS VALUES (3, 1, 1)`,
+		`INSERT INTO Z_28ASSETS VALUES (4, 2, 1)`,
+		`INSERT INTO Z_28ASSETS VALUES (5, 2, 2)`,
+	} {
+		_, err = db.Exec(q)
+		if err != nil {
+			t.Fatalf("%s: %s", q, err)
+		}
+	}
+	return filepath.Dir(dir)
+}
+
+type result struct {
+	file      string
+	title     string
+	livePhoto string
+	favorite  bool
+	archived  bool
+	trashed   bool
+	albums    []browser.LocalAlbum
+}
+
+func browse(t *testing.T, root string, v browser.EditedVersions) ([]result, []*browser.LocalAssetFile) {
+	ctx := context.Background()
+	lib, err := NewLibrary(ctx, fileevent.NewRecorder(nil, false), immich.DefaultSupportedMedia, os.DirFS(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib.SetEditedVersions(v)
+	err = lib.Prepare(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []result
+	var assets []*browser.LocalAssetFile
+	for a := range lib.Browse(ctx) {
+		r := result{
+			file:     a.FileName,
+			title:    a.Title,
+			favorite: a.Favorite,
+			archived: a.Archived,
+			trashed:  a.Trashed,
+			albums:   a.Albums,
+		}
+		if a.LivePhoto != nil {
+			r.livePhoto = a.LivePhoto.FileName
+		}
+		results = append(results, r)
+		assets = append(assets, a)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].file < results[j].file })
+	return results, assets
+}
+
+func TestLibrary(t *testing.T) {
+	root := makeLibrary(t)
+	got, assets := browse(t, root, browser.KeepAllVersions)
+
+	paris := browser.LocalAlbum{Title: "Paris", Path: "Trips/Paris"}
+	family := browser.LocalAlbum{Title: "Family", Path: "Family"}
+	want := []result{
+		{
+			file:      "My Library.photoslibrary/originals/1/1111.heic",
+			title:     "IMG_0001.HEIC",
+			livePhoto: "My Library.photoslibrary/originals/1/1111_3.mov",
+			favorite:  true,
+			albums:    []browser.LocalAlbum{paris},
+		},
+		{
+			file:     "My Library.photoslibrary/originals/2/2222.jpeg",
+			title:    "IMG_0002.JPG",
+			archived: true,
+			albums:   []browser.LocalAlbum{family},
+		},
+		{
+			file:    "My Library.photoslibrary/originals/3/3333.mov",
+			title:   "IMG_0003.MOV",
+			trashed: true,
+		},
+		{
+			file:     "My Library.photoslibrary/resources/renders/2/2222_1_201_a.jpeg",
+			title:    "IMG_0002-edited.jpeg",
+			archived: true,
+			albums:   []browser.LocalAlbum{family},
+		},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("unexpected assets\nwant %+v\ngot  %+v", want, got)
+	}
+
+	for _, a := range assets {
+		if a.Title != "IMG_0001.HEIC" {
+			continue
+		}
+		md := a.Metadata
+		if md.Title != "Eiffel tower" || md.Description != "Paris, at night" ||
+			!reflect.DeepEqual(md.Keywords, []string{"france", "travel"}) ||
+			!md.DateTaken.Equal(time.Date(2023, 6, 13, 17, 21, 0, 0, time.UTC)) ||
+			md.Latitude != 48.8584 || md.Longitude != 2.2945 {
+			t.Errorf("unexpected metadata: %+v", md)
+		}
+		if a.LivePhoto.Title != "IMG_0001.mov" {
+			t.Errorf("unexpected live photo's title: %s", a.LivePhoto.Title)
+		}
+	}
+}
+
+func TestLibraryEditedVersions(t *testing.T) {
+	root := makeLibrary(t)
+	for v, want := range map[browser.EditedVersions][]string{
+		browser.KeepEditedVersion:   {"IMG_0001.HEIC", "IMG_0002.jpeg", "IMG_0003.MOV"},
+		browser.KeepOriginalVersion: {"IMG_0001.HEIC", "IMG_0002.JPG", "IMG_0003.MOV"},
+	} {
+		got, _ := browse(t, root, v)
+		var titles []string
+		for _, r := range got {
+			titles = append(titles, r.title)
+		}
+		sort.Strings(titles)
+		if !reflect.DeepEqual(want, titles) {
+			t.Errorf("edited versions %d: want %v, got %v", v, want, titles)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package applephotos
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+)
+
+/*
+	The names of the tables and of the columns of the Core Data database change from a version of Photos to the next one.
+	The join tables are named after the entity numbers, like Z_28ASSETS(Z_28ALBUMS, Z_3ASSETS).
+	They are found by the names of their columns.
+*/
+
+// schema gives the names of the tables and columns of the library's database
+type schema struct {
+	assetTable    string // ZASSET, or ZGENERICASSET for Photos 5
+	hasCaption    bool   // the ZASSETDESCRIPTION table is present
+	keywordsJoin  string // join table of the keywords and the asset attributes
+	keywordsAttr  string // column of the asset attributes in the keywords join table
+	keywordsKey   string // column of the keywords in the keywords join table
+	albumsJoin    string // join table of the albums and the assets
+	albumsAlbum   string // column of the albums in the albums join table
+	albumsAsset   string // column of the assets in the albums join table
+	hasAdjustment bool   // the asset table has the ZHASADJUSTMENTS column
+}
+
+// dbAsset is an asset with its keys in the database
+type dbAsset struct {
+	libraryAsset
+	pk           int64
+	attributesPK int64
+}
+
+const (
+	albumKindUser   = 2    // album created by the user
+	albumKindFolder = 4000 // folder of albums
+)
+
+var (
+	reJoinAttr    = regexp.MustCompile(`^Z_\d+ASSETATTRIBUTES$`)
+	reJoinKeyword = regexp.MustCompile(`^Z_\d+KEYWORDS$`)
+	reJoinAlbum   = regexp.MustCompile(`^Z_\d+ALBUMS$`)
+	reJoinAsset   = regexp.MustCompile(`^Z_\d+ASSETS$`)
+)
+
+func readSchema(ctx context.Context, db *sql.DB) (*schema, error) {
+	tables, err := queryStrings(ctx, db, "SELECT name FROM sqlite_master WHERE type='table'")
+	if err != nil {
+		return nil, err
+	}
+	s := schema{}
+	for _, t := range tables {
+		switch {
+		case t == "ZASSET":
+			s.assetTable = t
+		case t == "ZGENERICASSET" && s.assetTable == "":
+			s.assetTable = t
+		case t == "ZASSETDESCRIPTION":
+			s.hasCaption = true
+		case strings.HasPrefix(t, "Z_"):
+			columns, err := queryStrings(ctx, db, "SELECT name FROM pragma_table_info(?)", t)
+			if err != nil {
+				return nil, err
+			}
+			attr, keyword := find(columns, reJoinAttr), find(columns, reJoinKeyword)
+			if attr != "" && keyword != "" {
+				s.keywordsJoin, s.keywordsAttr, s.keywordsKey = t, attr, keyword
+			}
+			album, asset := find(columns, reJoinAlbum), find(columns, reJoinAsset)
+			if album != "" && asset != "" {
+				s.albumsJoin, s.albumsAlbum, s.albumsAsset = t, album, asset
+			}
+		}
+	}
+	if s.assetTable == "" {
+		return nil, fmt.Errorf("the database isn't a Photos library database")
+	}
+	columns, err := queryStrings(ctx, db, "SELECT name FROM pragma_table_info(?)", s.assetTable)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range columns {
+		if c == "ZHASADJUSTMENTS" {
+			s.hasAdjustment = true
+		}
+	}
+	return &s, nil
+}
+
+func find(columns []string, re *regexp.Regexp) string {
+	for _, c := range columns {
+		if re.MatchString(c) {
+			return c
+		}
+	}
+	return ""
+}
+
+func queryStrings(ctx context.Context, db *sql.DB, query string, args ...any) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var r []string
+	for rows.Next() {
+		var s string
+		err = rows.Scan(&s)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, s)
+	}
+	return r, rows.Err()
+}
+
+// readAssets reads the assets with their attributes
+func (s *schema) readAssets(ctx context.Context, db *sql.DB) ([]dbAsset, error) {
+	adjusted := "0"
+	if s.hasAdjustment {
+		adjusted = "a.ZHASADJUSTMENTS"
+	}
+	caption, captionJoin := "''", ""
+	if s.hasCaption {
+		caption = "d.ZLONGDESCRIPTION"
+		captionJoin = "LEFT JOIN ZASSETDESCRIPTION d ON d.ZASSETATTRIBUTES = aa.Z_PK"
+	}
+	query := `SELECT a.Z_PK, COALESCE(aa.Z_PK, 0), a.ZUUID, a.ZDIRECTORY, a.ZFILENAME, COALESCE(aa.ZORIGINALFILENAME, ''),
+		COALESCE(aa.ZTITLE, ''), COALESCE(` + caption + `, ''), COALESCE(a.ZDATECREATED, 0),
+		COALESCE(a.ZLATITUDE, -180), COALESCE(a.ZLONGITUDE, -180),
+		COALESCE(a.ZFAVORITE, 0), COALESCE(a.ZHIDDEN, 0), COALESCE(a.ZTRASHEDSTATE, 0), COALESCE(` + adjusted + `, 0)
+		FROM ` + s.assetTable + ` a
+		LEFT JOIN ZADDITIONALASSETATTRIBUTES aa ON aa.ZASSET = a.Z_PK
+		` + captionJoin + `
+		ORDER BY a.ZDATECREATED, a.Z_PK`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assets []dbAsset
+	for rows.Next() {
+		var a dbAsset
+		var date, lat, lon float64
+		var favorite, hidden, trashed, adjusted int
+		err = rows.Scan(&a.pk, &a.attributesPK, &a.uuid, &a.directory, &a.fileName, &a.title,
+			&a.metadata.Title, &a.metadata.Description, &date,
+			&lat, &lon,
+			&favorite, &hidden, &trashed, &adjusted)
+		if err != nil {
+			return nil, err
+		}
+		if a.title == "" {
+			a.title = a.fileName
+		}
+		if date != 0 {
+			a.metadata.DateTaken = coreDataTime(date)
+		}
+		// -180 is given for the assets without location
+		if lat != -180 && lon != -180 && (lat != 0 || lon != 0) {
+			a.metadata.Latitude = lat
+			a.metadata.Longitude = lon
+		}
+		a.favorite = favorite != 0
+		a.hidden = hidden != 0
+		a.trashed = trashed != 0
+		a.edited = adjusted != 0
+		assets = append(assets, a)
+	}
+	return assets, rows.Err()
+}
+
+// readKeywords reads the keywords by asset attributes
+func (s *schema) readKeywords(ctx context.Context, db *sql.DB) (map[int64][]string, error) {
+	keywords := map[int64][]string{}
+	if s.keywordsJoin == "" {
+		return keywords, nil
+	}
+	rows, err := db.QueryContext(ctx, `SELECT j.`+s.keywordsAttr+`, k.ZTITLE FROM `+s.keywordsJoin+` j
+		JOIN ZKEYWORD k ON k.Z_PK = j.`+s.keywordsKey+`
+		WHERE k.ZTITLE IS NOT NULL
+		ORDER BY k.ZTITLE`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pk int64
+		var title string
+		err = rows.Scan(&pk, &title)
+		if err != nil {
+			return nil, err
+		}
+		keywords[pk] = append(keywords[pk], title)
+	}
+	return keywords, rows.Err()
+}
+
+// readAlbums reads the user's albums by asset. The album's path gives its folders.
+func (s *schema) readAlbums(ctx context.Context, db *sql.DB) (map[int64][]browser.LocalAlbum, error) {
+	albums := map[int64][]browser.LocalAlbum{}
+	if s.albumsJoin == "" {
+		return albums, nil
+	}
+
+	// All albums and folders, to build the albums' path
+	type genericAlbum struct {
+		title  string
+		kind   int
+		parent int64
+	}
+	all := map[int64]genericAlbum{}
+	rows, err := db.QueryContext(ctx, `SELECT Z_PK, COALESCE(ZTITLE, ''), COALESCE(ZKIND, 0), COALESCE(ZPARENTFOLDER, 0)
+		FROM ZGENERICALBUM WHERE COALESCE(ZTRASHEDSTATE, 0) = 0`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var pk int64
+		var g genericAlbum
+		err = rows.Scan(&pk, &g.title, &g.kind, &g.parent)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		all[pk] = g
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	albumPath := func(pk int64) string {
+		var p []string
+		for seen := 0; pk != 0 && seen < 100; seen++ {
+			g, ok := all[pk]
+			if !ok {
+				break
+			}
+			if g.title != "" && (g.kind == albumKindUser || g.kind == albumKindFolder) {
+				p = append([]string{g.title}, p...)
+			}
+			pk = g.parent
+		}
+		return path.Join(p...)
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT `+s.albumsAlbum+`, `+s.albumsAsset+` FROM `+s.albumsJoin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var albumPK, assetPK int64
+		err = rows.Scan(&albumPK, &assetPK)
+		if err != nil {
+			return nil, err
+		}
+		g, ok := all[albumPK]
+		if !ok || g.kind != albumKindUser || g.title == "" {
+			continue
+		}
+		albums[assetPK] = append(albums[assetPK], browser.LocalAlbum{Title: g.title, Path: albumPath(albumPK)})
+	}
+	return albums, rows.Err()
+}
@@ -8,3 +8,12 @@ type Browser interface {
 	Prepare(cxt context.Context) error
 	Browse(cxt context.Context) chan *LocalAssetFile
 }
+
+// EditedVersions tells which versions are kept when a photo has been edited
+type EditedVersions int
+
+const (
+	KeepAllVersions     EditedVersions = iota // the original and the edited versions
+	KeepEditedVersion                         // only the edited version
+	KeepOriginalVersion                       // only the original
+)
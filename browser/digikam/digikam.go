@@ -0,0 +1,355 @@
+// Package digikam reads the digiKam databases (digikam4.db files).
+package digikam
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/browser/files"
+	"github.com/simulot/immich-go/helpers/sqlitedb"
+)
+
+/*
+	The digiKam database references the files of the collections:
+	- AlbumRoots: the collections, identified by their volume and their path on the volume
+	- Albums: the folders of the collections, with their path relative to the collection
+	- Images: the files, with their status (1: visible, 3: in the trash, 4: removed from the disk)
+	- ImageInformation: the ratings
+	- ImageComments: the captions (type 1) and the titles (type 3), by language
+	- ImagePositions: the GPS coordinates
+	- Tags / ImageTags: the tags, the people, and the internal tags like the pick labels
+	- TagProperties: the kind of tags, like "person"
+	- ImageTagProperties: the face regions
+
+	The database is copied before being read. It is never modified.
+*/
+
+const (
+	statusTrashed  = 3
+	statusObsolete = 4
+
+	commentCaption = 1
+	commentTitle   = 3
+
+	internalTags  = "_Digikam_Internal_Tags_"
+	pickRejected  = "Pick Label Rejected"
+	pickAccepted  = "Pick Label Accepted"
+	personProp    = "person"
+	faceRegion    = "tagRegion"
+	internalProp  = "internalTag"
+	unknownPerson = "unknownPerson"
+)
+
+// ReadDatabase reads the database file and finds its collections on this computer.
+// The folders of the collections are the albums.
+func ReadDatabase(ctx context.Context, name string) ([]files.CatalogFolder, error) {
+	db, err := sqlitedb.OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	roots, folders, err := readAlbumRoots(ctx, db.DB, name)
+	if err != nil {
+		return nil, err
+	}
+	images, err := readImages(ctx, db.DB, roots)
+	if err != nil {
+		return nil, err
+	}
+	err = readComments(ctx, db.DB, images)
+	if err != nil {
+		return nil, err
+	}
+	err = readPositions(ctx, db.DB, images)
+	if err != nil {
+		return nil, err
+	}
+	err = readTags(ctx, db.DB, images)
+	if err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+// readAlbumRoots reads the collections. They are found with the path given by their volume identifier,
+// or with their path on the volume. A single collection is also searched in the folder of the database,
+// where digiKam puts it by default.
+func readAlbumRoots(ctx context.Context, db *sql.DB, database string) (map[int64]*files.CatalogFolder, []files.CatalogFolder, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, COALESCE(identifier, ''), COALESCE(specificPath, '') FROM AlbumRoots ORDER BY id`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a digiKam database: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	var locations [][]string
+	for rows.Next() {
+		var id int64
+		var identifier, specific string
+		err = rows.Scan(&id, &identifier, &specific)
+		if err != nil {
+			return nil, nil, err
+		}
+		var l []string
+		if _, q, ok := strings.Cut(identifier, "?"); ok {
+			if v, err := url.ParseQuery(q); err == nil {
+				for _, k := range []string{"path", "mountpath"} {
+					if p := v.Get(k); p != "" {
+						l = append(l, filepath.Join(filepath.FromSlash(p), filepath.FromSlash(specific)))
+					}
+				}
+			}
+		}
+		if len(l) == 0 {
+			// the path on a volume identified by its uuid, mounted at the root
+			l = append(l, filepath.FromSlash(specific))
+		}
+		ids = append(ids, id)
+		locations = append(locations, l)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(locations) == 1 {
+		locations[0] = append(locations[0], filepath.Dir(database))
+	}
+
+	roots := map[int64]*files.CatalogFolder{}
+	var folders []files.CatalogFolder
+	for i, id := range ids {
+		f := files.NewCatalogFolder(locations[i][0], locations[i]...)
+		roots[id] = f
+		folders = append(folders, *f)
+	}
+	return roots, folders, nil
+}
+
+// readImages reads the files of the collections. The files in the trash are trashed.
+func readImages(ctx context.Context, db *sql.DB, roots map[int64]*files.CatalogFolder) (map[int64]*files.CatalogEntry, error) {
+	rows, err := db.QueryContext(ctx, `SELECT i.id, i.name, COALESCE(i.status, 1), a.albumRoot, COALESCE(a.relativePath, '/'), COALESCE(a.caption, ''),
+		COALESCE(ii.rating, -1)
+		FROM Images i
+		JOIN Albums a ON a.id = i.album
+		LEFT JOIN ImageInformation ii ON ii.imageid = i.id
+		ORDER BY i.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := map[int64]*files.CatalogEntry{}
+	for rows.Next() {
+		var id, status, rootID, rating int64
+		var name, dir, caption string
+		err = rows.Scan(&id, &name, &status, &rootID, &dir, &caption, &rating)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := roots[rootID]
+		if !ok || status == statusObsolete {
+			continue
+		}
+		dir = strings.Trim(dir, "/")
+		e := &files.CatalogEntry{
+			Trashed: status == statusTrashed,
+			Rating:  max(int(rating), 0),
+		}
+		if dir != "" {
+			e.Albums = []browser.LocalAlbum{{Title: path.Base(dir), Path: dir, Description: caption}}
+		}
+		images[id] = e
+		r.Entries[strings.ToLower(path.Join(dir, name))] = e
+	}
+	return images, rows.Err()
+}
+
+// readComments reads the captions and the titles, the default language first
+func readComments(ctx context.Context, db *sql.DB, images map[int64]*files.CatalogEntry) error {
+	rows, err := db.QueryContext(ctx, `SELECT imageid, type, COALESCE(comment, '') FROM ImageComments
+		WHERE type IN (?, ?) AND COALESCE(comment, '') != ''
+		ORDER BY imageid, COALESCE(language, '') = 'x-default' DESC, id`, commentCaption, commentTitle)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, kind int64
+		var comment string
+		err = rows.Scan(&id, &kind, &comment)
+		if err != nil {
+			return err
+		}
+		e, ok := images[id]
+		if !ok {
+			continue
+		}
+		switch {
+		case kind == commentCaption && e.Description == "":
+			e.Description = comment
+		case kind == commentTitle && e.Title == "":
+			e.Title = comment
+		}
+	}
+	return rows.Err()
+}
+
+// readPositions reads the GPS coordinates
+func readPositions(ctx context.Context, db *sql.DB, images map[int64]*files.CatalogEntry) error {
+	rows, err := db.QueryContext(ctx, `SELECT imageid, latitudeNumber, longitudeNumber FROM ImagePositions
+		WHERE latitudeNumber IS NOT NULL AND longitudeNumber IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var lat, lon float64
+		err = rows.Scan(&id, &lat, &lon)
+		if err != nil {
+			return err
+		}
+		if e, ok := images[id]; ok {
+			e.Latitude, e.Longitude = lat, lon
+		}
+	}
+	return rows.Err()
+}
+
+// readTags reads the tags of the images. The tags of the people are given as people, with the confirmed
+// face regions. The accepted pick label makes a favorite, the rejected one a trashed file.
+// The other internal tags are ignored.
+func readTags(ctx context.Context, db *sql.DB, images map[int64]*files.CatalogEntry) error {
+	type tag struct {
+		name     string
+		parent   int64
+		person   bool
+		internal bool
+	}
+	tags := map[int64]*tag{}
+	rows, err := db.QueryContext(ctx, `SELECT id, COALESCE(pid, 0), COALESCE(name, '') FROM Tags`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int64
+		t := &tag{}
+		err = rows.Scan(&id, &t.parent, &t.name)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		tags[id] = t
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT tagid, property FROM TagProperties WHERE property IN (?, ?, ?)`, personProp, internalProp, unknownPerson)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int64
+		var property string
+		err = rows.Scan(&id, &property)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if t, ok := tags[id]; ok {
+			switch property {
+			case personProp:
+				t.person = true
+			default:
+				t.internal = true
+			}
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, t := range tags {
+		for p, seen := t, 0; p != nil && seen < 100; p, seen = tags[p.parent], seen+1 {
+			if p.name == internalTags {
+				t.internal = true
+				break
+			}
+		}
+	}
+
+	// The person tags applied to the image, and the confirmed face regions
+	rows, err = db.QueryContext(ctx, `SELECT imageid, tagid, '', 0, 0 FROM ImageTags
+		UNION SELECT p.imageid, p.tagid, COALESCE(p.value, ''), COALESCE(ii.width, 0), COALESCE(ii.height, 0) FROM ImageTagProperties p
+		LEFT JOIN ImageInformation ii ON ii.imageid = p.imageid
+		WHERE p.property = ?
+		ORDER BY 1, 2, 3`, faceRegion)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var imageID, tagID, width, height int64
+		var region string
+		err = rows.Scan(&imageID, &tagID, &region, &width, &height)
+		if err != nil {
+			return err
+		}
+		e, ok := images[imageID]
+		t, tok := tags[tagID]
+		if !ok || !tok || t.name == "" {
+			continue
+		}
+		switch {
+		case t.internal:
+			switch t.name {
+			case pickAccepted:
+				e.Favorite = true
+			case pickRejected:
+				e.Trashed = true
+			}
+		case t.person:
+			e.People = browser.AddPerson(e.People, browser.Person{Name: t.name, Region: readRegion(region, width, height)})
+		default:
+			if !slices.Contains(e.Keywords, t.name) {
+				e.Keywords = append(e.Keywords, t.name)
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// readRegion reads a face region given in pixels of the image: <rect x="1" y="2" width="3" height="4"/>.
+// It returns nil when the region can't be read.
+func readRegion(region string, width, height int64) *browser.FaceRegion {
+	if region == "" || width <= 0 || height <= 0 {
+		return nil
+	}
+	var rect struct {
+		X      float64 `xml:"x,attr"`
+		Y      float64 `xml:"y,attr"`
+		Width  float64 `xml:"width,attr"`
+		Height float64 `xml:"height,attr"`
+	}
+	err := xml.Unmarshal([]byte(region), &rect)
+	if err != nil || rect.X < 0 || rect.Y < 0 || rect.Width <= 0 || rect.Height <= 0 ||
+		rect.X+rect.Width > float64(width) || rect.Y+rect.Height > float64(height) {
+		return nil
+	}
+	return &browser.FaceRegion{
+		X:      rect.X / float64(width),
+		Y:      rect.Y / float64(height),
+		Width:  rect.Width / float64(width),
+		Height: rect.Height / float64(height),
+	}
+}
@@ -0,0 +1,170 @@
+package digikam
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/browser/files"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+// makeDatabase makes a database with the tables and columns read by immich-go.
+func makeDatabase(t *testing.T) string {
+	dir := filepath.Join(t.TempDir(), "Pictures")
+	for _, f := range []string{
+		"2023/Paris/IMG_0001.jpg",
+		"2023/Paris/IMG_0002.jpg",
+		"2023/IMG_0003.jpg",
+		"2023/IMG_0004.jpg",
+	} {
+		name := filepath.Join(dir, f)
+		err := os.MkdirAll(filepath.Dir(name), 0o700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(name, []byte(f), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	name := filepath.Join(filepath.Dir(dir), "digikam4.db")
+	db, err := sql.Open("sqlite", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, q := range []string{
+		`CREATE TABLE AlbumRoots (id INTEGER PRIMARY KEY, label TEXT, status INTEGER NOT NULL, type INTEGER NOT NULL, identifier TEXT, specificPath TEXT)`,
+		`CREATE TABLE Albums (id INTEGER PRIMARY KEY, albumRoot INTEGER NOT NULL, relativePath TEXT NOT NULL, date DATE, caption TEXT, collection TEXT, icon INTEGER)`,
+		`CREATE TABLE Images (id INTEGER PRIMARY KEY, album INTEGER, name TEXT NOT NULL, status INTEGER NOT NULL, category INTEGER NOT NULL, modificationDate DATETIME, fileSize INTEGER, uniqueHash TEXT, manualOrder INTEGER)`,
+		`CREATE TABLE ImageInformation (imageid INTEGER PRIMARY KEY, rating INTEGER, creationDate DATETIME, digitizationDate DATETIME, orientation INTEGER, width INTEGER, height INTEGER, format TEXT, colorDepth INTEGER, colorModel INTEGER)`,
+		`CREATE TABLE ImageComments (id INTEGER PRIMARY KEY, imageid INTEGER, type INTEGER, language TEXT, author TEXT, date DATETIME, comment TEXT)`,
+		`CREATE TABLE ImagePositions (imageid INTEGER PRIMARY KEY, latitude TEXT, latitudeNumber REAL, longitude TEXT, longitudeNumber REAL, altitude REAL)`,
+		`CREATE TABLE Tags (id INTEGER PRIMARY KEY, pid INTEGER, name TEXT NOT NULL, icon INTEGER, iconkde TEXT)`,
+		`CREATE TABLE TagProperties (tagid INTEGER, property TEXT, value TEXT)`,
+		`CREATE TABLE ImageTags (imageid INTEGER NOT NULL, tagid INTEGER NOT NULL)`,
+		`CREATE TABLE ImageTagProperties (imageid INTEGER, tagid INTEGER, property TEXT, value TEXT)`,
+
+		`INSERT INTO AlbumRoots VALUES (1, 'Pictures', 0, 2, 'volumeid:?path=` + url.QueryEscape(filepath.ToSlash(dir)) + `', '/')`,
+		`INSERT INTO AlbumRoots VALUES (2, 'Scans', 0, 1, 'volumeid:?uuid=0000-1111', '/home/someone/Scans')`,
+		`INSERT INTO Albums VALUES (1, 1, '/', NULL, NULL, NULL, NULL)`,
+		`INSERT INTO Albums VALUES (2, 1, '/2023', NULL, NULL, NULL, NULL)`,
+		`INSERT INTO Albums VALUES (3, 1, '/2023/Paris', NULL, 'A week in Paris', NULL, NULL)`,
+		`INSERT INTO Albums VALUES (4, 2, '/', NULL, NULL, NULL, NULL)`,
+		`INSERT INTO Images VALUES (1, 3, 'IMG_0001.jpg', 1, 1, NULL, 1, 'h1', NULL)`,
+		`INSERT INTO Images VALUES (2, 3, 'IMG_0002.jpg', 3, 1, NULL, 1, 'h2', NULL)`,
+		`INSERT INTO Images VALUES (3, 2, 'IMG_0003.jpg', 1, 1, NULL, 1, 'h3', NULL)`,
+		`INSERT INTO Images VALUES (5, 2, 'IMG_0005.jpg', 4, 1, NULL, 1, 'h5', NULL)`,
+		`INSERT INTO Images VALUES (6, 4, 'SCAN_0001.tif', 1, 1, NULL, 1, 'h6', NULL)`,
+		`INSERT INTO ImageInformation VALUES (1, 5, NULL, NULL, 1, 10, 10, 'JPG', 8, 1)`,
+		`INSERT INTO ImageInformation VALUES (3, -1, NULL, NULL, 1, 10, 10, 'JPG', 8, 1)`,
+		`INSERT INTO ImageComments VALUES (1, 1, 1, 'fr-FR', NULL, NULL, 'La tour Eiffel')`,
+		`INSERT INTO ImageComments VALUES (2, 1, 1, 'x-default', NULL, NULL, 'The Eiffel tower')`,
+		`INSERT INTO ImageComments VALUES (3, 1, 3, 'x-default', NULL, NULL, 'Eiffel')`,
+		`INSERT INTO ImagePositions VALUES (1, NULL, 48.8584, NULL, 2.2945, NULL)`,
+		`INSERT INTO Tags VALUES (1, 0, '_Digikam_Internal_Tags_', NULL, NULL)`,
+		`INSERT INTO Tags VALUES (2, 1, 'Pick Label Accepted', NULL, NULL)`,
+		`INSERT INTO Tags VALUES (3, 1, 'Pick Label Rejected', NULL, NULL)`,
+		`INSERT INTO Tags VALUES (4, 0, 'People', NULL, NULL)`,
+		`INSERT INTO Tags VALUES (5, 4, 'Alice', NULL, NULL)`,
+		`INSERT INTO Tags VALUES (6, 4, 'Bob', NULL, NULL)`,
+		`INSERT INTO Tags VALUES (7, 4, 'Unknown', NULL, NULL)`,
+		`INSERT INTO Tags VALUES (8, 0, 'Travel', NULL, NULL)`,
+		`INSERT INTO Tags VALUES (9, 8, 'France', NULL, NULL)`,
+		`INSERT INTO TagProperties VALUES (4, 'person', 'People')`,
+		`INSERT INTO TagProperties VALUES (5, 'person', 'Alice')`,
+		`INSERT INTO TagProperties VALUES (6, 'person', 'Bob')`,
+		`INSERT INTO TagProperties VALUES (7, 'unknownPerson', NULL)`,
+		`INSERT INTO ImageTags VALUES (1, 2)`,
+		`INSERT INTO ImageTags VALUES (1, 5)`,
+		`INSERT INTO ImageTags VALUES (1, 8)`,
+		`INSERT INTO ImageTags VALUES (1, 9)`,
+		`INSERT INTO ImageTags VALUES (3, 3)`,
+		`INSERT INTO ImageTagProperties VALUES (1, 6, 'tagRegion', '<rect x="1" y="2" width="3" height="4"/>')`,
+		`INSERT INTO ImageTagProperties VALUES (1, 7, 'autodetectedFace', '<rect x="5" y="6" width="3" height="4"/>')`,
+	} {
+		_, err = db.Exec(q)
+		if err != nil {
+			t.Fatalf("%s: %s", q, err)
+		}
+	}
+	return name
+}
+
+func TestDatabase(t *testing.T) {
+	ctx := context.Background()
+	folders, err := ReadDatabase(ctx, makeDatabase(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(folders) != 2 || folders[0].FSys == nil || folders[1].FSys != nil {
+		t.Fatalf("unexpected folders: %+v", folders)
+	}
+
+	jnl := fileevent.NewRecorder(nil, false)
+	b, err := files.NewCatalogBrowser(ctx, jnl, immich.DefaultSupportedMedia, "digiKam", folders...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Prepare(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []*browser.LocalAssetFile
+	for a := range b.Browse(ctx) {
+		got = append(got, a)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].FileName < got[j].FileName })
+
+	var names []string
+	for _, a := range got {
+		names = append(names, a.FileName)
+	}
+	if want := []string{"2023/IMG_0003.jpg", "2023/Paris/IMG_0001.jpg", "2023/Paris/IMG_0002.jpg"}; !reflect.DeepEqual(want, names) {
+		t.Fatalf("want %v, got %v", want, names)
+	}
+
+	rejected, paris, trashed := got[0], got[1], got[2]
+	if !rejected.Trashed || rejected.Favorite || rejected.Metadata.Rating != 0 || len(rejected.Albums) != 1 || rejected.Albums[0].Path != "2023" {
+		t.Errorf("unexpected rejected asset: %+v", rejected)
+	}
+	md := paris.Metadata
+	if !paris.Favorite || paris.Trashed || md.Rating != 5 || md.Title != "Eiffel" || md.Description != "The Eiffel tower" ||
+		md.Latitude != 48.8584 || md.Longitude != 2.2945 {
+		t.Errorf("unexpected asset: %+v", paris)
+	}
+	if want := []string{"Travel", "France"}; !reflect.DeepEqual(want, md.Keywords) {
+		t.Errorf("want keywords %v, got %v", want, md.Keywords)
+	}
+	if want := []browser.Person{{Name: "Alice"}, {Name: "Bob", Region: &browser.FaceRegion{X: 0.1, Y: 0.2, Width: 0.3, Height: 0.4}}}; !reflect.DeepEqual(want, paris.People) {
+		t.Errorf("want people %v, got %v", want, paris.People)
+	}
+	if want := []browser.LocalAlbum{{Title: "Paris", Path: "2023/Paris", Description: "A week in Paris"}}; !reflect.DeepEqual(want, paris.Albums) {
+		t.Errorf("want albums %v, got %v", want, paris.Albums)
+	}
+	if !trashed.Trashed {
+		t.Errorf("the asset in digiKam's trash must be trashed")
+	}
+
+	counts := jnl.GetCounts()
+	for code, v := range map[fileevent.Code]int64{
+		fileevent.DiscoveredImage:     4,
+		fileevent.DiscoveredDiscarded: 1, // IMG_0004.jpg isn't in the database
+		fileevent.DiscoveredTrashed:   2,
+		fileevent.Error:               1, // the missing collection
+	} {
+		if counts[code] != v {
+			t.Errorf("expecting %d %q events, got %d", v, code, counts[code])
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package files
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/helpers/namematcher"
+	"github.com/simulot/immich-go/immich"
+)
+
+/*
+	The photo managers (Lightroom, digiKam, Shotwell...) keep the attributes of the files in a database.
+	The CatalogBrowser browses the folders of the database with a LocalAssetBrowser, keeps the files known
+	by the database, and gives them the database's attributes.
+*/
+
+// CatalogEntry gives the attributes of a file found in the database of a photo manager
+type CatalogEntry struct {
+	Favorite    bool
+	Trashed     bool
+	Archived    bool
+	Rating      int
+	Title       string
+	Description string
+	Keywords    []string
+	People      []browser.Person
+	Albums      []browser.LocalAlbum
+	Latitude    float64
+	Longitude   float64
+	Notes       []string // reported once with the file
+}
+
+// CatalogFolder is a folder of the database
+type CatalogFolder struct {
+	Path    string                   // the folder's path, as given by the database
+	FSys    fs.FS                    // the folder found on this computer, nil when missing
+	Entries map[string]*CatalogEntry // by lower case file name in the folder
+}
+
+// NewCatalogFolder makes a folder of the database, found at the first existing location
+func NewCatalogFolder(path string, locations ...string) *CatalogFolder {
+	f := &CatalogFolder{Path: path, Entries: map[string]*CatalogEntry{}}
+	for _, dir := range locations {
+		if dir == "" {
+			continue
+		}
+		if s, err := os.Stat(dir); err == nil && s.IsDir() {
+			f.FSys = fshelper.NewFSWithName(os.DirFS(dir), filepath.Base(dir))
+			break
+		}
+	}
+	return f
+}
+
+// CatalogBrowser gives the files of the folders of a photo manager's database
+type CatalogBrowser struct {
+	source      string // name of the photo manager
+	folders     []CatalogFolder
+	log         *fileevent.Recorder
+	sm          immich.SupportedMedia
+	bannedFiles namematcher.List
+	whenNoDate  string
+
+	browsers []*LocalAssetBrowser // by folder, nil when the folder is missing
+}
+
+func NewCatalogBrowser(ctx context.Context, l *fileevent.Recorder, sm immich.SupportedMedia, source string, folders ...CatalogFolder) (*CatalogBrowser, error) {
+	return &CatalogBrowser{
+		source:     source,
+		folders:    folders,
+		log:        l,
+		sm:         sm,
+		whenNoDate: "FILE",
+	}, nil
+}
+
+func (cb *CatalogBrowser) SetBannedFiles(banned namematcher.List) *CatalogBrowser {
+	cb.bannedFiles = banned
+	return cb
+}
+
+func (cb *CatalogBrowser) SetWhenNoDate(opt string) *CatalogBrowser {
+	cb.whenNoDate = opt
+	return cb
+}
+
+// Prepare scans the folders. The files not in the database are discarded.
+func (cb *CatalogBrowser) Prepare(ctx context.Context) error {
+	cb.browsers = make([]*LocalAssetBrowser, len(cb.folders))
+	for i, f := range cb.folders {
+		if f.FSys == nil {
+			cb.log.Record(ctx, fileevent.Error, nil, f.Path, "error", "the folder of the "+cb.source+" database isn't found")
+			continue
+		}
+		entries := f.Entries
+		la, err := NewLocalFiles(ctx, cb.log, f.FSys)
+		if err != nil {
+			return err
+		}
+		la.SetSupportedMedia(cb.sm).
+			SetWhenNoDate(cb.whenNoDate).
+			SetBannedFiles(cb.bannedFiles).
+			SetFileSelector(func(name string) bool {
+				_, ok := entries[strings.ToLower(name)]
+				return ok
+			}, "not in the "+cb.source+" database")
+		err = la.Prepare(ctx)
+		if err != nil {
+			return err
+		}
+		cb.browsers[i] = la
+	}
+	return nil
+}
+
+// Browse gives the files of the folders with the database's attributes
+func (cb *CatalogBrowser) Browse(ctx context.Context) chan *browser.LocalAssetFile {
+	fileChan := make(chan *browser.LocalAssetFile)
+
+	go func() {
+		defer close(fileChan)
+		reported := map[*CatalogEntry]bool{}
+		for i, la := range cb.browsers {
+			if la == nil {
+				continue
+			}
+			for a := range la.Browse(ctx) {
+				if e := cb.folders[i].Entries[strings.ToLower(a.FileName)]; e != nil {
+					cb.setAttributes(ctx, a, e)
+					if !reported[e] {
+						reported[e] = true
+						for _, n := range e.Notes {
+							cb.log.Record(ctx, fileevent.INFO, nil, a.FileName, "info", n)
+						}
+					}
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case fileChan <- a:
+				}
+			}
+		}
+	}()
+	return fileChan
+}
+
+// setAttributes gives the database's attributes to the asset
+func (cb *CatalogBrowser) setAttributes(ctx context.Context, a *browser.LocalAssetFile, e *CatalogEntry) {
+	a.Favorite = e.Favorite
+	if e.Trashed {
+		a.Trashed = true
+		cb.log.Record(ctx, fileevent.DiscoveredTrashed, nil, a.FileName, "source", cb.source)
+	}
+	if e.Archived {
+		a.Archived = true
+		cb.log.Record(ctx, fileevent.DiscoveredArchived, nil, a.FileName, "source", cb.source)
+	}
+	a.Metadata.Rating = e.Rating
+	a.Metadata.Title = e.Title
+	a.Metadata.Description = e.Description
+	a.Metadata.Keywords = e.Keywords
+	if e.Latitude != 0 || e.Longitude != 0 {
+		a.Metadata.Latitude = e.Latitude
+		a.Metadata.Longitude = e.Longitude
+	}
+	a.People = e.People
+	a.Albums = e.Albums
+}
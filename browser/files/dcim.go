@@ -0,0 +1,281 @@
+package files
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/immich/metadata"
+)
+
+/*
+	The DCIM mode reads the memory cards of cameras, phones, action cams and drones.
+
+	The files are taken from the DCF folders only (DCIM/100CANON, DCIM/101MSDCF...), and from the Sony's
+	video folder PRIVATE/M4ROOT/CLIP. The companion files written by the devices are paired or ignored:
+	  - .THM: thumbnails of the Canon and GoPro videos, ignored
+	  - .LRV: low resolution copies of the GoPro videos, ignored
+	  - .XML: Sony's clip metadata, ignored
+	  - .AAE: Apple's edit instructions, ignored
+	  - .SRT: DJI's flight logs, the position of the first frame is given to the video
+
+	The devices number their files. The number of the last imported file of each folder is kept by card,
+	so the next import of the card starts after it. The numbers are read from the names given by the devices:
+	  - DCF names: 4 characters and the number, like IMG_0001, DSC01234, DJI_0001
+	  - GoPro: the videos are split in chapters sharing the number: GX010123, GX020123 (HERO6 and later),
+	    GOPR0123, GP010123 (before), G0010123 (burst and time lapse photos)
+	  - DJI: DJI_20230514123456_0001_D
+	  - Sony clips: C0001
+	The files with other names are always imported.
+
+	The card is identified by the serial number of its volume. Without it, the card is identified by
+	a fingerprint of its first file. As the -delete option removes this file, the fingerprint is written
+	in the marker file .immich-go-card at the root of the card, and is read from it at the next imports.
+*/
+
+// CardMarker is the file giving the ID of a card without volume serial number
+const CardMarker = ".immich-go-card"
+
+// dcimIgnored gives the companion files to ignore, with the reason
+var dcimIgnored = map[string]string{
+	".thm": "camera thumbnail",
+	".lrv": "low resolution video",
+	".xml": "camera clip metadata",
+	".aae": "Apple edit instructions",
+}
+
+var (
+	dcfFolderRe    = regexp.MustCompile(`^[1-9][0-9]{2}[0-9A-Za-z_]{5}$`)
+	sonyClipFolder = "PRIVATE/M4ROOT/CLIP"
+)
+
+// dcimNameRes give the number of the file, and the chapter when the regexp has 2 groups.
+// The GoPro names come first: they look like DCF names.
+var dcimNameRes = []*regexp.Regexp{
+	regexp.MustCompile(`^G[HXLSP]([0-9]{2})([0-9]{4})$`), // GoPro chapters: GX010123
+	regexp.MustCompile(`^G([0-9]{3})([0-9]{4})$`),        // GoPro groups of photos: G0010123
+	regexp.MustCompile(`^DJI_[0-9]{14}_([0-9]{4})_[A-Z]+$`),
+	regexp.MustCompile(`^C([0-9]{4})$`),            // Sony clips
+	regexp.MustCompile(`^[0-9A-Z_]{4}([0-9]{4})$`), // DCF names, GOPR0123 included
+}
+
+// DCIMNumber is the number given by the device to a file.
+// The GoPro videos are split in chapters: the chapters of a video share its number.
+type DCIMNumber struct {
+	Number  int
+	Chapter int
+}
+
+// Less tells if the file comes before the other one
+func (n DCIMNumber) Less(o DCIMNumber) bool {
+	if n.Number != o.Number {
+		return n.Number < o.Number
+	}
+	return n.Chapter < o.Chapter
+}
+
+// SetDCIM enables the DCIM mode. The files numbered up to the last imported file of their folder are discarded.
+// The last numbers are given by file system, then by folder.
+func (la *LocalAssetBrowser) SetDCIM(lastImported map[fs.FS]map[string]int) *LocalAssetBrowser {
+	la.dcim = true
+	la.lastImported = lastImported
+	return la
+}
+
+// IsDCIMFolder tells if the folder is a DCF folder of a memory card, or the Sony's video folder
+func IsDCIMFolder(dir string) bool {
+	if strings.EqualFold(dir, sonyClipFolder) || strings.HasSuffix(strings.ToUpper(dir), "/"+sonyClipFolder) {
+		return true
+	}
+	if !dcfFolderRe.MatchString(path.Base(dir)) {
+		return false
+	}
+	parent := path.Dir(dir)
+	return parent == "." || strings.EqualFold(path.Base(parent), "DCIM")
+}
+
+// ParseDCIMNumber gives the number given by the device to the file.
+// It tells false when the name isn't one of the known names.
+func ParseDCIMNumber(name string) (DCIMNumber, bool) {
+	base := path.Base(name)
+	base = strings.ToUpper(strings.TrimSuffix(base, path.Ext(base)))
+	for _, re := range dcimNameRes {
+		m := re.FindStringSubmatch(base)
+		if m == nil {
+			continue
+		}
+		var n DCIMNumber
+		if len(m) == 3 {
+			n.Chapter, _ = strconv.Atoi(m[1])
+		}
+		n.Number, _ = strconv.Atoi(m[len(m)-1])
+		return n, true
+	}
+	return DCIMNumber{}, false
+}
+
+// selectDCIMCompanion handles the companion files in DCIM mode.
+// It tells if the file is a companion, and if it must be kept for pairing.
+func (la *LocalAssetBrowser) selectDCIMCompanion(ctx context.Context, fsys fs.FS, name string) (companion bool, keep bool) {
+	if name == CardMarker {
+		return true, false
+	}
+	ext := strings.ToLower(path.Ext(name))
+	if ext == ".srt" {
+		la.log.Record(ctx, fileevent.DiscoveredSidecar, fsys, name)
+		if !IsDCIMFolder(path.Dir(name)) {
+			la.log.Record(ctx, fileevent.DiscoveredDiscarded, fsys, name, "reason", "not in a DCIM folder")
+			return true, false
+		}
+		return true, true
+	}
+	if reason, ok := dcimIgnored[ext]; ok {
+		la.log.Record(ctx, fileevent.DiscoveredDiscarded, fsys, name, "reason", reason)
+		return true, false
+	}
+	return false, false
+}
+
+// selectDCIMFile tells if the image or the video is in a DCIM folder, and not yet imported
+func (la *LocalAssetBrowser) selectDCIMFile(ctx context.Context, fsys fs.FS, name string) bool {
+	dir := path.Dir(name)
+	if !IsDCIMFolder(dir) {
+		la.log.Record(ctx, fileevent.DiscoveredDiscarded, fsys, name, "reason", "not in a DCIM folder")
+		return false
+	}
+	if n, ok := ParseDCIMNumber(name); ok {
+		if last, ok := la.lastImported[fsys][dir]; ok && n.Number <= last {
+			la.log.Record(ctx, fileevent.DiscoveredDiscarded, fsys, name, "reason", "already imported from this card")
+			return false
+		}
+	}
+	return true
+}
+
+// linkSRT gives the DJI flight logs to the videos having the same base name
+func linkSRT(links map[string]fileLinks, srts []string) {
+	for _, srt := range srts {
+		base := strings.TrimSuffix(srt, path.Ext(srt))
+		for f, l := range links {
+			if l.image == "" && l.video != "" && strings.TrimSuffix(l.video, path.Ext(l.video)) == base {
+				l.srt = srt
+				links[f] = l
+				break
+			}
+		}
+	}
+}
+
+// readSRT gives the position of the flight log to the video, when it hasn't one
+func (la *LocalAssetBrowser) readSRT(ctx context.Context, fsys fs.FS, a *browser.LocalAssetFile, srt string) {
+	f, err := fsys.Open(srt)
+	if err != nil {
+		la.log.Record(ctx, fileevent.Error, fsys, srt, "error", err.Error())
+		return
+	}
+	defer f.Close()
+	m, err := metadata.GetFromSRT(f)
+	if err != nil {
+		la.log.Record(ctx, fileevent.Error, fsys, srt, "error", err.Error())
+		return
+	}
+	if m.Latitude == 0 && m.Longitude == 0 {
+		la.log.Record(ctx, fileevent.AnalysisAssociatedMetadata, fsys, srt, "main", a.FileName, "info", "no GPS position")
+		return
+	}
+	if a.Metadata.Latitude == 0 && a.Metadata.Longitude == 0 {
+		a.Metadata.Latitude, a.Metadata.Longitude, a.Metadata.Altitude = m.Latitude, m.Longitude, m.Altitude
+	}
+	la.log.Record(ctx, fileevent.AnalysisAssociatedMetadata, fsys, srt, "main", a.FileName)
+}
+
+// sortDCIMFiles sorts the files of a folder in the order of their numbers, then the chapters.
+// The files without number come last.
+func sortDCIMFiles(files []string) {
+	sort.SliceStable(files, func(i, j int) bool {
+		ni, oki := ParseDCIMNumber(files[i])
+		nj, okj := ParseDCIMNumber(files[j])
+		switch {
+		case oki != okj:
+			return oki
+		case oki && ni != nj:
+			return ni.Less(nj)
+		}
+		return files[i] < files[j]
+	})
+}
+
+// CardID identifies the memory card: the serial number of the volume when the system gives it,
+// the ID of the card's marker file, otherwise a fingerprint of the first file of the DCIM folders.
+func CardID(fsys fs.FS) (string, error) {
+	id, _, err := cardID(fsys)
+	return id, err
+}
+
+// MarkCard identifies the memory card like CardID, and writes the fingerprint in the card's marker file
+// to keep the ID when the first file is deleted
+func MarkCard(fsys fs.FS) (string, error) {
+	id, lasting, err := cardID(fsys)
+	if err != nil || lasting {
+		return id, err
+	}
+	fp, ok := fsys.(fshelper.FullPathFS)
+	if !ok {
+		return "", errors.New("the card has no volume serial number, and the marker file can't be written")
+	}
+	err = os.WriteFile(fp.FullPath(CardMarker), []byte(id+"\n"), 0o644)
+	if err != nil {
+		return "", fmt.Errorf("the card has no volume serial number, and the marker file can't be written: %w", err)
+	}
+	return id, nil
+}
+
+// cardID gives the ID of the card, and tells if the ID lasts when the files are deleted
+func cardID(fsys fs.FS) (string, bool, error) {
+	if fp, ok := fsys.(fshelper.FullPathFS); ok {
+		if serial := fshelper.VolumeSerial(fp.FullPath(".")); serial != "" {
+			return serial, true, nil
+		}
+	}
+	if b, err := fs.ReadFile(fsys, CardMarker); err == nil {
+		if id := strings.TrimSpace(string(b)); id != "" {
+			return id, true, nil
+		}
+	}
+	first := ""
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !IsDCIMFolder(path.Dir(name)) {
+			return nil
+		}
+		// WalkDir gives the files in lexical order
+		first = name
+		return fs.SkipAll
+	})
+	if err != nil {
+		return "", false, err
+	}
+	if first == "" {
+		return "", false, fmt.Errorf("no DCIM folder found")
+	}
+	info, err := fs.Stat(fsys, first)
+	if err != nil {
+		return "", false, err
+	}
+	h := sha1.Sum([]byte(fmt.Sprintf("%s:%d:%d", first, info.Size(), info.ModTime().Unix())))
+	return "dcim-" + hex.EncodeToString(h[:6]), false, nil
+}
@@ -0,0 +1,221 @@
+package files
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/immich"
+)
+
+func TestIsDCIMFolder(t *testing.T) {
+	for dir, want := range map[string]bool{
+		"DCIM/100CANON":             true,
+		"media/card/DCIM/101MSDCF":  true,
+		"dcim/100GOPRO":             true,
+		"100APPLE":                  true, // the DCIM folder is given
+		"DCIM/CANONMSC":             false,
+		"DCIM/099CANON":             false,
+		"Photos/100CANON":           false,
+		"PRIVATE/M4ROOT/CLIP":       true,
+		"card/PRIVATE/M4ROOT/CLIP":  true,
+		"PRIVATE/M4ROOT/THMBNL":     false,
+		"DCIM/100CANON/Sub":         false,
+		"DCIM/100CANON/100CANON/xx": false,
+	} {
+		if got := IsDCIMFolder(dir); got != want {
+			t.Errorf("IsDCIMFolder(%q): want %v, got %v", dir, want, got)
+		}
+	}
+}
+
+func TestParseDCIMNumber(t *testing.T) {
+	for name, want := range map[string]DCIMNumber{
+		"DCIM/100CANON/IMG_0001.JPG":                  {Number: 1},
+		"DCIM/100MSDCF/DSC01234.ARW":                  {Number: 1234},
+		"DCIM/100CANON/mvi_0100.mp4":                  {Number: 100},
+		"DCIM/100GOPRO/GX010123.MP4":                  {Number: 123, Chapter: 1},
+		"DCIM/100GOPRO/GX020123.MP4":                  {Number: 123, Chapter: 2},
+		"DCIM/100GOPRO/GH010124.MP4":                  {Number: 124, Chapter: 1},
+		"DCIM/100GOPRO/GOPR0125.MP4":                  {Number: 125},
+		"DCIM/100GOPRO/GP010125.MP4":                  {Number: 125, Chapter: 1},
+		"DCIM/100GOPRO/GOPR0126.JPG":                  {Number: 126},
+		"DCIM/100GOPRO/G0020127.JPG":                  {Number: 127, Chapter: 2},
+		"DCIM/100MEDIA/DJI_0001.MP4":                  {Number: 1},
+		"DCIM/100MEDIA/DJI_20230514123456_0007_D.MP4": {Number: 7},
+		"DCIM/DJI_001/DJI_20230514123456_0008_V.JPG":  {Number: 8},
+		"PRIVATE/M4ROOT/CLIP/C0001.MP4":               {Number: 1},
+	} {
+		got, ok := ParseDCIMNumber(name)
+		if !ok || got != want {
+			t.Errorf("ParseDCIMNumber(%q): want %v, got %v, %v", name, want, got, ok)
+		}
+	}
+	for _, name := range []string{
+		"DCIM/100APPLE/IMG_E0005.HEIC",
+		"DCIM/100MEDIA/PXL_20231006_063000139.jpg",
+		"DCIM/100MEDIA/DJI_20230514123456.MP4",
+		"DCIM/100GOPRO/notes.mp4",
+	} {
+		if got, ok := ParseDCIMNumber(name); ok {
+			t.Errorf("ParseDCIMNumber(%q): want no number, got %v", name, got)
+		}
+	}
+}
+
+func TestDCIM(t *testing.T) {
+	ctx := context.Background()
+	fsys := newInMemFS().
+		addFile("DCIM/100CANON/IMG_0098.JPG").
+		addFile("DCIM/100CANON/IMG_0099.JPG").
+		addFile("DCIM/100CANON/MVI_0100.MP4").
+		addFile("DCIM/100CANON/MVI_0100.THM").
+		addFile("DCIM/100CANON/IMG_0101.CR3").
+		addFile("DCIM/100GOPRO/GH010034.MP4").
+		addFile("DCIM/100GOPRO/GL010034.LRV").
+		addFile("DCIM/100GOPRO/GH010034.THM").
+		addFile("DCIM/101GOPRO/GX010123.MP4").
+		addFile("DCIM/101GOPRO/GX020123.MP4").
+		addFile("DCIM/101GOPRO/GX010124.MP4").
+		addFile("DCIM/101GOPRO/GX020124.MP4").
+		addFile("DCIM/101GOPRO/GX010125.MP4").
+		addFile("DCIM/101GOPRO/notes.mp4").
+		addFile("DCIM/100MEDIA/DJI_0001.MP4").
+		addFile("DCIM/100MEDIA/DJI_0001.SRT").
+		addFile("DCIM/100MEDIA/DJI_0002.JPG").
+		addFile("DCIM/100APPLE/IMG_0005.HEIC").
+		addFile("DCIM/100APPLE/IMG_0005.MOV").
+		addFile("DCIM/100APPLE/IMG_0005.AAE").
+		addFile("PRIVATE/M4ROOT/CLIP/C0001.MP4").
+		addFile("PRIVATE/M4ROOT/CLIP/C0001M01.XML").
+		addFile("PRIVATE/M4ROOT/THMBNL/C0001T01.JPG").
+		addFile("MISC/logo.jpg")
+	if fsys.err != nil {
+		t.Fatal(fsys.err)
+	}
+	err := fsys.WriteFile("DCIM/100MEDIA/DJI_0001.SRT", []byte(`1
+00:00:00,000 --> 00:00:00,033
+[iso: 100] [latitude: 48.858400] [longitude: 2.294500] [rel_alt: 1.200 abs_alt: 120.500]
+`), 0o777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jnl := fileevent.NewRecorder(nil, false)
+	b, err := NewLocalFiles(ctx, jnl, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetSupportedMedia(immich.DefaultSupportedMedia)
+	b.SetDCIM(map[fs.FS]map[string]int{fsys: {"DCIM/100CANON": 99, "DCIM/101GOPRO": 123}})
+	err = b.Prepare(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	var latitude float64
+	for a := range b.Browse(ctx) {
+		name := a.FileName
+		if a.LivePhoto != nil {
+			name += "+" + a.LivePhoto.FileName
+		}
+		got = append(got, name)
+		if a.FileName == "DCIM/100MEDIA/DJI_0001.MP4" {
+			latitude = a.Metadata.Latitude
+		}
+	}
+	want := []string{
+		"DCIM/100APPLE/IMG_0005.HEIC+DCIM/100APPLE/IMG_0005.MOV",
+		"DCIM/100CANON/MVI_0100.MP4",
+		"DCIM/100CANON/IMG_0101.CR3",
+		"DCIM/100GOPRO/GH010034.MP4",
+		"DCIM/100MEDIA/DJI_0001.MP4",
+		"DCIM/100MEDIA/DJI_0002.JPG",
+		"DCIM/101GOPRO/GX010124.MP4",
+		"DCIM/101GOPRO/GX020124.MP4",
+		"DCIM/101GOPRO/GX010125.MP4",
+		"DCIM/101GOPRO/notes.mp4",
+		"PRIVATE/M4ROOT/CLIP/C0001.MP4",
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v\ngot  %v", want, got)
+	}
+	if latitude != 48.8584 {
+		t.Errorf("the position of the flight log isn't given to the video")
+	}
+
+	counts := jnl.GetCounts()
+	for c, v := range map[fileevent.Code]int64{
+		fileevent.DiscoveredDiscarded:        11, // 4 already imported, 2 THM, LRV, AAE, XML, 2 outside the DCIM folders
+		fileevent.DiscoveredSidecar:          1,
+		fileevent.AnalysisAssociatedMetadata: 1,
+	} {
+		if counts[c] != v {
+			t.Errorf("expecting %d %q events, got %d", v, c, counts[c])
+		}
+	}
+}
+
+func TestCardID(t *testing.T) {
+	card := newInMemFS().
+		addFile("MISC/logo.jpg").
+		addFile("DCIM/101CANON/IMG_0201.JPG").
+		addFile("DCIM/100CANON/IMG_0101.JPG")
+	other := newInMemFS().
+		addFile("DCIM/100CANON/IMG_0102.JPG")
+	id1, err := CardID(card)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := CardID(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id1 == id2 {
+		t.Errorf("the cards have the same ID %s", id1)
+	}
+	if _, err = CardID(newInMemFS().addFile("Photos/IMG_0001.JPG")); err == nil {
+		t.Errorf("expecting an error without DCIM folder")
+	}
+}
+
+func TestMarkCard(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"DCIM/100CANON/IMG_0101.JPG", "DCIM/100CANON/IMG_0102.JPG"} {
+		name = filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(name), 0o700)
+		if err == nil {
+			err = os.WriteFile(name, []byte(name), 0o600)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	card, err := fshelper.NewGlobWalkFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := MarkCard(card)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The ID is kept when the first file is deleted
+	err = os.Remove(filepath.Join(dir, "DCIM/100CANON/IMG_0101.JPG"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id2, err := CardID(card); err != nil || id2 != id {
+		t.Errorf("the card's ID has changed: %s, %s, %v", id, id2, err)
+	}
+
+	if _, err = MarkCard(newInMemFS().addFile("DCIM/100CANON/IMG_0101.JPG")); err == nil {
+		t.Errorf("expecting an error when the card can't be marked")
+	}
+}
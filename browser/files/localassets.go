@@ -22,16 +22,22 @@ type fileLinks struct {
 	image   string
 	video   string
 	sidecar string
+	srt     string // DJI flight log of the video
 }
 
 type LocalAssetBrowser struct {
-	fsyss       []fs.FS
-	albums      map[string]string
-	catalogs    map[fs.FS]map[string][]string
-	log         *fileevent.Recorder
-	sm          immich.SupportedMedia
-	bannedFiles namematcher.List // list of file pattern to be exclude
-	whenNoDate  string
+	fsyss        []fs.FS
+	albums       map[string]string
+	catalogs     map[fs.FS]map[string][]string
+	seen         map[fs.FS]map[string]bool // all files found while browsing
+	log          *fileevent.Recorder
+	sm           immich.SupportedMedia
+	bannedFiles  namematcher.List // list of file pattern to be exclude
+	whenNoDate   string
+	selector     func(name string) bool   // when set, selects the images and videos to be processed
+	notSelected  string                   // the reason given for the files not selected
+	dcim         bool                     // read memory cards, see dcim.go
+	lastImported map[fs.FS]map[string]int // DCIM mode: number of the last imported file by folder
 }
 
 func NewLocalFiles(ctx context.Context, l *fileevent.Recorder, fsyss ...fs.FS) (*LocalAssetBrowser, error) {
@@ -39,6 +45,7 @@ func NewLocalFiles(ctx context.Context, l *fileevent.Recorder, fsyss ...fs.FS) (
 		fsyss:      fsyss,
 		albums:     map[string]string{},
 		catalogs:   map[fs.FS]map[string][]string{},
+		seen:       map[fs.FS]map[string]bool{},
 		log:        l,
 		whenNoDate: "FILE",
 		sm:         immich.DefaultSupportedMedia,
@@ -60,6 +67,14 @@ func (la *LocalAssetBrowser) SetWhenNoDate(opt string) *LocalAssetBrowser {
 	return la
 }
 
+// SetFileSelector restricts the images and videos to the ones accepted by the selector.
+// The reason is recorded for the other files.
+func (la *LocalAssetBrowser) SetFileSelector(selector func(name string) bool, reason string) *LocalAssetBrowser {
+	la.selector = selector
+	la.notSelected = reason
+	return la
+}
+
 func (la *LocalAssetBrowser) Prepare(ctx context.Context) error {
 	for _, fsys := range la.fsyss {
 		err := la.passOneFsWalk(ctx, fsys)
@@ -73,6 +88,7 @@ func (la *LocalAssetBrowser) Prepare(ctx context.Context) error {
 
 func (la *LocalAssetBrowser) passOneFsWalk(ctx context.Context, fsys fs.FS) error {
 	la.catalogs[fsys] = map[string][]string{}
+	la.seen[fsys] = map[string]bool{}
 	err := fs.WalkDir(fsys, ".",
 		func(name string, d fs.DirEntry, err error) error {
 			if err != nil {
@@ -88,179 +104,224 @@ func (la *LocalAssetBrowser) passOneFsWalk(ctx context.Context, fsys fs.FS) erro
 				// If the context has been cancelled, return immediately
 				return ctx.Err()
 			default:
-				dir, base := filepath.Split(name)
-				dir = strings.TrimSuffix(dir, "/")
-				if dir == "" {
-					dir = "."
-				}
-				ext := filepath.Ext(base)
-				mediaType := la.sm.TypeFromExt(ext)
-
-				if mediaType == immich.TypeUnknown {
-					la.log.Record(ctx, fileevent.DiscoveredUnsupported, nil, name, "reason", "unsupported file type")
+				la.seen[fsys][name] = true
+				if !la.selectFile(ctx, fsys, name) {
 					return nil
 				}
-
-				cat := la.catalogs[fsys][dir]
-
-				switch mediaType {
-				case immich.TypeImage:
-					la.log.Record(ctx, fileevent.DiscoveredImage, nil, name)
-				case immich.TypeVideo:
-					la.log.Record(ctx, fileevent.DiscoveredVideo, nil, name)
-				case immich.TypeSidecar:
-					la.log.Record(ctx, fileevent.DiscoveredSidecar, nil, name)
-				}
-
-				if la.bannedFiles.Match(name) {
-					la.log.Record(ctx, fileevent.DiscoveredDiscarded, nil, name, "reason", "banned file")
-					return nil
-				}
-				la.catalogs[fsys][dir] = append(cat, name)
+				dir := path.Dir(name)
+				la.catalogs[fsys][dir] = append(la.catalogs[fsys][dir], name)
 			}
 			return nil
 		})
 	return err
 }
 
+// selectFile records the discovery of the file, and tells if the file must be processed
+func (la *LocalAssetBrowser) selectFile(ctx context.Context, fsys fs.FS, name string) bool {
+	if la.dcim {
+		if companion, keep := la.selectDCIMCompanion(ctx, fsys, name); companion {
+			return keep
+		}
+	}
+	mediaType := la.sm.TypeFromExt(path.Ext(name))
+
+	switch mediaType {
+	case immich.TypeUnknown:
+		la.log.Record(ctx, fileevent.DiscoveredUnsupported, fsys, name, "reason", "unsupported file type")
+		return false
+	case immich.TypeImage:
+		la.log.Record(ctx, fileevent.DiscoveredImage, fsys, name)
+	case immich.TypeVideo:
+		la.log.Record(ctx, fileevent.DiscoveredVideo, fsys, name)
+	case immich.TypeSidecar:
+		la.log.Record(ctx, fileevent.DiscoveredSidecar, fsys, name)
+	}
+
+	if la.bannedFiles.Match(name) {
+		la.log.Record(ctx, fileevent.DiscoveredDiscarded, fsys, name, "reason", "banned file")
+		return false
+	}
+	if la.selector != nil && mediaType != immich.TypeSidecar && !la.selector(name) {
+		la.log.Record(ctx, fileevent.DiscoveredDiscarded, fsys, name, "reason", la.notSelected)
+		return false
+	}
+	if la.dcim && mediaType != immich.TypeSidecar {
+		return la.selectDCIMFile(ctx, fsys, name)
+	}
+	return true
+}
+
+// Folders gives the folders found by Prepare, including the ones without asset
+func (la *LocalAssetBrowser) Folders() map[fs.FS][]string {
+	folders := map[fs.FS][]string{}
+	for _, fsys := range la.fsyss {
+		dirs := gen.MapKeys(la.catalogs[fsys])
+		sort.Strings(dirs)
+		folders[fsys] = dirs
+	}
+	return folders
+}
+
 func (la *LocalAssetBrowser) Browse(ctx context.Context) chan *browser.LocalAssetFile {
 	fileChan := make(chan *browser.LocalAssetFile)
 	// Browse all given FS to collect the list of files
 	go func(ctx context.Context) {
 		defer close(fileChan)
-		var err error
-
-		errFn := func(name string, err error) {
-			if err != nil {
-				la.log.Record(ctx, fileevent.Error, nil, name, "error", err.Error())
-			}
-		}
 		for _, fsys := range la.fsyss {
 			dirs := gen.MapKeys(la.catalogs[fsys])
 			sort.Strings(dirs)
 			for _, dir := range dirs {
-				links := map[string]fileLinks{}
 				files := la.catalogs[fsys][dir]
-
 				if len(files) == 0 {
 					continue
 				}
+				err := la.sendLinkedFiles(ctx, fsys, la.linkFiles(files), fileChan)
+				if err != nil {
+					return
+				}
+			}
+		}
+	}(ctx)
 
-				// Scan images first
-				for _, file := range files {
-					ext := path.Ext(file)
-					if la.sm.TypeFromExt(ext) == immich.TypeImage {
-						linked := links[file]
-						linked.image = file
-						links[file] = linked
+	return fileChan
+}
+
+// linkFiles associates the files of a folder: images with their live photo videos and their sidecars
+func (la *LocalAssetBrowser) linkFiles(files []string) map[string]fileLinks {
+	links := map[string]fileLinks{}
+	var srts []string
+
+	// Scan images first
+	for _, file := range files {
+		ext := path.Ext(file)
+		if la.sm.TypeFromExt(ext) == immich.TypeImage {
+			linked := links[file]
+			linked.image = file
+			links[file] = linked
+		}
+	}
+
+next:
+	for _, file := range files {
+		ext := path.Ext(file)
+		t := la.sm.TypeFromExt(ext)
+		if t == immich.TypeImage {
+			continue next
+		}
+
+		if la.dcim && strings.EqualFold(ext, ".srt") {
+			srts = append(srts, file)
+			continue next
+		}
+
+		base := strings.TrimSuffix(file, ext)
+		switch t {
+		case immich.TypeSidecar:
+			if image, ok := links[base]; ok {
+				// file.ext.XMP -> file.ext
+				image.sidecar = file
+				links[base] = image
+				continue next
+			}
+			for f := range links {
+				if strings.TrimSuffix(f, path.Ext(f)) == base {
+					if image, ok := links[f]; ok {
+						// base.XMP -> base.ext
+						image.sidecar = file
+						links[f] = image
+						continue next
 					}
 				}
-
-			next:
-				for _, file := range files {
-					ext := path.Ext(file)
-					t := la.sm.TypeFromExt(ext)
-					if t == immich.TypeImage {
+			}
+		case immich.TypeVideo:
+			if image, ok := links[base]; ok {
+				// file.MP.ext -> file.ext
+				image.sidecar = file
+				links[base] = image
+				continue next
+			}
+			for f := range links {
+				if strings.TrimSuffix(f, path.Ext(f)) == base {
+					if image, ok := links[f]; ok {
+						// base.MP4 -> base.ext
+						image.video = file
+						links[f] = image
 						continue next
 					}
-
-					base := strings.TrimSuffix(file, ext)
-					switch t {
-					case immich.TypeSidecar:
-						if image, ok := links[base]; ok {
-							// file.ext.XMP -> file.ext
-							image.sidecar = file
-							links[base] = image
-							continue next
-						}
-						for f := range links {
-							if strings.TrimSuffix(f, path.Ext(f)) == base {
-								if image, ok := links[f]; ok {
-									// base.XMP -> base.ext
-									image.sidecar = file
-									links[f] = image
-									continue next
-								}
-							}
-						}
-					case immich.TypeVideo:
-						if image, ok := links[base]; ok {
-							// file.MP.ext -> file.ext
-							image.sidecar = file
-							links[base] = image
-							continue next
-						}
-						for f := range links {
-							if strings.TrimSuffix(f, path.Ext(f)) == base {
-								if image, ok := links[f]; ok {
-									// base.MP4 -> base.ext
-									image.video = file
-									links[f] = image
-									continue next
-								}
-							}
-							if strings.TrimSuffix(f, path.Ext(f)) == file {
-								if image, ok := links[f]; ok {
-									// base.MP4 -> base.ext
-									image.video = file
-									links[f] = image
-									continue next
-								}
-							}
-						}
-						// Unlinked video
-						links[file] = fileLinks{video: file}
+				}
+				if strings.TrimSuffix(f, path.Ext(f)) == file {
+					if image, ok := links[f]; ok {
+						// base.MP4 -> base.ext
+						image.video = file
+						links[f] = image
+						continue next
 					}
 				}
+			}
+			// Unlinked video
+			links[file] = fileLinks{video: file}
+		}
+	}
+	linkSRT(links, srts)
+	return links
+}
 
-				files = gen.MapKeys(links)
-				sort.Strings(files)
-				for _, file := range files {
-					var a *browser.LocalAssetFile
-					linked := links[file]
-
-					if linked.image != "" {
-						a, err = la.assetFromFile(fsys, linked.image)
-						if err != nil {
-							errFn(linked.image, err)
-							return
-						}
-						if linked.video != "" {
-							a.LivePhoto, err = la.assetFromFile(fsys, linked.video)
-							if err != nil {
-								errFn(linked.video, err)
-								return
-							}
-						}
-					} else if linked.video != "" {
-						a, err = la.assetFromFile(fsys, linked.video)
-						if err != nil {
-							errFn(linked.video, err)
-							return
-						}
-					}
+// sendLinkedFiles builds the assets from the linked files and sends them to the channel.
+// It stops at the first error, after recording it.
+func (la *LocalAssetBrowser) sendLinkedFiles(ctx context.Context, fsys fs.FS, links map[string]fileLinks, fileChan chan *browser.LocalAssetFile) error {
+	var err error
+	errFn := func(name string, err error) error {
+		la.log.Record(ctx, fileevent.Error, fsys, name, "error", err.Error())
+		return err
+	}
 
-					if a != nil && linked.sidecar != "" {
-						a.SideCar = metadata.SideCarFile{
-							FSys:     fsys,
-							FileName: linked.sidecar,
-						}
-						la.log.Record(ctx, fileevent.AnalysisAssociatedMetadata, nil, linked.sidecar, "main", a.FileName)
-					}
-					select {
-					case <-ctx.Done():
-						return
-					default:
-						if a != nil {
-							fileChan <- a
-						}
-					}
+	files := gen.MapKeys(links)
+	sort.Strings(files)
+	if la.dcim {
+		sortDCIMFiles(files)
+	}
+	for _, file := range files {
+		var a *browser.LocalAssetFile
+		linked := links[file]
+
+		if linked.image != "" {
+			a, err = la.assetFromFile(fsys, linked.image)
+			if err != nil {
+				return errFn(linked.image, err)
+			}
+			if linked.video != "" {
+				a.LivePhoto, err = la.assetFromFile(fsys, linked.video)
+				if err != nil {
+					return errFn(linked.video, err)
 				}
 			}
+		} else if linked.video != "" {
+			a, err = la.assetFromFile(fsys, linked.video)
+			if err != nil {
+				return errFn(linked.video, err)
+			}
 		}
-	}(ctx)
 
-	return fileChan
+		if a != nil && linked.sidecar != "" {
+			a.SideCar = metadata.SideCarFile{
+				FSys:     fsys,
+				FileName: linked.sidecar,
+			}
+			la.log.Record(ctx, fileevent.AnalysisAssociatedMetadata, fsys, linked.sidecar, "main", a.FileName)
+		}
+		if a != nil && linked.srt != "" {
+			la.readSRT(ctx, fsys, a, linked.srt)
+		}
+		if a == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case fileChan <- a:
+		}
+	}
+	return nil
 }
 
 var toOldDate = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
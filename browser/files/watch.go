@@ -0,0 +1,302 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/helpers/gen"
+)
+
+/*
+	The watch mode keeps an eye on the folders after the first browsing.
+
+	The system notifications (inotify) tell which folders have changed. When they are not available,
+	or when they are not wanted (network shares), the folders are scanned periodically.
+
+	A new file is sent only when it has stopped changing for the settle time, and when all new files
+	of its folder are settled. This gives a chance to the live photo videos and the sidecars to arrive
+	before their image, and to be linked with it.
+*/
+
+// WatchOptions controls the watch mode
+type WatchOptions struct {
+	Settle time.Duration // Time a file must stay unchanged before being sent
+	Poll   time.Duration // Scan the folders at this interval instead of using the system notifications when not zero
+}
+
+const defaultPollInterval = time.Minute
+
+// pendingFile is a new file not yet settled
+type pendingFile struct {
+	size    int64
+	modTime time.Time
+	since   time.Time // time of the last observed change
+}
+
+type folderWatcher struct {
+	la      *LocalAssetBrowser
+	fsys    fs.FS
+	root    string                 // path of the file system on the host
+	seen    map[string]bool        // files already handled
+	pending map[string]pendingFile // new files waiting to be settled
+	dirty   map[string]bool        // folders to be scanned at next tick
+	notify  *fsnotify.Watcher      // nil when polling
+	opts    WatchOptions
+}
+
+// Watch sends the files added into the folders after the browsing.
+// Only the file systems backed by a host folder can be watched.
+// The channel is closed when the context is cancelled.
+func (la *LocalAssetBrowser) Watch(ctx context.Context, opts WatchOptions) chan *browser.LocalAssetFile {
+	fileChan := make(chan *browser.LocalAssetFile)
+	wg := sync.WaitGroup{}
+
+	for _, fsys := range la.fsyss {
+		fp, ok := fsys.(fshelper.FullPathFS)
+		if !ok {
+			name := ""
+			if fsys, ok := fsys.(fshelper.NameFS); ok {
+				name = fsys.Name()
+			}
+			la.log.Record(ctx, fileevent.INFO, nil, name, "info", "this source can't be watched")
+			continue
+		}
+		w := &folderWatcher{
+			la:      la,
+			fsys:    fsys,
+			root:    fp.FullPath("."),
+			seen:    la.seen[fsys],
+			pending: map[string]pendingFile{},
+			dirty:   map[string]bool{},
+			opts:    opts,
+		}
+		if w.seen == nil {
+			w.seen = map[string]bool{}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(ctx, fileChan)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(fileChan)
+	}()
+	return fileChan
+}
+
+func (w *folderWatcher) run(ctx context.Context, fileChan chan *browser.LocalAssetFile) {
+	interval := w.opts.Poll
+	if interval == 0 {
+		err := w.startNotify()
+		if err != nil {
+			w.la.log.Record(ctx, fileevent.INFO, nil, w.root, "info", "system notifications not available, falling back to polling", "error", err.Error())
+			interval = defaultPollInterval
+		}
+	}
+	if w.notify != nil {
+		defer w.notify.Close()
+		// Check often the pending files, they are released after the settle time anyway
+		interval = max(w.opts.Settle/2, 100*time.Millisecond)
+	}
+
+	// Files created between the browsing and the start of the watcher
+	w.markAllDirty()
+
+	var events chan fsnotify.Event
+	var errs chan error
+	if w.notify != nil {
+		events, errs = w.notify.Events, w.notify.Errors
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			w.handleEvent(ev)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			// Events may have been lost, scan everything
+			w.la.log.Record(ctx, fileevent.INFO, nil, w.root, "info", "watch error, rescanning the folders", "error", err.Error())
+			w.markAllDirty()
+		case <-ticker.C:
+			if w.notify == nil {
+				w.markAllDirty()
+			}
+			w.scan(ctx)
+			err := w.release(ctx, fileChan)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// startNotify registers all folders to the system notifications
+func (w *folderWatcher) startNotify() error {
+	var err error
+	w.notify, err = fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	err = w.addFolders(".")
+	if err != nil {
+		w.notify.Close()
+		w.notify = nil
+	}
+	return err
+}
+
+// addFolders registers the folder and its sub folders
+func (w *folderWatcher) addFolders(dir string) error {
+	return fs.WalkDir(w.fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			w.dirty[name] = true
+			if w.notify != nil {
+				return w.notify.Add(filepath.Join(w.root, filepath.FromSlash(name)))
+			}
+		}
+		return nil
+	})
+}
+
+func (w *folderWatcher) handleEvent(ev fsnotify.Event) {
+	name, err := filepath.Rel(w.root, ev.Name)
+	if err != nil || strings.HasPrefix(name, "..") {
+		return
+	}
+	name = filepath.ToSlash(name)
+	w.dirty[path.Dir(name)] = true
+
+	if ev.Has(fsnotify.Create) {
+		if i, err := fs.Stat(w.fsys, name); err == nil && i.IsDir() {
+			// A new folder may come with its files
+			_ = w.addFolders(name)
+		}
+	}
+}
+
+func (w *folderWatcher) markAllDirty() {
+	_ = fs.WalkDir(w.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			w.dirty[name] = true
+		}
+		return nil
+	})
+}
+
+// scan the dirty folders and the folders having pending files to update the pending list
+func (w *folderWatcher) scan(ctx context.Context) {
+	for name := range w.pending {
+		w.dirty[path.Dir(name)] = true
+	}
+	now := time.Now()
+	for dir := range w.dirty {
+		delete(w.dirty, dir)
+		if ctx.Err() != nil {
+			return
+		}
+		entries, err := fs.ReadDir(w.fsys, dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			w.la.log.Record(ctx, fileevent.Error, nil, dir, "error", err.Error())
+		}
+		present := map[string]bool{}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			name := path.Join(dir, e.Name())
+			if w.seen[name] {
+				continue
+			}
+			i, err := e.Info()
+			if err != nil {
+				continue
+			}
+			present[name] = true
+			p, ok := w.pending[name]
+			if !ok || p.size != i.Size() || !p.modTime.Equal(i.ModTime()) {
+				w.pending[name] = pendingFile{size: i.Size(), modTime: i.ModTime(), since: now}
+			}
+		}
+		// Forget pending files removed from the folder
+		for name := range w.pending {
+			if path.Dir(name) == dir && !present[name] {
+				delete(w.pending, name)
+			}
+		}
+	}
+}
+
+// release sends the files of folders where all new files are settled
+func (w *folderWatcher) release(ctx context.Context, fileChan chan *browser.LocalAssetFile) error {
+	now := time.Now()
+	byDir := map[string][]string{}
+	busy := map[string]bool{}
+	for name, p := range w.pending {
+		dir := path.Dir(name)
+		if now.Sub(p.since) < w.opts.Settle {
+			busy[dir] = true
+			continue
+		}
+		byDir[dir] = append(byDir[dir], name)
+	}
+
+	dirs := gen.MapKeys(byDir)
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if busy[dir] {
+			continue
+		}
+		names := byDir[dir]
+		sort.Strings(names)
+		files := []string{}
+		for _, name := range names {
+			delete(w.pending, name)
+			w.seen[name] = true
+			if w.la.selectFile(ctx, w.fsys, name) {
+				files = append(files, name)
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+		err := w.la.sendLinkedFiles(ctx, w.fsys, w.la.linkFiles(files), fileChan)
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
+	}
+	return nil
+}
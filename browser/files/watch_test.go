@@ -0,0 +1,122 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/fshelper"
+)
+
+func TestWatch(t *testing.T) {
+	tc := []struct {
+		name string
+		opts WatchOptions
+	}{
+		{
+			name: "notifications",
+			opts: WatchOptions{Settle: 200 * time.Millisecond},
+		},
+		{
+			name: "polling",
+			opts: WatchOptions{Settle: 200 * time.Millisecond, Poll: 50 * time.Millisecond},
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile := func(name string, content string) {
+				name = filepath.Join(dir, filepath.FromSlash(name))
+				err := os.MkdirAll(filepath.Dir(name), 0o700)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.WriteFile(name, []byte(content), 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			writeFile("PXL_20231006_063000000.jpg", "already there")
+
+			fsys, err := fshelper.NewGlobWalkFS(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			b, err := NewLocalFiles(ctx, fileevent.NewRecorder(nil, false), fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = b.Prepare(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range b.Browse(ctx) {
+			}
+
+			watchChan := b.Watch(ctx, c.opts)
+
+			// Let the watcher start before adding files
+			time.Sleep(100 * time.Millisecond)
+			writeFile("PXL_20231006_063528961.jpg", "image")
+			writeFile("PXL_20231006_063528961.jpg.xmp", "sidecar")
+			writeFile("new/PXL_20231006_063851485.jpg", "image")
+			writeFile("notes.txt", "ignored")
+
+			// The live photo video arrives a bit later, it must be linked to its image
+			time.Sleep(50 * time.Millisecond)
+			writeFile("PXL_20231006_063528961.mp4", "video")
+
+			got := map[string]fileLinks{}
+			for len(got) < 2 {
+				select {
+				case a := <-watchChan:
+					l := fileLinks{image: a.FileName, sidecar: a.SideCar.FileName}
+					if a.LivePhoto != nil {
+						l.video = a.LivePhoto.FileName
+					}
+					got[a.FileName] = l
+				case <-ctx.Done():
+					t.Fatalf("timeout, got %v", got)
+				}
+			}
+			expected := map[string]fileLinks{
+				"PXL_20231006_063528961.jpg": {
+					image:   "PXL_20231006_063528961.jpg",
+					video:   "PXL_20231006_063528961.mp4",
+					sidecar: "PXL_20231006_063528961.jpg.xmp",
+				},
+				"new/PXL_20231006_063851485.jpg": {image: "new/PXL_20231006_063851485.jpg"},
+			}
+			for k, v := range expected {
+				if got[k] != v {
+					t.Errorf("file %s: expected %+v, got %+v", k, v, got[k])
+				}
+			}
+
+			// Nothing else should come
+			select {
+			case a := <-watchChan:
+				t.Errorf("unexpected file %s", a.FileName)
+			case <-time.After(3 * c.opts.Settle):
+			}
+
+			cancel()
+			names := []string{}
+			for a := range watchChan {
+				names = append(names, a.FileName)
+			}
+			sort.Strings(names)
+			if len(names) > 0 {
+				t.Errorf("unexpected files after cancellation: %v", names)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io/fs"
 	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"unicode/utf8"
@@ -14,6 +15,7 @@ import (
 	"github.com/simulot/immich-go/helpers/fshelper"
 	"github.com/simulot/immich-go/helpers/gen"
 	"github.com/simulot/immich-go/helpers/namematcher"
+	"github.com/simulot/immich-go/helpers/stacking"
 	"github.com/simulot/immich-go/immich"
 	"github.com/simulot/immich-go/immich/metadata"
 )
@@ -22,11 +24,14 @@ type Takeout struct {
 	fsyss    []fs.FS
 	catalogs map[string]directoryCatalog   // file catalogs by directory in the set of the all takeout parts
 	albums   map[string]browser.LocalAlbum // track album names by folder
+	members  map[string][]string           // contributors of the assets by folder, members of the shared albums
 	log      *fileevent.Recorder
 	sm       immich.SupportedMedia
 
 	banned            namematcher.List // Banned files
 	acceptMissingJSON bool
+	editedVersions    browser.EditedVersions // Versions kept when a photo has been edited in Google Photos
+	manifest          *Manifest              // Manifest of the previous import, if any
 }
 
 // directoryCatalog captures all files in a given directory
@@ -49,6 +54,7 @@ func NewTakeout(ctx context.Context, l *fileevent.Recorder, sm immich.SupportedM
 		fsyss:    fsyss,
 		catalogs: map[string]directoryCatalog{},
 		albums:   map[string]browser.LocalAlbum{},
+		members:  map[string][]string{},
 		log:      l,
 		sm:       sm,
 	}
@@ -66,6 +72,18 @@ func (to *Takeout) SetAcceptMissingJSON(flag bool) *Takeout {
 	return to
 }
 
+func (to *Takeout) SetEditedVersions(v browser.EditedVersions) *Takeout {
+	to.editedVersions = v
+	return to
+}
+
+// SetManifest gives the manifest of the previous import. The files it knows aren't matched again,
+// and the new matches are recorded into it.
+func (to *Takeout) SetManifest(m *Manifest) *Takeout {
+	to.manifest = m
+	return to
+}
+
 // Prepare scans all files in all walker to build the file catalog of the archive
 // metadata files content is read and kept
 
@@ -76,6 +94,7 @@ func (to *Takeout) Prepare(ctx context.Context) error {
 			return err
 		}
 	}
+	to.shareAlbums()
 	err := to.solvePuzzle(ctx)
 	return err
 }
@@ -106,24 +125,31 @@ func (to *Takeout) passOneFsWalk(ctx context.Context, w fs.FS) error {
 				dirCatalog.matchedFiles = map[string]*assetFile{}
 			}
 			if _, ok := dirCatalog.unMatchedFiles[base]; ok {
-				to.log.Record(ctx, fileevent.AnalysisLocalDuplicate, nil, name)
+				to.log.Record(ctx, fileevent.AnalysisLocalDuplicate, w, name)
 				return nil
 			}
 
 			finfo, err := d.Info()
 			if err != nil {
-				to.log.Record(ctx, fileevent.Error, nil, name, "error", err.Error())
+				to.log.Record(ctx, fileevent.Error, w, name, "error", err.Error())
 				return err
 			}
 			switch ext {
 			case ".json":
+				if base == sharedAlbumComments {
+					to.readSharedAlbumComments(ctx, w, dir, name)
+					return nil
+				}
 				md, err := fshelper.ReadJSON[GoogleMetaData](w, name)
 				if err == nil {
 					switch {
 					case md.isAsset():
 						md.foundInPaths = append(md.foundInPaths, dir)
 						dirCatalog.jsons[base] = md
-						to.log.Record(ctx, fileevent.DiscoveredSidecar, nil, name, "type", "asset metadata", "title", md.Title)
+						if c := md.Contributor; c != nil {
+							to.addMember(dir, c.ProfileName)
+						}
+						to.log.Record(ctx, fileevent.DiscoveredSidecar, w, name, "type", "asset metadata", "title", md.Title)
 					case md.isAlbum():
 						a := to.albums[dir]
 						a.Title = md.Title
@@ -134,33 +160,33 @@ func (to *Takeout) passOneFsWalk(ctx context.Context, w fs.FS) error {
 							a.Longitude = e.Longitude
 						}
 						to.albums[dir] = a
-						to.log.Record(ctx, fileevent.DiscoveredSidecar, nil, name, "type", "album metadata", "title", md.Title)
+						to.log.Record(ctx, fileevent.DiscoveredSidecar, w, name, "type", "album metadata", "title", md.Title)
 					default:
-						to.log.Record(ctx, fileevent.DiscoveredUnsupported, nil, name, "reason", "unknown JSONfile")
+						to.log.Record(ctx, fileevent.DiscoveredUnsupported, w, name, "reason", "unknown JSONfile")
 						return nil
 					}
 				} else {
-					to.log.Record(ctx, fileevent.DiscoveredUnsupported, nil, name, "reason", "unknown JSONfile")
+					to.log.Record(ctx, fileevent.DiscoveredUnsupported, w, name, "reason", "unknown JSONfile")
 					return nil
 				}
 			default:
 				t := to.sm.TypeFromExt(ext)
 				switch t {
 				case immich.TypeUnknown:
-					to.log.Record(ctx, fileevent.DiscoveredUnsupported, nil, name, "reason", "unsupported file type")
+					to.log.Record(ctx, fileevent.DiscoveredUnsupported, w, name, "reason", "unsupported file type")
 					return nil
 				case immich.TypeVideo:
-					to.log.Record(ctx, fileevent.DiscoveredVideo, nil, name)
+					to.log.Record(ctx, fileevent.DiscoveredVideo, w, name)
 					if strings.Contains(name, "Failed Videos") {
-						to.log.Record(ctx, fileevent.DiscoveredDiscarded, nil, name, "reason", "can't upload failed videos")
+						to.log.Record(ctx, fileevent.DiscoveredDiscarded, w, name, "reason", "can't upload failed videos")
 						return nil
 					}
 				case immich.TypeImage:
-					to.log.Record(ctx, fileevent.DiscoveredImage, nil, name)
+					to.log.Record(ctx, fileevent.DiscoveredImage, w, name)
 				}
 
 				if to.banned.Match(name) {
-					to.log.Record(ctx, fileevent.DiscoveredDiscarded, nil, name, "reason", "banned file")
+					to.log.Record(ctx, fileevent.DiscoveredDiscarded, w, name, "reason", "banned file")
 					return nil
 				}
 
@@ -177,6 +203,67 @@ func (to *Takeout) passOneFsWalk(ctx context.Context, w fs.FS) error {
 	return err
 }
 
+// sharedAlbumComments is the file giving the comments of a shared album
+const sharedAlbumComments = "shared_album_comments.json"
+
+// readSharedAlbumComments collects the comments of the shared album.
+// The authors of the comments are members of the album.
+func (to *Takeout) readSharedAlbumComments(ctx context.Context, w fs.FS, dir string, name string) {
+	comments, err := fshelper.ReadJSON[[]googComment](w, name)
+	if err != nil {
+		to.log.Record(ctx, fileevent.DiscoveredUnsupported, w, name, "reason", "unknown JSONfile")
+		return
+	}
+	a := to.albums[dir]
+	if a.Path == "" {
+		a.Path = filepath.Base(dir)
+	}
+	if a.Sharing == nil {
+		a.Sharing = &browser.AlbumSharing{}
+	}
+	for _, c := range *comments {
+		author := strings.TrimSpace(c.ContributorInfo.ProfileName)
+		to.addMember(dir, author)
+		if text := strings.TrimSpace(c.Text); text != "" {
+			a.Sharing.Comments = append(a.Sharing.Comments, browser.AlbumComment{
+				Author: author,
+				Text:   text,
+				Date:   c.CreationTime.Time(),
+			})
+		}
+	}
+	to.albums[dir] = a
+	to.log.Record(ctx, fileevent.DiscoveredSidecar, w, name, "type", "shared album comments", "comments", len(a.Sharing.Comments))
+}
+
+// addMember records a member of the shared album of the folder
+func (to *Takeout) addMember(dir string, name string) {
+	name = strings.TrimSpace(name)
+	if name != "" && !slices.Contains(to.members[dir], name) {
+		to.members[dir] = append(to.members[dir], name)
+	}
+}
+
+// shareAlbums gives the members of the shared albums as collaborators.
+// The members are the authors of the comments, and the contributors of the assets.
+func (to *Takeout) shareAlbums() {
+	for dir, members := range to.members {
+		a, ok := to.albums[dir]
+		if !ok {
+			continue
+		}
+		if a.Sharing == nil {
+			a.Sharing = &browser.AlbumSharing{}
+		}
+		for _, m := range members {
+			if !slices.Contains(a.Sharing.Collaborators, m) {
+				a.Sharing.Collaborators = append(a.Sharing.Collaborators, m)
+			}
+		}
+		to.albums[dir] = a
+	}
+}
+
 // solvePuzzle prepares metadata with information collected during pass one for each accepted files
 //
 // JSON files give important information about the relative photos / movies:
@@ -228,6 +315,9 @@ func (to *Takeout) solvePuzzle(ctx context.Context) error {
 		cat := to.catalogs[dir]
 		jsons := gen.MapKeys(cat.jsons)
 		sort.Strings(jsons)
+		if to.manifest != nil {
+			to.matchFromManifest(ctx, dir, cat)
+		}
 		for _, matcher := range matchers {
 			for _, json := range jsons {
 				md := cat.jsons[json]
@@ -241,6 +331,9 @@ func (to *Takeout) solvePuzzle(ctx context.Context) error {
 							i.md = md
 							cat.matchedFiles[f] = i
 							to.log.Record(ctx, fileevent.AnalysisAssociatedMetadata, cat.unMatchedFiles[f], filepath.Join(dir, f), "json", json, "size", i.length, "matcher", matcher.name)
+							if to.manifest != nil {
+								to.manifest.SetMatch(path.Join(dir, f), json)
+							}
 							delete(cat.unMatchedFiles, f)
 						}
 					}
@@ -262,6 +355,25 @@ func (to *Takeout) solvePuzzle(ctx context.Context) error {
 	return nil
 }
 
+// matchFromManifest matches the files with the JSON found by the previous import
+func (to *Takeout) matchFromManifest(ctx context.Context, dir string, cat directoryCatalog) {
+	for _, f := range gen.MapKeys(cat.unMatchedFiles) {
+		json, ok := to.manifest.Match(path.Join(dir, f))
+		if !ok {
+			continue
+		}
+		md, ok := cat.jsons[json]
+		if !ok {
+			continue
+		}
+		i := cat.unMatchedFiles[f]
+		i.md = md
+		cat.matchedFiles[f] = i
+		to.log.Record(ctx, fileevent.AnalysisAssociatedMetadata, i, filepath.Join(dir, f), "json", json, "size", i.length, "matcher", "manifest")
+		delete(cat.unMatchedFiles, f)
+	}
+}
+
 // normalMatch
 //
 //	PXL_20230922_144936660.jpg.json
@@ -483,6 +595,7 @@ func (to *Takeout) Browse(ctx context.Context) chan *browser.LocalAssetFile {
 // 2. scan vidoes, if a picture matches, this is a live photo
 func (to *Takeout) passTwo(ctx context.Context, dir string, assetChan chan *browser.LocalAssetFile) error {
 	catalog := to.catalogs[dir]
+	matchedFiles := to.selectEditedVersions(ctx, dir, catalog.matchedFiles)
 
 	linkedFiles := map[string]struct {
 		video *assetFile
@@ -490,18 +603,18 @@ func (to *Takeout) passTwo(ctx context.Context, dir string, assetChan chan *brow
 	}{}
 
 	// Scan pictures
-	for _, f := range gen.MapKeys(catalog.matchedFiles) {
+	for _, f := range gen.MapKeys(matchedFiles) {
 		ext := path.Ext(f)
 		if to.sm.TypeFromExt(ext) == immich.TypeImage {
 			linked := linkedFiles[f]
-			linked.image = catalog.matchedFiles[f]
+			linked.image = matchedFiles[f]
 			linkedFiles[f] = linked
 		}
 	}
 
 	// Scan videos
 nextVideo:
-	for _, f := range gen.MapKeys(catalog.matchedFiles) {
+	for _, f := range gen.MapKeys(matchedFiles) {
 		fExt := path.Ext(f)
 		if to.sm.TypeFromExt(fExt) == immich.TypeVideo {
 			name := strings.TrimSuffix(f, fExt)
@@ -523,13 +636,13 @@ nextVideo:
 					p = strings.TrimSuffix(p, ext)
 				}
 				if p == name {
-					linked.video = catalog.matchedFiles[f]
+					linked.video = matchedFiles[f]
 					linkedFiles[i] = linked
 					continue nextVideo
 				}
 			}
 			linked := linkedFiles[f]
-			linked.video = catalog.matchedFiles[f]
+			linked.video = matchedFiles[f]
 			linkedFiles[f] = linked
 		}
 	}
@@ -561,6 +674,7 @@ nextVideo:
 				continue
 			}
 		}
+		to.recordCategories(ctx, a)
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
@@ -571,6 +685,67 @@ nextVideo:
 	return nil
 }
 
+// recordCategories counts the trashed, archived, partner's and Locked Folder assets
+func (to *Takeout) recordCategories(ctx context.Context, a *browser.LocalAssetFile) {
+	if a.Trashed {
+		to.log.Record(ctx, fileevent.DiscoveredTrashed, a, a.FileName)
+	}
+	if a.Archived {
+		to.log.Record(ctx, fileevent.DiscoveredArchived, a, a.FileName)
+	}
+	if a.FromPartner {
+		to.log.Record(ctx, fileevent.DiscoveredPartner, a, a.FileName)
+	}
+	if a.Locked {
+		to.log.Record(ctx, fileevent.DiscoveredLocked, a, a.FileName)
+	}
+}
+
+// isLockedFolder tells if the directory is the takeout's Locked Folder
+func isLockedFolder(dir string) bool {
+	return strings.EqualFold(path.Base(dir), "Locked Folder")
+}
+
+// selectEditedVersions removes the original or the edited version when only one is kept
+func (to *Takeout) selectEditedVersions(ctx context.Context, dir string, files map[string]*assetFile) map[string]*assetFile {
+	if to.editedVersions == browser.KeepAllVersions {
+		return files
+	}
+	selected := make(map[string]*assetFile, len(files))
+	for f, a := range files {
+		selected[f] = a
+	}
+	for _, f := range gen.MapKeys(files) {
+		base, ok := stacking.EditedBase(f)
+		if !ok {
+			continue
+		}
+		// Look for the original, with the same extension preferably
+		original := ""
+		for _, o := range gen.MapKeys(files) {
+			if o != f && strings.TrimSuffix(o, path.Ext(o)) == base {
+				if original == "" || path.Ext(o) == path.Ext(f) {
+					original = o
+				}
+			}
+		}
+		if original == "" {
+			continue
+		}
+		switch to.editedVersions {
+		case browser.KeepEditedVersion:
+			if _, ok := selected[original]; ok {
+				delete(selected, original)
+				to.log.Record(ctx, fileevent.UploadNotSelected, nil, path.Join(dir, original), "reason", "original of an edited version")
+			}
+		case browser.KeepOriginalVersion:
+			delete(selected, f)
+			to.log.Record(ctx, fileevent.UploadNotSelected, nil, path.Join(dir, f), "reason", "edited version")
+		}
+	}
+	return selected
+}
+
 // makeAsset makes a localAssetFile based on the google metadata
 func (to *Takeout) makeAsset(md *GoogleMetaData, fsys fs.FS, name string) (*browser.LocalAssetFile, error) {
 	i, err := fs.Stat(fsys, name)
@@ -583,6 +758,7 @@ func (to *Takeout) makeAsset(md *GoogleMetaData, fsys fs.FS, name string) (*brow
 		FileSize: int(i.Size()),
 		Title:    path.Base(name),
 		FSys:     fsys,
+		Locked:   isLockedFolder(path.Dir(name)),
 	}
 
 	if album, ok := to.albums[path.Dir(name)]; ok {
@@ -606,7 +782,13 @@ func (to *Takeout) makeAsset(md *GoogleMetaData, fsys fs.FS, name string) (*brow
 		a.Archived = md.Archived
 		a.FromPartner = md.isPartner()
 		a.Trashed = md.Trashed
+		a.Locked = a.Locked || md.InLockedFolder
 		a.Favorite = md.Favorited
+		for _, p := range md.People {
+			if name := strings.TrimSpace(p.Name); name != "" {
+				a.People = append(a.People, browser.Person{Name: name})
+			}
+		}
 
 		// Prepare sidecar data to force Immich with Google metadata
 
@@ -19,9 +19,12 @@ type Metablock struct {
 	GeoData        googGeoData        `json:"geoData"`
 	Trashed        bool               `json:"trashed,omitempty"`
 	Archived       bool               `json:"archived,omitempty"`
-	URLPresent     googIsPresent      `json:"url,omitempty"`         // true when the file is an asset metadata
-	Favorited      bool               `json:"favorited,omitempty"`   // true when starred in GP
-	Enrichments    *googleEnrichments `json:"enrichments,omitempty"` // Album enrichments
+	InLockedFolder bool               `json:"inLockedFolder,omitempty"`  // true when the asset is in the Locked Folder
+	URLPresent     googIsPresent      `json:"url,omitempty"`             // true when the file is an asset metadata
+	Favorited      bool               `json:"favorited,omitempty"`       // true when starred in GP
+	Enrichments    *googleEnrichments `json:"enrichments,omitempty"`     // Album enrichments
+	People         []googPerson       `json:"people,omitempty"`          // People tagged in the asset
+	Contributor    *googContributor   `json:"contributorInfo,omitempty"` // Member of the shared album who added the asset
 }
 
 type GoogleMetaData struct {
@@ -92,6 +95,23 @@ func (p googIsPresent) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct{}{})
 }
 
+// googPerson is a person tagged in the asset
+type googPerson struct {
+	Name string `json:"name"`
+}
+
+// googComment is an entry of the file shared_album_comments.json
+type googComment struct {
+	Text            string          `json:"text"`
+	CreationTime    googTimeObject  `json:"creationTime"`
+	ContributorInfo googContributor `json:"contributorInfo"`
+}
+
+// googContributor is the author of a comment or of a shared asset
+type googContributor struct {
+	ProfileName string `json:"profileName"`
+}
+
 // googGeoData contains GPS coordinates
 type googGeoData struct {
 	Latitude  float64 `json:"latitude"`
@@ -364,3 +364,26 @@ func TestEnrichedAlbum(t *testing.T) {
 		})
 	}
 }
+
+func TestPeople(t *testing.T) {
+	js := `{
+		"title": "PXL_20231006_063000139.jpg",
+		"photoTakenTime": {
+		  "timestamp": "1696574400",
+		  "formatted": "6 oct. 2023, 06:40:00 UTC"
+		},
+		"people": [{
+		  "name": "Alice"
+		}, {
+		  "name": "Bob Smith"
+		}]
+	  }`
+	var md GoogleMetaData
+	err := json.NewDecoder(strings.NewReader(js)).Decode(&md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(md.People) != 2 || md.People[0].Name != "Alice" || md.People[1].Name != "Bob Smith" {
+		t.Errorf("unexpected people: %v", md.People)
+	}
+}
@@ -0,0 +1,184 @@
+package gp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/configuration"
+)
+
+/*
+	The takeout manifest records what has been imported from a takeout, to import only the changes
+	of a newer takeout.
+
+	The assets are identified by their title, their date of capture and their size. They don't change
+	from a takeout to the next one, when the files' paths and the archives' names do.
+
+	The manifest also keeps the JSON matched with each file. The files already known aren't
+	matched again.
+*/
+
+const manifestVersion = 1
+
+// ManifestAsset is the state of an asset imported from a takeout
+type ManifestAsset struct {
+	ID       string   `json:"id"`                 // Server's asset ID
+	File     string   `json:"file"`               // Path of the file in the takeout
+	Favorite bool     `json:"favorite,omitempty"` // Favorite flag as imported
+	Archived bool     `json:"archived,omitempty"` // Archived flag as imported
+	Albums   []string `json:"albums,omitempty"`   // Albums of the asset as imported
+}
+
+type Manifest struct {
+	lock    sync.Mutex
+	Version int                       `json:"version"`
+	Assets  map[string]*ManifestAsset `json:"assets"`  // assets by key
+	Matches map[string]string         `json:"matches"` // JSON file name by file path in the takeout
+
+	previous map[string]ManifestAsset // assets as read from the previous manifest
+	seen     map[string]bool          // assets recorded during this run
+}
+
+func NewManifest() *Manifest {
+	return &Manifest{
+		Version:  manifestVersion,
+		Assets:   map[string]*ManifestAsset{},
+		Matches:  map[string]string{},
+		previous: map[string]ManifestAsset{},
+		seen:     map[string]bool{},
+	}
+}
+
+// ReadManifest reads the manifest of the previous import. A missing file gives an empty manifest.
+func ReadManifest(name string) (*Manifest, error) {
+	m := NewManifest()
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, m)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the takeout manifest %s: %w", name, err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("the takeout manifest %s has an unsupported version: %d", name, m.Version)
+	}
+	if m.Assets == nil {
+		m.Assets = map[string]*ManifestAsset{}
+	}
+	if m.Matches == nil {
+		m.Matches = map[string]string{}
+	}
+	for k, a := range m.Assets {
+		m.previous[k] = *a
+	}
+	return m, nil
+}
+
+// Write saves the manifest
+func (m *Manifest) Write(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	b, err := json.MarshalIndent(m, "", " ")
+	if err != nil {
+		return err
+	}
+	err = configuration.MakeDirForFile(name)
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	err = os.WriteFile(tmp, b, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// ManifestKey identifies the asset by its title, its date of capture and its size
+func ManifestKey(a *browser.LocalAssetFile) string {
+	return fmt.Sprintf("%s,%d,%d", a.Title, a.Metadata.DateTaken.Unix(), a.FileSize)
+}
+
+// Previous returns the asset as imported by the previous run
+func (m *Manifest) Previous(key string) (ManifestAsset, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	a, ok := m.previous[key]
+	return a, ok
+}
+
+// Set records the imported asset. The albums are added to the ones recorded during this run.
+func (m *Manifest) Set(key string, a ManifestAsset) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if e, ok := m.Assets[key]; ok && m.seen[key] {
+		for _, al := range e.Albums {
+			if !slices.Contains(a.Albums, al) {
+				a.Albums = append(a.Albums, al)
+			}
+		}
+	}
+	slices.Sort(a.Albums)
+	m.Assets[key] = &a
+	m.seen[key] = true
+}
+
+// RemovedAlbums returns the albums left by the assets since the previous import.
+// Only the assets recorded during this run are considered.
+// The result gives the assets' keys by album name.
+func (m *Manifest) RemovedAlbums() map[string][]string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	removed := map[string][]string{}
+	for k := range m.seen {
+		p, ok := m.previous[k]
+		if !ok {
+			continue
+		}
+		for _, al := range p.Albums {
+			if !slices.Contains(m.Assets[k].Albums, al) {
+				removed[al] = append(removed[al], k)
+			}
+		}
+	}
+	for _, keys := range removed {
+		slices.Sort(keys)
+	}
+	return removed
+}
+
+// Asset returns the asset as recorded during this run
+func (m *Manifest) Asset(key string) (ManifestAsset, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	a, ok := m.Assets[key]
+	if !ok {
+		return ManifestAsset{}, false
+	}
+	return *a, true
+}
+
+// Match returns the JSON matched with the file by a previous run
+func (m *Manifest) Match(file string) (string, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	j, ok := m.Matches[file]
+	return j, ok
+}
+
+// SetMatch records the JSON matched with the file
+func (m *Manifest) SetMatch(file string, json string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.Matches[file] = json
+}
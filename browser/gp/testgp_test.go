@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"path"
 	"reflect"
+	"slices"
 	"testing"
 
 	"github.com/kr/pretty"
@@ -384,3 +385,60 @@ func TestArchives(t *testing.T) {
 		)
 	}
 }
+
+func TestSharedAlbum(t *testing.T) {
+	ctx := context.Background()
+	contributor := func(name string) jsonFn {
+		return func(md *GoogleMetaData) {
+			md.Contributor = &googContributor{ProfileName: name}
+		}
+	}
+	fsys := newInMemFS().
+		addJSONAlbum("Album/anyname.json", "Album").
+		addFile("Album/shared_album_comments.json", []byte(`[
+			{"text": "Nice!", "creationTime": {"timestamp": "1697872351"}, "contributorInfo": {"profileName": "Bob"}},
+			{"creationTime": {"timestamp": "1697872360"}, "contributorInfo": {"profileName": "Carol"}},
+			{"text": "Where is it?", "creationTime": {"timestamp": "1697872400"}, "contributorInfo": {"profileName": "Bob"}}
+		]`)).
+		addJSONImage("Album/PXL_20230922_144936660.jpg.json", "PXL_20230922_144936660.jpg").
+		addImage("Album/PXL_20230922_144936660.jpg", 10).
+		addJSONImage("Album/PXL_20230922_144940000.jpg.json", "PXL_20230922_144940000.jpg", contributor("Dave")).
+		addImage("Album/PXL_20230922_144940000.jpg", 20).
+		addJSONImage("Photos from 2023/IMG_0001.jpg.json", "IMG_0001.jpg", contributor("Eve")).
+		addImage("Photos from 2023/IMG_0001.jpg", 30).FSs()
+
+	b, err := NewTakeout(ctx, fileevent.NewRecorder(nil, false), immich.DefaultSupportedMedia, fsys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Prepare(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for a := range b.Browse(ctx) {
+		n++
+		if path.Dir(a.FileName) != "Album" {
+			if len(a.Albums) != 0 {
+				t.Errorf("%s: the contributor of an asset out of an album doesn't make an album: %+v", a.FileName, a.Albums)
+			}
+			continue
+		}
+		if len(a.Albums) != 1 || a.Albums[0].Title != "Album" || a.Albums[0].Sharing == nil {
+			t.Fatalf("expecting the shared album, got %+v", a.Albums)
+		}
+		s := a.Albums[0].Sharing
+		collaborators := slices.Clone(s.Collaborators)
+		slices.Sort(collaborators)
+		if !reflect.DeepEqual(collaborators, []string{"Bob", "Carol", "Dave"}) {
+			t.Errorf("unexpected collaborators: %v", s.Collaborators)
+		}
+		if len(s.Comments) != 2 || s.Comments[0].Text != "Nice!" || s.Comments[1].Author != "Bob" || s.Comments[0].Date.Unix() != 1697872351 {
+			t.Errorf("unexpected comments: %+v", s.Comments)
+		}
+	}
+	if n != 3 {
+		t.Errorf("expecting 3 assets, got %d", n)
+	}
+}
@@ -0,0 +1,317 @@
+// Package icloud reads the archives of the iCloud Photos "Download your data" exports.
+package icloud
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/helpers/namematcher"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/immich/metadata"
+)
+
+/*
+	An iCloud Photos export is made of several archives "iCloud Photos Part 1 of N.zip".
+	Each archive has:
+	- the photos and videos, with the live photos' HEIC/JPG and MOV side by side
+	- Photo Details*.csv files giving the date of capture, the favorite, hidden and deleted flags of the photos
+	- an Albums folder with one CSV file per album, listing the album's photos
+
+	The photos are identified by their file name in all CSV files.
+*/
+
+type Export struct {
+	fsyss  []fs.FS
+	log    *fileevent.Recorder
+	sm     immich.SupportedMedia
+	banned namematcher.List
+
+	files   map[string][]*assetFile // media files by name without extension
+	details map[string]photoDetails // details by file name
+	albums  map[string][]string     // albums by file name
+}
+
+// assetFile is a media file found in the export
+type assetFile struct {
+	fsys fs.FS
+	name string
+	size int
+}
+
+// photoDetails is a line of a Photo Details CSV file
+type photoDetails struct {
+	favorite bool
+	hidden   bool
+	deleted  bool
+	date     time.Time
+}
+
+func NewExport(ctx context.Context, l *fileevent.Recorder, sm immich.SupportedMedia, fsyss ...fs.FS) (*Export, error) {
+	return &Export{
+		fsyss:   fsyss,
+		log:     l,
+		sm:      sm,
+		files:   map[string][]*assetFile{},
+		details: map[string]photoDetails{},
+		albums:  map[string][]string{},
+	}, nil
+}
+
+func (e *Export) SetBannedFiles(banned namematcher.List) *Export {
+	e.banned = banned
+	return e
+}
+
+// Prepare reads the CSV files and lists the media files of all archives
+func (e *Export) Prepare(ctx context.Context) error {
+	for _, fsys := range e.fsyss {
+		err := e.walk(ctx, fsys)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Export) walk(ctx context.Context, fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		dir, base := path.Split(name)
+		ext := strings.ToLower(path.Ext(base))
+
+		if ext == ".csv" {
+			switch {
+			case strings.HasPrefix(base, "Photo Details"):
+				err = e.readDetails(fsys, name)
+				if err != nil {
+					e.log.Record(ctx, fileevent.Error, fsys, name, "error", err.Error())
+					return nil
+				}
+				e.log.Record(ctx, fileevent.DiscoveredSidecar, fsys, name, "type", "photo details")
+			case path.Base(dir) == "Albums":
+				album := strings.TrimSuffix(base, path.Ext(base))
+				err = e.readAlbum(fsys, name, album)
+				if err != nil {
+					e.log.Record(ctx, fileevent.Error, fsys, name, "error", err.Error())
+					return nil
+				}
+				e.log.Record(ctx, fileevent.DiscoveredSidecar, fsys, name, "type", "album", "title", album)
+			default:
+				e.log.Record(ctx, fileevent.DiscoveredUnsupported, fsys, name, "reason", "unknown CSV file")
+			}
+			return nil
+		}
+
+		switch e.sm.TypeFromExt(ext) {
+		case immich.TypeImage:
+			e.log.Record(ctx, fileevent.DiscoveredImage, fsys, name)
+		case immich.TypeVideo:
+			e.log.Record(ctx, fileevent.DiscoveredVideo, fsys, name)
+		default:
+			e.log.Record(ctx, fileevent.DiscoveredUnsupported, fsys, name, "reason", "unsupported file type")
+			return nil
+		}
+
+		if e.banned.Match(name) {
+			e.log.Record(ctx, fileevent.DiscoveredDiscarded, fsys, name, "reason", "banned file")
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			e.log.Record(ctx, fileevent.Error, fsys, name, "error", err.Error())
+			return nil
+		}
+		stem := strings.TrimSuffix(base, path.Ext(base))
+		e.files[stem] = append(e.files[stem], &assetFile{fsys: fsys, name: name, size: int(info.Size())})
+		return nil
+	})
+}
+
+// readCSV reads a CSV file and calls fn for each line with the values by column name
+func readCSV(fsys fs.FS, name string, fn func(values map[string]string)) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return err
+	}
+	for i := range header {
+		header[i] = strings.TrimPrefix(strings.TrimSpace(header[i]), "\ufeff") // byte order mark
+	}
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		values := map[string]string{}
+		for i, v := range record {
+			if i < len(header) {
+				values[header[i]] = strings.TrimSpace(v)
+			}
+		}
+		fn(values)
+	}
+}
+
+// readDetails reads a Photo Details CSV file:
+// imgName,fileChecksum,favorite,hidden,deleted,originalCreationDate,viewCount,importDate
+func (e *Export) readDetails(fsys fs.FS, name string) error {
+	return readCSV(fsys, name, func(v map[string]string) {
+		img := v["imgName"]
+		if img == "" {
+			return
+		}
+		e.details[img] = photoDetails{
+			favorite: isYes(v["favorite"]),
+			hidden:   isYes(v["hidden"]),
+			deleted:  isYes(v["deleted"]),
+			date:     parseDate(v["originalCreationDate"]),
+		}
+	})
+}
+
+// readAlbum reads an album CSV file, giving the album's photos in the Images column
+func (e *Export) readAlbum(fsys fs.FS, name string, album string) error {
+	return readCSV(fsys, name, func(v map[string]string) {
+		img := v["Images"]
+		if img == "" {
+			return
+		}
+		if !slices.Contains(e.albums[img], album) {
+			e.albums[img] = append(e.albums[img], album)
+		}
+	})
+}
+
+func isYes(s string) bool {
+	return strings.EqualFold(s, "yes") || strings.EqualFold(s, "true")
+}
+
+// dateLayouts are the formats of the dates in the CSV files, like "Tuesday June 13,2023 5:21 PM GMT"
+var dateLayouts = []string{
+	"Monday January 2,2006 3:04 PM MST",
+	"Monday January 2,2006 3:04:05 PM MST",
+	"Monday, January 2, 2006 3:04 PM MST",
+	"Monday, January 2, 2006 3:04:05 PM MST",
+}
+
+func parseDate(s string) time.Time {
+	for _, l := range dateLayouts {
+		t, err := time.Parse(l, s)
+		if err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Browse gives the assets, with the live photos' video attached to their photo
+func (e *Export) Browse(ctx context.Context) chan *browser.LocalAssetFile {
+	assetChan := make(chan *browser.LocalAssetFile)
+
+	go func() {
+		defer close(assetChan)
+		stems := gen.MapKeys(e.files)
+		sort.Strings(stems)
+		for _, stem := range stems {
+			for _, a := range e.assets(ctx, e.files[stem]) {
+				select {
+				case <-ctx.Done():
+					return
+				case assetChan <- a:
+				}
+			}
+		}
+	}()
+	return assetChan
+}
+
+// assets makes the assets of the files having the same name.
+// A video with the same name as a photo is the video of a live photo.
+func (e *Export) assets(ctx context.Context, files []*assetFile) []*browser.LocalAssetFile {
+	var images, videos []*assetFile
+	for _, f := range files {
+		if e.sm.TypeFromExt(path.Ext(f.name)) == immich.TypeImage {
+			images = append(images, f)
+		} else {
+			videos = append(videos, f)
+		}
+	}
+
+	var assets []*browser.LocalAssetFile
+	for _, f := range images {
+		a := e.makeAsset(ctx, f)
+		if len(videos) > 0 {
+			a.LivePhoto = e.makeAsset(ctx, videos[0])
+			videos = videos[1:]
+		}
+		assets = append(assets, a)
+	}
+	for _, f := range videos {
+		assets = append(assets, e.makeAsset(ctx, f))
+	}
+	return assets
+}
+
+// makeAsset makes a LocalAssetFile with the details and the albums of the file
+func (e *Export) makeAsset(ctx context.Context, f *assetFile) *browser.LocalAssetFile {
+	base := path.Base(f.name)
+	a := &browser.LocalAssetFile{
+		FileName: f.name,
+		Title:    base,
+		FileSize: f.size,
+		FSys:     f.fsys,
+	}
+	if d, ok := e.details[base]; ok {
+		e.log.Record(ctx, fileevent.AnalysisAssociatedMetadata, nil, f.name)
+		a.Favorite = d.favorite
+		a.Archived = d.hidden
+		a.Trashed = d.deleted
+		if !d.date.IsZero() {
+			a.Metadata = metadata.Metadata{DateTaken: d.date}
+		}
+		if a.Trashed {
+			e.log.Record(ctx, fileevent.DiscoveredTrashed, nil, f.name)
+		}
+		if a.Archived {
+			e.log.Record(ctx, fileevent.DiscoveredArchived, nil, f.name)
+		}
+	}
+	for _, album := range e.albums[base] {
+		a.Albums = append(a.Albums, browser.LocalAlbum{Title: album, Path: album})
+	}
+	return a
+}
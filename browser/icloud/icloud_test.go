@@ -0,0 +1,117 @@
+package icloud
+
+import (
+	"context"
+	"io/fs"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	part1 := fstest.MapFS{
+		"iCloud Photos Part 1 of 2/Photos/IMG_0001.HEIC": {Data: []byte("heic")},
+		"iCloud Photos Part 1 of 2/Photos/IMG_0002.JPG":  {Data: []byte("jpg")},
+		"iCloud Photos Part 1 of 2/Photos/Photo Details.csv": {Data: []byte("\ufeffimgName,fileChecksum,favorite,hidden,deleted,originalCreationDate,viewCount,importDate\n" +
+			"IMG_0001.HEIC,abc,yes,no,no,\"Tuesday June 13,2023 5:21 PM GMT\",3,\"Tuesday June 13,2023 5:22 PM GMT\"\n" +
+			"IMG_0002.JPG,def,no,yes,no,\"Wednesday June 14,2023 8:00 AM GMT\",0,\n" +
+			"IMG_0003.MOV,ghi,no,no,yes,\"Thursday June 15,2023 10:30 AM GMT\",0,\n")},
+		"iCloud Photos Part 1 of 2/Albums/Holidays.csv": {Data: []byte("Images\nIMG_0001.HEIC\nIMG_0003.MOV\n")},
+		"iCloud Photos Part 1 of 2/Memories/Summer.csv": {Data: []byte("Images\nIMG_0001.HEIC\n")},
+	}
+	part2 := fstest.MapFS{
+		"iCloud Photos Part 2 of 2/Photos/IMG_0001.MOV": {Data: []byte("mov")},
+		"iCloud Photos Part 2 of 2/Photos/IMG_0003.MOV": {Data: []byte("mov")},
+		"iCloud Photos Part 2 of 2/Albums/Holidays.csv": {Data: []byte("Images\nIMG_0002.JPG\n")},
+	}
+
+	jnl := fileevent.NewRecorder(nil, false)
+	b, err := NewExport(ctx, jnl, immich.DefaultSupportedMedia, []fs.FS{part1, part2}...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Prepare(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		file      string
+		livePhoto string
+		favorite  bool
+		archived  bool
+		trashed   bool
+		date      time.Time
+		albums    []string
+	}
+	var got []result
+	for a := range b.Browse(ctx) {
+		r := result{
+			file:     a.FileName,
+			favorite: a.Favorite,
+			archived: a.Archived,
+			trashed:  a.Trashed,
+			date:     a.Metadata.DateTaken,
+		}
+		if a.LivePhoto != nil {
+			r.livePhoto = a.LivePhoto.FileName
+		}
+		for _, al := range a.Albums {
+			r.albums = append(r.albums, al.Title)
+		}
+		got = append(got, r)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].file < got[j].file })
+
+	want := []result{
+		{
+			file:      "iCloud Photos Part 1 of 2/Photos/IMG_0001.HEIC",
+			livePhoto: "iCloud Photos Part 2 of 2/Photos/IMG_0001.MOV",
+			favorite:  true,
+			date:      time.Date(2023, 6, 13, 17, 21, 0, 0, time.UTC),
+			albums:    []string{"Holidays"},
+		},
+		{
+			file:     "iCloud Photos Part 1 of 2/Photos/IMG_0002.JPG",
+			archived: true,
+			date:     time.Date(2023, 6, 14, 8, 0, 0, 0, time.UTC),
+			albums:   []string{"Holidays"},
+		},
+		{
+			file:    "iCloud Photos Part 2 of 2/Photos/IMG_0003.MOV",
+			trashed: true,
+			date:    time.Date(2023, 6, 15, 10, 30, 0, 0, time.UTC),
+			albums:  []string{"Holidays"},
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expecting %d assets, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		w, g := want[i], got[i]
+		if w.file != g.file || w.livePhoto != g.livePhoto || w.favorite != g.favorite || w.archived != g.archived ||
+			w.trashed != g.trashed || !w.date.Equal(g.date) || !reflect.DeepEqual(w.albums, g.albums) {
+			t.Errorf("unexpected asset\nwant %+v\ngot  %+v", w, g)
+		}
+	}
+
+	counts := jnl.GetCounts()
+	for c, v := range map[fileevent.Code]int64{
+		fileevent.DiscoveredImage:       2,
+		fileevent.DiscoveredVideo:       2,
+		fileevent.DiscoveredSidecar:     3,
+		fileevent.DiscoveredUnsupported: 1,
+		fileevent.DiscoveredArchived:    1,
+		fileevent.DiscoveredTrashed:     1,
+	} {
+		if counts[c] != v {
+			t.Errorf("expecting %d %q events, got %d", v, c, counts[c])
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Package lightroom reads the Lightroom Classic catalogs (.lrcat files).
+package lightroom
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/browser/files"
+	"github.com/simulot/immich-go/helpers/sqlitedb"
+)
+
+/*
+	A Lightroom catalog is a SQLite database referencing the master files:
+	- AgLibraryRootFolder: the folders added to the catalog, with their absolute path
+	  and their path relative to the catalog
+	- AgLibraryFolder: the sub folders, with their path from the root folder
+	- AgLibraryFile: the files, with their base name and extension
+	- Adobe_images: the photos, with their rating and pick flag. The virtual copies
+	  are photos having a master image.
+	- AgLibraryCollection / AgLibraryCollectionImage: the collections and the collection sets
+	- AgLibraryKeyword / AgLibraryKeywordImage: the keywords
+	- AgLibraryIPTC: the captions
+
+	The catalog is copied before being read. It is never modified.
+*/
+
+const (
+	collectionKind    = "com.adobe.ag.library.collection" // a collection, smart collections are ignored
+	collectionSetKind = "com.adobe.ag.library.group"      // a collection set
+)
+
+// ReadCatalog reads the catalog file and finds its root folders on this computer
+func ReadCatalog(ctx context.Context, name string) ([]files.CatalogFolder, error) {
+	db, err := sqlitedb.OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	roots, folders, err := readRootFolders(ctx, db.DB, name)
+	if err != nil {
+		return nil, err
+	}
+	images, err := readImages(ctx, db.DB, roots)
+	if err != nil {
+		return nil, err
+	}
+	err = readKeywords(ctx, db.DB, images)
+	if err != nil {
+		return nil, err
+	}
+	err = readCollections(ctx, db.DB, images)
+	if err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+// readRootFolders reads the root folders, and finds them with their absolute path, or their path relative to the catalog
+func readRootFolders(ctx context.Context, db *sql.DB, catalog string) (map[int64]*files.CatalogFolder, []files.CatalogFolder, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id_local, COALESCE(absolutePath, ''), COALESCE(relativePathFromCatalog, '') FROM AgLibraryRootFolder ORDER BY id_local`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	roots := map[int64]*files.CatalogFolder{}
+	var folders []files.CatalogFolder
+	for rows.Next() {
+		var id int64
+		var abs, rel string
+		err = rows.Scan(&id, &abs, &rel)
+		if err != nil {
+			return nil, nil, err
+		}
+		locations := []string{filepath.FromSlash(abs)}
+		if rel != "" {
+			locations = append(locations, filepath.Join(filepath.Dir(catalog), filepath.FromSlash(rel)))
+		}
+		f := files.NewCatalogFolder(abs, locations...)
+		roots[id] = f
+		folders = append(folders, *f)
+	}
+	return roots, folders, rows.Err()
+}
+
+// readImages reads the master images and their virtual copies.
+// The picked photos are favorites, the rejected ones are trashed.
+func readImages(ctx context.Context, db *sql.DB, roots map[int64]*files.CatalogFolder) (map[int64]*files.CatalogEntry, error) {
+	rows, err := db.QueryContext(ctx, `SELECT i.id_local, COALESCE(i.masterImage, 0), COALESCE(i.copyName, ''),
+		COALESCE(i.rating, 0), COALESCE(i.pick, 0), COALESCE(iptc.caption, ''),
+		fo.rootFolder, COALESCE(fo.pathFromRoot, ''), f.baseName, COALESCE(f.extension, ''), COALESCE(f.sidecarExtensions, '')
+		FROM Adobe_images i
+		JOIN AgLibraryFile f ON f.id_local = i.rootFile
+		JOIN AgLibraryFolder fo ON fo.id_local = f.folder
+		LEFT JOIN AgLibraryIPTC iptc ON iptc.image = i.id_local
+		ORDER BY COALESCE(i.masterImage, 0), i.id_local`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := map[int64]*files.CatalogEntry{}
+	for rows.Next() {
+		var id, master, rootID int64
+		var copyName, caption, dir, base, ext, sidecars string
+		var rating, pick float64
+		err = rows.Scan(&id, &master, &copyName, &rating, &pick, &caption, &rootID, &dir, &base, &ext, &sidecars)
+		if err != nil {
+			return nil, err
+		}
+
+		if master != 0 {
+			// A virtual copy is a set of develop settings applied to its master's file
+			if m, ok := images[master]; ok {
+				images[id] = m
+				m.Notes = append(m.Notes, fmt.Sprintf("the virtual copy %q isn't uploaded: its develop settings can't be applied", copyName))
+			}
+			continue
+		}
+
+		r, ok := roots[rootID]
+		if !ok {
+			continue
+		}
+		name := path.Join(dir, base)
+		im := &files.CatalogEntry{
+			Favorite:    pick > 0,
+			Trashed:     pick < 0,
+			Rating:      int(rating),
+			Description: caption,
+		}
+		images[id] = im
+		r.Entries[strings.ToLower(name+"."+ext)] = im
+
+		// The files handled as sidecars by Lightroom, like the JPEG of a RAW+JPEG pair, share the master's attributes
+		for _, sc := range strings.Split(sidecars, ",") {
+			sc = strings.TrimSpace(sc)
+			if sc != "" && !strings.EqualFold(sc, "xmp") {
+				r.Entries[strings.ToLower(name+"."+sc)] = im
+			}
+		}
+	}
+	return images, rows.Err()
+}
+
+// readKeywords reads the keywords of the images, skipping the ones excluded from the exports
+func readKeywords(ctx context.Context, db *sql.DB, images map[int64]*files.CatalogEntry) error {
+	rows, err := db.QueryContext(ctx, `SELECT ki.image, k.name FROM AgLibraryKeywordImage ki
+		JOIN AgLibraryKeyword k ON k.id_local = ki.tag
+		WHERE k.name IS NOT NULL AND COALESCE(k.includeOnExport, 1) != 0
+		ORDER BY k.name`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var name string
+		err = rows.Scan(&id, &name)
+		if err != nil {
+			return err
+		}
+		if im, ok := images[id]; ok && !slices.Contains(im.Keywords, name) {
+			im.Keywords = append(im.Keywords, name)
+		}
+	}
+	return rows.Err()
+}
+
+// readCollections reads the collections of the images. The album's path gives its collection sets.
+// The collections of a virtual copy are given to its master.
+func readCollections(ctx context.Context, db *sql.DB, images map[int64]*files.CatalogEntry) error {
+	type collection struct {
+		name   string
+		kind   string
+		parent int64
+		system bool
+	}
+	all := map[int64]collection{}
+	rows, err := db.QueryContext(ctx, `SELECT id_local, COALESCE(name, ''), COALESCE(creationId, ''), COALESCE(parent, 0),
+		CAST(COALESCE(systemOnly, 0) AS TEXT) FROM AgLibraryCollection`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int64
+		var c collection
+		var system string
+		err = rows.Scan(&id, &c.name, &c.kind, &c.parent, &system)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		c.system = system != "" && system != "0" && system != "false"
+		all[id] = c
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	collectionPath := func(id int64) string {
+		var p []string
+		for seen := 0; id != 0 && seen < 100; seen++ {
+			c, ok := all[id]
+			if !ok {
+				break
+			}
+			if c.name != "" && (c.kind == collectionKind || c.kind == collectionSetKind) {
+				p = append([]string{c.name}, p...)
+			}
+			id = c.parent
+		}
+		return path.Join(p...)
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT collection, image FROM AgLibraryCollectionImage ORDER BY collection, positionInCollection`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var collectionID, imageID int64
+		err = rows.Scan(&collectionID, &imageID)
+		if err != nil {
+			return err
+		}
+		c, ok := all[collectionID]
+		if !ok || c.kind != collectionKind || c.system || c.name == "" {
+			continue
+		}
+		im, ok := images[imageID]
+		if !ok {
+			continue
+		}
+		al := browser.LocalAlbum{Title: c.name, Path: collectionPath(collectionID)}
+		if !slices.Contains(im.Albums, al) {
+			im.Albums = append(im.Albums, al)
+		}
+	}
+	return rows.Err()
+}
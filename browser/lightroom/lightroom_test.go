@@ -0,0 +1,195 @@
+package lightroom
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/browser/files"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+// makeCatalog makes a catalog with the tables and columns read by immich-go.
+// The pictures are found with their path relative to the catalog.
+func makeCatalog(t *testing.T) string {
+	dir := t.TempDir()
+	for _, f := range []string{
+		"Pictures/2023/IMG_0001.CR2",
+		"Pictures/2023/IMG_0001.JPG",
+		"Pictures/2023/IMG_0001.xmp",
+		"Pictures/2023/IMG_0002.jpg",
+		"Pictures/2023/Paris/IMG_0003.jpg",
+		"Pictures/2023/IMG_0004.jpg",
+	} {
+		name := filepath.Join(dir, f)
+		err := os.MkdirAll(filepath.Dir(name), 0o700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(name, []byte(f), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.MkdirAll(filepath.Join(dir, "Catalog"), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "Catalog", "Lightroom Catalog.lrcat")
+	db, err := sql.Open("sqlite", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, q := range []string{
+		`CREATE TABLE AgLibraryRootFolder (id_local INTEGER PRIMARY KEY, id_global UNIQUE NOT NULL, absolutePath UNIQUE NOT NULL DEFAULT '', name NOT NULL DEFAULT '', relativePathFromCatalog)`,
+		`CREATE TABLE AgLibraryFolder (id_local INTEGER PRIMARY KEY, id_global UNIQUE NOT NULL, pathFromRoot NOT NULL DEFAULT '', rootFolder INTEGER NOT NULL DEFAULT 0, visibility INTEGER)`,
+		`CREATE TABLE AgLibraryFile (id_local INTEGER PRIMARY KEY, id_global UNIQUE NOT NULL, baseName NOT NULL DEFAULT '', extension NOT NULL DEFAULT '', folder INTEGER NOT NULL DEFAULT 0, idx_filename NOT NULL DEFAULT '', originalFilename NOT NULL DEFAULT '', sidecarExtensions)`,
+		`CREATE TABLE Adobe_images (id_local INTEGER PRIMARY KEY, id_global UNIQUE NOT NULL, captureTime, copyName, masterImage INTEGER, pick NOT NULL DEFAULT 0, rating, rootFile INTEGER NOT NULL DEFAULT 0)`,
+		`CREATE TABLE AgLibraryIPTC (id_local INTEGER PRIMARY KEY, caption, copyright, image INTEGER NOT NULL DEFAULT 0)`,
+		`CREATE TABLE AgLibraryKeyword (id_local INTEGER PRIMARY KEY, id_global UNIQUE NOT NULL, includeOnExport INTEGER NOT NULL DEFAULT 1, lc_name, name, parent INTEGER)`,
+		`CREATE TABLE AgLibraryKeywordImage (id_local INTEGER PRIMARY KEY, image INTEGER NOT NULL DEFAULT 0, tag INTEGER NOT NULL DEFAULT 0)`,
+		`CREATE TABLE AgLibraryCollection (id_local INTEGER PRIMARY KEY, creationId NOT NULL DEFAULT '', genealogy NOT NULL DEFAULT '', imageCount, name NOT NULL DEFAULT '', parent INTEGER, systemOnly NOT NULL DEFAULT '')`,
+		`CREATE TABLE AgLibraryCollectionImage (id_local INTEGER PRIMARY KEY, collection INTEGER NOT NULL DEFAULT 0, image INTEGER NOT NULL DEFAULT 0, pick NOT NULL DEFAULT 0, positionInCollection)`,
+
+		`INSERT INTO AgLibraryRootFolder VALUES (1, 'r1', '/Volumes/Photos/Pictures/', 'Pictures', '../Pictures/')`,
+		`INSERT INTO AgLibraryRootFolder VALUES (2, 'r2', '/Volumes/Missing/Scans/', 'Scans', NULL)`,
+		`INSERT INTO AgLibraryFolder VALUES (1, 'f1', '2023/', 1, NULL)`,
+		`INSERT INTO AgLibraryFolder VALUES (2, 'f2', '2023/Paris/', 1, NULL)`,
+		`INSERT INTO AgLibraryFolder VALUES (3, 'f3', '', 2, NULL)`,
+		`INSERT INTO AgLibraryFile VALUES (1, 'a1', 'IMG_0001', 'CR2', 1, 'IMG_0001.CR2', 'IMG_0001.CR2', 'JPG,xmp')`,
+		`INSERT INTO AgLibraryFile VALUES (2, 'a2', 'IMG_0002', 'jpg', 1, 'IMG_0002.jpg', 'IMG_0002.jpg', NULL)`,
+		`INSERT INTO AgLibraryFile VALUES (3, 'a3', 'IMG_0003', 'jpg', 2, 'IMG_0003.jpg', 'IMG_0003.jpg', NULL)`,
+		`INSERT INTO AgLibraryFile VALUES (4, 'a4', 'SCAN_0001', 'tif', 3, 'SCAN_0001.tif', 'SCAN_0001.tif', NULL)`,
+		`INSERT INTO Adobe_images VALUES (1, 'i1', '2023-06-13T17:21:00', NULL, NULL, 1, 4, 1)`,
+		`INSERT INTO Adobe_images VALUES (2, 'i2', '2023-06-13T17:22:00', NULL, NULL, -1, NULL, 2)`,
+		`INSERT INTO Adobe_images VALUES (3, 'i3', '2023-06-13T17:23:00', NULL, NULL, 0, 2, 3)`,
+		`INSERT INTO Adobe_images VALUES (4, 'i4', '2023-06-13T17:23:00', 'Black & white', 3, 0, 5, 3)`,
+		`INSERT INTO Adobe_images VALUES (5, 'i5', '2001-01-01T00:00:00', NULL, NULL, 0, NULL, 4)`,
+		`INSERT INTO AgLibraryIPTC VALUES (1, 'At the studio', NULL, 1)`,
+		`INSERT INTO AgLibraryKeyword VALUES (1, 'k1', 1, NULL, NULL, NULL)`,
+		`INSERT INTO AgLibraryKeyword VALUES (2, 'k2', 1, 'portrait', 'portrait', 1)`,
+		`INSERT INTO AgLibraryKeyword VALUES (3, 'k3', 0, 'private', 'private', 1)`,
+		`INSERT INTO AgLibraryKeyword VALUES (4, 'k4', 1, 'studio', 'studio', 1)`,
+		`INSERT INTO AgLibraryKeywordImage VALUES (1, 1, 4)`,
+		`INSERT INTO AgLibraryKeywordImage VALUES (2, 1, 2)`,
+		`INSERT INTO AgLibraryKeywordImage VALUES (3, 1, 3)`,
+		`INSERT INTO AgLibraryCollection VALUES (1, 'com.adobe.ag.library.group', '', NULL, 'Travels', NULL, '')`,
+		`INSERT INTO AgLibraryCollection VALUES (2, 'com.adobe.ag.library.collection', '', NULL, 'France', 1, '')`,
+		`INSERT INTO AgLibraryCollection VALUES (3, 'com.adobe.ag.library.collection', '', NULL, 'Best of', NULL, '')`,
+		`INSERT INTO AgLibraryCollection VALUES (4, 'com.adobe.ag.library.smart_collection', '', NULL, 'Five stars', NULL, '')`,
+		`INSERT INTO AgLibraryCollection VALUES (5, 'com.adobe.ag.library.collection', '', NULL, 'quick collection', NULL, 1)`,
+		`INSERT INTO AgLibraryCollectionImage VALUES (1, 2, 3, 0, 1)`,
+		`INSERT INTO AgLibraryCollectionImage VALUES (2, 3, 1, 0, 1)`,
+		`INSERT INTO AgLibraryCollectionImage VALUES (3, 3, 4, 0, 2)`,
+		`INSERT INTO AgLibraryCollectionImage VALUES (4, 4, 1, 0, 1)`,
+		`INSERT INTO AgLibraryCollectionImage VALUES (5, 5, 2, 0, 1)`,
+	} {
+		_, err = db.Exec(q)
+		if err != nil {
+			t.Fatalf("%s: %s", q, err)
+		}
+	}
+	return name
+}
+
+func TestCatalog(t *testing.T) {
+	ctx := context.Background()
+	folders, err := ReadCatalog(ctx, makeCatalog(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var missing []string
+	for _, f := range folders {
+		if f.FSys == nil {
+			missing = append(missing, f.Path)
+		}
+	}
+	if !reflect.DeepEqual(missing, []string{"/Volumes/Missing/Scans/"}) {
+		t.Errorf("unexpected missing folders: %v", missing)
+	}
+
+	jnl := fileevent.NewRecorder(nil, false)
+	b, err := files.NewCatalogBrowser(ctx, jnl, immich.DefaultSupportedMedia, "Lightroom", folders...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Prepare(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		file        string
+		favorite    bool
+		trashed     bool
+		rating      int
+		description string
+		keywords    []string
+		albums      []browser.LocalAlbum
+	}
+	var got []result
+	for a := range b.Browse(ctx) {
+		got = append(got, result{
+			file:        a.FileName,
+			favorite:    a.Favorite,
+			trashed:     a.Trashed,
+			rating:      a.Metadata.Rating,
+			description: a.Metadata.Description,
+			keywords:    a.Metadata.Keywords,
+			albums:      a.Albums,
+		})
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].file < got[j].file })
+
+	img1 := result{
+		favorite:    true,
+		rating:      4,
+		description: "At the studio",
+		keywords:    []string{"portrait", "studio"},
+		albums:      []browser.LocalAlbum{{Title: "Best of", Path: "Best of"}},
+	}
+	raw, jpg := img1, img1
+	raw.file = "2023/IMG_0001.CR2"
+	jpg.file = "2023/IMG_0001.JPG"
+	want := []result{
+		raw,
+		jpg,
+		{
+			file:    "2023/IMG_0002.jpg",
+			trashed: true,
+		},
+		{
+			file:   "2023/Paris/IMG_0003.jpg",
+			rating: 2,
+			albums: []browser.LocalAlbum{
+				{Title: "France", Path: "Travels/France"},
+				{Title: "Best of", Path: "Best of"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("unexpected assets\nwant %+v\ngot  %+v", want, got)
+	}
+
+	counts := jnl.GetCounts()
+	for code, v := range map[fileevent.Code]int64{
+		fileevent.DiscoveredImage:     5,
+		fileevent.DiscoveredSidecar:   1,
+		fileevent.DiscoveredDiscarded: 1, // IMG_0004.jpg isn't in the catalog
+		fileevent.DiscoveredTrashed:   1,
+		fileevent.INFO:                1, // the virtual copy of IMG_0003.jpg
+		fileevent.Error:               1, // the missing folder
+	} {
+		if counts[code] != v {
+			t.Errorf("expecting %d %q events, got %d", v, code, counts[code])
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package browser
 
 import (
+	"crypto/sha1"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/fs"
 	"os"
@@ -31,6 +34,7 @@ type LocalAssetFile struct {
 	FileName string               // The asset's path in the fsys
 	Title    string               // Google Photos may a have title longer than the filename
 	Albums   []LocalAlbum         // The asset's album, if any
+	People   []Person             // The people tagged in the asset
 	Err      error                // keep errors encountered
 	SideCar  metadata.SideCarFile // sidecar file if found
 	Metadata metadata.Metadata    // Metadata fields
@@ -39,20 +43,23 @@ type LocalAssetFile struct {
 	Trashed     bool // The asset is trashed
 	Archived    bool // The asset is archived
 	FromPartner bool // the asset comes from a partner
+	Locked      bool // The asset is in the Locked Folder
 	Favorite    bool
 
 	// Live Photos
 	LivePhoto   *LocalAssetFile // Local asset of the movie part
 	LivePhotoID string          // ID of the movie part, just uploaded
 
-	FSys     fs.FS // Asset's file system
-	FileSize int   // File size in bytes
+	FSys     fs.FS  // Asset's file system
+	FileSize int    // File size in bytes
+	Checksum string // base64 encoded SHA-1 of the file, when computed
 
 	// buffer management
 	sourceFile fs.File   // the opened source file
 	tempFile   *os.File  // buffer that keep partial reads available for the full file reading
 	teeReader  io.Reader // write each read from it into the tempWriter
 	reader     io.Reader // the reader that combines the partial read and original file for full file reading
+	hash       hash.Hash // SHA-1 of the bytes read for the upload, when the checksum isn't known
 }
 
 func (l LocalAssetFile) DebugObject() any {
@@ -81,6 +88,39 @@ func (l *LocalAssetFile) DeviceAssetID() string {
 	return fmt.Sprintf("%s-%d", l.Title, l.FileSize)
 }
 
+// ComputeChecksum gives the SHA-1 of the file, the same way the immich server does.
+// The result is kept in the Checksum field.
+//
+// The source is read once: the rest of the file is read after the bytes already read for the metadata,
+// and is kept in the temporary file for the upload. Once the upload has started, the file is read again.
+func (l *LocalAssetFile) ComputeChecksum() (string, error) {
+	if l.Checksum != "" {
+		return l.Checksum, nil
+	}
+	var r io.Reader
+	if l.reader != nil {
+		f, err := l.FSys.Open(l.FileName)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		var err error
+		r, err = l.PartialSourceReader()
+		if err != nil {
+			return "", err
+		}
+	}
+	h := sha1.New()
+	_, err := io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+	l.Checksum = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return l.Checksum, nil
+}
+
 // PartialSourceReader open a reader on the current asset.
 // each byte read from it is saved into a temporary file.
 //
@@ -111,6 +151,7 @@ func (l *LocalAssetFile) PartialSourceReader() (reader io.Reader, err error) {
 }
 
 // Open return fs.File that reads previously read bytes followed by the actual file content.
+// The checksum of the file is computed while it's read, when it isn't known.
 func (l *LocalAssetFile) Open() (fs.File, error) {
 	var err error
 	if l.sourceFile == nil {
@@ -119,6 +160,7 @@ func (l *LocalAssetFile) Open() (fs.File, error) {
 			return nil, err
 		}
 	}
+	first := l.reader == nil
 	if l.tempFile != nil {
 		_, err = l.tempFile.Seek(0, 0)
 		if err != nil {
@@ -128,12 +170,22 @@ func (l *LocalAssetFile) Open() (fs.File, error) {
 	} else {
 		l.reader = l.sourceFile
 	}
+	l.hash = nil
+	if first && l.Checksum == "" {
+		l.hash = sha1.New()
+		l.reader = io.TeeReader(l.reader, l.hash)
+	}
 	return l, nil
 }
 
 // Read
 func (l *LocalAssetFile) Read(b []byte) (int, error) {
-	return l.reader.Read(b)
+	n, err := l.reader.Read(b)
+	if err == io.EOF && l.hash != nil {
+		l.Checksum = base64.StdEncoding.EncodeToString(l.hash.Sum(nil))
+		l.hash = nil
+	}
+	return n, err
 }
 
 // Close close the temporary file  and close the source
@@ -149,6 +201,7 @@ func (l *LocalAssetFile) Close() error {
 		err = errors.Join(err, os.Remove(f))
 		l.tempFile = nil
 	}
+	l.reader, l.hash = nil, nil
 	return err
 }
 
@@ -0,0 +1,114 @@
+package browser
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// countingFS counts the bytes read from its files
+type countingFS struct {
+	fstest.MapFS
+	read int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	f, err := c.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &countingFile{File: f, fsys: c}, nil
+}
+
+type countingFile struct {
+	fs.File
+	fsys *countingFS
+}
+
+func (f *countingFile) Read(b []byte) (int, error) {
+	n, err := f.File.Read(b)
+	f.fsys.read += n
+	return n, err
+}
+
+func TestLocalAssetFileChecksum(t *testing.T) {
+	content := GenRandomBytes(100000)
+	sum := sha1.Sum(content)
+	want := base64.StdEncoding.EncodeToString(sum[:])
+
+	for _, sniff := range []bool{true, false} {
+		fsys := &countingFS{MapFS: fstest.MapFS{"photo.jpg": {Data: content}}}
+		a := &LocalAssetFile{FSys: fsys, FileName: "photo.jpg", FileSize: len(content)}
+
+		if sniff {
+			// The metadata are read at the beginning of the file
+			r, err := a.PartialSourceReader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = io.ReadFull(r, make([]byte, 1000))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := a.ComputeChecksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("sniff %v: want checksum %s, got %s", sniff, want, got)
+		}
+
+		// The upload reads the whole file
+		f, err := a.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, content) {
+			t.Errorf("sniff %v: the uploaded content differs", sniff)
+		}
+		err = a.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fsys.read != len(content) {
+			t.Errorf("sniff %v: the file is read more than once: %d bytes read", sniff, fsys.read)
+		}
+	}
+}
+
+func TestLocalAssetFileChecksumOnUpload(t *testing.T) {
+	content := GenRandomBytes(100000)
+	sum := sha1.Sum(content)
+	fsys := &countingFS{MapFS: fstest.MapFS{"photo.jpg": {Data: content}}}
+	a := &LocalAssetFile{FSys: fsys, FileName: "photo.jpg", FileSize: len(content)}
+
+	f, err := a.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.Copy(io.Discard, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = a.Close()
+
+	got, err := a.ComputeChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("unexpected checksum %s", got)
+	}
+	if fsys.read != len(content) {
+		t.Errorf("the file is read more than once: %d bytes read", fsys.read)
+	}
+}
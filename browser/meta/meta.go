@@ -0,0 +1,372 @@
+// Package meta reads the Facebook and Instagram "Download your information" exports.
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/helpers/namematcher"
+	"github.com/simulot/immich-go/immich"
+)
+
+/*
+	A Meta export is made of one or several archives. The media files are in folders like
+	posts/media, photos_and_videos/<album> (Facebook) or media/posts/<month> (Instagram).
+	The JSON files describe the albums, the posts and the stories. They reference the media files
+	with their "uri", the path of the file in the export, and give:
+	- creation_timestamp: the date of the upload, in seconds since the epoch
+	- description (Facebook) or title (Instagram): the caption
+	- media_metadata.*.exif_data: the GPS coordinates, when the file had them
+	A Facebook album is an object with a "name" and its "photos".
+
+	The strings are mojibake: each byte of their UTF-8 encoding is written as a \u00XX character.
+*/
+
+type Export struct {
+	fsyss             []fs.FS
+	log               *fileevent.Recorder
+	sm                immich.SupportedMedia
+	banned            namematcher.List
+	acceptMissingJSON bool
+
+	files   map[string]*assetFile // media files by path in the export
+	byURI   map[string]*assetFile // media files by the end of their path, to resolve the uris
+	details map[string]*mediaDetails
+}
+
+// assetFile is a media file found in the export
+type assetFile struct {
+	fsys fs.FS
+	name string
+	size int
+}
+
+// mediaDetails is what the JSON files tell about a media file
+type mediaDetails struct {
+	json        string // the first JSON file referencing the media
+	date        time.Time
+	description string
+	latitude    float64
+	longitude   float64
+	albums      []browser.LocalAlbum
+}
+
+func NewExport(ctx context.Context, l *fileevent.Recorder, sm immich.SupportedMedia, fsyss ...fs.FS) (*Export, error) {
+	return &Export{
+		fsyss:   fsyss,
+		log:     l,
+		sm:      sm,
+		files:   map[string]*assetFile{},
+		byURI:   map[string]*assetFile{},
+		details: map[string]*mediaDetails{},
+	}, nil
+}
+
+func (e *Export) SetBannedFiles(banned namematcher.List) *Export {
+	e.banned = banned
+	return e
+}
+
+// SetAcceptMissingJSON accepts the media files not referenced by the JSON files
+func (e *Export) SetAcceptMissingJSON(flag bool) *Export {
+	e.acceptMissingJSON = flag
+	return e
+}
+
+// Prepare reads the JSON files and lists the media files of all archives
+func (e *Export) Prepare(ctx context.Context) error {
+	for _, fsys := range e.fsyss {
+		err := e.walk(ctx, fsys)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Export) walk(ctx context.Context, fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		ext := strings.ToLower(path.Ext(name))
+		if ext == ".json" {
+			if isMessage(name) {
+				return nil
+			}
+			n, err := e.readJSON(fsys, name)
+			if err != nil {
+				e.log.Record(ctx, fileevent.Error, fsys, name, "error", err.Error())
+				return nil
+			}
+			if n > 0 {
+				e.log.Record(ctx, fileevent.DiscoveredSidecar, fsys, name, "type", "metadata", "media", n)
+			}
+			return nil
+		}
+
+		switch e.sm.TypeFromExt(ext) {
+		case immich.TypeImage:
+			e.log.Record(ctx, fileevent.DiscoveredImage, fsys, name)
+		case immich.TypeVideo:
+			e.log.Record(ctx, fileevent.DiscoveredVideo, fsys, name)
+		default:
+			e.log.Record(ctx, fileevent.DiscoveredUnsupported, fsys, name, "reason", "unsupported file type")
+			return nil
+		}
+
+		if isMessage(name) {
+			e.log.Record(ctx, fileevent.DiscoveredDiscarded, fsys, name, "reason", "message attachment")
+			return nil
+		}
+		if e.banned.Match(name) {
+			e.log.Record(ctx, fileevent.DiscoveredDiscarded, fsys, name, "reason", "banned file")
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			e.log.Record(ctx, fileevent.Error, fsys, name, "error", err.Error())
+			return nil
+		}
+		f := &assetFile{fsys: fsys, name: name, size: int(info.Size())}
+		e.files[name] = f
+		// the uris are relative to the export's root, that can be a sub folder of the archive
+		for p := name; ; {
+			if _, ok := e.byURI[p]; !ok {
+				e.byURI[p] = f
+			}
+			_, rest, ok := strings.Cut(p, "/")
+			if !ok {
+				break
+			}
+			p = rest
+		}
+		return nil
+	})
+}
+
+// isMessage tells if the file is in the messages folder. The photos exchanged in the conversations aren't imported.
+func isMessage(name string) bool {
+	return slices.Contains(strings.Split(path.Dir(name), "/"), "messages")
+}
+
+// isInstagram tells if the JSON file comes from an Instagram export, where the title is the caption.
+// In the Facebook exports, the title of a media is the name of its album.
+func isInstagram(name string) bool {
+	dirs := strings.Split(path.Dir(name), "/")
+	return slices.Contains(dirs, "your_instagram_activity") || dirs[len(dirs)-1] == "content"
+}
+
+// readJSON reads a JSON file and collects the details of the media it references
+func (e *Export) readJSON(fsys fs.FS, name string) (int, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var v any
+	err = json.NewDecoder(f).Decode(&v)
+	if err != nil {
+		return 0, err
+	}
+	r := jsonReader{export: e, name: name, instagram: isInstagram(name)}
+	r.read(v, "", nil)
+	return r.count, nil
+}
+
+type jsonReader struct {
+	export    *Export
+	name      string
+	instagram bool
+	count     int
+}
+
+// read walks the JSON values. The caption of a post and the album are given to the media they contain.
+func (r *jsonReader) read(v any, caption string, album *browser.LocalAlbum) {
+	switch v := v.(type) {
+	case []any:
+		for _, i := range v {
+			r.read(i, caption, album)
+		}
+	case map[string]any:
+		if uri := stringValue(v, "uri"); uri != "" && r.export.sm.IsMedia(path.Ext(uri)) {
+			r.addMedia(v, uri, caption, album)
+			return
+		}
+		if name := stringValue(v, "name"); name != "" {
+			if _, ok := v["photos"].([]any); ok {
+				album = &browser.LocalAlbum{Title: name, Path: name, Description: stringValue(v, "description")}
+			}
+		}
+		if c := postText(v); c != "" {
+			caption = c
+		} else if _, ok := v["media"].([]any); ok && r.instagram {
+			caption = stringValue(v, "title")
+		}
+		keys := gen.MapKeys(v)
+		sort.Strings(keys)
+		for _, k := range keys {
+			r.read(v[k], caption, album)
+		}
+	}
+}
+
+// postText gives the text of a Facebook post: "data": [{"post": "..."}]
+func postText(v map[string]any) string {
+	data, _ := v["data"].([]any)
+	for _, d := range data {
+		if m, ok := d.(map[string]any); ok {
+			if s := stringValue(m, "post"); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// addMedia merges the details of a media referenced by several JSON files, like a post and an album
+func (r *jsonReader) addMedia(v map[string]any, uri string, caption string, album *browser.LocalAlbum) {
+	uri = strings.TrimPrefix(path.Clean(uri), "/")
+	d, ok := r.export.details[uri]
+	if !ok {
+		d = &mediaDetails{json: r.name}
+		r.export.details[uri] = d
+	}
+	r.count++
+
+	description := stringValue(v, "description")
+	if r.instagram && description == "" {
+		description = stringValue(v, "title")
+	}
+	if description == "" {
+		description = caption
+	}
+	if d.description == "" {
+		d.description = description
+	}
+	if ts, ok := v["creation_timestamp"].(float64); ok && ts > 0 && d.date.IsZero() {
+		d.date = time.Unix(int64(ts), 0)
+	}
+	if d.latitude == 0 && d.longitude == 0 {
+		d.latitude, d.longitude = exifPosition(v)
+	}
+	if album != nil && !slices.ContainsFunc(d.albums, func(a browser.LocalAlbum) bool { return a.Title == album.Title }) {
+		d.albums = append(d.albums, *album)
+	}
+}
+
+// exifPosition gives the GPS coordinates of media_metadata.photo_metadata.exif_data, or video_metadata
+func exifPosition(v map[string]any) (float64, float64) {
+	md, _ := v["media_metadata"].(map[string]any)
+	for _, k := range []string{"photo_metadata", "video_metadata"} {
+		m, _ := md[k].(map[string]any)
+		exif, _ := m["exif_data"].([]any)
+		for _, x := range exif {
+			x, _ := x.(map[string]any)
+			lat, _ := x["latitude"].(float64)
+			lon, _ := x["longitude"].(float64)
+			if lat != 0 || lon != 0 {
+				return lat, lon
+			}
+		}
+	}
+	return 0, 0
+}
+
+// stringValue gives the string of the key, with the mojibake fixed
+func stringValue(v map[string]any, key string) string {
+	s, _ := v[key].(string)
+	return strings.TrimSpace(fixMojibake(s))
+}
+
+// fixMojibake decodes the strings where each byte of the UTF-8 encoding is written as a character,
+// like "CafÃ©" for "Café". The other strings are kept.
+func fixMojibake(s string) string {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return s
+		}
+		b = append(b, byte(r))
+	}
+	if !utf8.Valid(b) {
+		return s
+	}
+	return string(b)
+}
+
+// Browse gives the media files with the details of the JSON files
+func (e *Export) Browse(ctx context.Context) chan *browser.LocalAssetFile {
+	assetChan := make(chan *browser.LocalAssetFile)
+
+	go func() {
+		defer close(assetChan)
+		details := map[*assetFile]*mediaDetails{}
+		for uri, d := range e.details {
+			if f, ok := e.byURI[uri]; ok {
+				details[f] = d
+			}
+		}
+
+		names := gen.MapKeys(e.files)
+		sort.Strings(names)
+		for _, name := range names {
+			f := e.files[name]
+			d, ok := details[f]
+			if ok {
+				e.log.Record(ctx, fileevent.AnalysisAssociatedMetadata, nil, name, "json", d.json)
+			} else {
+				e.log.Record(ctx, fileevent.AnalysisMissingAssociatedMetadata, nil, name)
+				if !e.acceptMissingJSON {
+					e.log.Record(ctx, fileevent.DiscoveredDiscarded, nil, name, "reason", "not referenced by the JSON files")
+					continue
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case assetChan <- e.makeAsset(f, d):
+			}
+		}
+	}()
+	return assetChan
+}
+
+// makeAsset makes a LocalAssetFile with the details of the file
+func (e *Export) makeAsset(f *assetFile, d *mediaDetails) *browser.LocalAssetFile {
+	a := &browser.LocalAssetFile{
+		FileName: f.name,
+		Title:    path.Base(f.name),
+		FileSize: f.size,
+		FSys:     f.fsys,
+	}
+	if d != nil {
+		a.Metadata.DateTaken = d.date
+		a.Metadata.Description = d.description
+		a.Metadata.Latitude = d.latitude
+		a.Metadata.Longitude = d.longitude
+		a.Albums = d.albums
+	}
+	return a
+}
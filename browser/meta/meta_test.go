@@ -0,0 +1,221 @@
+package meta
+
+import (
+	"context"
+	"io/fs"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+func TestFixMojibake(t *testing.T) {
+	for _, c := range []struct {
+		s, want string
+	}{
+		{"CafÃ©", "Café"},
+		{"ð\u009f\u0098\u008d", "😍"},
+		{"plain text", "plain text"},
+		{"Café", "Café"}, // not a valid UTF-8 encoding, kept
+		{"déjà 😍", "déjà 😍"},
+	} {
+		if got := fixMojibake(c.s); got != c.want {
+			t.Errorf("fixMojibake(%q): want %q, got %q", c.s, c.want, got)
+		}
+	}
+}
+
+func TestFacebookExport(t *testing.T) {
+	ctx := context.Background()
+	part1 := fstest.MapFS{
+		"your_facebook_activity/posts/album/0.json": {Data: []byte(`{
+			"name": "Vacances d'Ã©tÃ©",
+			"description": "At the beach",
+			"photos": [
+				{
+					"uri": "your_facebook_activity/posts/media/Vacances_123/101.jpg",
+					"creation_timestamp": 1686676860,
+					"title": "Vacances d'Ã©tÃ©",
+					"media_metadata": {"photo_metadata": {"exif_data": [{"latitude": 48.8584, "longitude": 2.2945}]}}
+				},
+				{
+					"uri": "your_facebook_activity/posts/media/Vacances_123/102.jpg",
+					"creation_timestamp": 1686763260,
+					"description": "Sunset"
+				}
+			]
+		}`)},
+		"your_facebook_activity/posts/your_posts__check_ins__photos_and_videos_1.json": {Data: []byte(`[
+			{
+				"timestamp": 1686676900,
+				"data": [{"post": "CafÃ© time"}],
+				"attachments": [{"data": [{"media": {
+					"uri": "your_facebook_activity/posts/media/Vacances_123/101.jpg",
+					"creation_timestamp": 1686676860,
+					"title": "Vacances"
+				}}]}]
+			},
+			{
+				"timestamp": 1686850000,
+				"attachments": [{"data": [{"media": {
+					"uri": "your_facebook_activity/posts/media/MobileUploads_456/201.mp4",
+					"creation_timestamp": 1686850000,
+					"title": "Mobile uploads"
+				}}]}]
+			}
+		]`)},
+		"your_facebook_activity/posts/media/Vacances_123/101.jpg": {Data: []byte("jpg")},
+		"your_facebook_activity/messages/inbox/someone_1/message_1.json": {Data: []byte(`{
+			"messages": [{"photos": [{"uri": "your_facebook_activity/messages/inbox/someone_1/photos/301.jpg", "creation_timestamp": 1686850000}]}]
+		}`)},
+		"your_facebook_activity/messages/inbox/someone_1/photos/301.jpg": {Data: []byte("jpg")},
+	}
+	part2 := fstest.MapFS{
+		"your_facebook_activity/posts/media/Vacances_123/102.jpg":         {Data: []byte("jpg")},
+		"your_facebook_activity/posts/media/MobileUploads_456/201.mp4":    {Data: []byte("mp4")},
+		"your_facebook_activity/posts/media/MobileUploads_456/202.jpg":    {Data: []byte("jpg")},
+		"your_facebook_activity/posts/media/MobileUploads_456/readme.txt": {Data: []byte("txt")},
+	}
+
+	jnl := fileevent.NewRecorder(nil, false)
+	b, err := NewExport(ctx, jnl, immich.DefaultSupportedMedia, []fs.FS{part1, part2}...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Prepare(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		file        string
+		date        time.Time
+		description string
+		latitude    float64
+		albums      []string
+	}
+	var got []result
+	for a := range b.Browse(ctx) {
+		r := result{
+			file:        a.FileName,
+			date:        a.Metadata.DateTaken,
+			description: a.Metadata.Description,
+			latitude:    a.Metadata.Latitude,
+		}
+		for _, al := range a.Albums {
+			r.albums = append(r.albums, al.Title)
+		}
+		got = append(got, r)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].file < got[j].file })
+
+	want := []result{
+		{
+			file: "your_facebook_activity/posts/media/MobileUploads_456/201.mp4",
+			date: time.Unix(1686850000, 0),
+		},
+		{
+			file:        "your_facebook_activity/posts/media/Vacances_123/101.jpg",
+			date:        time.Unix(1686676860, 0),
+			description: "Café time",
+			latitude:    48.8584,
+			albums:      []string{"Vacances d'été"},
+		},
+		{
+			file:        "your_facebook_activity/posts/media/Vacances_123/102.jpg",
+			date:        time.Unix(1686763260, 0),
+			description: "Sunset",
+			albums:      []string{"Vacances d'été"},
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expecting %d assets, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		w, g := want[i], got[i]
+		if w.file != g.file || !w.date.Equal(g.date) || w.description != g.description || w.latitude != g.latitude ||
+			!reflect.DeepEqual(w.albums, g.albums) {
+			t.Errorf("unexpected asset\nwant %+v\ngot  %+v", w, g)
+		}
+	}
+
+	counts := jnl.GetCounts()
+	for c, v := range map[fileevent.Code]int64{
+		fileevent.DiscoveredImage:                   4,
+		fileevent.DiscoveredVideo:                   1,
+		fileevent.DiscoveredSidecar:                 2,
+		fileevent.DiscoveredUnsupported:             1,
+		fileevent.DiscoveredDiscarded:               2, // the message's photo and 202.jpg
+		fileevent.AnalysisAssociatedMetadata:        3,
+		fileevent.AnalysisMissingAssociatedMetadata: 1,
+	} {
+		if counts[c] != v {
+			t.Errorf("expecting %d %q events, got %d", v, c, counts[c])
+		}
+	}
+}
+
+func TestInstagramExport(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"instagram-someone-2024-01-01/your_instagram_activity/content/posts_1.json": {Data: []byte(`[
+			{
+				"media": [{"uri": "media/posts/202306/401.jpg", "creation_timestamp": 1686676860, "title": "Ã\u0080 la plage"}]
+			},
+			{
+				"title": "Two photos",
+				"creation_timestamp": 1686763260,
+				"media": [
+					{"uri": "media/posts/202306/402.jpg", "creation_timestamp": 1686763260, "title": ""},
+					{"uri": "media/posts/202306/403.jpg", "creation_timestamp": 1686763261, "title": ""}
+				]
+			}
+		]`)},
+		"instagram-someone-2024-01-01/your_instagram_activity/content/stories.json": {Data: []byte(`{
+			"ig_stories": [{"uri": "media/stories/202306/501.mp4", "creation_timestamp": 1686850000, "title": ""}]
+		}`)},
+		"instagram-someone-2024-01-01/media/posts/202306/401.jpg":   {Data: []byte("jpg")},
+		"instagram-someone-2024-01-01/media/posts/202306/402.jpg":   {Data: []byte("jpg")},
+		"instagram-someone-2024-01-01/media/posts/202306/403.jpg":   {Data: []byte("jpg")},
+		"instagram-someone-2024-01-01/media/stories/202306/501.mp4": {Data: []byte("mp4")},
+		"instagram-someone-2024-01-01/media/other/601.jpg":          {Data: []byte("jpg")},
+	}
+
+	jnl := fileevent.NewRecorder(nil, false)
+	b, err := NewExport(ctx, jnl, immich.DefaultSupportedMedia, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetAcceptMissingJSON(true)
+	err = b.Prepare(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	dates := map[string]time.Time{}
+	for a := range b.Browse(ctx) {
+		got[a.Title] = a.Metadata.Description
+		dates[a.Title] = a.Metadata.DateTaken
+	}
+	want := map[string]string{
+		"401.jpg": "À la plage",
+		"402.jpg": "Two photos",
+		"403.jpg": "Two photos",
+		"501.mp4": "",
+		"601.jpg": "", // accepted without JSON
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want captions %v, got %v", want, got)
+	}
+	if d := dates["403.jpg"]; !d.Equal(time.Unix(1686763261, 0)) {
+		t.Errorf("unexpected date %s", d)
+	}
+	if d := dates["601.jpg"]; !d.IsZero() {
+		t.Errorf("unexpected date %s", d)
+	}
+}
@@ -0,0 +1,27 @@
+package browser
+
+// Person is a person tagged in an asset
+type Person struct {
+	Name   string
+	Region *FaceRegion // The position of the face, nil when unknown
+}
+
+// FaceRegion is the position of a face in the image, in fractions of the image's width and height
+type FaceRegion struct {
+	X, Y          float64 // top left corner
+	Width, Height float64
+}
+
+// AddPerson adds the person to the list, unless the name is already there.
+// The region completes the person already known without region.
+func AddPerson(people []Person, p Person) []Person {
+	for i := range people {
+		if people[i].Name == p.Name {
+			if people[i].Region == nil {
+				people[i].Region = p.Region
+			}
+			return people
+		}
+	}
+	return append(people, p)
+}
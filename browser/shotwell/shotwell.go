@@ -0,0 +1,316 @@
+// Package shotwell reads the Shotwell databases (photo.db files).
+package shotwell
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/browser/files"
+	"github.com/simulot/immich-go/helpers/sqlitedb"
+)
+
+/*
+	The Shotwell database references the files with their absolute path:
+	- PhotoTable / VideoTable: the files, with their flags, rating, title, comment and event
+	- EventTable: the events, named by the user
+	- TagTable: the tags, with the list of their photos ("thumb" + hex id) and videos ("video-" + hex id)
+	- FaceTable / FaceLocationTable: the people and their face regions (Shotwell 0.26+)
+
+	The database is copied before being read. It is never modified.
+*/
+
+const (
+	flagHidden   = 0x01
+	flagFavorite = 0x02
+	flagTrash    = 0x04
+	flagFlagged  = 0x10
+
+	ratingRejected = -1
+
+	photoPrefix = "thumb"
+	videoPrefix = "video-"
+)
+
+// the key of a photo or a video of the database
+type mediaKey struct {
+	video bool
+	id    int64
+}
+
+// ReadDatabase reads the database file. The folders of the files are grouped under their top folders.
+// The named events are the albums.
+func ReadDatabase(ctx context.Context, name string) ([]files.CatalogFolder, error) {
+	db, err := sqlitedb.OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	events, err := readEvents(ctx, db.DB)
+	if err != nil {
+		return nil, err
+	}
+	media := map[mediaKey]*files.CatalogEntry{}
+	fileNames := map[*files.CatalogEntry]string{}
+	for _, t := range []struct {
+		table string
+		video bool
+	}{{"PhotoTable", false}, {"VideoTable", true}} {
+		err = readMedia(ctx, db.DB, t.table, t.video, events, media, fileNames)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = readTags(ctx, db.DB, media)
+	if err != nil {
+		return nil, err
+	}
+	err = readFaces(ctx, db.DB, media)
+	if err != nil {
+		return nil, err
+	}
+	return makeFolders(fileNames), nil
+}
+
+// hasColumn tells if the table has the column. The tables change with Shotwell's versions.
+func hasColumn(ctx context.Context, db *sql.DB, table, column string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&n)
+	return n > 0, err
+}
+
+// hasTable tells if the database has the table
+func hasTable(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n)
+	return n > 0, err
+}
+
+// optionalColumn gives the column when present in the table, or the default value
+func optionalColumn(ctx context.Context, db *sql.DB, table, column, def string) (string, error) {
+	ok, err := hasColumn(ctx, db, table, column)
+	if err != nil || !ok {
+		return def, err
+	}
+	return "COALESCE(" + column + ", " + def + ")", nil
+}
+
+// readEvents reads the named events as albums
+func readEvents(ctx context.Context, db *sql.DB) (map[int64]browser.LocalAlbum, error) {
+	comment, err := optionalColumn(ctx, db, "EventTable", "comment", "''")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT id, name, `+comment+` FROM EventTable WHERE COALESCE(name, '') != ''`)
+	if err != nil {
+		return nil, fmt.Errorf("not a Shotwell database: %w", err)
+	}
+	defer rows.Close()
+	events := map[int64]browser.LocalAlbum{}
+	for rows.Next() {
+		var id int64
+		var name, description string
+		err = rows.Scan(&id, &name, &description)
+		if err != nil {
+			return nil, err
+		}
+		events[id] = browser.LocalAlbum{Title: name, Path: name, Description: strings.TrimSpace(description)}
+	}
+	return events, rows.Err()
+}
+
+// readMedia reads the photos or the videos. The files in the trash and the rejected ones are trashed,
+// the hidden ones are archived, the favorite and flagged ones are favorites.
+func readMedia(ctx context.Context, db *sql.DB, table string, video bool, events map[int64]browser.LocalAlbum,
+	media map[mediaKey]*files.CatalogEntry, fileNames map[*files.CatalogEntry]string,
+) error {
+	columns := []string{"id", "filename", "COALESCE(event_id, -1)"}
+	for _, c := range []struct{ name, def string }{{"flags", "0"}, {"rating", "0"}, {"title", "''"}, {"comment", "''"}} {
+		col, err := optionalColumn(ctx, db, table, c.name, c.def)
+		if err != nil {
+			return err
+		}
+		columns = append(columns, col)
+	}
+	rows, err := db.QueryContext(ctx, `SELECT `+strings.Join(columns, ", ")+` FROM `+table+` ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("not a Shotwell database: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, event, flags, rating int64
+		var name, title, comment string
+		err = rows.Scan(&id, &name, &event, &flags, &rating, &title, &comment)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		e := &files.CatalogEntry{
+			Favorite:    flags&(flagFavorite|flagFlagged) != 0,
+			Trashed:     flags&flagTrash != 0 || rating == ratingRejected,
+			Archived:    flags&flagHidden != 0,
+			Rating:      max(int(rating), 0),
+			Title:       title,
+			Description: strings.TrimSpace(comment),
+		}
+		if a, ok := events[event]; ok {
+			e.Albums = []browser.LocalAlbum{a}
+		}
+		media[mediaKey{video: video, id: id}] = e
+		fileNames[e] = name
+	}
+	return rows.Err()
+}
+
+// readTags reads the tags. The hierarchical tags are named with their path, like "/Travel/France":
+// only the last part is kept.
+func readTags(ctx context.Context, db *sql.DB, media map[mediaKey]*files.CatalogEntry) error {
+	rows, err := db.QueryContext(ctx, `SELECT name, COALESCE(photo_id_list, '') FROM TagTable ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, list string
+		err = rows.Scan(&name, &list)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(name, "/") {
+			name = path.Base(name)
+		}
+		if name == "" || name == "/" {
+			continue
+		}
+		for _, s := range strings.Split(list, ",") {
+			k, ok := parseMediaKey(strings.TrimSpace(s))
+			if !ok {
+				continue
+			}
+			if e, ok := media[k]; ok && !slices.Contains(e.Keywords, name) {
+				e.Keywords = append(e.Keywords, name)
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// parseMediaKey parses the keys of the TagTable's lists
+func parseMediaKey(s string) (mediaKey, bool) {
+	for _, p := range []struct {
+		prefix string
+		video  bool
+	}{{videoPrefix, true}, {photoPrefix, false}} {
+		if h, ok := strings.CutPrefix(s, p.prefix); ok {
+			id, err := strconv.ParseInt(h, 16, 64)
+			return mediaKey{video: p.video, id: id}, err == nil
+		}
+	}
+	return mediaKey{}, false
+}
+
+// readFaces reads the people recognized on the photos, when the database has the face tables
+func readFaces(ctx context.Context, db *sql.DB, media map[mediaKey]*files.CatalogEntry) error {
+	for _, t := range []string{"FaceTable", "FaceLocationTable"} {
+		ok, err := hasTable(ctx, db, t)
+		if err != nil || !ok {
+			return err
+		}
+	}
+	rows, err := db.QueryContext(ctx, `SELECT l.photo_id, f.name, COALESCE(l.geometry, '') FROM FaceLocationTable l
+		JOIN FaceTable f ON f.id = l.face_id
+		WHERE COALESCE(f.name, '') != ''
+		ORDER BY l.photo_id, f.id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var name, geometry string
+		err = rows.Scan(&id, &name, &geometry)
+		if err != nil {
+			return err
+		}
+		if e, ok := media[mediaKey{id: id}]; ok {
+			e.People = browser.AddPerson(e.People, browser.Person{Name: name, Region: faceRegion(geometry)})
+		}
+	}
+	return rows.Err()
+}
+
+// faceRegion reads the geometry of a face: "Rectangle;x;y;half width;half height".
+// The center of the rectangle and its half sizes are given in fractions of the photo's size.
+// It returns nil when the geometry can't be read.
+func faceRegion(geometry string) *browser.FaceRegion {
+	parts := strings.Split(geometry, ";")
+	if len(parts) != 5 || parts[0] != "Rectangle" {
+		return nil
+	}
+	var v [4]float64
+	for i, p := range parts[1:] {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil || f < 0 || f > 1 {
+			return nil
+		}
+		v[i] = f
+	}
+	r := browser.FaceRegion{X: v[0] - v[2], Y: v[1] - v[3], Width: 2 * v[2], Height: 2 * v[3]}
+	if r.X < 0 || r.Y < 0 || r.X+r.Width > 1 || r.Y+r.Height > 1 || r.Width == 0 || r.Height == 0 {
+		return nil
+	}
+	return &r
+}
+
+// makeFolders groups the files under their top folders
+func makeFolders(fileNames map[*files.CatalogEntry]string) []files.CatalogFolder {
+	dirs := map[string]bool{}
+	for _, name := range fileNames {
+		dirs[filepath.Dir(name)] = true
+	}
+	sorted := make([]string, 0, len(dirs))
+	for d := range dirs {
+		sorted = append(sorted, d)
+	}
+	sort.Strings(sorted)
+
+	var roots []*files.CatalogFolder
+	for _, d := range sorted {
+		if !slices.ContainsFunc(roots, func(r *files.CatalogFolder) bool { return isUnder(d, r.Path) }) {
+			roots = append(roots, files.NewCatalogFolder(d, d))
+		}
+	}
+
+	for e, name := range fileNames {
+		for _, r := range roots {
+			if isUnder(filepath.Dir(name), r.Path) {
+				rel, err := filepath.Rel(r.Path, name)
+				if err == nil {
+					r.Entries[strings.ToLower(filepath.ToSlash(rel))] = e
+				}
+				break
+			}
+		}
+	}
+
+	folders := make([]files.CatalogFolder, 0, len(roots))
+	for _, r := range roots {
+		folders = append(folders, *r)
+	}
+	return folders
+}
+
+// isUnder tells if the folder is the root or one of its sub folders
+func isUnder(dir, root string) bool {
+	return dir == root || strings.HasPrefix(dir, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+}
@@ -0,0 +1,155 @@
+package shotwell
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/browser/files"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+// makeDatabase makes a database with the tables and columns read by immich-go.
+func makeDatabase(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	for _, f := range []string{
+		"Pictures/2023/IMG_0001.jpg",
+		"Pictures/2023/Paris/IMG_0002.jpg",
+		"Pictures/2023/IMG_0003.jpg",
+		"Pictures/2023/IMG_0004.jpg",
+		"Videos/VID_0001.mp4",
+	} {
+		name := filepath.Join(dir, f)
+		err := os.MkdirAll(filepath.Dir(name), 0o700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(name, []byte(f), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	name := filepath.Join(dir, "photo.db")
+	db, err := sql.Open("sqlite", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	file := func(f string) string {
+		return filepath.Join(dir, f)
+	}
+	for _, q := range []string{
+		`CREATE TABLE PhotoTable (id INTEGER PRIMARY KEY, filename TEXT UNIQUE NOT NULL, event_id INTEGER, flags INTEGER DEFAULT 0, rating INTEGER DEFAULT 0, title TEXT, comment TEXT)`,
+		`CREATE TABLE VideoTable (id INTEGER PRIMARY KEY, filename TEXT UNIQUE NOT NULL, event_id INTEGER, rating INTEGER DEFAULT 0, title TEXT, flags INTEGER DEFAULT 0)`,
+		`CREATE TABLE EventTable (id INTEGER PRIMARY KEY, name TEXT, primary_photo_id INTEGER, time_created INTEGER, comment TEXT)`,
+		`CREATE TABLE TagTable (id INTEGER PRIMARY KEY, name TEXT UNIQUE NOT NULL, photo_id_list TEXT, time_created INTEGER)`,
+		`CREATE TABLE FaceTable (id INTEGER PRIMARY KEY, name TEXT UNIQUE NOT NULL, time_created TIMESTAMP)`,
+		`CREATE TABLE FaceLocationTable (id INTEGER PRIMARY KEY, face_id INTEGER NOT NULL, photo_id INTEGER NOT NULL, geometry TEXT)`,
+	} {
+		_, err = db.Exec(q)
+		if err != nil {
+			t.Fatalf("%s: %s", q, err)
+		}
+	}
+	for _, q := range []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT INTO EventTable VALUES (1, 'Paris', 1, 0, 'A week in Paris')`, nil},
+		{`INSERT INTO EventTable VALUES (2, NULL, 3, 0, NULL)`, nil},
+		{`INSERT INTO PhotoTable VALUES (1, ?, 1, 2, 5, 'Eiffel', 'The Eiffel tower')`, []any{file("Pictures/2023/IMG_0001.jpg")}},
+		{`INSERT INTO PhotoTable VALUES (2, ?, 1, 1, 0, NULL, NULL)`, []any{file("Pictures/2023/Paris/IMG_0002.jpg")}},
+		{`INSERT INTO PhotoTable VALUES (3, ?, 2, 0, -1, NULL, NULL)`, []any{file("Pictures/2023/IMG_0003.jpg")}},
+		{`INSERT INTO PhotoTable VALUES (4, '/media/missing/IMG_9999.jpg', 2, 0, 0, NULL, NULL)`, nil},
+		{`INSERT INTO VideoTable VALUES (1, ?, 1, 3, NULL, 4)`, []any{file("Videos/VID_0001.mp4")}},
+		{`INSERT INTO TagTable VALUES (1, '/Travel', 'thumb0000000000000001,video-0000000000000001', 0)`, nil},
+		{`INSERT INTO TagTable VALUES (2, '/Travel/France', 'thumb0000000000000001', 0)`, nil},
+		{`INSERT INTO FaceTable VALUES (1, 'Alice', 0)`, nil},
+		{`INSERT INTO FaceTable VALUES (2, 'Bob', 0)`, nil},
+		{`INSERT INTO FaceLocationTable VALUES (1, 1, 1, 'Rectangle;0.5;0.375;0.125;0.25')`, nil},
+		{`INSERT INTO FaceLocationTable VALUES (2, 2, 1, 'x=1')`, nil},
+	} {
+		_, err = db.Exec(q.query, q.args...)
+		if err != nil {
+			t.Fatalf("%s: %s", q.query, err)
+		}
+	}
+	return name, dir
+}
+
+func TestDatabase(t *testing.T) {
+	ctx := context.Background()
+	name, dir := makeDatabase(t)
+	folders, err := ReadDatabase(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range folders {
+		paths = append(paths, f.Path)
+	}
+	if want := []string{"/media/missing", filepath.Join(dir, "Pictures/2023"), filepath.Join(dir, "Videos")}; !reflect.DeepEqual(want, paths) {
+		t.Fatalf("want folders %v, got %v", want, paths)
+	}
+
+	jnl := fileevent.NewRecorder(nil, false)
+	b, err := files.NewCatalogBrowser(ctx, jnl, immich.DefaultSupportedMedia, "Shotwell", folders...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Prepare(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]*browser.LocalAssetFile{}
+	var names []string
+	for a := range b.Browse(ctx) {
+		got[a.FileName] = a
+		names = append(names, a.FileName)
+	}
+	sort.Strings(names)
+	if want := []string{"IMG_0001.jpg", "IMG_0003.jpg", "Paris/IMG_0002.jpg", "VID_0001.mp4"}; !reflect.DeepEqual(want, names) {
+		t.Fatalf("want %v, got %v", want, names)
+	}
+
+	paris := []browser.LocalAlbum{{Title: "Paris", Path: "Paris", Description: "A week in Paris"}}
+	people := []browser.Person{{Name: "Alice", Region: &browser.FaceRegion{X: 0.375, Y: 0.125, Width: 0.25, Height: 0.5}}, {Name: "Bob"}}
+	a := got["IMG_0001.jpg"]
+	md := a.Metadata
+	if !a.Favorite || a.Trashed || md.Rating != 5 || md.Title != "Eiffel" || md.Description != "The Eiffel tower" ||
+		!reflect.DeepEqual(md.Keywords, []string{"Travel", "France"}) || !reflect.DeepEqual(a.People, people) ||
+		!reflect.DeepEqual(a.Albums, paris) {
+		t.Errorf("unexpected asset: %+v", a)
+	}
+	if a := got["Paris/IMG_0002.jpg"]; !a.Archived || a.Favorite || !reflect.DeepEqual(a.Albums, paris) {
+		t.Errorf("the hidden asset must be archived: %+v", a)
+	}
+	if a := got["IMG_0003.jpg"]; !a.Trashed || len(a.Albums) != 0 {
+		t.Errorf("the rejected asset must be trashed: %+v", a)
+	}
+	if a := got["VID_0001.mp4"]; !a.Trashed || a.Metadata.Rating != 3 || !reflect.DeepEqual(a.Metadata.Keywords, []string{"Travel"}) {
+		t.Errorf("the asset in Shotwell's trash must be trashed: %+v", a)
+	}
+
+	counts := jnl.GetCounts()
+	for code, v := range map[fileevent.Code]int64{
+		fileevent.DiscoveredImage:     4,
+		fileevent.DiscoveredVideo:     1,
+		fileevent.DiscoveredDiscarded: 1, // IMG_0004.jpg isn't in the database
+		fileevent.DiscoveredTrashed:   2,
+		fileevent.DiscoveredArchived:  1,
+		fileevent.Error:               1, // the missing folder
+	} {
+		if counts[code] != v {
+			t.Errorf("expecting %d %q events, got %d", v, code, counts[code])
+		}
+	}
+}
@@ -24,24 +24,27 @@ import (
 
 // SharedFlags collect all parameters that are common to all commands
 type SharedFlags struct {
-	ConfigurationFile string        // Path to the configuration file to use
-	Server            string        // Immich server address (http://<your-ip>:2283/api or https://<your-domain>/api)
-	API               string        // Immich api endpoint (http://container_ip:3301)
-	Key               string        // API Key
-	DeviceUUID        string        // Set a device UUID
-	APITrace          bool          // Enable API call traces
-	LogLevel          string        // Indicate the log level (string)
-	Level             slog.Level    // Set the log level
-	Debug             bool          // Enable the debug mode
-	TimeZone          string        // Override default TZ
-	SkipSSL           bool          // Skip SSL Verification
-	ClientTimeout     time.Duration // Set the client request timeout
-	NoUI              bool          // Disable user interface
-	JSONLog           bool          // Enable JSON structured log
-	DebugCounters     bool          // Enable CSV action counters per file
-	DebugFileList     bool          // When true, the file argument is a file wile the list of Takeout files
+	ConfigurationFile string                 // Path to the configuration file to use
+	Server            string                 // Immich server address (http://<your-ip>:2283/api or https://<your-domain>/api)
+	API               string                 // Immich api endpoint (http://container_ip:3301)
+	Key               string                 // API Key
+	DeviceUUID        string                 // Set a device UUID
+	APITrace          bool                   // Enable API call traces
+	LogLevel          string                 // Indicate the log level (string)
+	Level             slog.Level             // Set the log level
+	Debug             bool                   // Enable the debug mode
+	TimeZone          string                 // Override default TZ
+	SkipSSL           bool                   // Skip SSL Verification
+	ClientTimeout     time.Duration          // Set the client request timeout
+	MaxBandwidth      int64                  // Limit the upload bandwidth in bytes per second, 0 for no limit
+	NoUI              bool                   // Disable user interface
+	JSONLog           bool                   // Enable JSON structured log
+	DebugCounters     bool                   // Enable CSV action counters per file
+	DebugFileList     bool                   // When true, the file argument is a file wile the list of Takeout files
+	Remotes           []configuration.Remote // Credentials of the remote sources, read from the configuration file
 
 	Immich             immich.ImmichInterface // Immich client
+	User               immich.User            // Connected user
 	Log                *slog.Logger           // Logger
 	Jnl                *fileevent.Recorder    // Program's logger
 	LogFile            string                 // Log file name
@@ -79,6 +82,7 @@ func (app *SharedFlags) SetFlags(fs *flag.FlagSet) {
 	fs.BoolFunc("skip-verify-ssl", "Skip SSL verification", myflag.BoolFlagFn(&app.SkipSSL, app.SkipSSL))
 	fs.BoolFunc("no-ui", "Disable the user interface", myflag.BoolFlagFn(&app.NoUI, app.NoUI))
 	fs.Func("client-timeout", "Set server calls timeout, default 1m", myflag.DurationFlagFn(&app.ClientTimeout, app.ClientTimeout))
+	fs.Func("max-bandwidth", "Limit the upload bandwidth, ex: 500K, 2MB, 10Mbit. Default no limit", myflag.BandwidthFlagFn(&app.MaxBandwidth, app.MaxBandwidth))
 	fs.BoolFunc("debug-counters", "generate a CSV file with actions per handled files", myflag.BoolFlagFn(&app.DebugCounters, false))
 }
 
@@ -120,16 +124,16 @@ func (app *SharedFlags) Start(ctx context.Context) error {
 		}
 	}
 
+	conf, err := configuration.ConfigRead(app.ConfigurationFile)
+	confExist := err == nil
+	app.Remotes = conf.Remotes
+
 	// If the client isn't yet initialized
 	if app.Immich == nil {
-		if app.Server == "" && app.API == "" && app.Key == "" {
-			conf, err := configuration.ConfigRead(app.ConfigurationFile)
-			confExist := err == nil
-			if confExist && app.Server == "" && app.Key == "" && app.API == "" {
-				app.Server = conf.ServerURL
-				app.Key = conf.APIKey
-				app.API = conf.APIURL
-			}
+		if confExist && app.Server == "" && app.Key == "" && app.API == "" {
+			app.Server = conf.ServerURL
+			app.Key = conf.APIKey
+			app.API = conf.APIURL
 		}
 
 		switch {
@@ -146,12 +150,10 @@ func (app *SharedFlags) Start(ctx context.Context) error {
 			return joinedErr
 		}
 
-		// Connection details are saved into the configuration file
-		conf := configuration.Configuration{
-			ServerURL: app.Server,
-			APIKey:    app.Key,
-			APIURL:    app.API,
-		}
+		// Connection details are saved into the configuration file, with the remotes' credentials
+		conf.ServerURL = app.Server
+		conf.APIKey = app.Key
+		conf.APIURL = app.API
 		err := configuration.MakeDirForFile(app.ConfigurationFile)
 		if err != nil {
 			return err
@@ -162,7 +164,7 @@ func (app *SharedFlags) Start(ctx context.Context) error {
 		}
 		app.Log.Info("Connection to the server " + app.Server)
 
-		app.Immich, err = immich.NewImmichClient(app.Server, app.Key, immich.OptionVerifySSL(app.SkipSSL), immich.OptionConnectionTimeout(app.ClientTimeout))
+		app.Immich, err = immich.NewImmichClient(app.Server, app.Key, immich.OptionVerifySSL(app.SkipSSL), immich.OptionConnectionTimeout(app.ClientTimeout), immich.OptionMaxBandwidth(app.MaxBandwidth))
 		if err != nil {
 			return err
 		}
@@ -198,6 +200,7 @@ func (app *SharedFlags) Start(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
+		app.User = user
 		app.Log.Info(fmt.Sprintf("Connected, user: %s", user.Email))
 	}
 
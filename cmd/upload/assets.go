@@ -1,32 +1,42 @@
 package upload
 
 import (
+	"context"
 	"fmt"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/simulot/immich-go/browser"
 	"github.com/simulot/immich-go/immich"
 )
 
 type AssetIndex struct {
+	lock   sync.RWMutex // the index is shared by the upload workers
 	assets []*immich.Asset
 	byHash map[string][]*immich.Asset
 	byName map[string][]*immich.Asset
 	byID   map[string]*immich.Asset
 	// albums []immich.AlbumSimplified
+
+	uploading map[string]chan struct{} // the assets being uploaded, by name and by checksum
 }
 
 func (ai *AssetIndex) ReIndex() {
+	ai.lock.Lock()
+	defer ai.lock.Unlock()
 	ai.byHash = map[string][]*immich.Asset{}
 	ai.byName = map[string][]*immich.Asset{}
 	ai.byID = map[string]*immich.Asset{}
 
 	for _, a := range ai.assets {
 		ID := fmt.Sprintf("%s-%d", a.OriginalFileName, a.ExifInfo.FileSizeInByte)
-		l := ai.byHash[a.Checksum]
-		l = append(l, a)
-		ai.byHash[a.Checksum] = l
+		var l []*immich.Asset
+		if a.Checksum != "" {
+			l = ai.byHash[a.Checksum]
+			l = append(l, a)
+			ai.byHash[a.Checksum] = l
+		}
 
 		n := a.OriginalFileName
 		l = ai.byName[n]
@@ -37,6 +47,8 @@ func (ai *AssetIndex) ReIndex() {
 }
 
 func (ai *AssetIndex) Len() int {
+	ai.lock.RLock()
+	defer ai.lock.RUnlock()
 	return len(ai.assets)
 }
 
@@ -51,11 +63,78 @@ func (ai *AssetIndex) AddLocalAsset(la *browser.LocalAssetFile, immichID string)
 			Latitude:         la.Metadata.Latitude,
 			Longitude:        la.Metadata.Longitude,
 		},
+		Checksum:     la.Checksum,
 		JustUploaded: true,
 	}
+	ai.lock.Lock()
+	defer ai.lock.Unlock()
 	ai.assets = append(ai.assets, sa)
 	ai.byID[sa.DeviceAssetID] = sa
+	if sa.Checksum != "" {
+		ai.byHash[sa.Checksum] = append(ai.byHash[sa.Checksum], sa)
+	}
 	l := ai.byName[sa.OriginalFileName]
 	l = append(l, sa)
 	ai.byName[sa.OriginalFileName] = l
 }
+
+// assetFileName gives the file name of the asset, with the extension of the file when the title has none
+func assetFileName(la *browser.LocalAssetFile) string {
+	filename := la.Title
+	if path.Ext(filename) == "" {
+		filename += path.Ext(la.FileName)
+	}
+	return filename
+}
+
+// ReserveUpload checks if the server has this asset, and reserves its upload when the advice is to upload it.
+// When another worker is uploading an asset with the same name or the same checksum, it waits for the end of
+// that upload and checks again: two copies of an asset are never uploaded together.
+// The release function ends the reservation, after AddLocalAsset when the upload succeeds.
+func (ai *AssetIndex) ReserveUpload(ctx context.Context, la *browser.LocalAssetFile) (*Advice, func(), error) {
+	keys := []string{"name:" + path.Base(assetFileName(la))}
+	if la.Checksum != "" {
+		keys = append(keys, "hash:"+la.Checksum)
+	}
+	for {
+		ai.lock.Lock()
+		var wait chan struct{}
+		for _, k := range keys {
+			if c, ok := ai.uploading[k]; ok {
+				wait = c
+				break
+			}
+		}
+		if wait != nil {
+			ai.lock.Unlock()
+			select {
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			case <-wait:
+			}
+			continue
+		}
+
+		advice := ai.shouldUpload(la)
+		if advice.Advice != NotOnServer && advice.Advice != SmallerOnServer {
+			ai.lock.Unlock()
+			return advice, func() {}, nil
+		}
+		if ai.uploading == nil {
+			ai.uploading = map[string]chan struct{}{}
+		}
+		done := make(chan struct{})
+		for _, k := range keys {
+			ai.uploading[k] = done
+		}
+		ai.lock.Unlock()
+		return advice, func() {
+			ai.lock.Lock()
+			defer ai.lock.Unlock()
+			for _, k := range keys {
+				delete(ai.uploading, k)
+			}
+			close(done)
+		}, nil
+	}
+}
@@ -0,0 +1,187 @@
+package upload
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+)
+
+// CategoryAction tells what to do with the assets of a Google Photos category
+type CategoryAction int
+
+const (
+	CategoryImport  CategoryAction = iota // import the asset
+	CategoryDiscard                       // don't import the asset
+	CategoryAlbum                         // import the asset into the policy's album
+	CategoryArchive                       // import the asset as archived
+	CategoryTrash                         // import the asset, then move it to the server's trash
+)
+
+// CategoryPolicy is the action applied to the trashed, archived, partner's or Locked Folder assets.
+// The value of the flag is import, discard, archive, trash or album:NAME
+type CategoryPolicy struct {
+	Action CategoryAction
+	Album  string // album name for the CategoryAlbum action
+}
+
+func (p CategoryPolicy) String() string {
+	switch p.Action {
+	case CategoryDiscard:
+		return "discard"
+	case CategoryAlbum:
+		return "album:" + p.Album
+	case CategoryArchive:
+		return "archive"
+	case CategoryTrash:
+		return "trash"
+	default:
+		return "import"
+	}
+}
+
+func (p *CategoryPolicy) Set(s string) error {
+	if name, ok := strings.CutPrefix(s, "album:"); ok {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return fmt.Errorf("the album policy needs an album name: album:NAME")
+		}
+		*p = CategoryPolicy{Action: CategoryAlbum, Album: name}
+		return nil
+	}
+	switch s {
+	case "import":
+		*p = CategoryPolicy{Action: CategoryImport}
+	case "discard":
+		*p = CategoryPolicy{Action: CategoryDiscard}
+	case "archive":
+		*p = CategoryPolicy{Action: CategoryArchive}
+	case "trash":
+		*p = CategoryPolicy{Action: CategoryTrash}
+	default:
+		return fmt.Errorf("invalid policy %q, expecting import, discard, archive, trash or album:NAME", s)
+	}
+	return nil
+}
+
+// setCategoryPolicies gives the policies set by the older options -keep-trashed, -keep-partner, -partner-album,
+// -discard-archived and -auto-archive, unless the policy is given explicitly.
+func (app *UpCmd) setCategoryPolicies(cmd *flag.FlagSet) error {
+	set := map[string]bool{}
+	cmd.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if !set["trashed-policy"] && app.KeepTrashed {
+		app.TrashedPolicy = CategoryPolicy{Action: CategoryImport}
+	}
+	if !set["partner-policy"] {
+		switch {
+		case !app.KeepPartner:
+			app.PartnerPolicy = CategoryPolicy{Action: CategoryDiscard}
+		case app.PartnerAlbum != "":
+			app.PartnerPolicy = CategoryPolicy{Action: CategoryAlbum, Album: app.PartnerAlbum}
+		}
+	}
+	if !set["archived-policy"] {
+		switch {
+		case app.DiscardArchived:
+			app.ArchivedPolicy = CategoryPolicy{Action: CategoryDiscard}
+		case !app.AutoArchive:
+			app.ArchivedPolicy = CategoryPolicy{Action: CategoryImport}
+		}
+	}
+	// the takeout manifest keeps the archived flag only when it is given to the server
+	app.AutoArchive = app.ArchivedPolicy.Action == CategoryArchive
+
+	if !app.GooglePhotos && !app.ICloud && !app.PhotosLibrary && !app.readsCatalog() && (set["trashed-policy"] || set["archived-policy"] || set["partner-policy"] || set["locked-policy"]) {
+		return fmt.Errorf("the -trashed-policy, -archived-policy, -partner-policy and -locked-policy options are for Google Photos takeouts, iCloud Photos exports, Apple Photos libraries and the databases of Lightroom, digiKam and Shotwell")
+	}
+	return nil
+}
+
+// assetCategory is a category of Google Photos assets with its policy
+type assetCategory struct {
+	name   string
+	option string
+	policy CategoryPolicy
+}
+
+// categories returns the categories of the asset, in the order of their policies' precedence
+func (app *UpCmd) categories(a *browser.LocalAssetFile) []assetCategory {
+	var c []assetCategory
+	if a.Locked {
+		c = append(c, assetCategory{name: "locked folder", option: "-locked-policy", policy: app.LockedPolicy})
+	}
+	if a.Trashed {
+		c = append(c, assetCategory{name: "trashed", option: "-trashed-policy", policy: app.TrashedPolicy})
+	}
+	if a.FromPartner {
+		c = append(c, assetCategory{name: "partner's", option: "-partner-policy", policy: app.PartnerPolicy})
+	}
+	if a.Archived {
+		c = append(c, assetCategory{name: "archived", option: "-archived-policy", policy: app.ArchivedPolicy})
+	}
+	return c
+}
+
+// applyCategoryPolicies applies the policies of the asset's categories.
+// It returns false when the asset is discarded.
+// The archived flag is set only when a policy asks for it.
+func (app *UpCmd) applyCategoryPolicies(ctx context.Context, a *browser.LocalAssetFile, cats []assetCategory) bool {
+	archived := false
+	for _, c := range cats {
+		switch c.policy.Action {
+		case CategoryDiscard:
+			app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", c.name+" asset excluded by "+c.option)
+			return false
+		case CategoryArchive:
+			archived = true
+		}
+	}
+	a.Archived = archived
+	if a.LivePhoto != nil {
+		a.LivePhoto.Archived = archived
+	}
+	return true
+}
+
+// manageCategoryAlbums adds the asset to the albums given by the policies of its categories
+func (app *UpCmd) manageCategoryAlbums(ctx context.Context, assetID string, a *browser.LocalAssetFile, cats []assetCategory) {
+	for _, c := range cats {
+		if c.policy.Action != CategoryAlbum {
+			continue
+		}
+		app.Jnl.Record(ctx, fileevent.UploadAddToAlbum, a, a.FileName, "album", c.policy.Album, "reason", "option "+c.option)
+		if app.DryRun {
+			continue
+		}
+		err := app.AddToAlbum(ctx, assetID, browser.LocalAlbum{Title: c.policy.Album})
+		if err != nil {
+			app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
+		}
+	}
+}
+
+// trashCategory moves the uploaded asset to the server's trash when one of its categories' policies asks for it
+func (app *UpCmd) trashCategory(ctx context.Context, a *browser.LocalAssetFile, id string, cats []assetCategory) {
+	for _, c := range cats {
+		if c.policy.Action != CategoryTrash {
+			continue
+		}
+		app.Jnl.Record(ctx, fileevent.UploadMovedToTrash, a, a.FileName, "id", id, "reason", c.name+" asset, option "+c.option)
+		if app.DryRun {
+			return
+		}
+		ids := []string{id}
+		if a.LivePhotoID != "" {
+			ids = append(ids, a.LivePhotoID)
+		}
+		err := app.Immich.DeleteAssets(ctx, ids, false)
+		if err != nil {
+			app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
+		}
+		return
+	}
+}
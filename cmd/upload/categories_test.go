@@ -0,0 +1,162 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+// icCategories tracks the archived uploads and the assets moved to the trash
+type icCategories struct {
+	icCatchUploadsAssets
+	archived []string
+	trashed  []string
+}
+
+func (c *icCategories) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	if a.Archived {
+		c.lock.Lock()
+		c.archived = append(c.archived, a.FileName)
+		c.lock.Unlock()
+	}
+	return c.icCatchUploadsAssets.AssetUpload(ctx, a)
+}
+
+func (c *icCategories) DeleteAssets(ctx context.Context, ids []string, force bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !force {
+		c.trashed = append(c.trashed, ids...)
+	}
+	return nil
+}
+
+func TestCategoryPolicies(t *testing.T) {
+	// Trash a photo and lock another one in a copy of the takeout. The album has already an archived photo.
+	tmp := t.TempDir()
+	album := "Google Photos/Album test 6-10-23"
+	copyDir(t, filepath.Join("TEST_DATA/Takeout1", album), filepath.Join(tmp, album))
+	for file, flag := range map[string]string{
+		"PXL_20231006_063000139.jpg.json": `"trashed": true`,
+		"PXL_20231006_063029647.jpg.json": `"inLockedFolder": true`,
+	} {
+		name := filepath.Join(tmp, album, file)
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := strings.Replace(string(b), `"title":`, flag+`, "title":`, 1)
+		err = os.WriteFile(name, []byte(s), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	trashed := album + "/PXL_20231006_063000139.jpg"
+	locked := album + "/PXL_20231006_063029647.jpg"
+	archived := album + "/PXL_20231006_063536303.jpg"
+
+	testCases := []struct {
+		name             string
+		args             []string
+		expectedUploads  int
+		expectedArchived []string
+		expectedTrashed  []string
+		expectedLocked   []string
+		expectedCounts   map[fileevent.Code]int64
+	}{
+		{
+			name:             "default policies",
+			expectedUploads:  6,
+			expectedArchived: []string{archived},
+			expectedCounts: map[fileevent.Code]int64{
+				fileevent.DiscoveredTrashed:  1,
+				fileevent.DiscoveredArchived: 1,
+				fileevent.DiscoveredLocked:   1,
+				fileevent.DiscoveredPartner:  0,
+				fileevent.UploadNotSelected:  2,
+			},
+		},
+		{
+			name:            "trash, album and import",
+			args:            []string{"-trashed-policy=trash", "-locked-policy=album:Locked", "-archived-policy=import"},
+			expectedUploads: 8,
+			expectedTrashed: []string{trashed},
+			expectedLocked:  []string{locked},
+			expectedCounts: map[fileevent.Code]int64{
+				fileevent.UploadMovedToTrash: 1,
+				fileevent.UploadNotSelected:  0,
+			},
+		},
+		{
+			name:            "discard archived",
+			args:            []string{"-archived-policy=discard"},
+			expectedUploads: 5,
+		},
+		{
+			name:            "legacy options",
+			args:            []string{"-keep-trashed", "-auto-archive=false"},
+			expectedUploads: 7,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := &icCategories{
+				icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+			}
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			jnl := fileevent.NewRecorder(log, false)
+			serv := cmd.SharedFlags{
+				Immich: ic,
+				Jnl:    jnl,
+				Log:    log,
+			}
+			err := UploadCommand(context.Background(), &serv, append(append([]string{"-no-ui", "-google-photos"}, tc.args...), tmp))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ic.assets) != tc.expectedUploads {
+				t.Errorf("expecting %d uploads, got %d", tc.expectedUploads, len(ic.assets))
+				pretty.Ldiff(t, []string{}, ic.assets)
+			}
+			if !cmpSlices(tc.expectedArchived, ic.archived) {
+				t.Errorf("unexpected archived uploads: %v", ic.archived)
+			}
+			if !cmpSlices(tc.expectedTrashed, ic.trashed) {
+				t.Errorf("unexpected trashed assets: %v", ic.trashed)
+			}
+			if !cmpSlices(tc.expectedLocked, ic.albums["Locked"]) {
+				t.Errorf("unexpected assets in the Locked album: %v", ic.albums["Locked"])
+			}
+			counts := jnl.GetCounts()
+			for c, v := range tc.expectedCounts {
+				if counts[c] != v {
+					t.Errorf("expecting %d %q events, got %d", v, c, counts[c])
+				}
+			}
+		})
+	}
+}
+
+func TestCategoryPolicyOptions(t *testing.T) {
+	ic := &icCategories{}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+	}
+	err := UploadCommand(context.Background(), &serv, []string{"-no-ui", "-trashed-policy=import", "TEST_DATA/folder/low"})
+	if err == nil {
+		t.Error("expecting an error for a policy without -google-photos")
+	}
+}
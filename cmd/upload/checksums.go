@@ -0,0 +1,102 @@
+package upload
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+)
+
+/*
+	The -compare-checksum option asks the server if it has the content of the files not found by name.
+
+	The workers' questions are gathered and sent together to the bulk endpoint: a batch is sent when each
+	worker has asked, or after checksumBatchDelay. A single worker sends one request per file.
+*/
+
+// checksumBatchDelay is the longest wait of a question for the other workers' ones
+var checksumBatchDelay = 50 * time.Millisecond
+
+// checksumBatcher gathers the checksums to check on the server
+type checksumBatcher struct {
+	ctx     context.Context // cancels the requests
+	ic      immich.ImmichInterface
+	size    int // a batch is sent once it has this size
+	lock    sync.Mutex
+	pending []checksumQuestion
+	timer   *time.Timer
+	next    int // identifies the questions
+}
+
+// checksumQuestion is a checksum waiting for the server's answer
+type checksumQuestion struct {
+	item   immich.BulkUploadCheckItem
+	answer chan checksumAnswer
+}
+
+type checksumAnswer struct {
+	result immich.BulkUploadCheckResult
+	err    error
+}
+
+func newChecksumBatcher(ctx context.Context, ic immich.ImmichInterface, size int) *checksumBatcher {
+	return &checksumBatcher{ctx: ctx, ic: ic, size: max(size, 1)}
+}
+
+// check asks the server if it has an asset with the checksum
+func (b *checksumBatcher) check(ctx context.Context, checksum string) (immich.BulkUploadCheckResult, error) {
+	answer := make(chan checksumAnswer, 1)
+	b.lock.Lock()
+	b.next++
+	b.pending = append(b.pending, checksumQuestion{
+		item:   immich.BulkUploadCheckItem{ID: strconv.Itoa(b.next), Checksum: checksum},
+		answer: answer,
+	})
+	switch {
+	case len(b.pending) >= b.size:
+		b.sendLocked()
+	case b.timer == nil:
+		b.timer = time.AfterFunc(checksumBatchDelay, func() {
+			b.lock.Lock()
+			defer b.lock.Unlock()
+			b.sendLocked()
+		})
+	}
+	b.lock.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return immich.BulkUploadCheckResult{}, ctx.Err()
+	case a := <-answer:
+		return a.result, a.err
+	}
+}
+
+// sendLocked sends the pending questions, and dispatches the answers. The lock must be held.
+func (b *checksumBatcher) sendLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	questions := b.pending
+	b.pending = nil
+	if len(questions) == 0 {
+		return
+	}
+	go func() {
+		items := make([]immich.BulkUploadCheckItem, len(questions))
+		for i, q := range questions {
+			items[i] = q.item
+		}
+		results, err := b.ic.CheckBulkUpload(b.ctx, items)
+		byID := map[string]immich.BulkUploadCheckResult{}
+		for _, r := range results {
+			byID[r.ID] = r
+		}
+		for _, q := range questions {
+			q.answer <- checksumAnswer{result: byID[q.item.ID], err: err}
+		}
+	}()
+}
@@ -0,0 +1,65 @@
+package upload
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/simulot/immich-go/immich"
+)
+
+// icCountChecks counts the bulk checks
+type icCountChecks struct {
+	icWithServerChecksums
+	lock  sync.Mutex
+	calls [][]immich.BulkUploadCheckItem
+}
+
+func (c *icCountChecks) CheckBulkUpload(ctx context.Context, items []immich.BulkUploadCheckItem) ([]immich.BulkUploadCheckResult, error) {
+	c.lock.Lock()
+	c.calls = append(c.calls, items)
+	c.lock.Unlock()
+	return c.icWithServerChecksums.CheckBulkUpload(ctx, items)
+}
+
+func TestChecksumBatcher(t *testing.T) {
+	ctx := context.Background()
+	ic := &icCountChecks{icWithServerChecksums: icWithServerChecksums{bulkChecks: map[string]string{"sum-2": "server-2"}}}
+	b := newChecksumBatcher(ctx, ic, 3)
+
+	// 3 workers ask together: one request
+	var wg sync.WaitGroup
+	results := make([]immich.BulkUploadCheckResult, 3)
+	for i, sum := range []string{"sum-1", "sum-2", "sum-3"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := b.check(ctx, sum)
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = r
+		}()
+	}
+	wg.Wait()
+	if len(ic.calls) != 1 || len(ic.calls[0]) != 3 {
+		t.Errorf("expecting one request for 3 files, got %v", ic.calls)
+	}
+	for i, r := range results {
+		if reject := r.Action == immich.BulkUploadReject; reject != (i == 1) {
+			t.Errorf("file %d: unexpected result %v", i, r)
+		}
+	}
+	if results[1].AssetID != "server-2" {
+		t.Errorf("unexpected server's asset %q", results[1].AssetID)
+	}
+
+	// A lone question is sent after the delay
+	r, err := b.check(ctx, "sum-2")
+	if err != nil || r.AssetID != "server-2" {
+		t.Errorf("unexpected result %v, %v", r, err)
+	}
+	if len(ic.calls) != 2 || len(ic.calls[1]) != 1 {
+		t.Errorf("expecting a second request for 1 file, got %v", ic.calls)
+	}
+}
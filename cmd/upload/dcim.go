@@ -0,0 +1,216 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/browser/files"
+	"github.com/simulot/immich-go/helpers/configuration"
+	"github.com/simulot/immich-go/helpers/fshelper"
+)
+
+/*
+	The -dcim option remembers the last file imported from each folder of the memory cards.
+
+	The cards are identified by files.CardID. Their numbers are kept in a JSON file beside the upload state,
+	one file per server and user. The number of a folder advances while its files are settled, in the order of
+	their numbers: the files after a failed one are read again at the next import of the card.
+	A file is settled when it's on the server, or when it's skipped on purpose.
+	A number advances once all the files sharing it are settled: the chapters of a GoPro video, the RAW and the JPEG of a photo.
+*/
+
+// CardEntry is the import state of a memory card
+type CardEntry struct {
+	Folders    map[string]int `json:"folders"` // number of the last imported file by folder
+	LastImport time.Time      `json:"lastImport"`
+}
+
+// CardFileName gives the name of the memory cards' file, beside the state file of the server and the user
+func CardFileName(configurationFile string, server string, user string) string {
+	return strings.TrimSuffix(StateFileName(configurationFile, server, user), ".jsonl") + "_cards.json"
+}
+
+// cardFolder is a folder of a memory card
+type cardFolder struct {
+	fsys fs.FS
+	dir  string
+}
+
+// folderProgress follows the import of the files of a folder
+type folderProgress struct {
+	files []cardFile      // browsed files, in browsing order
+	done  map[string]bool // by file name
+}
+
+// cardFile is a file of a memory card, with the number given by the device
+type cardFile struct {
+	name   string
+	number files.DCIMNumber
+}
+
+// CardImports keeps track of the files imported from the memory cards
+type CardImports struct {
+	lock     sync.Mutex
+	fileName string
+	readOnly bool
+	cards    map[string]*CardEntry // by card ID
+	ids      map[fs.FS]string      // card ID by file system
+	progress map[cardFolder]*folderProgress
+}
+
+// OpenCardImports reads the memory cards' file, and identifies the cards.
+// The cards are marked when their files are deleted after the import. In read only mode, the file is never written.
+func OpenCardImports(fileName string, fsyss []fs.FS, mark bool, readOnly bool) (*CardImports, error) {
+	c := &CardImports{
+		fileName: fileName,
+		readOnly: readOnly,
+		cards:    map[string]*CardEntry{},
+		ids:      map[fs.FS]string{},
+		progress: map[cardFolder]*folderProgress{},
+	}
+	b, err := os.ReadFile(fileName)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		err = json.Unmarshal(b, &c.cards)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the memory cards file %s: %w", fileName, err)
+		}
+	}
+	for _, fsys := range fsyss {
+		var id string
+		if mark {
+			id, err = files.MarkCard(fsys)
+		} else {
+			id, err = files.CardID(fsys)
+		}
+		if err != nil {
+			name := ""
+			if n, ok := fsys.(fshelper.NameFS); ok {
+				name = n.Name() + ": "
+			}
+			return nil, fmt.Errorf("%s%w", name, err)
+		}
+		c.ids[fsys] = id
+		if c.cards[id] == nil {
+			c.cards[id] = &CardEntry{Folders: map[string]int{}}
+		}
+	}
+	return c, nil
+}
+
+// Card gives the ID and the state of the card of the file system
+func (c *CardImports) Card(fsys fs.FS) (string, CardEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	id := c.ids[fsys]
+	if e, ok := c.cards[id]; ok {
+		return id, *e
+	}
+	return id, CardEntry{}
+}
+
+// LastImported gives the number of the last imported file of each folder, by file system
+func (c *CardImports) LastImported() map[fs.FS]map[string]int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	last := map[fs.FS]map[string]int{}
+	for fsys, id := range c.ids {
+		last[fsys] = map[string]int{}
+		for dir, n := range c.cards[id].Folders {
+			last[fsys][dir] = n
+		}
+	}
+	return last
+}
+
+// follow notes the order of the browsed assets, and forwards them
+func (c *CardImports) follow(ctx context.Context, in chan *browser.LocalAssetFile) chan *browser.LocalAssetFile {
+	out := make(chan *browser.LocalAssetFile)
+	go func() {
+		defer close(out)
+		for a := range in {
+			c.browsed(a)
+			select {
+			case <-ctx.Done():
+				return
+			case out <- a:
+			}
+		}
+	}()
+	return out
+}
+
+func (c *CardImports) browsed(a *browser.LocalAssetFile) {
+	n, ok := files.ParseDCIMNumber(a.FileName)
+	if !ok {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	k := cardFolder{a.FSys, path.Dir(a.FileName)}
+	p := c.progress[k]
+	if p == nil {
+		p = &folderProgress{done: map[string]bool{}}
+		c.progress[k] = p
+	}
+	p.files = append(p.files, cardFile{name: a.FileName, number: n})
+}
+
+// Done records that the file is settled: on the server, or skipped on purpose
+func (c *CardImports) Done(a *browser.LocalAssetFile) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if p := c.progress[cardFolder{a.FSys, path.Dir(a.FileName)}]; p != nil {
+		p.done[a.FileName] = true
+	}
+}
+
+// Save advances the folders' numbers, and writes the memory cards' file
+func (c *CardImports) Save() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for k, p := range c.progress {
+		e := c.cards[c.ids[k.fsys]]
+		if e == nil {
+			continue
+		}
+		last, advanced := 0, false
+		for i, f := range p.files {
+			if !p.done[f.name] {
+				break
+			}
+			if i+1 < len(p.files) && p.files[i+1].number.Number == f.number.Number {
+				// the next file sharing the number must be settled too
+				continue
+			}
+			last, advanced = f.number.Number, true
+		}
+		if advanced && last > e.Folders[k.dir] {
+			e.Folders[k.dir] = last
+			e.LastImport = time.Now()
+		}
+	}
+	if c.readOnly {
+		return nil
+	}
+	err := configuration.MakeDirForFile(c.fileName)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(c.cards, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.fileName, b, 0o600)
+}
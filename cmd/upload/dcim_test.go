@@ -0,0 +1,175 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/fileevent"
+)
+
+func TestCardImports(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"DCIM/100CANON/IMG_0001.JPG", "DCIM/100CANON/IMG_0002.JPG", "DCIM/100CANON/IMG_0003.JPG", "DCIM/101CANON/IMG_0004.JPG"} {
+		name = filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(name), 0o700)
+		if err == nil {
+			err = os.WriteFile(name, []byte(name), 0o600)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	card := os.DirFS(dir)
+	fileName := CardFileName(filepath.Join(t.TempDir(), "immich-go.json"), "http://localhost:2283", "user")
+
+	c, err := OpenCardImports(fileName, []fs.FS{card}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := c.LastImported(); len(last[card]) != 0 {
+		t.Errorf("a new card has no imported files, got %v", last)
+	}
+
+	// IMG_0002 fails: the folder 100CANON stops at IMG_0001
+	in := make(chan *browser.LocalAssetFile)
+	go func() {
+		for _, name := range []string{"DCIM/100CANON/IMG_0001.JPG", "DCIM/100CANON/IMG_0002.JPG", "DCIM/100CANON/IMG_0003.JPG", "DCIM/101CANON/IMG_0004.JPG"} {
+			in <- &browser.LocalAssetFile{FSys: card, FileName: name}
+		}
+		close(in)
+	}()
+	for a := range c.follow(ctx, in) {
+		if a.FileName != "DCIM/100CANON/IMG_0002.JPG" {
+			c.Done(a)
+		}
+	}
+	err = c.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = OpenCardImports(fileName, []fs.FS{card}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"DCIM/100CANON": 1, "DCIM/101CANON": 4}
+	if got := c.LastImported()[card]; !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if _, e := c.Card(card); e.LastImport.IsZero() {
+		t.Errorf("the date of the last import isn't recorded")
+	}
+}
+
+func TestCardImportsChapters(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	names := []string{
+		"DCIM/100GOPRO/GX010123.MP4", "DCIM/100GOPRO/GX020123.MP4",
+		"DCIM/100GOPRO/GX010124.MP4", "DCIM/100GOPRO/GX020124.MP4",
+		"DCIM/100GOPRO/GX010125.MP4",
+		"DCIM/101CANON/IMG_0001.CR3", "DCIM/101CANON/IMG_0001.JPG",
+		"DCIM/101CANON/IMG_0002.CR3", "DCIM/101CANON/IMG_0002.JPG",
+	}
+	for _, name := range names {
+		name = filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(name), 0o700)
+		if err == nil {
+			err = os.WriteFile(name, []byte(name), 0o600)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	card := os.DirFS(dir)
+	fileName := CardFileName(filepath.Join(t.TempDir(), "immich-go.json"), "http://localhost:2283", "user")
+	c, err := OpenCardImports(fileName, []fs.FS{card}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second chapter of the video 0124 fails, the JPEG of the photo 0002 fails
+	failed := map[string]bool{"DCIM/100GOPRO/GX020124.MP4": true, "DCIM/101CANON/IMG_0002.JPG": true}
+	in := make(chan *browser.LocalAssetFile)
+	go func() {
+		for _, name := range names {
+			in <- &browser.LocalAssetFile{FSys: card, FileName: name}
+		}
+		close(in)
+	}()
+	for a := range c.follow(ctx, in) {
+		if !failed[a.FileName] {
+			c.Done(a)
+		}
+	}
+	err = c.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"DCIM/100GOPRO": 123, "DCIM/101CANON": 1}
+	if got := c.LastImported()[card]; !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestUploadDCIMSkipped(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"DCIM/100CANON/IMG_0001.JPG", "DCIM/100CANON/MVI_0002.MP4", "DCIM/100CANON/IMG_0003.JPG"} {
+		name = filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(name), 0o700)
+		if err == nil {
+			err = os.WriteFile(name, []byte(name), 0o600)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	configDir := t.TempDir()
+	ic := &icCatchUploadsAssets{
+		albums: map[string][]string{},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Immich:            ic,
+		Jnl:               fileevent.NewRecorder(log, false),
+		Log:               log,
+		ConfigurationFile: filepath.Join(configDir, "immich-go.json"),
+	}
+
+	// The video in the middle of the folder is skipped on purpose: the folder advances after it
+	err := UploadCommand(context.Background(), &serv, []string{"-no-ui", "-dcim", "-exclude-types=.mp4", dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ic.assets) != 2 {
+		t.Errorf("expected 2 uploads, got %v", ic.assets)
+	}
+	cardFiles, _ := filepath.Glob(filepath.Join(configDir, "state", "*_cards.json"))
+	if len(cardFiles) != 1 {
+		t.Fatalf("expected one memory cards' file, got %v", cardFiles)
+	}
+	b, err := os.ReadFile(cardFiles[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cards := map[string]CardEntry{}
+	err = json.Unmarshal(b, &cards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, e := range cards {
+		if want := map[string]int{"DCIM/100CANON": 3}; !reflect.DeepEqual(want, e.Folders) {
+			t.Errorf("card %s: want %v, got %v", id, want, e.Folders)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/fshelper"
+)
+
+/*
+	The -delete option turns the upload into a move.
+
+	The local files are removed only when the server's asset has the same checksum than the local file.
+	The image, its live photo video and its sidecar are removed together, or kept together.
+*/
+
+// deleteLocalAsset removes the local files of the asset once the server's asset with the given ID is verified.
+// errors are logged, but not returned
+func (app *UpCmd) deleteLocalAsset(ctx context.Context, a *browser.LocalAssetFile, id string) {
+	if !app.Delete || id == "" {
+		return
+	}
+	if _, ok := a.FSys.(fshelper.Remover); !ok {
+		app.Jnl.Record(ctx, fileevent.INFO, a, a.FileName, "info", "the file can't be removed from this source, file kept")
+		return
+	}
+	if app.Quarantine != "" {
+		if _, ok := a.FSys.(fshelper.FullPathFS); !ok {
+			app.Jnl.Record(ctx, fileevent.INFO, a, a.FileName, "info", "the file can't be moved from this source, file kept")
+			return
+		}
+	}
+
+	if app.DryRun {
+		app.Jnl.Record(ctx, fileevent.UploadLocalDelete, a, a.FileName, "info", "dry run, file kept")
+		return
+	}
+
+	err := app.verifyServerAsset(ctx, a, id)
+	if err != nil {
+		app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", "can't verify the server's asset, file kept: "+err.Error())
+		return
+	}
+
+	// Release the file before removing it
+	_ = a.Close()
+	if a.LivePhoto != nil {
+		_ = a.LivePhoto.Close()
+	}
+
+	err = app.removeLocalFile(a.FSys, a.FileName)
+	if err != nil {
+		app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
+		return
+	}
+	app.Jnl.Record(ctx, fileevent.UploadLocalDelete, a.FSys, a.FileName, "quarantine", app.Quarantine)
+	if a.LivePhoto != nil {
+		err = app.removeLocalFile(a.LivePhoto.FSys, a.LivePhoto.FileName)
+		if err != nil {
+			app.Jnl.Record(ctx, fileevent.Error, a.LivePhoto, a.LivePhoto.FileName, "error", err.Error())
+		} else {
+			app.Jnl.Record(ctx, fileevent.UploadLocalDelete, a.LivePhoto, a.LivePhoto.FileName, "quarantine", app.Quarantine)
+		}
+	}
+	if a.SideCar.FileName != "" {
+		err = app.removeLocalFile(a.SideCar.FSys, a.SideCar.FileName)
+		if err != nil {
+			app.Jnl.Record(ctx, fileevent.Error, a.SideCar.FSys, a.SideCar.FileName, "error", err.Error())
+		} else {
+			app.Jnl.Record(ctx, fileevent.UploadLocalDelete, a.SideCar.FSys, a.SideCar.FileName, "quarantine", app.Quarantine)
+		}
+	}
+}
+
+// verifyServerAsset checks that the server's asset and its live photo video have the same checksum than the local files
+func (app *UpCmd) verifyServerAsset(ctx context.Context, a *browser.LocalAssetFile, id string) error {
+	sum, err := a.ComputeChecksum()
+	if err != nil {
+		return err
+	}
+	sa, err := app.Immich.GetAssetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if sa.IsTrashed {
+		return fmt.Errorf("the server's asset %s is in the trash", id)
+	}
+	if !sameChecksum(sum, sa.Checksum) {
+		return fmt.Errorf("the server's asset %s has a different checksum", id)
+	}
+	if a.LivePhoto != nil {
+		if sa.LivePhotoVideoID == "" {
+			return fmt.Errorf("the server's asset %s has no live photo video", id)
+		}
+		return app.verifyServerAsset(ctx, a.LivePhoto, sa.LivePhotoVideoID)
+	}
+	return nil
+}
+
+// removeLocalFile deletes the file, or moves it into the quarantine folder
+func (app *UpCmd) removeLocalFile(fsys fs.FS, name string) error {
+	if app.Quarantine == "" {
+		return fshelper.Remove(fsys, name)
+	}
+	fp, ok := fsys.(fshelper.FullPathFS)
+	if !ok {
+		return fmt.Errorf("can't move %s into the quarantine folder", name)
+	}
+	dst := filepath.Join(app.Quarantine, filepath.FromSlash(name))
+	if fsys, ok := fsys.(fshelper.NameFS); ok {
+		dst = filepath.Join(app.Quarantine, fsys.Name(), filepath.FromSlash(name))
+	}
+	return fshelper.MoveFile(fp.FullPath(name), dst)
+}
+
+// sameChecksum compares SHA-1 given in base64 or in hex
+func sameChecksum(a, b string) bool {
+	da, db := decodeChecksum(a), decodeChecksum(b)
+	return len(da) > 0 && bytes.Equal(da, db)
+}
+
+func decodeChecksum(s string) []byte {
+	if len(s) == 40 {
+		if b, err := hex.DecodeString(s); err == nil {
+			return b
+		}
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,182 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+// icVerifyUploads keeps the checksum of uploaded files like the server does
+type icVerifyUploads struct {
+	icCatchUploadsAssets
+	checksums map[string]string
+	corrupted string // this asset's checksum is wrong
+}
+
+func (c *icVerifyUploads) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	sum, err := a.ComputeChecksum()
+	if err != nil {
+		return immich.AssetResponse{}, err
+	}
+	r, err := c.icCatchUploadsAssets.AssetUpload(ctx, a)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.checksums[r.ID] = sum
+	return r, err
+}
+
+func (c *icVerifyUploads) GetAssetByID(ctx context.Context, id string) (*immich.Asset, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	sum := c.checksums[id]
+	if id == c.corrupted {
+		sum = "AAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	}
+	return &immich.Asset{ID: id, Checksum: sum}, nil
+}
+
+func TestUploadDelete(t *testing.T) {
+	testCases := []struct {
+		name       string
+		args       []string
+		quarantine bool
+		expectErr  bool     // the corrupted file is reported
+		expected   []string // files left in the folder
+	}{
+		{
+			name:      "delete",
+			args:      []string{"-delete"},
+			expectErr: true,
+			expected:  []string{"PXL_20231006_063029647.jpg"},
+		},
+		{
+			name:       "quarantine",
+			args:       []string{"-delete"},
+			quarantine: true,
+			expectErr:  true,
+			expected:   []string{"PXL_20231006_063029647.jpg"},
+		},
+		{
+			name: "dry run",
+			args: []string{"-delete", "-dry-run"},
+			expected: []string{
+				"PXL_20231006_063000139.jpg",
+				"PXL_20231006_063029647.jpg",
+				"PXL_20231006_063108407.jpg",
+				"PXL_20231006_063121958.jpg",
+				"PXL_20231006_063357420.jpg",
+			},
+		},
+		{
+			name: "no delete",
+			args: []string{},
+			expected: []string{
+				"PXL_20231006_063000139.jpg",
+				"PXL_20231006_063029647.jpg",
+				"PXL_20231006_063108407.jpg",
+				"PXL_20231006_063121958.jpg",
+				"PXL_20231006_063357420.jpg",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			dir := filepath.Join(tmp, "AlbumA")
+			copyDir(t, "TEST_DATA/folder/high/AlbumA", dir)
+
+			args := tc.args
+			quarantine := filepath.Join(tmp, "quarantine")
+			if tc.quarantine {
+				args = append(args, "-quarantine", quarantine)
+			}
+
+			ic := &icVerifyUploads{
+				icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+				checksums:            map[string]string{},
+				corrupted:            "PXL_20231006_063029647.jpg",
+			}
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			serv := cmd.SharedFlags{
+				Immich: ic,
+				Jnl:    fileevent.NewRecorder(log, false),
+				Log:    log,
+			}
+			err := UploadCommand(context.Background(), &serv, append(append([]string{"-no-ui"}, args...), dir))
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			left := listDir(t, dir)
+			if !cmpSlices(tc.expected, left) {
+				t.Errorf("unexpected files left in the folder")
+				pretty.Ldiff(t, tc.expected, left)
+			}
+			if tc.quarantine {
+				moved := listDir(t, filepath.Join(quarantine, "AlbumA"))
+				if len(moved) != 4 {
+					t.Errorf("expected 4 files in the quarantine, got %v", moved)
+				}
+			}
+		})
+	}
+}
+
+func copyDir(t *testing.T, src, dst string) {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(dst, 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(src, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dst, e.Name()), b, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func listDir(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := []string{}
+	for _, e := range entries {
+		l = append(l, e.Name())
+	}
+	sort.Strings(l)
+	return l
+}
+
+func TestSameChecksum(t *testing.T) {
+	b64 := "qUqP5cyxm6YcTAhz05Hph5gvu9M="
+	hex := "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"
+	if !sameChecksum(b64, hex) || !sameChecksum(hex, b64) || !sameChecksum(b64, b64) {
+		t.Errorf("checksums should be the same")
+	}
+	if sameChecksum(b64, "") || sameChecksum("", "") {
+		t.Errorf("empty checksums can't be the same")
+	}
+}
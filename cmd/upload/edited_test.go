@@ -0,0 +1,137 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/fileevent"
+)
+
+// icCatchStacks tracks the stacks
+type icCatchStacks struct {
+	icCatchUploadsAssets
+	stacks map[string][]string // cover -> stacked assets
+}
+
+func (c *icCatchStacks) StackAssets(ctx context.Context, cover string, ids []string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.stacks[cover] = append(c.stacks[cover], ids...)
+	return nil
+}
+
+func TestEditedVersions(t *testing.T) {
+	// Add an edited version in a copy of the takeout
+	tmp := t.TempDir()
+	album := "Google Photos/Album test 6-10-23"
+	copyDir(t, filepath.Join("TEST_DATA/Takeout1", album), filepath.Join(tmp, album))
+	b, err := os.ReadFile(filepath.Join(tmp, album, "PXL_20231006_063000139.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(tmp, album, "PXL_20231006_063000139-modifié.jpg"), append(b, 0), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := album + "/PXL_20231006_063000139.jpg"
+	edited := album + "/PXL_20231006_063000139-modifié.jpg"
+
+	testCases := []struct {
+		name           string
+		args           []string
+		expectedStacks map[string][]string
+		uploaded       []string
+		notUploaded    []string
+	}{
+		{
+			name:           "all",
+			args:           []string{},
+			expectedStacks: map[string][]string{},
+			uploaded:       []string{original, edited},
+		},
+		{
+			name:           "stack-edited",
+			args:           []string{"-edited-versions=stack-edited"},
+			expectedStacks: map[string][]string{edited: {original}},
+			uploaded:       []string{original, edited},
+		},
+		{
+			name:           "stack-original",
+			args:           []string{"-edited-versions=stack-original"},
+			expectedStacks: map[string][]string{original: {edited}},
+			uploaded:       []string{original, edited},
+		},
+		{
+			name:           "edited",
+			args:           []string{"-edited-versions=edited"},
+			expectedStacks: map[string][]string{},
+			uploaded:       []string{edited},
+			notUploaded:    []string{original},
+		},
+		{
+			name:           "original",
+			args:           []string{"-edited-versions=original"},
+			expectedStacks: map[string][]string{},
+			uploaded:       []string{original},
+			notUploaded:    []string{edited},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := &icCatchStacks{
+				icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+				stacks:               map[string][]string{},
+			}
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			serv := cmd.SharedFlags{
+				Immich: ic,
+				Jnl:    fileevent.NewRecorder(log, false),
+				Log:    log,
+			}
+			err := UploadCommand(context.Background(), &serv, append(append([]string{"-no-ui", "-google-photos"}, tc.args...), tmp))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmpAlbums(tc.expectedStacks, ic.stacks) {
+				t.Errorf("unexpected stacks")
+				pretty.Ldiff(t, tc.expectedStacks, ic.stacks)
+			}
+			for _, f := range tc.uploaded {
+				if !slices.Contains(ic.assets, f) {
+					t.Errorf("%s should be uploaded", f)
+				}
+			}
+			for _, f := range tc.notUploaded {
+				if slices.Contains(ic.assets, f) {
+					t.Errorf("%s should not be uploaded", f)
+				}
+			}
+		})
+	}
+}
+
+func TestEditedVersionsOptions(t *testing.T) {
+	for _, args := range [][]string{
+		{"-edited-versions=stack-edited", "."},
+		{"-google-photos", "-edited-versions=newest", "."},
+	} {
+		ic := &icCatchStacks{}
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		serv := cmd.SharedFlags{
+			Immich: ic,
+			Jnl:    fileevent.NewRecorder(log, false),
+			Log:    log,
+		}
+		err := UploadCommand(context.Background(), &serv, append([]string{"-no-ui"}, args...))
+		if err == nil {
+			t.Errorf("expecting an error with %v", args)
+		}
+	}
+}
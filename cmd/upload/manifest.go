@@ -0,0 +1,104 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/browser/gp"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/gen"
+)
+
+// updateFromManifest applies the changes of an asset imported from a previous takeout, without uploading it again:
+// flags are updated, the asset is added to the albums it has joined, and its people are applied.
+func (app *UpCmd) updateFromManifest(ctx context.Context, a *browser.LocalAssetFile, e gp.ManifestAsset) {
+	app.Jnl.Record(ctx, fileevent.UploadResumed, a, a.FileName, "reason", "imported from a previous takeout", "id", e.ID)
+	app.updateFlags(ctx, a, e.ID, e.Favorite, e.Archived)
+
+	joined := *a
+	joined.Albums = gen.Filter(a.Albums, func(al browser.LocalAlbum) bool {
+		return !slices.Contains(e.Albums, app.createdAlbumName(al))
+	})
+	app.manageAssetAlbum(ctx, e.ID, &joined, &Advice{})
+	app.managePeople(ctx, e.ID, a)
+	app.recordManifest(a, e.ID)
+}
+
+// updateFlags sets the favorite and archived flags of the server's asset like in the takeout
+func (app *UpCmd) updateFlags(ctx context.Context, a *browser.LocalAssetFile, id string, favorite bool, archived bool) {
+	isFavorite := a.Favorite
+	isArchived := a.Archived
+	if !app.AutoArchive {
+		isArchived = archived
+	}
+	if isFavorite == favorite && isArchived == archived {
+		return
+	}
+	app.Jnl.Record(ctx, fileevent.UploadUpdated, a, a.FileName, "id", id, "favorite", isFavorite, "archived", isArchived)
+	if app.DryRun {
+		return
+	}
+	err := app.Immich.UpdateAssets(ctx, []string{id}, isArchived, isFavorite, 0, 0, false, "")
+	if err != nil {
+		app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
+	}
+}
+
+// recordManifest records the imported asset into the takeout manifest
+func (app *UpCmd) recordManifest(a *browser.LocalAssetFile, id string) {
+	if app.manifest == nil {
+		return
+	}
+	e := gp.ManifestAsset{
+		ID:       id,
+		File:     a.FileName,
+		Favorite: a.Favorite,
+		Archived: a.Archived && app.AutoArchive,
+	}
+	if app.CreateAlbums {
+		for _, al := range a.Albums {
+			if name := app.createdAlbumName(al); !slices.Contains(e.Albums, name) {
+				e.Albums = append(e.Albums, name)
+			}
+		}
+	}
+	app.manifest.Set(gp.ManifestKey(a), e)
+}
+
+// closeManifest removes the assets from the albums they have left since the previous import,
+// and saves the manifest for the next import
+func (app *UpCmd) closeManifest(ctx context.Context) error {
+	if app.CreateAlbums {
+		for album, keys := range app.manifest.RemovedAlbums() {
+			app.albumsLock.Lock()
+			al, exist := app.albums[album]
+			app.albumsLock.Unlock()
+			if !exist {
+				continue
+			}
+			var ids []string
+			for _, k := range keys {
+				e, _ := app.manifest.Asset(k)
+				app.Jnl.Record(ctx, fileevent.UploadRemoveFromAlbum, nil, e.File, "album", album, "id", e.ID, "reason", "not in the album anymore")
+				ids = append(ids, e.ID)
+			}
+			if app.DryRun {
+				continue
+			}
+			_, err := app.Immich.RemoveAssetFromAlbum(ctx, al.ID, ids)
+			if err != nil {
+				app.Log.Error(fmt.Sprintf("Can't remove assets from the album %s: %s", album, err))
+			}
+		}
+	}
+	if app.DryRun {
+		return nil
+	}
+	err := app.manifest.Write(app.TakeoutManifest)
+	if err != nil {
+		return fmt.Errorf("can't write the takeout manifest: %w", err)
+	}
+	return nil
+}
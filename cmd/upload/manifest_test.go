@@ -0,0 +1,168 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/simulot/immich-go/browser/gp"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+// icManifest keeps the albums from a run to the next, and tracks the updates
+type icManifest struct {
+	icCatchUploadsAssets
+	removed map[string][]string // album -> assets
+	updated []string            // asset:favorite:archived
+}
+
+func (c *icManifest) GetAllAlbums(context.Context) ([]immich.AlbumSimplified, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var albums []immich.AlbumSimplified
+	for name := range c.albums {
+		albums = append(albums, immich.AlbumSimplified{ID: name, AlbumName: name})
+	}
+	return albums, nil
+}
+
+func (c *icManifest) RemoveAssetFromAlbum(ctx context.Context, album string, ids []string) ([]immich.UpdateAlbumResult, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.removed[album] = append(c.removed[album], ids...)
+	return nil, nil
+}
+
+func (c *icManifest) UpdateAssets(ctx context.Context, ids []string, isArchived bool, isFavorite bool, latitude float64, longitude float64, removeParent bool, stackParentID string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, id := range ids {
+		c.updated = append(c.updated, fmt.Sprintf("%s:%v:%v", id, isFavorite, isArchived))
+	}
+	return nil
+}
+
+// reset forgets what has been done by the previous run, and keeps the albums
+func (c *icManifest) reset() {
+	c.assets = nil
+	c.removed = map[string][]string{}
+	c.updated = nil
+	for k := range c.albums {
+		c.albums[k] = nil
+	}
+}
+
+func TestTakeoutManifest(t *testing.T) {
+	tmp := t.TempDir()
+	takeout := filepath.Join(tmp, "takeout")
+	album := "Google Photos/Album test 6-10-23"
+	copyDir(t, filepath.Join("TEST_DATA/Takeout1", album), filepath.Join(takeout, album))
+	manifest := filepath.Join(tmp, "manifest.json")
+	albumTitle := "Album test 6/10/23"
+	photo1 := album + "/PXL_20231006_063000139.jpg"
+	photo2 := album + "/PXL_20231006_063029647.jpg"
+
+	ic := &icManifest{
+		icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+	}
+	run := func(t *testing.T) {
+		ic.reset()
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		serv := cmd.SharedFlags{
+			Immich: ic,
+			Jnl:    fileevent.NewRecorder(log, false),
+			Log:    log,
+		}
+		err := UploadCommand(context.Background(), &serv, []string{"-no-ui", "-google-photos", "-takeout-manifest=" + manifest, takeout})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// First import: everything is uploaded, and the manifest is written
+	run(t)
+	if len(ic.assets) != 8 {
+		t.Fatalf("expecting 8 uploads, got %d", len(ic.assets))
+	}
+	m, err := gp.ReadManifest(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Assets) != 8 || len(m.Matches) == 0 {
+		t.Fatalf("unexpected manifest: %d assets, %d matches", len(m.Assets), len(m.Matches))
+	}
+
+	// Second import: photo1 is now a favorite, and photo2 has joined another album
+	jsonFile := filepath.Join(takeout, photo1+".json")
+	b, err := os.ReadFile(jsonFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(jsonFile, []byte(strings.Replace(string(b), `"title":`, `"favorited": true, "title":`, 1)), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(takeout, "Google Photos/Other")
+	copyFile(t, filepath.Join(takeout, photo2), filepath.Join(other, "PXL_20231006_063029647.jpg"))
+	copyFile(t, filepath.Join(takeout, photo2+".json"), filepath.Join(other, "PXL_20231006_063029647.jpg.json"))
+	err = os.WriteFile(filepath.Join(other, "metadata.json"), []byte(`{"title": "Other", "date": {"timestamp": "1697872351"}}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run(t)
+	if len(ic.assets) != 0 {
+		t.Errorf("expecting no upload, got %v", ic.assets)
+	}
+	if !cmpSlices([]string{photo1 + ":true:false"}, ic.updated) {
+		t.Errorf("unexpected updates: %v", ic.updated)
+	}
+	expectedAlbums := map[string][]string{albumTitle: nil, "Other": {photo2}}
+	if !cmpAlbums(expectedAlbums, ic.albums) {
+		t.Errorf("unexpected albums")
+		pretty.Ldiff(t, expectedAlbums, ic.albums)
+	}
+
+	// Third import: photo2 has left the first album
+	err = os.Remove(filepath.Join(takeout, photo2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Remove(filepath.Join(takeout, photo2+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run(t)
+	if len(ic.assets) != 0 || len(ic.updated) != 0 {
+		t.Errorf("expecting no upload and no update, got %v, %v", ic.assets, ic.updated)
+	}
+	expectedRemoved := map[string][]string{albumTitle: {photo2}}
+	if !cmpAlbums(expectedRemoved, ic.removed) {
+		t.Errorf("unexpected removals")
+		pretty.Ldiff(t, expectedRemoved, ic.removed)
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	b, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Dir(dst), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(dst, b, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -42,6 +42,11 @@ func (app *UpCmd) runNoUI(ctx context.Context) error {
 			immichPct = 100
 		}
 
+		paused := ""
+		if m := app.pausedMessage(); m != "" {
+			paused = ", " + m
+		}
+
 		if app.GooglePhotos {
 			gpTotal := app.Jnl.TotalAssets()
 			gpProcessed := app.Jnl.TotalProcessedGP()
@@ -54,11 +59,11 @@ func (app *UpCmd) runNoUI(ctx context.Context) error {
 			upTotal := app.Jnl.TotalAssets()
 			upPercent := 100 * upProcessed / upTotal
 
-			return fmt.Sprintf("\rImmich read %d%%, Assets found: %d, Google Photos Analysis: %d%%, Upload errors: %d, Uploaded %d%% %s",
-				immichPct, app.Jnl.TotalAssets(), gpPercent, counts[fileevent.UploadServerError], upPercent, string(spinner[spinIdx]))
+			return fmt.Sprintf("\rImmich read %d%%, Assets found: %d, Google Photos Analysis: %d%%, Upload errors: %d, Uploaded %d%%%s %s",
+				immichPct, app.Jnl.TotalAssets(), gpPercent, counts[fileevent.UploadServerError], upPercent, paused, string(spinner[spinIdx]))
 		}
 
-		return fmt.Sprintf("\rImmich read %d%%, Assets found: %d, Upload errors: %d, Uploaded %d %s", immichPct, app.Jnl.TotalAssets(), counts[fileevent.UploadServerError], counts[fileevent.Uploaded], string(spinner[spinIdx]))
+		return fmt.Sprintf("\rImmich read %d%%, Assets found: %d, Upload errors: %d, Uploaded %d%s %s", immichPct, app.Jnl.TotalAssets(), counts[fileevent.UploadServerError], counts[fileevent.Uploaded], paused, string(spinner[spinIdx]))
 	}
 	uiGrp := errgroup.Group{}
 
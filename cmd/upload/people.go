@@ -0,0 +1,182 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+// peopleTag is the parent of the tags given to the people without face region
+const peopleTag = "People"
+
+// managePeople tags the asset with its people.
+// The people are matched by name with the server's people, and created when missing.
+// A person with a known face region is added to the asset with this face. The other
+// people are given as the tag People/<name>, since Immich needs the face's position.
+//
+// The people already on the asset are kept, the asset can be already on the server.
+// errors are logged, but not returned. It tells if all the people have been applied.
+func (app *UpCmd) managePeople(ctx context.Context, assetID string, a *browser.LocalAssetFile) bool {
+	if !app.ImportPeople {
+		return false
+	}
+	done := true
+	var faces []immich.Face
+	facesRead := false
+	for _, person := range a.People {
+		if person.Region == nil {
+			tag := peopleTag + "/" + person.Name
+			app.Jnl.Record(ctx, fileevent.UploadAddToPerson, a.FSys, a.FileName, "person", person.Name, "tag", tag)
+			if app.DryRun {
+				continue
+			}
+			id, err := app.getPeopleTag(ctx, tag)
+			if err == nil {
+				err = app.Immich.TagAssets(ctx, id, []string{assetID})
+			}
+			if err != nil {
+				app.Jnl.Record(ctx, fileevent.Error, a.FSys, a.FileName, "person", person.Name, "error", err.Error())
+				done = false
+			}
+			continue
+		}
+
+		if app.DryRun {
+			app.Jnl.Record(ctx, fileevent.UploadAddToPerson, a.FSys, a.FileName, "person", person.Name)
+			continue
+		}
+		p, err := app.getPerson(ctx, person.Name)
+		if err == nil && !facesRead {
+			faces, err = app.Immich.GetAssetFaces(ctx, assetID)
+			facesRead = err == nil
+		}
+		if err == nil && slices.ContainsFunc(faces, func(f immich.Face) bool { return f.Person != nil && f.Person.ID == p.ID }) {
+			continue
+		}
+		if err == nil {
+			app.Jnl.Record(ctx, fileevent.UploadAddToPerson, a.FSys, a.FileName, "person", person.Name)
+			err = app.Immich.AddAssetToPerson(ctx, assetID, p.ID, *person.Region)
+		}
+		if err != nil {
+			app.Jnl.Record(ctx, fileevent.Error, a.FSys, a.FileName, "person", person.Name, "error", err.Error())
+			done = false
+		}
+	}
+	return done
+}
+
+// getPeopleTag returns the ID of the tag, and creates it when missing
+func (app *UpCmd) getPeopleTag(ctx context.Context, name string) (string, error) {
+	key := personKey(name)
+	app.peopleLock.Lock()
+	id, ok := app.peopleTags[key]
+	app.peopleLock.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	v, err, _ := app.peopleCreation.Do("tag:"+key, func() (any, error) {
+		app.peopleLock.Lock()
+		id, ok := app.peopleTags[key]
+		app.peopleLock.Unlock()
+		if ok {
+			return id, nil
+		}
+		tags, err := app.Immich.UpsertTags(ctx, []string{name})
+		if err != nil {
+			return nil, err
+		}
+		if len(tags) == 0 {
+			return nil, fmt.Errorf("the tag %q hasn't been created", name)
+		}
+		app.peopleLock.Lock()
+		if app.peopleTags == nil {
+			app.peopleTags = map[string]string{}
+		}
+		app.peopleTags[key] = tags[0].ID
+		app.peopleLock.Unlock()
+		return tags[0].ID, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// getPerson returns the server's person with the given name, and creates it when missing
+//
+// The people cache is locked only to read and update it. The people are read once, and a person is created once:
+// the workers needing a person being created wait for its creation.
+func (app *UpCmd) getPerson(ctx context.Context, name string) (immich.Person, error) {
+	key := personKey(name)
+	app.peopleLock.Lock()
+	loaded := app.people != nil
+	p, exist := app.people[key]
+	app.peopleLock.Unlock()
+	if exist {
+		return p, nil
+	}
+
+	if !loaded {
+		_, err, _ := app.peopleCreation.Do("people", func() (any, error) {
+			app.peopleLock.Lock()
+			loaded := app.people != nil
+			app.peopleLock.Unlock()
+			if loaded {
+				return nil, nil
+			}
+			people, err := app.Immich.GetAllPeople(ctx)
+			if err != nil {
+				return nil, err
+			}
+			byName := map[string]immich.Person{}
+			for _, p := range people {
+				if p.Name == "" {
+					continue
+				}
+				if _, exist := byName[personKey(p.Name)]; !exist {
+					byName[personKey(p.Name)] = p
+				}
+			}
+			app.peopleLock.Lock()
+			app.people = byName
+			app.peopleLock.Unlock()
+			return nil, nil
+		})
+		if err != nil {
+			return immich.Person{}, err
+		}
+	}
+
+	v, err, _ := app.peopleCreation.Do("person:"+key, func() (any, error) {
+		// The person may have been read or created by a worker in the meantime
+		app.peopleLock.Lock()
+		p, exist := app.people[key]
+		app.peopleLock.Unlock()
+		if exist {
+			return p, nil
+		}
+		p, err := app.Immich.CreatePerson(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		app.peopleLock.Lock()
+		app.people[key] = p
+		app.peopleLock.Unlock()
+		return p, nil
+	})
+	if err != nil {
+		return immich.Person{}, err
+	}
+	return v.(immich.Person), nil
+}
+
+// personKey matches the names regardless of the case and the spaces
+func personKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
@@ -0,0 +1,287 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kr/pretty"
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+// icPeople knows Alice, and tracks the people created, the faces and the tags added to the assets
+type icPeople struct {
+	icCatchUploadsAssets
+	created []string
+	faces   map[string][]immich.Face // asset ID -> faces
+	regions map[string]browser.FaceRegion
+	tagged  map[string][]string // tag ID -> assets
+}
+
+func (c *icPeople) GetAllPeople(ctx context.Context) ([]immich.Person, error) {
+	return []immich.Person{{ID: "alice-id", Name: "Alice"}}, nil
+}
+
+func (c *icPeople) CreatePerson(ctx context.Context, name string) (immich.Person, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.created = append(c.created, name)
+	return immich.Person{ID: name + "-id", Name: name}, nil
+}
+
+func (c *icPeople) GetAssetFaces(ctx context.Context, assetID string) ([]immich.Face, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.faces[assetID], nil
+}
+
+func (c *icPeople) AddAssetToPerson(ctx context.Context, assetID string, personID string, region browser.FaceRegion) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.faces[assetID] = append(c.faces[assetID], immich.Face{ID: assetID + "/" + personID, Person: &immich.Person{ID: personID}})
+	c.regions[assetID+"/"+personID] = region
+	return nil
+}
+
+func (c *icPeople) UpsertTags(ctx context.Context, names []string) ([]immich.Tag, error) {
+	var tags []immich.Tag
+	for _, n := range names {
+		tags = append(tags, immich.Tag{ID: n, Name: path.Base(n), Value: n})
+	}
+	return tags, nil
+}
+
+func (c *icPeople) TagAssets(ctx context.Context, tagID string, assetIDs []string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.tagged[tagID] = append(c.tagged[tagID], assetIDs...)
+	return nil
+}
+
+func newICPeople() *icPeople {
+	return &icPeople{
+		icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+		faces:                map[string][]immich.Face{},
+		regions:              map[string]browser.FaceRegion{},
+		tagged:               map[string][]string{},
+	}
+}
+
+// takeoutWithPeople tags people in a copy of the takeout
+func takeoutWithPeople(t *testing.T) (string, string) {
+	tmp := t.TempDir()
+	album := "Google Photos/Album test 6-10-23"
+	copyDir(t, filepath.Join("TEST_DATA/Takeout1", album), filepath.Join(tmp, album))
+	for file, people := range map[string]string{
+		"PXL_20231006_063000139.jpg.json": `[{"name": "Alice"}, {"name": "Bob"}]`,
+		"PXL_20231006_063029647.jpg.json": `[{"name": "Alice "}]`,
+	} {
+		name := filepath.Join(tmp, album, file)
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := strings.Replace(string(b), `"title":`, `"people": `+people+`, "title":`, 1)
+		err = os.WriteFile(name, []byte(s), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tmp, album
+}
+
+func TestUploadPeople(t *testing.T) {
+	tmp, album := takeoutWithPeople(t)
+
+	testCases := []struct {
+		name           string
+		args           []string
+		expectedTagged map[string][]string
+	}{
+		{
+			name: "people",
+			args: []string{"-people"},
+			expectedTagged: map[string][]string{
+				"People/Alice": {album + "/PXL_20231006_063000139.jpg", album + "/PXL_20231006_063029647.jpg"},
+				"People/Bob":   {album + "/PXL_20231006_063000139.jpg"},
+			},
+		},
+		{
+			name:           "no people",
+			args:           []string{},
+			expectedTagged: map[string][]string{},
+		},
+		{
+			name:           "dry run",
+			args:           []string{"-people", "-dry-run"},
+			expectedTagged: map[string][]string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := newICPeople()
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			serv := cmd.SharedFlags{
+				Immich: ic,
+				Jnl:    fileevent.NewRecorder(log, false),
+				Log:    log,
+			}
+			err := UploadCommand(context.Background(), &serv, append(append([]string{"-no-ui", "-google-photos"}, tc.args...), tmp))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ic.created) > 0 || len(ic.regions) > 0 {
+				t.Errorf("no face is expected without the face regions: created %v, faces %v", ic.created, ic.regions)
+			}
+			if !cmpAlbums(tc.expectedTagged, ic.tagged) {
+				t.Errorf("unexpected tagged assets")
+				pretty.Ldiff(t, tc.expectedTagged, ic.tagged)
+			}
+		})
+	}
+}
+
+// TestUploadPeopleResumed checks that the people are applied to the assets handled by a previous run
+func TestUploadPeopleResumed(t *testing.T) {
+	tmp, album := takeoutWithPeople(t)
+	configFile := filepath.Join(t.TempDir(), "immich-go.json")
+
+	run := func(args ...string) *icPeople {
+		ic := newICPeople()
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		serv := cmd.SharedFlags{
+			Immich:            ic,
+			Jnl:               fileevent.NewRecorder(log, false),
+			Log:               log,
+			ConfigurationFile: configFile,
+		}
+		err := UploadCommand(context.Background(), &serv, append(append([]string{"-no-ui", "-google-photos", "-resume"}, args...), tmp))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ic
+	}
+
+	ic := run()
+	if len(ic.assets) == 0 || len(ic.tagged) > 0 {
+		t.Fatalf("the first run should upload the assets without their people")
+	}
+	ic = run("-people")
+	if len(ic.assets) > 0 {
+		t.Errorf("the second run should not upload again, got %v", ic.assets)
+	}
+	expected := map[string][]string{
+		"People/Alice": {album + "/PXL_20231006_063000139.jpg", album + "/PXL_20231006_063029647.jpg"},
+		"People/Bob":   {album + "/PXL_20231006_063000139.jpg"},
+	}
+	if !cmpAlbums(expected, ic.tagged) {
+		t.Errorf("the people should be applied to the resumed assets")
+		pretty.Ldiff(t, expected, ic.tagged)
+	}
+	ic = run("-people")
+	if len(ic.tagged) > 0 {
+		t.Errorf("the people are already applied, got %v", ic.tagged)
+	}
+}
+
+func TestManagePeopleRegions(t *testing.T) {
+	ic := newICPeople()
+	ic.faces["asset"] = []immich.Face{{ID: "face", Person: &immich.Person{ID: "alice-id"}}}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	app := &UpCmd{
+		SharedFlags:  &cmd.SharedFlags{Immich: ic, Jnl: fileevent.NewRecorder(log, false), Log: log},
+		ImportPeople: true,
+	}
+	region := browser.FaceRegion{X: 0.1, Y: 0.2, Width: 0.3, Height: 0.4}
+	a := &browser.LocalAssetFile{
+		FileName: "photo.jpg",
+		People: []browser.Person{
+			{Name: "alice", Region: &region}, // already on the asset
+			{Name: "Bob", Region: &region},
+			{Name: "Carol"},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if !app.managePeople(context.Background(), "asset", a) {
+			t.Fatalf("the people should be applied")
+		}
+	}
+	if !cmpSlices([]string{"Bob"}, ic.created) {
+		t.Errorf("unexpected people created: %v", ic.created)
+	}
+	expectedRegions := map[string]browser.FaceRegion{"asset/Bob-id": region}
+	if !reflect.DeepEqual(expectedRegions, ic.regions) {
+		t.Errorf("unexpected faces: %v", ic.regions)
+	}
+	if len(ic.faces["asset"]) != 2 {
+		t.Errorf("the faces should be added once: %v", ic.faces["asset"])
+	}
+	if want := []string{"asset", "asset"}; !reflect.DeepEqual(want, ic.tagged["People/Carol"]) {
+		t.Errorf("unexpected tagged assets: %v", ic.tagged)
+	}
+}
+
+// icSlowPeople waits for the release before creating a person
+type icSlowPeople struct {
+	*icPeople
+	release chan struct{}
+}
+
+func (c *icSlowPeople) CreatePerson(ctx context.Context, name string) (immich.Person, error) {
+	<-c.release
+	return c.icPeople.CreatePerson(ctx, name)
+}
+
+func TestGetPersonConcurrent(t *testing.T) {
+	ic := &icSlowPeople{icPeople: newICPeople(), release: make(chan struct{})}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	app := &UpCmd{
+		SharedFlags:  &cmd.SharedFlags{Immich: ic, Jnl: fileevent.NewRecorder(log, false), Log: log},
+		ImportPeople: true,
+	}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := app.getPerson(ctx, "Bob")
+			if err != nil || p.ID != "Bob-id" {
+				t.Errorf("unexpected person %v, %v", p, err)
+			}
+		}()
+	}
+
+	// The known people are given while a person is being created
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p, err := app.getPerson(ctx, "alice")
+		if err != nil || p.ID != "alice-id" {
+			t.Errorf("unexpected person %v, %v", p, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the people are locked during the creation of a person")
+	}
+
+	close(ic.release)
+	wg.Wait()
+	if !cmpSlices([]string{"Bob"}, ic.created) {
+		t.Errorf("the person should be created once: %v", ic.created)
+	}
+}
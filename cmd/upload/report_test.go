@@ -0,0 +1,135 @@
+package upload
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+func TestUploadReport(t *testing.T) {
+	tmp := t.TempDir()
+	for _, name := range []string{"report.json", "report.csv", "report.html"} {
+		t.Run(name, func(t *testing.T) {
+			ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			serv := cmd.SharedFlags{
+				Immich: ic,
+				Jnl:    fileevent.NewRecorder(log, false),
+				Log:    log,
+			}
+			report := filepath.Join(tmp, name)
+			err := UploadCommand(context.Background(), &serv, []string{"-no-ui", "-create-album-folder", "-report", report, "TEST_DATA/folder/high"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(report)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch filepath.Ext(name) {
+			case ".json":
+				var records []fileevent.FileRecord
+				err = json.Unmarshal(b, &records)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(records) != 8 {
+					t.Fatalf("expected 8 records, got %d", len(records))
+				}
+				r := records[0]
+				if r.File != "AlbumA/PXL_20231006_063000139.jpg" || r.Outcome != fileevent.Uploaded.String() || r.ID != r.File || len(r.Albums) != 1 || r.Albums[0] != "AlbumA" {
+					t.Errorf("unexpected record: %#v", r)
+				}
+			case ".csv":
+				lines, err := csv.NewReader(strings.NewReader(string(b))).ReadAll()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(lines) != 9 || lines[0][0] != "file" || lines[8][0] != "AlbumB/PXL_20231006_063851485.jpg" || lines[8][3] != "AlbumB" {
+					t.Errorf("unexpected csv report: %v", lines)
+				}
+			case ".html":
+				if !strings.Contains(string(b), "<td>AlbumB/PXL_20231006_063851485.jpg</td><td>uploaded</td>") {
+					t.Errorf("unexpected html report: %s", b)
+				}
+			}
+		})
+	}
+
+	_, err := newCommand(context.Background(), &cmd.SharedFlags{}, []string{"-report", "report.txt", "TEST_DATA/folder/high"}, nil)
+	if err == nil {
+		t.Errorf("expected an error for the report format")
+	}
+}
+
+// icFailAlbums can't create the albums
+type icFailAlbums struct {
+	icCatchUploadsAssets
+}
+
+func (c *icFailAlbums) CreateAlbum(ctx context.Context, album string, description string, ids []string) (immich.AlbumSimplified, error) {
+	return immich.AlbumSimplified{}, errors.New("album error")
+}
+
+func TestUploadReportFolders(t *testing.T) {
+	// Two folders have a file with the same path
+	tmp := t.TempDir()
+	for folder, src := range map[string]string{
+		"one": "TEST_DATA/folder/high/AlbumA/PXL_20231006_063000139.jpg",
+		"two": "TEST_DATA/folder/high/AlbumB/PXL_20231006_063528961.jpg",
+	} {
+		b, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Join(tmp, folder, "Album", "photo.jpg")
+		err = os.MkdirAll(filepath.Dir(name), 0o700)
+		if err == nil {
+			err = os.WriteFile(name, b, 0o600)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ic := &icFailAlbums{icCatchUploadsAssets{albums: map[string][]string{}}}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+	}
+	report := filepath.Join(tmp, "report.json")
+	// The album errors are reported by the command
+	_ = UploadCommand(context.Background(), &serv, []string{"-no-ui", "-create-album-folder", "-report", report, filepath.Join(tmp, "one"), filepath.Join(tmp, "two")})
+	b, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []fileevent.FileRecord
+	err = json.Unmarshal(b, &records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].FS != "one" || records[1].FS != "two" {
+		t.Fatalf("expected a record by folder, got %#v", records)
+	}
+	for _, r := range records {
+		// The album error doesn't change the outcome of the uploaded file
+		if r.File != "Album/photo.jpg" || r.Outcome != fileevent.Uploaded.String() || r.Error != "album error" {
+			t.Errorf("unexpected record: %#v", r)
+		}
+	}
+}
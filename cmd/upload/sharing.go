@@ -0,0 +1,157 @@
+package upload
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/immich"
+)
+
+// readAlbumUsers reads the file giving the Immich user of each Google Photos collaborator.
+//
+// Each line is in the form: Google profile name = immich user's email
+// Empty lines and lines starting with # are ignored.
+func readAlbumUsers(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := map[string]string{}
+	s := bufio.NewScanner(f)
+	line := 0
+	for s.Scan() {
+		line++
+		l := strings.TrimSpace(s.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		collaborator, email, ok := strings.Cut(l, "=")
+		collaborator, email = strings.TrimSpace(collaborator), strings.TrimSpace(email)
+		if !ok || collaborator == "" || !strings.Contains(email, "@") {
+			return nil, fmt.Errorf("%s, line %d: expecting: collaborator's name = user's email", name, line)
+		}
+		users[personKey(collaborator)] = strings.ToLower(email)
+	}
+	return users, s.Err()
+}
+
+// shareAlbum shares the album like it was shared in Google Photos.
+// The collaborators become editors of the album. When the album is created, the comments are posted on the album.
+// The users of an existing album are reconciled: the missing collaborators are added.
+// errors are logged, but not returned
+func (app *UpCmd) shareAlbum(ctx context.Context, albumID string, album browser.LocalAlbum, created bool) {
+	sharing := album.Sharing
+	if sharing == nil {
+		return
+	}
+	if app.albumUsers != nil {
+		var users []immich.AlbumUser
+		for _, c := range sharing.Collaborators {
+			email, ok := app.albumUsers[personKey(c)]
+			if !ok {
+				app.Log.Warn("The collaborator isn't in the -album-users file", "album", album.Title, "collaborator", c)
+				continue
+			}
+			id, err := app.getUserID(ctx, email)
+			if err != nil {
+				app.Log.Error("Can't get the user", "album", album.Title, "collaborator", c, "email", email, "error", err)
+				continue
+			}
+			if id == app.User.ID || slices.ContainsFunc(users, func(u immich.AlbumUser) bool { return u.UserID == id }) {
+				continue
+			}
+			users = append(users, immich.AlbumUser{UserID: id, Role: "editor"})
+		}
+		if len(users) > 0 && !created {
+			info, err := app.Immich.GetAlbumInfo(ctx, albumID, true)
+			if err != nil {
+				app.Log.Error("Can't get the album's users", "album", album.Title, "error", err)
+				users = nil
+			}
+			users = gen.Filter(users, func(u immich.AlbumUser) bool {
+				return !slices.ContainsFunc(info.AlbumUsers, func(i immich.AlbumUserInfo) bool { return i.User.ID == u.UserID })
+			})
+		}
+		if len(users) > 0 {
+			err := app.Immich.AddUsersToAlbum(ctx, albumID, users)
+			if err != nil {
+				app.Log.Error("Can't share the album", "album", album.Title, "error", err)
+			}
+		}
+	}
+	if app.AlbumComments && created {
+		for _, c := range sharing.Comments {
+			err := app.Immich.AddActivity(ctx, immich.Activity{
+				AlbumID: albumID,
+				Type:    "comment",
+				Comment: commentText(c),
+			})
+			if err != nil {
+				app.Log.Error("Can't add the comment", "album", album.Title, "error", err)
+			}
+		}
+	}
+}
+
+// reconcileSharing shares the existing album once per run
+func (app *UpCmd) reconcileSharing(ctx context.Context, albumID string, album browser.LocalAlbum) {
+	if album.Sharing == nil || app.albumUsers == nil {
+		return
+	}
+	app.albumsLock.Lock()
+	done := app.sharedAlbums[albumID]
+	app.sharedAlbums[albumID] = true
+	app.albumsLock.Unlock()
+	if !done {
+		app.shareAlbum(ctx, albumID, album, false)
+	}
+}
+
+// commentText gives the comment with its author and its date, as the comment is posted by the current user
+func commentText(c browser.AlbumComment) string {
+	b := strings.Builder{}
+	if c.Author != "" {
+		b.WriteString(c.Author)
+	}
+	if !c.Date.IsZero() {
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(c.Date.Format("2006-01-02 15:04"))
+	}
+	if b.Len() > 0 {
+		b.WriteString(": ")
+	}
+	b.WriteString(c.Text)
+	return b.String()
+}
+
+// getUserID returns the ID of the server's user having this email
+func (app *UpCmd) getUserID(ctx context.Context, email string) (string, error) {
+	app.usersLock.Lock()
+	defer app.usersLock.Unlock()
+
+	if app.users == nil {
+		users, err := app.Immich.GetAllUsers(ctx)
+		if err != nil {
+			return "", err
+		}
+		app.users = map[string]string{}
+		for _, u := range users {
+			app.users[strings.ToLower(u.Email)] = u.ID
+		}
+	}
+	id, ok := app.users[email]
+	if !ok {
+		return "", fmt.Errorf("no user with the email %s", email)
+	}
+	return id, nil
+}
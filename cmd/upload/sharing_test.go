@@ -0,0 +1,214 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kr/pretty"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/tzone"
+	"github.com/simulot/immich-go/immich"
+)
+
+// icSharing knows Bob and Dave, and tracks the album users and the activities
+type icSharing struct {
+	icCatchUploadsAssets
+	albumUsers map[string][]string // album ID -> user IDs
+	comments   map[string][]string // album ID -> comments
+}
+
+func (c *icSharing) GetAllUsers(ctx context.Context) ([]immich.User, error) {
+	return []immich.User{{ID: "bob-id", Email: "Bob@example.com"}, {ID: "me-id", Email: "me@example.com"}, {ID: "dave-id", Email: "dave@example.com"}}, nil
+}
+
+func (c *icSharing) AddUsersToAlbum(ctx context.Context, albumID string, users []immich.AlbumUser) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, u := range users {
+		c.albumUsers[albumID] = append(c.albumUsers[albumID], u.UserID+":"+u.Role)
+	}
+	return nil
+}
+
+func (c *icSharing) AddActivity(ctx context.Context, a immich.Activity) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.comments[a.AlbumID] = append(c.comments[a.AlbumID], a.Comment)
+	return nil
+}
+
+// sharedTakeout shares an album of a copy of the takeout, and gives the -album-users file
+func sharedTakeout(t *testing.T) (string, string) {
+	tmp := t.TempDir()
+	album := "Google Photos/Album test 6-10-23"
+	copyDir(t, filepath.Join("TEST_DATA/Takeout1", album), filepath.Join(tmp, album))
+	err := os.WriteFile(filepath.Join(tmp, album, "shared_album_comments.json"), []byte(`[
+		{"text": "Nice!", "creationTime": {"timestamp": "1697872351"}, "contributorInfo": {"profileName": "Bob"}},
+		{"text": "Thanks", "creationTime": {"timestamp": "1697872400"}, "contributorInfo": {"profileName": "Me"}},
+		{"text": "Who?", "creationTime": {"timestamp": "1697872500"}, "contributorInfo": {"profileName": "Dave"}}
+	]`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := filepath.Join(tmp, "users.txt")
+	err = os.WriteFile(users, []byte("# Google name = immich email\nbob = bob@example.com\nMe=me@example.com\nDave = dave@example.com\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmp, users
+}
+
+func TestSharedAlbums(t *testing.T) {
+	tmp, users := sharedTakeout(t)
+
+	const albumTitle = "Album test 6/10/23"
+	testCases := []struct {
+		name          string
+		args          []string
+		expectedUsers map[string][]string
+		expectedCmts  map[string][]string
+	}{
+		{
+			name:          "not shared",
+			args:          []string{},
+			expectedUsers: map[string][]string{},
+			expectedCmts:  map[string][]string{},
+		},
+		{
+			name:          "users",
+			args:          []string{"-album-users=" + users},
+			expectedUsers: map[string][]string{albumTitle: {"bob-id:editor", "dave-id:editor"}},
+			expectedCmts:  map[string][]string{},
+		},
+		{
+			name:          "comments",
+			args:          []string{"-album-comments"},
+			expectedUsers: map[string][]string{},
+			expectedCmts: map[string][]string{albumTitle: {
+				"Bob, " + dateText(t, 1697872351) + ": Nice!",
+				"Me, " + dateText(t, 1697872400) + ": Thanks",
+				"Dave, " + dateText(t, 1697872500) + ": Who?",
+			}},
+		},
+		{
+			name:          "dry run",
+			args:          []string{"-album-users=" + users, "-album-comments", "-dry-run"},
+			expectedUsers: map[string][]string{},
+			expectedCmts:  map[string][]string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := &icSharing{
+				icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+				albumUsers:           map[string][]string{},
+				comments:             map[string][]string{},
+			}
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			serv := cmd.SharedFlags{
+				Immich: ic,
+				Jnl:    fileevent.NewRecorder(log, false),
+				Log:    log,
+				User:   immich.User{ID: "me-id"},
+			}
+			err := UploadCommand(context.Background(), &serv, append(append([]string{"-no-ui", "-google-photos"}, tc.args...), tmp))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmpAlbums(tc.expectedUsers, ic.albumUsers) {
+				t.Errorf("unexpected album users")
+				pretty.Ldiff(t, tc.expectedUsers, ic.albumUsers)
+			}
+			if !cmpAlbums(tc.expectedCmts, ic.comments) {
+				t.Errorf("unexpected comments")
+				pretty.Ldiff(t, tc.expectedCmts, ic.comments)
+			}
+		})
+	}
+}
+
+// icSharedAlbum has the shared album already, shared with Dave
+type icSharedAlbum struct {
+	icSharing
+}
+
+func (c *icSharedAlbum) GetAllAlbums(ctx context.Context) ([]immich.AlbumSimplified, error) {
+	return []immich.AlbumSimplified{{ID: "album-id", AlbumName: "Album test 6/10/23"}}, nil
+}
+
+func (c *icSharedAlbum) GetAlbumInfo(ctx context.Context, id string, withoutAssets bool) (immich.AlbumContent, error) {
+	return immich.AlbumContent{ID: id, AlbumUsers: []immich.AlbumUserInfo{{User: immich.User{ID: "dave-id"}, Role: "viewer"}}}, nil
+}
+
+func TestSharedExistingAlbum(t *testing.T) {
+	tmp, users := sharedTakeout(t)
+	ic := &icSharedAlbum{icSharing{
+		icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+		albumUsers:           map[string][]string{},
+		comments:             map[string][]string{},
+	}}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+		User:   immich.User{ID: "me-id"},
+	}
+	err := UploadCommand(context.Background(), &serv, []string{"-no-ui", "-google-photos", "-album-users=" + users, "-album-comments", tmp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ic.albums["album-id"]) < 2 {
+		t.Fatalf("the assets should be added to the existing album: %v", ic.albums)
+	}
+	// Bob is added once, Dave is already a user of the album
+	expected := map[string][]string{"album-id": {"bob-id:editor"}}
+	if !cmpAlbums(expected, ic.albumUsers) {
+		t.Errorf("unexpected album users")
+		pretty.Ldiff(t, expected, ic.albumUsers)
+	}
+	if len(ic.comments) > 0 {
+		t.Errorf("the comments are posted when the album is created, got %v", ic.comments)
+	}
+}
+
+// dateText gives the date of the comment, in the local time zone like the takeout's dates
+func dateText(t *testing.T, ts int64) string {
+	local, err := tzone.Local()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return time.Unix(ts, 0).In(local).Format("2006-01-02 15:04")
+}
+
+func TestSharedAlbumsOptions(t *testing.T) {
+	tmp := t.TempDir()
+	bad := filepath.Join(tmp, "bad.txt")
+	err := os.WriteFile(bad, []byte("bob\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"-album-comments", "."},
+		{"-google-photos", "-album-users=" + bad, "."},
+		{"-google-photos", "-album-users=" + filepath.Join(tmp, "missing.txt"), "."},
+	} {
+		ic := &icSharing{}
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		serv := cmd.SharedFlags{
+			Immich: ic,
+			Jnl:    fileevent.NewRecorder(log, false),
+			Log:    log,
+		}
+		err := UploadCommand(context.Background(), &serv, append([]string{"-no-ui"}, args...))
+		if err == nil {
+			t.Errorf("expecting an error with %v", args)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package upload
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/configuration"
+	"github.com/simulot/immich-go/helpers/fshelper"
+)
+
+/*
+	The upload state keeps track of the files handled during previous runs.
+
+	The state is a JSON lines file. Each line is the last known state of a local file.
+	When a file is listed several times, the last line wins. The file is compacted when opened.
+
+	The file is kept beside the configuration file, one file per server and user.
+*/
+
+type StateStatus string
+
+const (
+	StateUploaded StateStatus = "uploaded" // The file has been uploaded
+	StateSkipped  StateStatus = "skipped"  // The server has already the file
+)
+
+// StateEntry is the state of a local file
+type StateEntry struct {
+	Key      string      `json:"key"`               // path, size and modification time of the file
+	Hash     string      `json:"hash,omitempty"`    // SHA-1 of the file when known
+	ID       string      `json:"id"`                // Server's asset ID
+	Status   StateStatus `json:"status"`            // Uploaded or skipped
+	Albums   bool        `json:"albums,omitempty"`  // The asset's albums are up to date
+	Stacked  bool        `json:"stacked,omitempty"` // The asset's stack is done
+	People   bool        `json:"people,omitempty"`  // The asset's people are applied
+	LastSeen time.Time   `json:"lastSeen"`
+}
+
+type StateStore struct {
+	lock     sync.Mutex
+	fileName string
+	readOnly bool
+	entries  map[string]*StateEntry // entries by key
+	byID     map[string]*StateEntry // entries by server's ID
+	byHash   map[string]*StateEntry // entries by file's SHA-1
+	w        *os.File
+}
+
+var stateNameRe = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// StateFileName gives the name of the state file for the server and the user.
+// The file is placed beside the configuration file.
+func StateFileName(configurationFile string, server string, user string) string {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	name := stateNameRe.ReplaceAllString(server+"_"+user, "-")
+	name = strings.Trim(name, "-_")
+	if name == "" {
+		name = "default"
+	}
+	return filepath.Join(filepath.Dir(configurationFile), "state", name+".jsonl")
+}
+
+// OpenStateStore reads the state file and prepares it for appending new states.
+// In read only mode, the file is never written.
+func OpenStateStore(fileName string, readOnly bool) (*StateStore, error) {
+	s := &StateStore{
+		fileName: fileName,
+		readOnly: readOnly,
+		entries:  map[string]*StateEntry{},
+		byID:     map[string]*StateEntry{},
+		byHash:   map[string]*StateEntry{},
+	}
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	if readOnly {
+		return s, nil
+	}
+	err = s.compact()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *StateStore) load() error {
+	f, err := os.Open(s.fileName)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var e StateEntry
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			// A line can be truncated when the program is killed
+			continue
+		}
+		s.set(&e)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("can't read the state file %s at line %d: %w", s.fileName, line, err)
+	}
+	return nil
+}
+
+// compact writes the current entries in a new file, and keeps it open for appending new states
+func (s *StateStore) compact() error {
+	err := configuration.MakeDirForFile(s.fileName)
+	if err != nil {
+		return err
+	}
+	tmp := s.fileName + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range s.entries {
+		err = errors.Join(err, enc.Encode(e))
+	}
+	err = errors.Join(err, w.Flush(), f.Close())
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, s.fileName)
+	if err != nil {
+		return err
+	}
+	s.w, err = os.OpenFile(s.fileName, os.O_APPEND|os.O_WRONLY, 0o600)
+	return err
+}
+
+func (s *StateStore) set(e *StateEntry) {
+	if prev, ok := s.entries[e.Key]; ok && prev.ID != e.ID {
+		delete(s.byID, prev.ID)
+	}
+	s.entries[e.Key] = e
+	if e.ID != "" {
+		s.byID[e.ID] = e
+	}
+	if e.Hash != "" {
+		s.byHash[e.Hash] = e
+	}
+}
+
+// write appends the entry into the state file
+func (s *StateStore) write(e *StateEntry) error {
+	if s.readOnly || s.w == nil {
+		return nil
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// Get returns a copy of the state of the key
+func (s *StateStore) Get(key string) (StateEntry, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return StateEntry{}, false
+	}
+	return *e, true
+}
+
+// GetByHash returns a copy of the state of the file having the SHA-1
+func (s *StateStore) GetByHash(hash string) (StateEntry, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.byHash[hash]
+	if !ok {
+		return StateEntry{}, false
+	}
+	return *e, true
+}
+
+// Set records the state of a file
+func (s *StateStore) Set(e StateEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e.LastSeen = time.Now()
+	s.set(&e)
+	return s.write(&e)
+}
+
+// SetAlbumsDone records that the albums of the file have been updated
+func (s *StateStore) SetAlbumsDone(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	e.Albums = true
+	return s.write(e)
+}
+
+// SetPeopleDone records that the people of the file have been applied
+func (s *StateStore) SetPeopleDone(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	e.People = true
+	return s.write(e)
+}
+
+// SetStacked records that the assets have been stacked
+func (s *StateStore) SetStacked(ids []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var err error
+	for _, id := range ids {
+		if e, ok := s.byID[id]; ok {
+			e.Stacked = true
+			err = errors.Join(err, s.write(e))
+		}
+	}
+	return err
+}
+
+// Len returns the number of known files
+func (s *StateStore) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.entries)
+}
+
+func (s *StateStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.w == nil {
+		return nil
+	}
+	err := s.w.Close()
+	s.w = nil
+	return err
+}
+
+// StateKey identifies a local file by its path, its size and its modification time
+func StateKey(a *browser.LocalAssetFile) (string, error) {
+	name := a.FileName
+	switch fsys := a.FSys.(type) {
+	case fshelper.FullPathFS:
+		name = filepath.ToSlash(fsys.FullPath(name))
+	case fshelper.NameFS:
+		name = path.Join(fsys.Name(), name)
+	}
+	i, err := fs.Stat(a.FSys, a.FileName)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s|%d|%d", name, i.Size(), i.ModTime().Unix()), nil
+}
@@ -0,0 +1,105 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/fileevent"
+)
+
+func TestStateStore(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "state", "test.jsonl")
+
+	s, err := OpenStateStore(fileName, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Set(StateEntry{Key: "a", ID: "1", Status: StateUploaded})
+	_ = s.Set(StateEntry{Key: "b", ID: "2", Status: StateSkipped})
+	_ = s.SetAlbumsDone("a")
+	_ = s.SetStacked([]string{"2"})
+	_ = s.Set(StateEntry{Key: "c", ID: "3", Status: StateUploaded})
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a line truncated by a crash
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"key":"d","id":"4","sta`)
+	f.Close()
+
+	s, err = OpenStateStore(fileName, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if s.Len() != 3 {
+		t.Errorf("expected 3 entries, got %d", s.Len())
+	}
+	e, ok := s.Get("a")
+	if !ok || e.ID != "1" || e.Status != StateUploaded || !e.Albums || e.Stacked {
+		t.Errorf("unexpected entry a: %+v", e)
+	}
+	e, ok = s.Get("b")
+	if !ok || e.ID != "2" || e.Status != StateSkipped || e.Albums || !e.Stacked {
+		t.Errorf("unexpected entry b: %+v", e)
+	}
+	if _, ok = s.Get("d"); ok {
+		t.Errorf("the truncated entry shouldn't be loaded")
+	}
+}
+
+func TestStateFileName(t *testing.T) {
+	got := StateFileName(filepath.Join("config", "immich-go.json"), "https://my.server:2283/", "1234-abcd")
+	want := filepath.Join("config", "state", "my.server-2283-_1234-abcd.jsonl")
+	if got != want {
+		t.Errorf("StateFileName()=%q, want %q", got, want)
+	}
+}
+
+func TestUploadResume(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "immich-go.json")
+
+	run := func(args ...string) *icCatchUploadsAssets {
+		ic := &icCatchUploadsAssets{
+			albums: map[string][]string{},
+		}
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		serv := cmd.SharedFlags{
+			Immich:            ic,
+			Jnl:               fileevent.NewRecorder(log, false),
+			Log:               log,
+			ConfigurationFile: configFile,
+		}
+		err := UploadCommand(context.Background(), &serv, append([]string{"-no-ui", "-resume"}, args...))
+		if err != nil {
+			t.Fatalf("upload failed: %s", err)
+		}
+		return ic
+	}
+
+	ic := run("TEST_DATA/folder/high/AlbumA")
+	if len(ic.assets) != 5 {
+		t.Fatalf("expected 5 uploads on the first run, got %d", len(ic.assets))
+	}
+
+	ic = run("TEST_DATA/folder/high")
+	expected := []string{
+		"AlbumB/PXL_20231006_063528961.jpg",
+		"AlbumB/PXL_20231006_063536303.jpg",
+		"AlbumB/PXL_20231006_063851485.jpg",
+	}
+	if !cmpSlices(expected, ic.assets) {
+		t.Errorf("the second run should upload only new files, got %v", ic.assets)
+	}
+}
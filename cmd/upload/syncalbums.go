@@ -0,0 +1,265 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/configuration"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/immich"
+)
+
+/*
+	The -sync-albums option makes each folder album mirror its folder.
+
+	During the upload, the server's IDs of the folder's files are collected per album.
+	Once all files are handled, each album is compared with its folder:
+	- the missing assets are added to the album
+	- the assets that aren't in the folder anymore are removed from the album. They are kept on the server.
+
+	Only the albums of the folders having assets are synchronized. The folders whose album has been
+	synchronized are kept in a JSON file beside the upload state, one file per server and user.
+	The album of such a folder left without asset is emptied at the next run. The album of a folder
+	never synchronized is never emptied, even when its name is the one of a folder.
+	When a file of the folder can't be handled, the album's assets are not removed.
+*/
+
+type albumSync struct {
+	lock    sync.Mutex
+	albums  map[string]map[string]albumFile // album name -> asset ID -> file
+	folders map[string]string               // folder -> album name, for the folders having assets
+	failed  map[string]bool                 // albums having a file in error
+
+	fileName string
+	readOnly bool
+	synced   map[string]string // folder -> album name, synchronized by the previous runs
+}
+
+// albumFile is the file of an album's asset
+type albumFile struct {
+	fsys fs.FS
+	name string
+}
+
+func newAlbumSync() *albumSync {
+	return &albumSync{
+		albums:  map[string]map[string]albumFile{},
+		folders: map[string]string{},
+		failed:  map[string]bool{},
+		synced:  map[string]string{},
+	}
+}
+
+// SyncedAlbumsFileName gives the name of the synchronized folders' file, beside the state file of the server and the user
+func SyncedAlbumsFileName(configurationFile string, server string, user string) string {
+	return strings.TrimSuffix(StateFileName(configurationFile, server, user), ".jsonl") + "_albums.json"
+}
+
+// load reads the folders synchronized by the previous runs. In read only mode, the file is never written.
+func (s *albumSync) load(fileName string, readOnly bool) error {
+	s.fileName, s.readOnly = fileName, readOnly
+	b, err := os.ReadFile(fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(b, &s.synced)
+	if err != nil {
+		return fmt.Errorf("can't read the synchronized albums file %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// save records the synchronized folders
+func (s *albumSync) save() error {
+	if s.readOnly || s.fileName == "" {
+		return nil
+	}
+	err := configuration.MakeDirForFile(s.fileName)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s.synced, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.fileName, b, 0o600)
+}
+
+// add the asset of the folder to the album's content
+func (s *albumSync) add(album string, folder string, id string, f albumFile) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	l := s.albums[album]
+	if l == nil {
+		l = map[string]albumFile{}
+		s.albums[album] = l
+	}
+	l[id] = f
+	s.folders[folder] = album
+}
+
+// emptied registers the album of a folder without asset, when the album has been synchronized with the folder before
+func (s *albumSync) emptied(album string, folder string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.folders[folder]; ok || s.synced[folder] != album {
+		return
+	}
+	if s.albums[album] == nil {
+		s.albums[album] = map[string]albumFile{}
+	}
+	s.folders[folder] = album
+}
+
+// fail marks the album as incomplete
+func (s *albumSync) fail(album string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failed[album] = true
+}
+
+// folderKey identifies a folder across the runs
+func folderKey(fsys fs.FS, dir string) string {
+	switch fsys := fsys.(type) {
+	case fshelper.FullPathFS:
+		return filepath.ToSlash(fsys.FullPath(dir))
+	case fshelper.NameFS:
+		return path.Join(fsys.Name(), dir)
+	}
+	return dir
+}
+
+// syncAlbumAdd adds the asset to the content of its folder's album
+func (app *UpCmd) syncAlbumAdd(a *browser.LocalAssetFile, id string) {
+	app.albumSync.add(app.folderAlbumName(a), folderKey(a.FSys, path.Dir(a.FileName)), id, albumFile{fsys: a.FSys, name: a.FileName})
+}
+
+// syncAlbumFailed prevents the removal of assets from the album of a file that can't be handled
+func (app *UpCmd) syncAlbumFailed(a *browser.LocalAssetFile) {
+	if app.albumSync != nil {
+		app.albumSync.fail(app.folderAlbumName(a))
+	}
+}
+
+// syncFolderAlbums updates the server's albums to mirror the folders
+func (app *UpCmd) syncFolderAlbums(ctx context.Context) error {
+	// The albums of the folders left without asset are emptied when they have been synchronized before
+	if b, ok := app.browser.(interface{ Folders() map[fs.FS][]string }); ok {
+		for fsys, dirs := range b.Folders() {
+			for _, dir := range dirs {
+				app.albumSync.emptied(app.folderAlbum(fsys, dir), folderKey(fsys, dir))
+			}
+		}
+	}
+
+	names := make([]string, 0, len(app.albumSync.albums))
+	for name := range app.albumSync.albums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := app.syncFolderAlbum(ctx, name, app.albumSync.albums[name])
+		if err != nil {
+			app.Jnl.Record(ctx, fileevent.Error, nil, "", "album", name, "error", err.Error())
+			continue
+		}
+		for folder, album := range app.albumSync.folders {
+			if album == name {
+				app.albumSync.synced[folder] = album
+			}
+		}
+	}
+	return app.albumSync.save()
+}
+
+func (app *UpCmd) syncFolderAlbum(ctx context.Context, name string, local map[string]albumFile) error {
+	var serverAssets []immich.AssetSimplified
+	album, exist := app.albums[name]
+	if !exist && len(local) == 0 {
+		return nil
+	}
+	if exist {
+		content, err := app.Immich.GetAlbumInfo(ctx, album.ID, false)
+		if err != nil {
+			return fmt.Errorf("can't get the album's content: %w", err)
+		}
+		serverAssets = content.Assets
+	}
+
+	onServer := map[string]bool{}
+	removed := []string{}
+	for _, sa := range serverAssets {
+		onServer[sa.ID] = true
+		if _, ok := local[sa.ID]; ok {
+			continue
+		}
+		if app.albumSync.failed[name] {
+			continue
+		}
+		fileName := sa.OriginalFileName
+		if fileName == "" {
+			fileName = sa.ID
+		}
+		app.Jnl.Record(ctx, fileevent.UploadRemoveFromAlbum, nil, fileName, "album", name, "id", sa.ID, "reason", "not in the folder")
+		removed = append(removed, sa.ID)
+	}
+
+	added := []string{}
+	for id, f := range local {
+		if onServer[id] {
+			continue
+		}
+		app.Jnl.Record(ctx, fileevent.UploadAddToAlbum, f.fsys, f.name, "album", name, "reason", "option -sync-albums")
+		added = append(added, id)
+	}
+	sort.Strings(added)
+
+	msg := fmt.Sprintf("Album %q: %d asset(s) added, %d removed, %d unchanged", name, len(added), len(removed), len(local)-len(added))
+	if app.albumSync.failed[name] {
+		msg += ", some files of the folder are in error: the album's assets are not removed"
+	}
+	app.Log.Info(msg)
+
+	if app.DryRun {
+		return nil
+	}
+	if len(added) > 0 {
+		if !exist {
+			a, err := app.Immich.CreateAlbum(ctx, name, "", added)
+			if err != nil {
+				return err
+			}
+			app.albums[name] = immich.AlbumSimplified{ID: a.ID, AlbumName: a.AlbumName, Description: a.Description}
+		} else {
+			_, err := app.Immich.AddAssetToAlbum(ctx, album.ID, added)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(removed) > 0 {
+		_, err := app.Immich.RemoveAssetFromAlbum(ctx, album.ID, removed)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+// icSyncAlbums has the album AlbumA containing an asset that isn't in the folder anymore
+type icSyncAlbums struct {
+	icCatchUploadsAssets
+	removed    map[string][]string
+	failUpload string
+}
+
+func (c *icSyncAlbums) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	if a.FileName == c.failUpload {
+		return immich.AssetResponse{}, errors.New("upload error")
+	}
+	return c.icCatchUploadsAssets.AssetUpload(ctx, a)
+}
+
+func (c *icSyncAlbums) GetAllAlbums(context.Context) ([]immich.AlbumSimplified, error) {
+	return []immich.AlbumSimplified{{ID: "AlbumA", AlbumName: "AlbumA"}}, nil
+}
+
+func (c *icSyncAlbums) GetAlbumInfo(ctx context.Context, id string, withoutAssets bool) (immich.AlbumContent, error) {
+	return immich.AlbumContent{
+		ID:        id,
+		AlbumName: id,
+		Assets: []immich.AssetSimplified{
+			{ID: "AlbumA/PXL_20231006_063000139.jpg", OriginalFileName: "PXL_20231006_063000139.jpg"},
+			{ID: "removed-from-folder", OriginalFileName: "removed.jpg"},
+		},
+	}, nil
+}
+
+func (c *icSyncAlbums) RemoveAssetFromAlbum(ctx context.Context, album string, ids []string) ([]immich.UpdateAlbumResult, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.removed[album] = append(c.removed[album], ids...)
+	return nil, nil
+}
+
+func TestSyncAlbums(t *testing.T) {
+	albumA := []string{
+		"AlbumA/PXL_20231006_063029647.jpg",
+		"AlbumA/PXL_20231006_063108407.jpg",
+		"AlbumA/PXL_20231006_063121958.jpg",
+		"AlbumA/PXL_20231006_063357420.jpg",
+	}
+	albumB := []string{
+		"AlbumB/PXL_20231006_063528961.jpg",
+		"AlbumB/PXL_20231006_063536303.jpg",
+		"AlbumB/PXL_20231006_063851485.jpg",
+	}
+
+	testCases := []struct {
+		name            string
+		args            []string
+		failUpload      string
+		expectedAlbums  map[string][]string
+		expectedRemoved map[string][]string
+	}{
+		{
+			name:            "sync",
+			args:            []string{"-sync-albums"},
+			expectedAlbums:  map[string][]string{"AlbumA": albumA, "AlbumB": albumB},
+			expectedRemoved: map[string][]string{"AlbumA": {"removed-from-folder"}},
+		},
+		{
+			name:            "dry run",
+			args:            []string{"-sync-albums", "-dry-run"},
+			expectedAlbums:  map[string][]string{},
+			expectedRemoved: map[string][]string{},
+		},
+		{
+			name:            "file in error",
+			args:            []string{"-sync-albums"},
+			failUpload:      "AlbumA/PXL_20231006_063108407.jpg",
+			expectedAlbums:  map[string][]string{"AlbumA": slices.Delete(slices.Clone(albumA), 1, 2), "AlbumB": albumB},
+			expectedRemoved: map[string][]string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := &icSyncAlbums{
+				icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+				removed:              map[string][]string{},
+				failUpload:           tc.failUpload,
+			}
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			serv := cmd.SharedFlags{
+				Immich:            ic,
+				Jnl:               fileevent.NewRecorder(log, false),
+				Log:               log,
+				ConfigurationFile: filepath.Join(t.TempDir(), "immich-go.json"),
+			}
+			_ = UploadCommand(context.Background(), &serv, append(append([]string{"-no-ui"}, tc.args...), "TEST_DATA/folder/high"))
+
+			if !cmpAlbums(tc.expectedAlbums, ic.albums) {
+				t.Errorf("unexpected albums")
+				pretty.Ldiff(t, tc.expectedAlbums, ic.albums)
+			}
+			if !cmpAlbums(tc.expectedRemoved, ic.removed) {
+				t.Errorf("unexpected removed assets")
+				pretty.Ldiff(t, tc.expectedRemoved, ic.removed)
+			}
+		})
+	}
+}
+
+func TestSyncAlbumsOptions(t *testing.T) {
+	for _, args := range [][]string{
+		{"-sync-albums", "-google-photos"},
+		{"-sync-albums", "-watch"},
+		{"-sync-albums", "-date=2023"},
+		{"-sync-albums", "-select-types=.jpg"},
+		{"-sync-albums", "-delete"},
+		{"-sync-albums", "-dcim"},
+	} {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		serv := cmd.SharedFlags{
+			Immich: &stubIC{},
+			Jnl:    fileevent.NewRecorder(log, false),
+			Log:    log,
+		}
+		_, err := newCommand(context.Background(), &serv, append(args, "TEST_DATA/folder/high"), nil)
+		if err == nil {
+			t.Errorf("expected an error with %v", args)
+		}
+	}
+}
+
+// icSyncEmptiedAlbum has the album of a folder that has no asset anymore
+type icSyncEmptiedAlbum struct {
+	icSyncAlbums
+}
+
+func (c *icSyncEmptiedAlbum) GetAllAlbums(context.Context) ([]immich.AlbumSimplified, error) {
+	return []immich.AlbumSimplified{
+		{ID: "AlbumA", AlbumName: "AlbumA"},
+		{ID: "Emptied", AlbumName: "Emptied"},
+		{ID: "Other", AlbumName: "Other"},
+		{ID: "2023", AlbumName: "2023"},
+	}, nil
+}
+
+func (c *icSyncEmptiedAlbum) GetAlbumInfo(ctx context.Context, id string, withoutAssets bool) (immich.AlbumContent, error) {
+	content := immich.AlbumContent{ID: id, AlbumName: id}
+	switch id {
+	case "AlbumA":
+		content.Assets = []immich.AssetSimplified{{ID: "AlbumA/photo.jpg", OriginalFileName: "photo.jpg"}}
+	case "Emptied":
+		content.Assets = []immich.AssetSimplified{{ID: "old-1", OriginalFileName: "old1.jpg"}, {ID: "old-2", OriginalFileName: "old2.jpg"}}
+	case "Other":
+		content.Assets = []immich.AssetSimplified{{ID: "other", OriginalFileName: "other.jpg"}}
+	case "2023":
+		content.Assets = []immich.AssetSimplified{{ID: "2023", OriginalFileName: "2023.jpg"}}
+	}
+	return content, nil
+}
+
+func TestSyncAlbumsEmptiedFolder(t *testing.T) {
+	dir := t.TempDir()
+	photo, err := os.ReadFile("TEST_DATA/folder/high/AlbumA/PXL_20231006_063000139.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trip, err := os.ReadFile("TEST_DATA/folder/high/AlbumB/PXL_20231006_063528961.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string][]byte{
+		"AlbumA/photo.jpg":   photo,
+		"Emptied/notes.txt":  []byte("the photos were moved"),
+		"2023/Trip/trip.jpg": trip,
+	} {
+		name = filepath.Join(dir, name)
+		err = os.MkdirAll(filepath.Dir(name), 0o700)
+		if err == nil {
+			err = os.WriteFile(name, content, 0o600)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = os.MkdirAll(filepath.Join(dir, "Empty"), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configFile := filepath.Join(t.TempDir(), "immich-go.json")
+	ic := &icSyncEmptiedAlbum{icSyncAlbums{
+		icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+		removed:              map[string][]string{},
+	}}
+	run := func(want map[string][]string) {
+		t.Helper()
+		ic.removed = map[string][]string{}
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		serv := cmd.SharedFlags{
+			Immich:            ic,
+			Jnl:               fileevent.NewRecorder(log, false),
+			Log:               log,
+			ConfigurationFile: configFile,
+		}
+		err := UploadCommand(context.Background(), &serv, []string{"-no-ui", "-sync-albums", dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cmpAlbums(want, ic.removed) {
+			t.Errorf("unexpected removed assets")
+			pretty.Ldiff(t, want, ic.removed)
+		}
+	}
+
+	// The albums never synchronized with their folder are kept, even when a folder has their name
+	run(map[string][]string{})
+	if _, ok := ic.albums["Empty"]; ok {
+		t.Errorf("no album is created for an empty folder")
+	}
+
+	// The album synchronized with its folder is emptied when the folder has no asset anymore
+	err = os.WriteFile(filepath.Join(dir, "Emptied/photo.jpg"), photo, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(map[string][]string{"Emptied": {"old-1", "old-2"}})
+	err = os.Remove(filepath.Join(dir, "Emptied/photo.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(map[string][]string{"Emptied": {"old-1", "old-2"}})
+}
@@ -127,6 +127,11 @@ func (app *UpCmd) runUI(ctx context.Context) error {
 					for c := range ui.counts {
 						ui.getCountView(c, counts[c])
 					}
+					if m := app.pausedMessage(); m != "" {
+						ui.uploadCounts.SetTitle("Uploading, " + m)
+					} else {
+						ui.uploadCounts.SetTitle("Uploading")
+					}
 					if app.GooglePhotos {
 						ui.immichPrepare.SetMaxValue(int(app.Jnl.TotalAssets()))
 						ui.immichPrepare.SetValue(int(app.Jnl.TotalProcessedGP()))
@@ -267,8 +272,16 @@ func newUI(ctx context.Context, app *UpCmd) *uiPage {
 	ui.addCounter(ui.prepareCounts, 5, "Duplicates in the input", fileevent.AnalysisLocalDuplicate)
 	ui.addCounter(ui.prepareCounts, 6, "Files with a sidecar", fileevent.AnalysisAssociatedMetadata)
 	ui.addCounter(ui.prepareCounts, 7, "Files without sidecar", fileevent.AnalysisMissingAssociatedMetadata)
+	prepareRows := 8
+	if app.GooglePhotos || app.ICloud || app.PhotosLibrary || app.readsCatalog() {
+		ui.addCounter(ui.prepareCounts, 8, "Trashed assets", fileevent.DiscoveredTrashed)
+		ui.addCounter(ui.prepareCounts, 9, "Archived assets", fileevent.DiscoveredArchived)
+		ui.addCounter(ui.prepareCounts, 10, "Partner's assets", fileevent.DiscoveredPartner)
+		ui.addCounter(ui.prepareCounts, 11, "Locked Folder assets", fileevent.DiscoveredLocked)
+		prepareRows = 12
+	}
 
-	ui.prepareCounts.SetSize(8, 2, 1, 1).SetColumns(30, 10)
+	ui.prepareCounts.SetSize(prepareRows, 2, 1, 1).SetColumns(30, 10)
 
 	ui.uploadCounts = tview.NewGrid()
 	ui.uploadCounts.SetBorder(true).SetTitle("Uploading")
@@ -279,7 +292,8 @@ func newUI(ctx context.Context, app *UpCmd) *uiPage {
 	ui.addCounter(ui.uploadCounts, 3, "Server's asset upgraded", fileevent.UploadUpgraded)
 	ui.addCounter(ui.uploadCounts, 4, "Server has same quality", fileevent.UploadServerDuplicate)
 	ui.addCounter(ui.uploadCounts, 5, "Server has better quality", fileevent.UploadServerBetter)
-	ui.uploadCounts.SetSize(6, 2, 1, 1).SetColumns(30, 10)
+	ui.addCounter(ui.uploadCounts, 6, "Handled by a previous run", fileevent.UploadResumed)
+	ui.uploadCounts.SetSize(7, 2, 1, 1).SetColumns(30, 10)
 
 	if _, err := app.Immich.GetJobs(ctx); err == nil {
 		ui.watchJobs = true
@@ -344,7 +358,7 @@ func newUI(ctx context.Context, app *UpCmd) *uiPage {
 	ui.screen.AddItem(ui.footer, 3, 0, 1, 1, 0, 0, false)
 
 	// Adjust section's height
-	ui.screen.SetRows(4, 10, 0, 1)
+	ui.screen.SetRows(4, prepareRows+2, 0, 1)
 	return ui
 }
 
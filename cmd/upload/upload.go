@@ -4,6 +4,7 @@ package upload
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
@@ -12,13 +13,21 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/google/uuid"
 	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/browser/applephotos"
+	"github.com/simulot/immich-go/browser/digikam"
 	"github.com/simulot/immich-go/browser/files"
 	"github.com/simulot/immich-go/browser/gp"
+	"github.com/simulot/immich-go/browser/icloud"
+	"github.com/simulot/immich-go/browser/lightroom"
+	"github.com/simulot/immich-go/browser/meta"
+	"github.com/simulot/immich-go/browser/shotwell"
 	"github.com/simulot/immich-go/cmd"
 	"github.com/simulot/immich-go/helpers/fileevent"
 	"github.com/simulot/immich-go/helpers/fshelper"
@@ -27,7 +36,10 @@ import (
 	"github.com/simulot/immich-go/helpers/namematcher"
 	"github.com/simulot/immich-go/helpers/stacking"
 	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/immich/metadata"
 	"github.com/simulot/immich-go/internal/fakefs"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
 type UpCmd struct {
@@ -35,43 +47,87 @@ type UpCmd struct {
 
 	fsyss []fs.FS // pseudo file system to browse
 
-	GooglePhotos           bool             // For reading Google Photos takeout files
-	Delete                 bool             // Delete original file after import
-	CreateAlbumAfterFolder bool             // Create albums for assets based on the parent folder or a given name
-	UseFullPathAsAlbumName bool             // Create albums for assets based on the full path to the asset
-	AlbumNamePathSeparator string           // Determines how multiple (sub) folders, if any, will be joined
-	ImportIntoAlbum        string           // All assets will be added to this album
-	PartnerAlbum           string           // Partner's assets will be added to this album
-	Import                 bool             // Import instead of upload
-	DeviceUUID             string           // Set a device UUID
-	Paths                  []string         // Path to explore
-	DateRange              immich.DateRange // Set capture date range
-	ImportFromAlbum        string           // Import assets from this albums
-	CreateAlbums           bool             // Create albums when exists in the source
-	KeepTrashed            bool             // Import trashed assets
-	KeepPartner            bool             // Import partner's assets
-	KeepUntitled           bool             // Keep untitled albums
-	UseFolderAsAlbumName   bool             // Use folder's name instead of metadata's title as Album name
-	DryRun                 bool             // Display actions but don't change anything
-	CreateStacks           bool             // Stack jpg/raw/burst (Default: TRUE)
-	StackJpgRaws           bool             // Stack jpg/raw (Default: TRUE)
-	StackBurst             bool             // Stack burst (Default: TRUE)
-	DiscardArchived        bool             // Don't import archived assets (Default: FALSE)
-	AutoArchive            bool             // Automatically archive photos that are also archived in google photos (Default: TRUE)
-	WhenNoDate             string           // When the date can't be determined use the FILE's date or NOW (default: FILE)
-	ForceUploadWhenNoJSON  bool             // Some takeout don't supplies all JSON. When true, files are uploaded without any additional metadata
-	BannedFiles            namematcher.List // List of banned file name patterns
+	GooglePhotos           bool                   // For reading Google Photos takeout files
+	ICloud                 bool                   // For reading iCloud Photos exports
+	MetaExport             bool                   // For reading Facebook and Instagram exports
+	PhotosLibrary          bool                   // For reading Apple Photos libraries
+	Lightroom              bool                   // For reading Lightroom Classic catalogs
+	DigiKam                bool                   // For reading digiKam databases
+	Shotwell               bool                   // For reading Shotwell databases
+	DCIM                   bool                   // For reading memory cards, and resuming after the last file imported from the card
+	Delete                 bool                   // Delete original file after import
+	Quarantine             string                 // Move the original files into this folder instead of deleting them
+	CreateAlbumAfterFolder bool                   // Create albums for assets based on the parent folder or a given name
+	UseFullPathAsAlbumName bool                   // Create albums for assets based on the full path to the asset
+	AlbumNamePathSeparator string                 // Determines how multiple (sub) folders, if any, will be joined
+	ImportIntoAlbum        string                 // All assets will be added to this album
+	PartnerAlbum           string                 // Partner's assets will be added to this album
+	Import                 bool                   // Import instead of upload
+	DeviceUUID             string                 // Set a device UUID
+	Paths                  []string               // Path to explore
+	DateRange              immich.DateRange       // Set capture date range
+	ImportFromAlbum        string                 // Import assets from this albums
+	CreateAlbums           bool                   // Create albums when exists in the source
+	KeepTrashed            bool                   // Import trashed assets, same as -trashed-policy=import
+	KeepPartner            bool                   // Import partner's assets, -partner-policy=discard when false
+	TrashedPolicy          CategoryPolicy         // What to do with the trashed assets (default: discard)
+	ArchivedPolicy         CategoryPolicy         // What to do with the archived assets (default: archive)
+	PartnerPolicy          CategoryPolicy         // What to do with the partner's assets (default: import)
+	LockedPolicy           CategoryPolicy         // What to do with the Locked Folder assets (default: discard)
+	KeepUntitled           bool                   // Keep untitled albums
+	UseFolderAsAlbumName   bool                   // Use folder's name instead of metadata's title as Album name
+	ImportPeople           bool                   // Tag the assets with the people tagged in Google Photos, digiKam or Shotwell
+	TakeoutManifest        string                 // Manifest of the takeout imports, to import only the changes of a newer takeout
+	AlbumUsers             string                 // File giving the Immich user of each Google Photos collaborator
+	AlbumComments          bool                   // Post the comments of the shared albums
+	EditedVersions         string                 // What to do with the photos edited in Google Photos: all, stack-edited, stack-original, edited, original (default: all)
+	DryRun                 bool                   // Display actions but don't change anything
+	CreateStacks           bool                   // Stack jpg/raw/burst (Default: TRUE)
+	StackJpgRaws           bool                   // Stack jpg/raw (Default: TRUE)
+	StackBurst             bool                   // Stack burst (Default: TRUE)
+	DiscardArchived        bool                   // Don't import archived assets, same as -archived-policy=discard (Default: FALSE)
+	AutoArchive            bool                   // Automatically archive photos that are also archived in google photos, -archived-policy=import when false (Default: TRUE)
+	WhenNoDate             string                 // When the date can't be determined use the FILE's date or NOW (default: FILE)
+	ForceUploadWhenNoJSON  bool                   // Some takeout don't supplies all JSON. When true, files are uploaded without any additional metadata
+	BannedFiles            namematcher.List       // List of banned file name patterns
+	ConcurrentUploads      int                    // Number of assets uploaded in parallel (default 1)
+	Resume                 bool                   // Skip files handled by a previous run, and replay pending album and stack operations
+	CompareChecksum        bool                   // Compare the SHA-1 of local files with server's assets
+	Watch                  bool                   // Keep watching the folders for new files after the first pass
+	WatchSettle            time.Duration          // Time a new file must stay unchanged before being uploaded
+	WatchPoll              time.Duration          // Scan the folders at this interval instead of using system notifications
+	UploadWindow           UploadWindow           // Time of the day when uploads are allowed
+	SyncAlbums             bool                   // Folder albums mirror their folder: missing assets are added, others are removed
+	Report                 string                 // Write the per file report into this file (.json, .csv or .html)
+	SideCarPolicy          metadata.SideCarPolicy // How the metadata found by immich-go are combined with existing XMP sidecars
 
 	BrowserConfig Configuration
 
-	albums map[string]immich.AlbumSimplified // Albums by title
-
-	AssetIndex       *AssetIndex               // List of assets present on the server
-	deleteServerList []*immich.Asset           // List of server assets to remove
-	deleteLocalList  []*browser.LocalAssetFile // List of local assets to remove
+	albums         map[string]immich.AlbumSimplified // Albums by title
+	albumsLock     sync.Mutex                        // Protect albums and sharedAlbums against concurrent workers
+	sharedAlbums   map[string]bool                   // Albums whose sharing is done by ID
+	albumsCreation singleflight.Group                // Albums being created, by title
+	people         map[string]immich.Person          // Server's people by name, loaded on first use
+	peopleTags     map[string]string                 // IDs of the people's tags by name
+	peopleLock     sync.Mutex                        // Protect people and peopleTags against concurrent workers
+	peopleCreation singleflight.Group                // People and tags being read or created, by name
+	albumUsers     map[string]string                 // Immich user's email by collaborator, read from the -album-users file
+	users          map[string]string                 // Server's user IDs by email, loaded on first use
+	usersLock      sync.Mutex                        // Protect users against concurrent workers
+	manifest       *gp.Manifest                      // Takeout manifest, when -takeout-manifest is set
+	catalogs       []files.CatalogFolder             // Folders of the photo manager's databases, when -lightroom, -digikam or -shotwell is set
+
+	AssetIndex       *AssetIndex     // List of assets present on the server
+	deleteServerList []*immich.Asset // List of server assets to remove
 	// updateAlbums     map[string]map[string]any // track immich albums changes
-	stacks  *stacking.StackBuilder
-	browser browser.Browser
+	albumSync *albumSync // Content of the folder albums when -sync-albums is set
+	stacks    *stacking.StackBuilder
+	browser   browser.Browser
+	state     *StateStore      // Files handled by previous runs
+	cards     *CardImports     // Last files imported from the memory cards, when -dcim is set
+	checksums *checksumBatcher // Checks the checksums on the server, when -compare-checksum is set
+
+	pausedUntil atomic.Int64 // Unix time of the next upload window opening, 0 when not paused
 }
 
 func UploadCommand(ctx context.Context, common *cmd.SharedFlags, args []string) error {
@@ -124,16 +180,48 @@ func newCommand(ctx context.Context, common *cmd.SharedFlags, args []string, fsO
 		myflag.BoolFlagFn(&app.CreateAlbumAfterFolder, false))
 	cmd.BoolFunc(
 		"use-full-path-album-name",
-		" folder import only: Use the full path towards the asset for determining the Album name",
+		" folder, Photos library, Lightroom, digiKam and Shotwell imports only: Use the full path towards the asset, or the album's folders, for determining the Album name",
 		myflag.BoolFlagFn(&app.UseFullPathAsAlbumName, false))
 	cmd.StringVar(&app.AlbumNamePathSeparator,
 		"album-name-path-separator",
 		" ",
 		" when use-full-path-album-name = true, determines how multiple (sub) folders, if any, will be joined")
+	cmd.BoolFunc(
+		"sync-albums",
+		" folder import only: Make the folder albums mirror their folder, adding missing assets and removing the others. Implies -create-album-folder (default FALSE)",
+		myflag.BoolFlagFn(&app.SyncAlbums, false))
 	cmd.BoolFunc(
 		"google-photos",
 		"Import GooglePhotos takeout zip files",
 		myflag.BoolFlagFn(&app.GooglePhotos, false))
+	cmd.BoolFunc(
+		"icloud",
+		"Import iCloud Photos exports (\"Download your data\" archives)",
+		myflag.BoolFlagFn(&app.ICloud, false))
+	cmd.BoolFunc(
+		"facebook",
+		"Import Facebook exports (\"Download your information\" archives, JSON format)",
+		myflag.BoolFlagFn(&app.MetaExport, false))
+	cmd.BoolFunc(
+		"instagram",
+		"Import Instagram exports (\"Download your information\" archives, JSON format)",
+		myflag.BoolFlagFn(&app.MetaExport, false))
+	cmd.BoolFunc(
+		"photos-library",
+		"Import Apple Photos libraries (.photoslibrary folders)",
+		myflag.BoolFlagFn(&app.PhotosLibrary, false))
+	cmd.BoolFunc(
+		"lightroom",
+		"Import the files of Lightroom Classic catalogs (.lrcat files), with their collections, ratings, pick flags and keywords",
+		myflag.BoolFlagFn(&app.Lightroom, false))
+	cmd.BoolFunc(
+		"digikam",
+		"Import the files of digiKam databases (digikam4.db files), with their albums, tags, people, ratings, pick labels and captions",
+		myflag.BoolFlagFn(&app.DigiKam, false))
+	cmd.BoolFunc(
+		"shotwell",
+		"Import the files of Shotwell databases (photo.db files), with their events, tags, people, ratings, flags and comments",
+		myflag.BoolFlagFn(&app.Shotwell, false))
 	cmd.BoolFunc(
 		"create-albums",
 		" google-photos only: Create albums like there were in the source (default: TRUE)",
@@ -145,6 +233,18 @@ func newCommand(ctx context.Context, common *cmd.SharedFlags, args []string, fsO
 	cmd.BoolFunc(
 		"keep-partner",
 		" google-photos only: Import also partner's items (default: TRUE)", myflag.BoolFlagFn(&app.KeepPartner, true))
+	cmd.BoolFunc(
+		"keep-trashed",
+		" google-photos only: Import also trashed items (default: FALSE)", myflag.BoolFlagFn(&app.KeepTrashed, false))
+
+	app.TrashedPolicy = CategoryPolicy{Action: CategoryDiscard}
+	app.ArchivedPolicy = CategoryPolicy{Action: CategoryArchive}
+	app.PartnerPolicy = CategoryPolicy{Action: CategoryImport}
+	app.LockedPolicy = CategoryPolicy{Action: CategoryDiscard}
+	cmd.Var(&app.TrashedPolicy, "trashed-policy", " google-photos, icloud, photos-library, lightroom, digikam and shotwell: What to do with the trashed items, or the rejected photos: import, discard, archive, trash or album:NAME (default discard)")
+	cmd.Var(&app.ArchivedPolicy, "archived-policy", " google-photos, icloud, photos-library and shotwell: What to do with the archived or hidden items: import, discard, archive, trash or album:NAME (default archive)")
+	cmd.Var(&app.PartnerPolicy, "partner-policy", " google-photos only: What to do with the partner's items: import, discard, archive, trash or album:NAME (default import)")
+	cmd.Var(&app.LockedPolicy, "locked-policy", " google-photos only: What to do with the Locked Folder items: import, discard, archive, trash or album:NAME (default discard)")
 	cmd.StringVar(&app.ImportFromAlbum,
 		"from-album",
 		"",
@@ -158,6 +258,29 @@ func newCommand(ctx context.Context, common *cmd.SharedFlags, args []string, fsO
 		"use-album-folder-as-name",
 		" google-photos only: Use folder name and ignore albums' title (default:FALSE)", myflag.BoolFlagFn(&app.UseFolderAsAlbumName, false))
 
+	cmd.BoolFunc(
+		"people",
+		" google-photos, digikam and shotwell only: Tag the assets with the people tagged in Google Photos, digiKam or Shotwell, creating the missing people on the server (default FALSE)", myflag.BoolFlagFn(&app.ImportPeople, false))
+
+	cmd.StringVar(&app.TakeoutManifest,
+		"takeout-manifest",
+		"",
+		" google-photos only: Import only the changes since the previous takeout recorded in this file, and update the file")
+
+	cmd.StringVar(&app.AlbumUsers,
+		"album-users",
+		"",
+		" google-photos only: Share the albums shared in Google Photos with the Immich users given in this file. Each line is: collaborator's name = user's email")
+
+	cmd.BoolFunc(
+		"album-comments",
+		" google-photos only: Post the comments of the shared albums on the Immich albums (default FALSE)", myflag.BoolFlagFn(&app.AlbumComments, false))
+
+	cmd.StringVar(&app.EditedVersions,
+		"edited-versions",
+		"all",
+		" google-photos and photos-library only: What to do with the edited photos: all, stack-edited, stack-original, edited or original (default all)")
+
 	cmd.BoolFunc(
 		"discard-archived",
 		" google-photos only: Do not import archived photos (default FALSE)", myflag.BoolFlagFn(&app.DiscardArchived, false))
@@ -177,7 +300,14 @@ func newCommand(ctx context.Context, common *cmd.SharedFlags, args []string, fsO
 		"stack-burst",
 		"Control the stacking bursts (default TRUE)", myflag.BoolFlagFn(&app.StackBurst, false))
 
-	// cmd.BoolVar(&app.Delete, "delete", false, "Delete local assets after upload")
+	cmd.BoolFunc(
+		"delete",
+		" folder import only: Delete local files once the server's asset is verified (default FALSE)",
+		myflag.BoolFlagFn(&app.Delete, false))
+	cmd.StringVar(&app.Quarantine,
+		"quarantine",
+		"",
+		" with -delete: Move the local files into this folder instead of deleting them")
 
 	cmd.Var(&app.BrowserConfig.SelectExtensions, "select-types", "list of selected extensions separated by a comma")
 	cmd.Var(&app.BrowserConfig.ExcludeExtensions, "exclude-types", "list of excluded extensions separated by a comma")
@@ -191,6 +321,28 @@ func newCommand(ctx context.Context, common *cmd.SharedFlags, args []string, fsO
 
 	cmd.BoolVar(&app.ForceUploadWhenNoJSON, "upload-when-missing-JSON", app.ForceUploadWhenNoJSON, "when true, photos are upload even without associated JSON file.")
 	cmd.BoolVar(&app.DebugFileList, "debug-file-list", app.DebugFileList, "Check how the your file list would be processed")
+	cmd.IntVar(&app.ConcurrentUploads, "concurrent-uploads", 1, "Number of assets uploaded in parallel (default 1)")
+	cmd.BoolFunc(
+		"compare-checksum",
+		"Compute the SHA-1 of each file and don't upload files having the same content than a server's asset. The files not found by name are checked on the server, in batches of -concurrent-uploads files (default FALSE)",
+		myflag.BoolFlagFn(&app.CompareChecksum, false))
+	cmd.BoolFunc(
+		"resume",
+		"Skip files handled by a previous run, and record the progression for the next one (default FALSE)",
+		myflag.BoolFlagFn(&app.Resume, false))
+	cmd.Var(&app.UploadWindow, "upload-window", "Upload only during this time of the day, ex: 01:00-06:00")
+	cmd.Var(&app.SideCarPolicy, "sidecar-policy", "How metadata found by immich-go are combined with existing XMP sidecars: keep, merge or replace (default merge)")
+	cmd.StringVar(&app.Report, "report", "", "Write what happened to each file into this file. The format is given by the extension: .json, .csv or .html")
+	cmd.BoolFunc(
+		"watch",
+		" folder import only: Keep running and upload new files when they appear in the folders (default FALSE)",
+		myflag.BoolFlagFn(&app.Watch, false))
+	cmd.Func("watch-settle", " with -watch: Time a new file must stay unchanged before being uploaded, default 10s", myflag.DurationFlagFn(&app.WatchSettle, 10*time.Second))
+	cmd.Func("watch-poll", " with -watch: Scan the folders at this interval instead of using system notifications. Useful for network shares", myflag.DurationFlagFn(&app.WatchPoll, 0))
+	cmd.BoolFunc(
+		"dcim",
+		" folder import only: Read memory cards: DCIM folders only, companion files of the devices paired or ignored, resume after the last file imported from the card (default FALSE)",
+		myflag.BoolFlagFn(&app.DCIM, false))
 
 	err = cmd.Parse(args)
 	if err != nil {
@@ -210,6 +362,108 @@ func newCommand(ctx context.Context, common *cmd.SharedFlags, args []string, fsO
 	} else {
 	}
 
+	sources := 0
+	for _, b := range []bool{app.GooglePhotos, app.ICloud, app.MetaExport, app.PhotosLibrary, app.Lightroom, app.DigiKam, app.Shotwell, app.DCIM} {
+		if b {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return nil, fmt.Errorf("the -google-photos, -icloud, -facebook, -instagram, -photos-library, -lightroom, -digikam, -shotwell and -dcim options can't be used together")
+	}
+
+	err = app.setCategoryPolicies(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if app.ConcurrentUploads < 1 {
+		return nil, fmt.Errorf("the -concurrent-uploads must be at least 1")
+	}
+
+	if app.Report != "" && fileevent.ReportFormat(app.Report) == "" {
+		return nil, fmt.Errorf("the -report option accepts .json, .csv or .html files")
+	}
+
+	if app.Quarantine != "" && !app.Delete {
+		return nil, fmt.Errorf("the -quarantine option requires -delete")
+	}
+
+	if app.Watch {
+		switch {
+		case app.GooglePhotos:
+			return nil, fmt.Errorf("the -watch option can't be used with -google-photos")
+		case app.ICloud:
+			return nil, fmt.Errorf("the -watch option can't be used with -icloud")
+		case app.MetaExport:
+			return nil, fmt.Errorf("the -watch option can't be used with -facebook or -instagram")
+		case app.PhotosLibrary:
+			return nil, fmt.Errorf("the -watch option can't be used with -photos-library")
+		case app.readsCatalog():
+			return nil, fmt.Errorf("the -watch option can't be used with -lightroom, -digikam or -shotwell")
+		case app.CreateStacks:
+			return nil, fmt.Errorf("the -watch option can't be used with -create-stacks")
+		}
+	}
+
+	if app.SyncAlbums {
+		switch {
+		case app.GooglePhotos:
+			return nil, fmt.Errorf("the -sync-albums option can't be used with -google-photos")
+		case app.ICloud:
+			return nil, fmt.Errorf("the -sync-albums option can't be used with -icloud")
+		case app.MetaExport:
+			return nil, fmt.Errorf("the -sync-albums option can't be used with -facebook or -instagram")
+		case app.PhotosLibrary:
+			return nil, fmt.Errorf("the -sync-albums option can't be used with -photos-library")
+		case app.readsCatalog():
+			return nil, fmt.Errorf("the -sync-albums option can't be used with -lightroom, -digikam or -shotwell")
+		case app.Watch:
+			return nil, fmt.Errorf("the -sync-albums option can't be used with -watch")
+		case app.Delete:
+			return nil, fmt.Errorf("the -sync-albums option can't be used with -delete: the deleted files would be removed from the albums")
+		case app.DCIM:
+			return nil, fmt.Errorf("the -sync-albums option can't be used with -dcim: the files imported before would be removed from the albums")
+		case app.DateRange.IsSet() || len(app.BrowserConfig.SelectExtensions) > 0 || len(app.BrowserConfig.ExcludeExtensions) > 0:
+			return nil, fmt.Errorf("the -sync-albums option can't be used with -date, -select-types or -exclude-types: the files not selected would be removed from the albums")
+		}
+		app.CreateAlbumAfterFolder = true
+		app.albumSync = newAlbumSync()
+	}
+
+	if app.TakeoutManifest != "" {
+		if !app.GooglePhotos {
+			return nil, fmt.Errorf("the -takeout-manifest option is for Google Photos takeouts")
+		}
+		app.manifest, err = gp.ReadManifest(app.TakeoutManifest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if app.AlbumUsers != "" || app.AlbumComments {
+		if !app.GooglePhotos {
+			return nil, fmt.Errorf("the -album-users and -album-comments options are for Google Photos takeouts")
+		}
+		if app.AlbumUsers != "" {
+			app.albumUsers, err = readAlbumUsers(app.AlbumUsers)
+			if err != nil {
+				return nil, fmt.Errorf("can't read the -album-users file: %w", err)
+			}
+		}
+	}
+
+	app.EditedVersions = strings.ToLower(app.EditedVersions)
+	switch app.EditedVersions {
+	case "all":
+	case "stack-edited", "stack-original", "edited", "original":
+		if !app.GooglePhotos && !app.PhotosLibrary {
+			return nil, fmt.Errorf("the -edited-versions option is for Google Photos takeouts and Apple Photos libraries")
+		}
+	default:
+		return nil, fmt.Errorf("the -edited-versions option accepts all, stack-edited, stack-original, edited or original")
+	}
+
 	app.WhenNoDate = strings.ToUpper(app.WhenNoDate)
 	switch app.WhenNoDate {
 	case "FILE", "NOW":
@@ -222,10 +476,16 @@ func newCommand(ctx context.Context, common *cmd.SharedFlags, args []string, fsO
 	if err != nil {
 		return nil, err
 	}
+	if app.Report != "" {
+		app.Jnl.CollectFileReport()
+	}
 
 	if fsOpener == nil {
 		fsOpener = func() ([]fs.FS, error) {
-			return fshelper.ParsePath(cmd.Args())
+			if app.readsCatalog() {
+				return app.readCatalogs(ctx, cmd.Args())
+			}
+			return fshelper.ParsePath(ctx, cmd.Args(), app.Remotes...)
 		}
 	}
 	app.fsyss, err = fsOpener()
@@ -244,15 +504,72 @@ func (app *UpCmd) run(ctx context.Context) error {
 		_ = fshelper.CloseFSs(app.fsyss)
 	}()
 
-	if app.CreateStacks || app.StackBurst || app.StackJpgRaws {
+	if app.CreateStacks || app.StackBurst || app.StackJpgRaws || app.stackEdited() {
 		app.stacks = stacking.NewStackBuilder(app.Immich.SupportedMedia())
 	}
+	if app.CompareChecksum {
+		app.checksums = newChecksumBatcher(ctx, app.Immich, app.ConcurrentUploads)
+	}
+	if app.stackEdited() {
+		app.stacks.SetEditedStacks(app.EditedVersions == "stack-edited")
+	}
 
 	var err error
+	server := app.Server
+	if server == "" {
+		server = app.API
+	}
+	if app.Resume {
+		app.state, err = OpenStateStore(StateFileName(app.ConfigurationFile, server, app.User.ID), app.DryRun)
+		if err != nil {
+			return fmt.Errorf("can't open the upload state: %w", err)
+		}
+		defer app.state.Close()
+		app.Log.Info(fmt.Sprintf("%d files handled by previous runs", app.state.Len()))
+	}
+	if app.albumSync != nil {
+		err = app.albumSync.load(SyncedAlbumsFileName(app.ConfigurationFile, server, app.User.ID), app.DryRun)
+		if err != nil {
+			return err
+		}
+	}
+	if app.DCIM {
+		app.cards, err = OpenCardImports(CardFileName(app.ConfigurationFile, server, app.User.ID), app.fsyss, app.Delete && !app.DryRun, app.DryRun)
+		if err != nil {
+			return fmt.Errorf("can't identify the memory card: %w", err)
+		}
+		defer func() {
+			err := app.cards.Save()
+			if err != nil {
+				app.Log.Error(fmt.Sprintf("Can't record the memory cards: %s", err))
+			}
+		}()
+		for _, fsys := range app.fsyss {
+			id, card := app.cards.Card(fsys)
+			if card.LastImport.IsZero() {
+				app.Log.Info(fmt.Sprintf("Memory card %s: first import", id))
+			} else {
+				app.Log.Info(fmt.Sprintf("Memory card %s: last imported on %s", id, card.LastImport.Format(time.DateTime)))
+			}
+		}
+	}
+
 	switch {
 	case app.GooglePhotos:
 		app.Log.Info("Browsing google take out archive...")
 		app.browser, err = app.ReadGoogleTakeOut(ctx, app.fsyss)
+	case app.ICloud:
+		app.Log.Info("Browsing iCloud Photos export...")
+		app.browser, err = app.ReadICloudExport(ctx, app.fsyss)
+	case app.MetaExport:
+		app.Log.Info("Browsing Facebook or Instagram export...")
+		app.browser, err = app.ReadMetaExport(ctx, app.fsyss)
+	case app.PhotosLibrary:
+		app.Log.Info("Reading Apple Photos library...")
+		app.browser, err = app.ReadPhotosLibrary(ctx, app.fsyss)
+	case app.readsCatalog():
+		app.Log.Info("Reading " + app.catalogReader().source + " database...")
+		app.browser, err = app.ReadCatalogs(ctx)
 	default:
 		app.Log.Info("Browsing folder(s)...")
 		app.browser, err = app.ExploreLocalFolder(ctx, app.fsyss)
@@ -262,6 +579,10 @@ func (app *UpCmd) run(ctx context.Context) error {
 		return err
 	}
 
+	if app.Report != "" {
+		defer app.writeReport()
+	}
+
 	defer func() {
 		if app.DebugCounters {
 			fn := strings.TrimSuffix(app.LogFile, filepath.Ext(app.LogFile)) + ".csv"
@@ -287,9 +608,25 @@ func (app *UpCmd) run(ctx context.Context) error {
 	return app.runUI(ctx)
 }
 
+// writeReport writes the per file report
+func (app *UpCmd) writeReport() {
+	f, err := os.Create(app.Report)
+	if err == nil {
+		err = app.Jnl.WriteFileReport(f, app.Report)
+		err = errors.Join(err, f.Close())
+	}
+	if err != nil {
+		app.Log.Error(fmt.Sprintf("can't write the report: %s", err))
+		fmt.Println("can't write the report:", err)
+		return
+	}
+	fmt.Println("\nCheck the report file: ", app.Report)
+}
+
 func (app *UpCmd) getImmichAlbums(ctx context.Context) error {
 	serverAlbums, err := app.Immich.GetAllAlbums(ctx)
 	app.albums = map[string]immich.AlbumSimplified{}
+	app.sharedAlbums = map[string]bool{}
 	if err != nil {
 		return fmt.Errorf("can't get the album list from the server: %w", err)
 	}
@@ -342,35 +679,68 @@ func (app *UpCmd) getImmichAssets(ctx context.Context, updateFn progressUpdate)
 
 func (app *UpCmd) uploadLoop(ctx context.Context) error {
 	var err error
-	assetChan := app.browser.Browse(ctx)
-assetLoop:
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
 
-		case a, ok := <-assetChan:
-			if !ok {
-				break assetLoop
-			}
-			if a.Err != nil {
-				app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, a.Err.Error())
-			} else {
-				err = app.handleAsset(ctx, a)
-				if err != nil {
-					app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, a.Err.Error())
+	// The workers' context is cancelled when a worker fails: the other workers and the browser stop too.
+	workers, wctx := errgroup.WithContext(ctx)
+	assetChan := app.browser.Browse(wctx)
+	if app.Watch {
+		assetChan = app.watchFolders(wctx, assetChan)
+	}
+	if app.cards != nil {
+		assetChan = app.cards.follow(wctx, assetChan)
+	}
+
+	// Start the upload workers. They share the asset channel, and stop when it's closed or when the context is cancelled.
+	for i := 0; i < app.ConcurrentUploads; i++ {
+		workers.Go(func() error {
+			for {
+				select {
+				case <-wctx.Done():
+					return wctx.Err()
+
+				case a, ok := <-assetChan:
+					if !ok {
+						return nil
+					}
+					err := app.waitUploadWindow(wctx)
+					if err != nil {
+						return err
+					}
+					if a.Err != nil {
+						app.Jnl.Record(wctx, fileevent.Error, a, a.FileName, "error", a.Err.Error())
+						app.syncAlbumFailed(a)
+					} else {
+						err = app.handleAsset(wctx, a)
+						if err != nil {
+							app.Jnl.Record(wctx, fileevent.Error, a, a.FileName, "error", err.Error())
+							app.syncAlbumFailed(a)
+						}
+					}
 				}
 			}
+		})
+	}
+	err = workers.Wait()
+	if err != nil {
+		return err
+	}
+
+	if app.manifest != nil {
+		err = app.closeManifest(ctx)
+		if err != nil {
+			return err
 		}
 	}
 
-	if app.CreateStacks {
+	if app.CreateStacks || app.stackEdited() {
 		stacks := app.stacks.Stacks()
 		if len(stacks) > 0 {
 			app.Log.Info("Creating stacks")
 		nextStack:
 			for _, s := range stacks {
 				switch {
+				case !app.CreateStacks && s.StackType != stacking.StackEdited:
+					continue nextStack
 				case !app.StackBurst && s.StackType == stacking.StackBurst:
 					continue nextStack
 				case !app.StackJpgRaws && s.StackType == stacking.StackRawJpg:
@@ -381,12 +751,30 @@ assetLoop:
 					err = app.Immich.StackAssets(ctx, s.CoverID, s.IDs)
 					if err != nil {
 						app.Log.Error(fmt.Sprintf("Can't stack images: %s", err))
+						continue nextStack
 					}
+					if app.state != nil {
+						err = app.state.SetStacked(append([]string{s.CoverID}, s.IDs...))
+						if err != nil {
+							app.Log.Error(fmt.Sprintf("Can't record the upload state: %s", err))
+						}
+					}
+				}
+				for _, fn := range s.FileNames {
+					app.Jnl.Record(ctx, fileevent.Stacked, nil, fn, "stack", s.CoverID)
 				}
 			}
 		}
 	}
 
+	if app.albumSync != nil {
+		app.Log.Info("Synchronizing albums")
+		err = app.syncFolderAlbums(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
 	// if app.CreateAlbums || app.CreateAlbumAfterFolder || (app.KeepPartner && app.PartnerAlbum != "") || app.ImportIntoAlbum != "" {
 	// 	app.Log.Info("Managing albums")
 	// 	err = app.ManageAlbums(ctx)
@@ -407,11 +795,67 @@ assetLoop:
 		}
 	}
 
-	if len(app.deleteLocalList) > 0 {
-		err = app.DeleteLocalAssets()
+	return err
+}
+
+// waitUploadWindow pauses the upload until the upload window opens
+func (app *UpCmd) waitUploadWindow(ctx context.Context) error {
+	now := time.Now()
+	if app.UploadWindow.Contains(now) {
+		return nil
+	}
+	until := app.UploadWindow.NextStart(now)
+	if app.pausedUntil.Swap(until.Unix()) != until.Unix() {
+		app.Log.Info(fmt.Sprintf("Upload paused until %s", until.Format("15:04")))
+	}
+
+	t := time.NewTimer(time.Until(until))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+	}
+	if app.pausedUntil.Swap(0) != 0 {
+		app.Log.Info("Upload resumed")
 	}
+	return nil
+}
 
-	return err
+// pausedMessage gives the pause state for the progress views
+func (app *UpCmd) pausedMessage() string {
+	if u := app.pausedUntil.Load(); u != 0 {
+		return "paused until " + time.Unix(u, 0).Format("15:04")
+	}
+	return ""
+}
+
+// watchFolders forwards the assets of the first pass, then the new files found in the folders until the context is cancelled
+func (app *UpCmd) watchFolders(ctx context.Context, firstPass chan *browser.LocalAssetFile) chan *browser.LocalAssetFile {
+	assetChan := make(chan *browser.LocalAssetFile)
+	go func() {
+		defer close(assetChan)
+		forward := func(c chan *browser.LocalAssetFile) bool {
+			for a := range c {
+				select {
+				case <-ctx.Done():
+					return false
+				case assetChan <- a:
+				}
+			}
+			return ctx.Err() == nil
+		}
+		if !forward(firstPass) {
+			return
+		}
+		lb, ok := app.browser.(*files.LocalAssetBrowser)
+		if !ok {
+			return
+		}
+		app.Log.Info("Watching the folders for new files. Press Ctrl+C to stop.")
+		forward(lb.Watch(ctx, files.WatchOptions{Settle: app.WatchSettle, Poll: app.WatchPoll}))
+	}()
+	return assetChan
 }
 
 func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) error {
@@ -420,42 +864,33 @@ func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) er
 	}()
 	ext := path.Ext(a.FileName)
 	if app.BrowserConfig.ExcludeExtensions.Exclude(ext) {
-		app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", "extension in rejection list")
+		app.notSelected(ctx, a, "extension in rejection list")
 		return nil
 	}
 	if !app.BrowserConfig.SelectExtensions.Include(ext) {
-		app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", "extension not in selection list")
-		return nil
-	}
-
-	if !app.KeepPartner && a.FromPartner {
-		app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", "partners asset excluded")
+		app.notSelected(ctx, a, "extension not in selection list")
 		return nil
 	}
 
-	if !app.KeepTrashed && a.Trashed {
-		app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", "trashed asset excluded")
+	cats := app.categories(a)
+	if !app.applyCategoryPolicies(ctx, a, cats) {
+		app.cardDone(a)
 		return nil
 	}
 
 	if app.ImportFromAlbum != "" && !app.isInAlbum(a, app.ImportFromAlbum) {
-		app.Jnl.Record(ctx, fileevent.UploadNotSelected, a.FileName, "reason", "doesn't belong to required album")
-		return nil
-	}
-
-	if app.DiscardArchived && a.Archived {
-		app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", "archived asset are discarded")
+		app.notSelected(ctx, a, "doesn't belong to required album")
 		return nil
 	}
 
 	if app.DateRange.IsSet() {
 		d := a.Metadata.DateTaken
 		if d.IsZero() {
-			app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", "date of capture is unknown")
+			app.notSelected(ctx, a, "date of capture is unknown")
 			return nil
 		}
 		if !app.DateRange.InRange(d) {
-			app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", "date of capture is out of the given range")
+			app.notSelected(ctx, a, "date of capture is out of the given range")
 			return nil
 		}
 	}
@@ -466,50 +901,205 @@ func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) er
 		})
 	}
 
-	advice, err := app.AssetIndex.ShouldUpload(a)
+	var stateKey string
+	if app.state != nil {
+		var err error
+		stateKey, err = StateKey(a)
+		if err != nil {
+			return err
+		}
+		if e, ok := app.state.Get(stateKey); ok {
+			app.resumeAsset(ctx, a, e)
+			return nil
+		}
+	}
+
+	if app.manifest != nil {
+		if e, ok := app.manifest.Previous(gp.ManifestKey(a)); ok && e.ID != "" {
+			app.updateFromManifest(ctx, a, e)
+			return nil
+		}
+	}
+
+	if app.CompareChecksum {
+		_, err := a.ComputeChecksum()
+		if err != nil {
+			return err
+		}
+		if app.state != nil {
+			if e, ok := app.state.GetByHash(a.Checksum); ok {
+				app.resumeAsset(ctx, a, e)
+				return nil
+			}
+		}
+	}
+
+	// Another worker can't upload a copy of the asset until this one is handled
+	advice, release, err := app.AssetIndex.ReserveUpload(ctx, a)
 	if err != nil {
 		return err
 	}
+	defer release()
+
+	if app.CompareChecksum && advice.Advice == NotOnServer {
+		advice, err = app.checkServerChecksum(ctx, a, advice)
+		if err != nil {
+			return err
+		}
+	}
 
 	switch advice.Advice {
 	case NotOnServer: // Upload and manage albums
 		ID, err := app.UploadAsset(ctx, a)
 		if err != nil {
+			app.syncAlbumFailed(a)
 			return nil
 		}
+		app.recordState(ctx, a, stateKey, ID, StateUploaded)
 		app.manageAssetAlbum(ctx, ID, a, advice)
+		app.manageCategoryAlbums(ctx, ID, a, cats)
+		app.recordAlbumsDone(ctx, a, stateKey)
+		app.applyPeople(ctx, ID, a, stateKey)
+		app.recordManifest(a, ID)
+		app.trashCategory(ctx, a, ID, cats)
+		app.deleteLocalAsset(ctx, a, ID)
 
 	case SmallerOnServer: // Upload, manage albums and delete the server's asset
 		app.Jnl.Record(ctx, fileevent.UploadUpgraded, a, a.FileName, "reason", advice.Message)
 		// add the superior asset into albums of the original asset.
 		ID, err := app.UploadAsset(ctx, a)
 		if err != nil {
+			app.syncAlbumFailed(a)
 			return nil
 		}
+		app.recordState(ctx, a, stateKey, ID, StateUploaded)
 		app.manageAssetAlbum(ctx, ID, a, advice)
+		app.manageCategoryAlbums(ctx, ID, a, cats)
+		app.recordAlbumsDone(ctx, a, stateKey)
+		app.applyPeople(ctx, ID, a, stateKey)
+		app.recordManifest(a, ID)
+		app.trashCategory(ctx, a, ID, cats)
 		// delete the existing lower quality asset
 		err = app.deleteAsset(ctx, advice.ServerAsset.ID)
 		if err != nil {
 			app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
 		}
+		app.deleteLocalAsset(ctx, a, ID)
 
 	case SameOnServer: // manage albums
 		// Set add the server asset into albums determined locally
 		if !advice.ServerAsset.JustUploaded {
-			app.Jnl.Record(ctx, fileevent.UploadServerDuplicate, a, a.FileName, "reason", advice.Message)
+			app.Jnl.Record(ctx, fileevent.UploadServerDuplicate, a, a.FileName, "reason", advice.Message, "id", advice.ServerAsset.ID)
 		} else {
 			app.Jnl.Record(ctx, fileevent.AnalysisLocalDuplicate, a, a.FileName)
 		}
+		app.recordState(ctx, a, stateKey, advice.ServerAsset.ID, StateSkipped)
 		app.manageAssetAlbum(ctx, advice.ServerAsset.ID, a, advice)
+		app.manageCategoryAlbums(ctx, advice.ServerAsset.ID, a, cats)
+		app.recordAlbumsDone(ctx, a, stateKey)
+		app.applyPeople(ctx, advice.ServerAsset.ID, a, stateKey)
+		if app.manifest != nil && !advice.ServerAsset.JustUploaded {
+			app.updateFlags(ctx, a, advice.ServerAsset.ID, advice.ServerAsset.IsFavorite, advice.ServerAsset.IsArchived)
+		}
+		app.recordManifest(a, advice.ServerAsset.ID)
+		app.deleteLocalAsset(ctx, a, advice.ServerAsset.ID)
 
 	case BetterOnServer: // and manage albums
-		app.Jnl.Record(ctx, fileevent.UploadServerBetter, a, a.FileName, "reason", advice.Message)
+		app.Jnl.Record(ctx, fileevent.UploadServerBetter, a, a.FileName, "reason", advice.Message, "id", advice.ServerAsset.ID)
+		app.recordState(ctx, a, stateKey, advice.ServerAsset.ID, StateSkipped)
 		app.manageAssetAlbum(ctx, advice.ServerAsset.ID, a, advice)
+		app.manageCategoryAlbums(ctx, advice.ServerAsset.ID, a, cats)
+		app.recordAlbumsDone(ctx, a, stateKey)
+		app.applyPeople(ctx, advice.ServerAsset.ID, a, stateKey)
+		if app.manifest != nil {
+			app.updateFlags(ctx, a, advice.ServerAsset.ID, advice.ServerAsset.IsFavorite, advice.ServerAsset.IsArchived)
+		}
+		app.recordManifest(a, advice.ServerAsset.ID)
 	}
 
 	return nil
 }
 
+// checkServerChecksum asks the server if it has an asset with the same checksum than the local file
+func (app *UpCmd) checkServerChecksum(ctx context.Context, a *browser.LocalAssetFile, advice *Advice) (*Advice, error) {
+	r, err := app.checksums.check(ctx, a.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	if r.Action == immich.BulkUploadReject && r.AssetID != "" {
+		return app.AssetIndex.adviceSameContentOnServer(&immich.Asset{ID: r.AssetID, Checksum: a.Checksum, IsTrashed: r.IsTrashed}), nil
+	}
+	return advice, nil
+}
+
+// resumeAsset handles a file already handled by a previous run.
+// Pending album, people and stack operations are replayed.
+func (app *UpCmd) resumeAsset(ctx context.Context, a *browser.LocalAssetFile, e StateEntry) {
+	app.Jnl.Record(ctx, fileevent.UploadResumed, a, a.FileName, "status", string(e.Status), "id", e.ID)
+	app.cardDone(a)
+	if !e.Albums {
+		app.manageAssetAlbum(ctx, e.ID, a, &Advice{})
+		app.recordAlbumsDone(ctx, a, e.Key)
+	} else if app.albumSync != nil {
+		app.syncAlbumAdd(a, e.ID)
+	}
+	if !e.People {
+		app.applyPeople(ctx, e.ID, a, e.Key)
+	}
+	if (app.CreateStacks || app.stackEdited()) && e.Status == StateUploaded && !e.Stacked {
+		app.stacks.ProcessAsset(e.ID, app.stackName(a), a.Metadata.DateTaken)
+	}
+	app.deleteLocalAsset(ctx, a, e.ID)
+}
+
+// notSelected records that the file is skipped on purpose
+func (app *UpCmd) notSelected(ctx context.Context, a *browser.LocalAssetFile, reason string) {
+	app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", reason)
+	app.cardDone(a)
+}
+
+// cardDone records that the file of a memory card is settled: on the server, or skipped on purpose.
+// The files in error aren't settled: the next import of the card reads them again.
+func (app *UpCmd) cardDone(a *browser.LocalAssetFile) {
+	if app.cards != nil {
+		app.cards.Done(a)
+	}
+}
+
+// recordState saves the state of the file for the next run
+func (app *UpCmd) recordState(ctx context.Context, a *browser.LocalAssetFile, stateKey string, id string, status StateStatus) {
+	app.cardDone(a)
+	if app.state == nil || app.DryRun {
+		return
+	}
+	err := app.state.Set(StateEntry{Key: stateKey, Hash: a.Checksum, ID: id, Status: status})
+	if err != nil {
+		app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", "can't record the upload state: "+err.Error())
+	}
+}
+
+// recordAlbumsDone saves that albums of the file are up to date
+func (app *UpCmd) recordAlbumsDone(ctx context.Context, a *browser.LocalAssetFile, stateKey string) {
+	if app.state == nil || app.DryRun {
+		return
+	}
+	err := app.state.SetAlbumsDone(stateKey)
+	if err != nil {
+		app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", "can't record the upload state: "+err.Error())
+	}
+}
+
+// applyPeople applies the people of the file, and saves it when they are all applied
+func (app *UpCmd) applyPeople(ctx context.Context, id string, a *browser.LocalAssetFile, stateKey string) {
+	if !app.managePeople(ctx, id, a) || app.state == nil || app.DryRun {
+		return
+	}
+	err := app.state.SetPeopleDone(stateKey)
+	if err != nil {
+		app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", "can't record the upload state: "+err.Error())
+	}
+}
+
 func (app *UpCmd) deleteAsset(ctx context.Context, id string) error {
 	return app.Immich.DeleteAssets(ctx, []string{id}, true)
 }
@@ -533,14 +1123,11 @@ func (app *UpCmd) manageAssetAlbum(ctx context.Context, assetID string, a *brows
 
 	if app.CreateAlbums {
 		for _, al := range a.Albums {
-			album := al.Title
-			if app.GooglePhotos && (app.CreateAlbumAfterFolder || app.UseFolderAsAlbumName || album == "") {
-				album = filepath.Base(al.Path)
-			}
+			album := app.createdAlbumName(al)
 			if _, exist := addedTo[album]; !exist {
 				app.Jnl.Record(ctx, fileevent.UploadAddToAlbum, a, a.FileName, "album", album)
 				if !app.DryRun {
-					err := app.AddToAlbum(ctx, assetID, browser.LocalAlbum{Title: album})
+					err := app.AddToAlbum(ctx, assetID, browser.LocalAlbum{Title: album, Sharing: al.Sharing})
 					if err != nil {
 						app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
 					}
@@ -558,29 +1145,13 @@ func (app *UpCmd) manageAssetAlbum(ctx context.Context, assetID string, a *brows
 		}
 	}
 
-	if app.GooglePhotos {
-		if app.PartnerAlbum != "" && a.FromPartner {
-			app.Jnl.Record(ctx, fileevent.UploadAddToAlbum, a, a.FileName, "album", app.PartnerAlbum, "reason", "option -partner-album")
-			if !app.DryRun {
-				err := app.AddToAlbum(ctx, assetID, browser.LocalAlbum{Title: app.PartnerAlbum})
-				if err != nil {
-					app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
-				}
-			}
-		}
-	} else {
+	if !app.GooglePhotos {
 		if app.CreateAlbumAfterFolder {
-			album := path.Base(path.Dir(a.FileName))
-			if !app.GooglePhotos && app.UseFullPathAsAlbumName {
-				// full path
-				album = strings.Replace(filepath.Dir(a.FileName), string(os.PathSeparator), app.AlbumNamePathSeparator, -1)
-			}
-			if album == "" || album == "." {
-				if fsys, ok := a.FSys.(fshelper.NameFS); ok {
-					album = fsys.Name()
-				} else {
-					album = "no-folder-name"
-				}
+			album := app.folderAlbumName(a)
+			if app.albumSync != nil {
+				// The album is updated once all files are handled
+				app.syncAlbumAdd(a, assetID)
+				return
 			}
 			app.Jnl.Record(ctx, fileevent.UploadAddToAlbum, a, a.FileName, "album", album, "reason", "option -create-album-folder")
 			if !app.DryRun {
@@ -593,6 +1164,28 @@ func (app *UpCmd) manageAssetAlbum(ctx context.Context, assetID string, a *brows
 	}
 }
 
+// folderAlbumName gives the album name of the file for the option -create-album-folder
+func (app *UpCmd) folderAlbumName(a *browser.LocalAssetFile) string {
+	return app.folderAlbum(a.FSys, path.Dir(a.FileName))
+}
+
+// folderAlbum gives the album name of the folder for the option -create-album-folder
+func (app *UpCmd) folderAlbum(fsys fs.FS, dir string) string {
+	album := path.Base(dir)
+	if app.UseFullPathAsAlbumName {
+		// full path
+		album = strings.Replace(filepath.FromSlash(dir), string(os.PathSeparator), app.AlbumNamePathSeparator, -1)
+	}
+	if album == "" || album == "." {
+		if fsys, ok := fsys.(fshelper.NameFS); ok {
+			album = fsys.Name()
+		} else {
+			album = "no-folder-name"
+		}
+	}
+	return album
+}
+
 func (app *UpCmd) isInAlbum(a *browser.LocalAssetFile, album string) bool {
 	for _, al := range a.Albums {
 		if app.albumName(al) == album {
@@ -610,9 +1203,129 @@ func (app *UpCmd) ReadGoogleTakeOut(ctx context.Context, fsyss []fs.FS) (browser
 	}
 	b.SetBannedFiles(app.BannedFiles)
 	b.SetAcceptMissingJSON(app.ForceUploadWhenNoJSON)
+	if app.manifest != nil {
+		b.SetManifest(app.manifest)
+	}
+	switch app.EditedVersions {
+	case "edited":
+		b.SetEditedVersions(browser.KeepEditedVersion)
+	case "original":
+		b.SetEditedVersions(browser.KeepOriginalVersion)
+	}
 	return b, err
 }
 
+func (app *UpCmd) ReadICloudExport(ctx context.Context, fsyss []fs.FS) (browser.Browser, error) {
+	app.Delete = false
+	b, err := icloud.NewExport(ctx, app.Jnl, app.Immich.SupportedMedia(), fsyss...)
+	if err != nil {
+		return nil, err
+	}
+	b.SetBannedFiles(app.BannedFiles)
+	return b, nil
+}
+
+func (app *UpCmd) ReadMetaExport(ctx context.Context, fsyss []fs.FS) (browser.Browser, error) {
+	app.Delete = false
+	b, err := meta.NewExport(ctx, app.Jnl, app.Immich.SupportedMedia(), fsyss...)
+	if err != nil {
+		return nil, err
+	}
+	b.SetBannedFiles(app.BannedFiles)
+	b.SetAcceptMissingJSON(app.ForceUploadWhenNoJSON)
+	return b, nil
+}
+
+func (app *UpCmd) ReadPhotosLibrary(ctx context.Context, fsyss []fs.FS) (browser.Browser, error) {
+	app.Delete = false
+	b, err := applephotos.NewLibrary(ctx, app.Jnl, app.Immich.SupportedMedia(), fsyss...)
+	if err != nil {
+		return nil, err
+	}
+	b.SetBannedFiles(app.BannedFiles)
+	switch app.EditedVersions {
+	case "edited":
+		b.SetEditedVersions(browser.KeepEditedVersion)
+	case "original":
+		b.SetEditedVersions(browser.KeepOriginalVersion)
+	}
+	return b, nil
+}
+
+// catalogReader reads the databases of a photo manager
+type catalogReader struct {
+	source string // name of the photo manager
+	kind   string // kind of database, with its file extension
+	ext    string
+	read   func(ctx context.Context, name string) ([]files.CatalogFolder, error)
+}
+
+// readsCatalog tells if the files are given by the database of a photo manager
+func (app *UpCmd) readsCatalog() bool {
+	return app.Lightroom || app.DigiKam || app.Shotwell
+}
+
+// catalogReader gives the reader of the photo manager's databases
+func (app *UpCmd) catalogReader() catalogReader {
+	switch {
+	case app.DigiKam:
+		return catalogReader{source: "digiKam", kind: "digiKam database (digikam4.db file)", ext: ".db", read: digikam.ReadDatabase}
+	case app.Shotwell:
+		return catalogReader{source: "Shotwell", kind: "Shotwell database (photo.db file)", ext: ".db", read: shotwell.ReadDatabase}
+	default:
+		return catalogReader{source: "Lightroom", kind: "Lightroom catalog (.lrcat file)", ext: ".lrcat", read: lightroom.ReadCatalog}
+	}
+}
+
+// readCatalogs reads the databases given as arguments, and returns their folders found on this computer
+func (app *UpCmd) readCatalogs(ctx context.Context, args []string) ([]fs.FS, error) {
+	r := app.catalogReader()
+	var fsyss []fs.FS
+	for _, a := range args {
+		names, err := filepath.Glob(a)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("the %s %s isn't found", r.kind, a)
+		}
+		for _, name := range names {
+			if !strings.EqualFold(filepath.Ext(name), r.ext) {
+				return nil, fmt.Errorf("%s isn't a %s", name, r.kind)
+			}
+			folders, err := r.read(ctx, name)
+			if err != nil {
+				return nil, fmt.Errorf("can't read the %s %s: %w", r.kind, name, err)
+			}
+			for _, f := range folders {
+				if f.FSys == nil {
+					app.Log.Warn("folder of the "+r.source+" database not found", "database", name, "folder", f.Path)
+					continue
+				}
+				fsyss = append(fsyss, f.FSys)
+			}
+			app.catalogs = append(app.catalogs, folders...)
+		}
+	}
+	return fsyss, nil
+}
+
+func (app *UpCmd) ReadCatalogs(ctx context.Context) (browser.Browser, error) {
+	app.Delete = false
+	b, err := files.NewCatalogBrowser(ctx, app.Jnl, app.Immich.SupportedMedia(), app.catalogReader().source, app.catalogs...)
+	if err != nil {
+		return nil, err
+	}
+	b.SetBannedFiles(app.BannedFiles)
+	b.SetWhenNoDate(app.WhenNoDate)
+	return b, nil
+}
+
+// stackEdited tells if the edited versions are stacked with their original
+func (app *UpCmd) stackEdited() bool {
+	return strings.HasPrefix(app.EditedVersions, "stack-")
+}
+
 func (app *UpCmd) ExploreLocalFolder(ctx context.Context, fsyss []fs.FS) (browser.Browser, error) {
 	b, err := files.NewLocalFiles(ctx, app.Jnl, fsyss...)
 	if err != nil {
@@ -621,6 +1334,9 @@ func (app *UpCmd) ExploreLocalFolder(ctx context.Context, fsyss []fs.FS) (browse
 	b.SetSupportedMedia(app.Immich.SupportedMedia())
 	b.SetWhenNoDate(app.WhenNoDate)
 	b.SetBannedFiles(app.BannedFiles)
+	if app.cards != nil {
+		b.SetDCIM(app.cards.LastImported())
+	}
 	return b, nil
 }
 
@@ -630,17 +1346,16 @@ func (app *UpCmd) ExploreLocalFolder(ctx context.Context, fsyss []fs.FS) (browse
 func (app *UpCmd) UploadAsset(ctx context.Context, a *browser.LocalAssetFile) (string, error) {
 	var resp, liveResp immich.AssetResponse
 	var err error
-	if !app.AutoArchive && a.Archived {
-		a.Archived = false
-	}
+	a.SideCar.Policy = app.SideCarPolicy
 	if !app.DryRun {
 		if a.LivePhoto != nil {
+			a.LivePhoto.SideCar.Policy = app.SideCarPolicy
 			liveResp, err = app.Immich.AssetUpload(ctx, a.LivePhoto)
 			if err == nil {
 				if liveResp.Status == immich.UploadDuplicate {
-					app.Jnl.Record(ctx, fileevent.UploadServerDuplicate, a.LivePhoto, a.LivePhoto.FileName, "info", "the server has this file")
+					app.Jnl.Record(ctx, fileevent.UploadServerDuplicate, a.LivePhoto, a.LivePhoto.FileName, "info", "the server has this file", "id", liveResp.ID)
 				} else {
-					app.Jnl.Record(ctx, fileevent.Uploaded, a.LivePhoto, a.LivePhoto.FileName)
+					app.Jnl.Record(ctx, fileevent.Uploaded, a.LivePhoto, a.LivePhoto.FileName, "id", liveResp.ID)
 				}
 				a.LivePhotoID = liveResp.ID
 			} else {
@@ -651,10 +1366,10 @@ func (app *UpCmd) UploadAsset(ctx context.Context, a *browser.LocalAssetFile) (s
 		resp, err = app.Immich.AssetUpload(ctx, a)
 		if err == nil {
 			if resp.Status == immich.UploadDuplicate {
-				app.Jnl.Record(ctx, fileevent.UploadServerDuplicate, a, a.FileName, "info", "the server has this file")
+				app.Jnl.Record(ctx, fileevent.UploadServerDuplicate, a, a.FileName, "info", "the server has this file", "id", resp.ID)
 			} else {
 				b.LivePhoto = nil
-				app.Jnl.Record(ctx, fileevent.Uploaded, &b, b.FileName, "capture date", b.Metadata.DateTaken.String())
+				app.Jnl.Record(ctx, fileevent.Uploaded, &b, b.FileName, "capture date", b.Metadata.DateTaken.String(), "id", resp.ID)
 			}
 		} else {
 			app.Jnl.Record(ctx, fileevent.UploadServerError, a, a.FileName, "error", err.Error())
@@ -666,15 +1381,15 @@ func (app *UpCmd) UploadAsset(ctx context.Context, a *browser.LocalAssetFile) (s
 			liveResp.ID = uuid.NewString()
 		}
 		resp.ID = uuid.NewString()
-		app.Jnl.Record(ctx, fileevent.Uploaded, a, a.FileName, "capture date", a.Metadata.DateTaken.String())
+		app.Jnl.Record(ctx, fileevent.Uploaded, a, a.FileName, "capture date", a.Metadata.DateTaken.String(), "id", resp.ID)
 	}
 	if resp.Status != immich.UploadDuplicate {
 		if a.LivePhoto != nil && liveResp.ID != "" {
 			app.AssetIndex.AddLocalAsset(a, liveResp.ID)
 		}
 		app.AssetIndex.AddLocalAsset(a, resp.ID)
-		if app.CreateStacks {
-			app.stacks.ProcessAsset(resp.ID, a.FileName, a.Metadata.DateTaken)
+		if app.CreateStacks || app.stackEdited() {
+			app.stacks.ProcessAsset(resp.ID, app.stackName(a), a.Metadata.DateTaken)
 		}
 	}
 
@@ -694,41 +1409,76 @@ func (app *UpCmd) albumName(al browser.LocalAlbum) string {
 	return Name
 }
 
+// createdAlbumName gives the name of the server's album for the local album
+func (app *UpCmd) createdAlbumName(al browser.LocalAlbum) string {
+	album := al.Title
+	if app.GooglePhotos && (app.CreateAlbumAfterFolder || app.UseFolderAsAlbumName || album == "") {
+		album = filepath.Base(al.Path)
+	}
+	if (app.PhotosLibrary || app.readsCatalog()) && app.UseFullPathAsAlbumName && al.Path != "" {
+		// the path gives the album's folders, or the collection sets
+		album = strings.Join(strings.Split(al.Path, "/"), app.AlbumNamePathSeparator)
+	}
+	return album
+}
+
+// stackName gives the name used to detect the stacks.
+// The files of a Photos library are named after their UUID, their title is the original file name.
+func (app *UpCmd) stackName(a *browser.LocalAssetFile) string {
+	if app.PhotosLibrary {
+		return a.Title
+	}
+	return a.FileName
+}
+
 // AddToAlbum add the ID to the immich album having the same name as the local album
+//
+// The album cache is locked only to read and update it. An album is created once:
+// the workers adding assets to an album being created wait for its creation.
 func (app *UpCmd) AddToAlbum(ctx context.Context, id string, album browser.LocalAlbum) error {
 	title := album.Title
 
+	app.albumsLock.Lock()
 	l, exist := app.albums[title]
-	if !exist {
-		a, err := app.Immich.CreateAlbum(ctx, title, album.Description, []string{id})
-		if err != nil {
-			return err
-		}
-		app.albums[title] = immich.AlbumSimplified{ID: a.ID, AlbumName: a.AlbumName, Description: a.Description}
-	} else {
+	app.albumsLock.Unlock()
+	if exist {
 		_, err := app.Immich.AddAssetToAlbum(ctx, l.ID, []string{id})
-		if err != nil {
-			return err
-		}
+		app.reconcileSharing(ctx, l.ID, album)
+		return err
 	}
-	return nil
-}
-
-func (app *UpCmd) DeleteLocalAssets() error {
-	app.Log.Info(fmt.Sprintf("%d local assets to delete.", len(app.deleteLocalList)))
 
-	for _, a := range app.deleteLocalList {
-		if !app.DryRun {
-			app.Log.Info(fmt.Sprintf("delete file %q", a.Title))
-			err := a.Remove()
-			if err != nil {
-				return err
-			}
-		} else {
-			app.Log.Info(fmt.Sprintf("file %q not deleted, dry run mode.", a.Title))
+	created := false
+	v, err, _ := app.albumsCreation.Do(title, func() (any, error) {
+		// The album may have been created by a worker in the meantime
+		app.albumsLock.Lock()
+		l, exist := app.albums[title]
+		app.albumsLock.Unlock()
+		if exist {
+			return l, nil
+		}
+		a, err := app.Immich.CreateAlbum(ctx, title, album.Description, []string{id})
+		if err != nil {
+			return nil, err
 		}
+		l = immich.AlbumSimplified{ID: a.ID, AlbumName: a.AlbumName, Description: a.Description}
+		app.albumsLock.Lock()
+		app.albums[title] = l
+		app.sharedAlbums[l.ID] = true
+		app.albumsLock.Unlock()
+		created = true
+		return l, nil
+	})
+	if err != nil {
+		return err
 	}
-	return nil
+	l = v.(immich.AlbumSimplified)
+	if created {
+		app.shareAlbum(ctx, l.ID, album, true)
+		return nil
+	}
+	_, err = app.Immich.AddAssetToAlbum(ctx, l.ID, []string{id})
+	app.reconcileSharing(ctx, l.ID, album)
+	return err
 }
 
 func (app *UpCmd) DeleteServerAssets(ctx context.Context, ids []string) error {
@@ -857,6 +1607,18 @@ func (ai *AssetIndex) adviceSameOnServer(sa *immich.Asset) *Advice {
 	}
 }
 
+func (ai *AssetIndex) adviceSameContentOnServer(sa *immich.Asset) *Advice {
+	msg := fmt.Sprintf("An asset with the same content (SHA-1:%s) exists on the server. No need to upload.", sa.Checksum)
+	if sa.IsTrashed {
+		msg = fmt.Sprintf("An asset with the same content (SHA-1:%s) exists in the server's trash. No need to upload.", sa.Checksum)
+	}
+	return &Advice{
+		Advice:      SameOnServer,
+		Message:     msg,
+		ServerAsset: sa,
+	}
+}
+
 func (ai *AssetIndex) adviceSmallerOnServer(sa *immich.Asset) *Advice {
 	return &Advice{
 		Advice:      SmallerOnServer,
@@ -886,17 +1648,28 @@ func (ai *AssetIndex) adviceNotOnServer() *Advice {
 // The server may have the asset, but in lower resolution. Compare the taken date and resolution
 
 func (ai *AssetIndex) ShouldUpload(la *browser.LocalAssetFile) (*Advice, error) {
-	filename := la.Title
-	if path.Ext(filename) == "" {
-		filename += path.Ext(la.FileName)
-	}
+	ai.lock.RLock()
+	defer ai.lock.RUnlock()
+	return ai.shouldUpload(la), nil
+}
+
+// shouldUpload gives the advice, the index must be locked
+func (ai *AssetIndex) shouldUpload(la *browser.LocalAssetFile) *Advice {
+	filename := assetFileName(la)
 
 	ID := la.DeviceAssetID()
 
 	sa := ai.byID[ID]
 	if sa != nil {
 		// the same ID exist on the server
-		return ai.adviceSameOnServer(sa), nil
+		return ai.adviceSameOnServer(sa)
+	}
+
+	if la.Checksum != "" {
+		if l := ai.byHash[la.Checksum]; len(l) > 0 {
+			// the same content exists on the server, whatever its name or its date
+			return ai.adviceSameContentOnServer(l[0])
+		}
 	}
 
 	var l []*immich.Asset
@@ -920,15 +1693,15 @@ func (ai *AssetIndex) ShouldUpload(la *browser.LocalAssetFile) (*Advice, error)
 
 			switch {
 			case compareDate == 0 && compareSize == 0:
-				return ai.adviceSameOnServer(sa), nil
+				return ai.adviceSameOnServer(sa)
 			case compareDate == 0 && compareSize > 0:
-				return ai.adviceSmallerOnServer(sa), nil
+				return ai.adviceSmallerOnServer(sa)
 			case compareDate == 0 && compareSize < 0:
-				return ai.adviceBetterOnServer(sa), nil
+				return ai.adviceBetterOnServer(sa)
 			}
 		}
 	}
-	return ai.adviceNotOnServer(), nil
+	return ai.adviceNotOnServer()
 }
 
 func compareDate(d1 time.Time, d2 time.Time) int {
@@ -3,11 +3,15 @@ package upload
 import (
 	"cmp"
 	"context"
+	"errors"
 	"io"
 	"log/slog"
+	"os"
 	"reflect"
 	"slices"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/kr/pretty"
 	"github.com/simulot/immich-go/browser"
@@ -27,6 +31,14 @@ func (c *stubIC) AssetUpload(context.Context, *browser.LocalAssetFile) (immich.A
 	return immich.AssetResponse{}, nil
 }
 
+func (c *stubIC) CheckBulkUpload(context.Context, []immich.BulkUploadCheckItem) ([]immich.BulkUploadCheckResult, error) {
+	return nil, nil
+}
+
+func (c *stubIC) GetAssetByID(context.Context, string) (*immich.Asset, error) {
+	return &immich.Asset{}, nil
+}
+
 func (c *stubIC) DeleteAssets(context.Context, []string, bool) error {
 	return nil
 }
@@ -39,6 +51,10 @@ func (c *stubIC) AddAssetToAlbum(context.Context, string, []string) ([]immich.Up
 	return nil, nil
 }
 
+func (c *stubIC) RemoveAssetFromAlbum(context.Context, string, []string) ([]immich.UpdateAlbumResult, error) {
+	return nil, nil
+}
+
 func (c *stubIC) CreateAlbum(context.Context, string, string, []string) (immich.AlbumSimplified, error) {
 	return immich.AlbumSimplified{}, nil
 }
@@ -47,6 +63,42 @@ func (c *stubIC) UpdateAssets(ctx context.Context, ids []string, isArchived bool
 	return nil
 }
 
+func (c *stubIC) GetAllPeople(ctx context.Context) ([]immich.Person, error) {
+	return nil, nil
+}
+
+func (c *stubIC) CreatePerson(ctx context.Context, name string) (immich.Person, error) {
+	return immich.Person{}, nil
+}
+
+func (c *stubIC) AddAssetToPerson(ctx context.Context, assetID string, personID string, region browser.FaceRegion) error {
+	return nil
+}
+
+func (c *stubIC) GetAssetFaces(ctx context.Context, assetID string) ([]immich.Face, error) {
+	return nil, nil
+}
+
+func (c *stubIC) UpsertTags(ctx context.Context, names []string) ([]immich.Tag, error) {
+	return nil, nil
+}
+
+func (c *stubIC) TagAssets(ctx context.Context, tagID string, assetIDs []string) error {
+	return nil
+}
+
+func (c *stubIC) GetAllUsers(ctx context.Context) ([]immich.User, error) {
+	return nil, nil
+}
+
+func (c *stubIC) AddUsersToAlbum(ctx context.Context, albumID string, users []immich.AlbumUser) error {
+	return nil
+}
+
+func (c *stubIC) AddActivity(ctx context.Context, a immich.Activity) error {
+	return nil
+}
+
 func (c *stubIC) StackAssets(ctx context.Context, cover string, ids []string) error {
 	return nil
 }
@@ -108,11 +160,14 @@ func (c *stubIC) GetAlbumInfo(context.Context, string, bool) (immich.AlbumConten
 type icCatchUploadsAssets struct {
 	stubIC
 
+	lock   sync.Mutex
 	assets []string
 	albums map[string][]string
 }
 
 func (c *icCatchUploadsAssets) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	c.assets = append(c.assets, a.FileName)
 	return immich.AssetResponse{
 		ID: a.FileName,
@@ -120,6 +175,8 @@ func (c *icCatchUploadsAssets) AssetUpload(ctx context.Context, a *browser.Local
 }
 
 func (c *icCatchUploadsAssets) AddAssetToAlbum(ctx context.Context, album string, ids []string) ([]immich.UpdateAlbumResult, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	l := c.albums[album]
 	c.albums[album] = append(l, ids...)
 	return nil, nil
@@ -129,6 +186,8 @@ func (c *icCatchUploadsAssets) CreateAlbum(ctx context.Context, album string, de
 	if album == "" {
 		panic("can't create album without name")
 	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	if c.albums == nil {
 		c.albums = map[string][]string{}
 	}
@@ -251,6 +310,39 @@ func TestUpload(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Folders, album after folder, concurrent uploads",
+			args: []string{
+				"-create-album-folder",
+				"-concurrent-uploads=4",
+				"TEST_DATA/folder/high",
+			},
+			expectedErr: false,
+			expectedAssets: []string{
+				"AlbumA/PXL_20231006_063000139.jpg",
+				"AlbumA/PXL_20231006_063029647.jpg",
+				"AlbumA/PXL_20231006_063108407.jpg",
+				"AlbumA/PXL_20231006_063121958.jpg",
+				"AlbumA/PXL_20231006_063357420.jpg",
+				"AlbumB/PXL_20231006_063528961.jpg",
+				"AlbumB/PXL_20231006_063536303.jpg",
+				"AlbumB/PXL_20231006_063851485.jpg",
+			},
+			expectedAlbums: map[string][]string{
+				"AlbumA": {
+					"AlbumA/PXL_20231006_063000139.jpg",
+					"AlbumA/PXL_20231006_063029647.jpg",
+					"AlbumA/PXL_20231006_063108407.jpg",
+					"AlbumA/PXL_20231006_063121958.jpg",
+					"AlbumA/PXL_20231006_063357420.jpg",
+				},
+				"AlbumB": {
+					"AlbumB/PXL_20231006_063528961.jpg",
+					"AlbumB/PXL_20231006_063536303.jpg",
+					"AlbumB/PXL_20231006_063851485.jpg",
+				},
+			},
+		},
 		{
 			name: "google photos, default options",
 			args: []string{
@@ -592,3 +684,187 @@ func cmpSlices[T cmp.Ordered](a, b []T) bool {
 	slices.Sort(b)
 	return reflect.DeepEqual(a, b)
 }
+
+type icWithServerChecksums struct {
+	icCatchUploadsAssets
+
+	serverAssets []*immich.Asset
+	bulkChecks   map[string]string // server's asset ID by checksum
+}
+
+func (c *icWithServerChecksums) GetAllAssetsWithFilter(ctx context.Context, filter func(*immich.Asset) error) error {
+	for _, a := range c.serverAssets {
+		err := filter(a)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *icWithServerChecksums) CheckBulkUpload(ctx context.Context, items []immich.BulkUploadCheckItem) ([]immich.BulkUploadCheckResult, error) {
+	var r []immich.BulkUploadCheckResult
+	for _, i := range items {
+		if id, ok := c.bulkChecks[i.Checksum]; ok {
+			r = append(r, immich.BulkUploadCheckResult{ID: i.ID, Action: immich.BulkUploadReject, Reason: "duplicate", AssetID: id})
+		} else {
+			r = append(r, immich.BulkUploadCheckResult{ID: i.ID, Action: immich.BulkUploadAccept})
+		}
+	}
+	return r, nil
+}
+
+func TestUploadCompareChecksum(t *testing.T) {
+	checksum := func(name string) string {
+		a := browser.LocalAssetFile{FSys: os.DirFS("TEST_DATA/folder/high"), FileName: name}
+		s, err := a.ComputeChecksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	ic := &icWithServerChecksums{
+		icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+		serverAssets: []*immich.Asset{
+			{ID: "server-1", OriginalFileName: "renamed.jpg", Checksum: checksum("AlbumA/PXL_20231006_063000139.jpg")},
+		},
+		bulkChecks: map[string]string{
+			checksum("AlbumB/PXL_20231006_063528961.jpg"): "server-2",
+		},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+	}
+	err := UploadCommand(context.Background(), &serv, []string{"-no-ui", "-compare-checksum", "TEST_DATA/folder/high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"AlbumA/PXL_20231006_063029647.jpg",
+		"AlbumA/PXL_20231006_063108407.jpg",
+		"AlbumA/PXL_20231006_063121958.jpg",
+		"AlbumA/PXL_20231006_063357420.jpg",
+		"AlbumB/PXL_20231006_063536303.jpg",
+		"AlbumB/PXL_20231006_063851485.jpg",
+	}
+	if !cmpSlices(expected, ic.assets) {
+		t.Errorf("expected upload differs ")
+		pretty.Ldiff(t, expected, ic.assets)
+	}
+	if c := serv.Jnl.GetCounts()[fileevent.UploadServerDuplicate]; c != 2 {
+		t.Errorf("expected 2 server duplicates, got %d", c)
+	}
+}
+
+// icSlowAlbumCreation blocks the creation of the album "slow" until released
+type icSlowAlbumCreation struct {
+	icCatchUploadsAssets
+
+	release  chan struct{}
+	creating chan struct{}
+	created  map[string]int
+}
+
+func (c *icSlowAlbumCreation) CreateAlbum(ctx context.Context, album string, description string, ids []string) (immich.AlbumSimplified, error) {
+	if album == "slow" {
+		close(c.creating)
+		<-c.release
+	}
+	c.lock.Lock()
+	c.created[album]++
+	c.lock.Unlock()
+	return c.icCatchUploadsAssets.CreateAlbum(ctx, album, description, ids)
+}
+
+func TestAddToAlbumConcurrent(t *testing.T) {
+	ctx := context.Background()
+	ic := &icSlowAlbumCreation{
+		release:  make(chan struct{}),
+		creating: make(chan struct{}),
+		created:  map[string]int{},
+	}
+	app := &UpCmd{SharedFlags: &cmd.SharedFlags{Immich: ic}, albums: map[string]immich.AlbumSimplified{}, sharedAlbums: map[string]bool{}}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for _, id := range []string{"1", "2", "3"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- app.AddToAlbum(ctx, id, browser.LocalAlbum{Title: "slow"})
+		}()
+	}
+	<-ic.creating
+
+	// Another album isn't delayed by the creation of the slow one
+	err := app.AddToAlbum(ctx, "4", browser.LocalAlbum{Title: "fast"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(ic.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ic.created["slow"] != 1 || ic.created["fast"] != 1 {
+		t.Errorf("each album must be created once, got %v", ic.created)
+	}
+	want := map[string][]string{"slow": {"1", "2", "3"}, "fast": {"4"}}
+	if !cmpAlbums(want, ic.albums) {
+		t.Errorf("expected albums differs")
+		pretty.Ldiff(t, want, ic.albums)
+	}
+}
+
+func TestReserveUpload(t *testing.T) {
+	ctx := context.Background()
+	ai := &AssetIndex{}
+	ai.ReIndex()
+	date := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	copy1 := &browser.LocalAssetFile{FileName: "a/IMG_0001.jpg", Title: "IMG_0001.jpg", FileSize: 100}
+	copy2 := &browser.LocalAssetFile{FileName: "b/IMG_0001.jpg", Title: "IMG_0001.jpg", FileSize: 100}
+	copy1.Metadata.DateTaken, copy2.Metadata.DateTaken = date, date
+
+	advice, release, err := ai.ReserveUpload(ctx, copy1)
+	if err != nil || advice.Advice != NotOnServer {
+		t.Fatalf("the first copy must be uploaded, got %v, %v", advice, err)
+	}
+
+	// The second copy waits for the upload of the first one
+	second := make(chan *Advice)
+	go func() {
+		advice, release, err := ai.ReserveUpload(ctx, copy2)
+		if err != nil {
+			t.Error(err)
+		}
+		release()
+		second <- advice
+	}()
+	select {
+	case <-second:
+		t.Fatal("the second copy must wait for the upload of the first one")
+	case <-time.After(50 * time.Millisecond):
+	}
+	ai.AddLocalAsset(copy1, "id-1")
+	release()
+	if advice := <-second; advice.Advice != SameOnServer || advice.ServerAsset.ID != "id-1" {
+		t.Errorf("the second copy must be found on the server, got %v", advice)
+	}
+
+	// The reservation is abandoned with the context
+	_, release, _ = ai.ReserveUpload(ctx, &browser.LocalAssetFile{FileName: "IMG_0002.jpg", Title: "IMG_0002.jpg", FileSize: 10})
+	defer release()
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err = ai.ReserveUpload(cctx, &browser.LocalAssetFile{FileName: "c/IMG_0002.jpg", Title: "IMG_0002.jpg", FileSize: 20}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expecting a cancelled reservation, got %v", err)
+	}
+}
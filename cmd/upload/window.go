@@ -0,0 +1,84 @@
+package upload
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UploadWindow is the time of the day when uploads are allowed, ex: 01:00-06:00
+// The window can span midnight, ex: 22:00-06:00
+type UploadWindow struct {
+	start, end int // minutes since midnight
+	set        bool
+}
+
+func (w UploadWindow) String() string {
+	if !w.set {
+		return ""
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.start/60, w.start%60, w.end/60, w.end%60)
+}
+
+func (w *UploadWindow) Set(s string) error {
+	invalid := fmt.Errorf("invalid upload window %q, expected HH:MM-HH:MM", s)
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return invalid
+	}
+	start, err := parseWindowTime(from, false)
+	if err != nil {
+		return invalid
+	}
+	end, err := parseWindowTime(to, true)
+	if err != nil {
+		return invalid
+	}
+	if start == end {
+		return fmt.Errorf("invalid upload window %q, the window is empty", s)
+	}
+	w.start, w.end = start, end%(24*60)
+	w.set = true
+	return nil
+}
+
+// parseWindowTime gives the minutes since midnight of a HH:MM time.
+// 24:00 is the only accepted time after 23:59, as the end of the window.
+func parseWindowTime(s string, end bool) (int, error) {
+	if end && s == "24:00" {
+		return 24 * 60, nil
+	}
+	if len(s) != len("15:04") {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w UploadWindow) IsSet() bool {
+	return w.set
+}
+
+// Contains tells if uploads are allowed at the given time
+func (w UploadWindow) Contains(t time.Time) bool {
+	if !w.set {
+		return true
+	}
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+// NextStart gives the next opening of the window after the given time
+func (w UploadWindow) NextStart(t time.Time) time.Time {
+	next := time.Date(t.Year(), t.Month(), t.Day(), w.start/60, w.start%60, 0, 0, t.Location())
+	if !next.After(t) {
+		next = time.Date(t.Year(), t.Month(), t.Day()+1, w.start/60, w.start%60, 0, 0, t.Location())
+	}
+	return next
+}
@@ -0,0 +1,93 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/cmd"
+)
+
+func TestUploadWindow(t *testing.T) {
+	at := func(h, m int) time.Time {
+		return time.Date(2024, 6, 15, h, m, 0, 0, time.Local)
+	}
+	tc := []struct {
+		window    string
+		wantErr   bool
+		time      time.Time
+		contains  bool
+		nextStart time.Time
+	}{
+		{window: "01:00-06:00", time: at(3, 0), contains: true, nextStart: at(1, 0).AddDate(0, 0, 1)},
+		{window: "01:00-06:00", time: at(6, 0), contains: false, nextStart: at(1, 0).AddDate(0, 0, 1)},
+		{window: "01:00-06:00", time: at(0, 30), contains: false, nextStart: at(1, 0)},
+		{window: "22:00-06:30", time: at(23, 0), contains: true, nextStart: at(22, 0).AddDate(0, 0, 1)},
+		{window: "22:00-06:30", time: at(6, 15), contains: true, nextStart: at(22, 0)},
+		{window: "22:00-06:30", time: at(12, 0), contains: false, nextStart: at(22, 0)},
+		{window: "20:00-24:00", time: at(23, 59), contains: true, nextStart: at(20, 0).AddDate(0, 0, 1)},
+		{window: "00:00-24:00", time: at(12, 0), contains: true, nextStart: at(0, 0).AddDate(0, 0, 1)},
+		{window: "00:00-23:59", time: at(23, 59), contains: false, nextStart: at(0, 0).AddDate(0, 0, 1)},
+		{window: "23:59-00:01", time: at(0, 0), contains: true, nextStart: at(23, 59)},
+		{window: "06:00-06:00", wantErr: true},
+		{window: "25:00-06:00", wantErr: true},
+		{window: "24:00-06:00", wantErr: true},
+		{window: "22:00-24:30", wantErr: true},
+		{window: "22:00-24:01", wantErr: true},
+		{window: "22:00-25:00", wantErr: true},
+		{window: "22:60-06:00", wantErr: true},
+		{window: "22:00-06:60", wantErr: true},
+		{window: "-1:00-06:00", wantErr: true},
+		{window: "night", wantErr: true},
+		{window: "08:00-18:00xyz", wantErr: true},
+		{window: "8:00-18:00", wantErr: true},
+		{window: "08:00-18:0", wantErr: true},
+		{window: "08:00 - 18:00", wantErr: true},
+		{window: "08:00-18:00-20:00", wantErr: true},
+		{window: "08:00-24:00:00", wantErr: true},
+	}
+	for _, c := range tc {
+		t.Run(c.window, func(t *testing.T) {
+			var w UploadWindow
+			err := w.Set(c.window)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if c.wantErr {
+				return
+			}
+			if got := w.Contains(c.time); got != c.contains {
+				t.Errorf("Contains(%s)=%v, want %v", c.time.Format("15:04"), got, c.contains)
+			}
+			if got := w.NextStart(c.time); !got.Equal(c.nextStart) {
+				t.Errorf("NextStart(%s)=%s, want %s", c.time.Format("15:04"), got, c.nextStart)
+			}
+		})
+	}
+}
+
+func TestWaitUploadWindow(t *testing.T) {
+	now := time.Now()
+	start, end := now.Add(2*time.Hour), now.Add(3*time.Hour)
+	app := UpCmd{SharedFlags: &cmd.SharedFlags{Log: slog.New(slog.NewTextHandler(io.Discard, nil))}}
+	err := app.UploadWindow.Set(start.Format("15:04") + "-" + end.Format("15:04"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- app.waitUploadWindow(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if m := app.pausedMessage(); m != "paused until "+start.Format("15:04") {
+		t.Errorf("unexpected pause message: %q", m)
+	}
+	if err := <-done; err == nil {
+		t.Errorf("the wait should be interrupted by the context")
+	}
+}
@@ -2,8 +2,10 @@ package configuration
 
 import (
 	"encoding/json"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -11,6 +13,38 @@ type Configuration struct {
 	APIURL    string `json:",omitempty"`
 	ServerURL string `json:",omitempty"`
 	APIKey    string
+	Remotes   []Remote `json:",omitempty"` // Credentials of the remote sources of files
+}
+
+// Remote gives the credentials of a remote source of files, like a WebDAV share.
+// They are used for the URLs starting with the remote's URL.
+// For S3 buckets, the user and the password are the access key and the secret key.
+type Remote struct {
+	URL      string
+	User     string `json:",omitempty"`
+	Password string `json:",omitempty"`
+	Endpoint string `json:",omitempty"` // S3 only: URL of a S3 compatible server, like MinIO
+	Region   string `json:",omitempty"` // S3 only
+}
+
+// FindRemote gives the remote matching the URL, the longest one when several match
+func FindRemote(remotes []Remote, u *url.URL) (Remote, bool) {
+	var found Remote
+	ok := false
+	for _, r := range remotes {
+		ru, err := url.Parse(r.URL)
+		if err != nil || !strings.EqualFold(ru.Scheme, u.Scheme) || !strings.EqualFold(ru.Host, u.Host) {
+			continue
+		}
+		p := strings.TrimSuffix(ru.Path, "/")
+		if u.Path != p && !strings.HasPrefix(u.Path, p+"/") {
+			continue
+		}
+		if !ok || len(r.URL) > len(found.URL) {
+			found, ok = r, true
+		}
+	}
+	return found, ok
 }
 
 // DefaultConfigFile return the default configuration file name
@@ -26,6 +26,10 @@ const (
 	DiscoveredSidecar                 // = "Scanned side car file"
 	DiscoveredDiscarded               // = "Discarded"
 	DiscoveredUnsupported             // = "File type not supported"
+	DiscoveredTrashed                 // = "Trashed asset"
+	DiscoveredArchived                // = "Archived asset"
+	DiscoveredPartner                 // = "Partner's asset"
+	DiscoveredLocked                  // = "Locked Folder asset"
 
 	AnalysisAssociatedMetadata
 	AnalysisMissingAssociatedMetadata
@@ -36,8 +40,14 @@ const (
 	UploadServerDuplicate // = "Server has photo"
 	UploadServerBetter    // = "Server's asset is better"
 	UploadAlbumCreated
-	UploadAddToAlbum  // = "Added to an album"
-	UploadServerError // = "Server error"
+	UploadAddToAlbum      // = "Added to an album"
+	UploadRemoveFromAlbum // = "Removed from an album"
+	UploadAddToPerson     // = "Tagged with a person"
+	UploadServerError     // = "Server error"
+	UploadResumed         // = "Already handled by a previous run"
+	UploadUpdated         // = "Server's asset updated"
+	UploadMovedToTrash    // = "Moved to the server's trash"
+	UploadLocalDelete     // = "Local file deleted after upload"
 
 	Uploaded  // = "Uploaded"
 	Stacked   // = "Stacked"
@@ -54,6 +64,10 @@ var _code = map[Code]string{
 	DiscoveredSidecar:     "scanned sidecar file",
 	DiscoveredDiscarded:   "discarded file",
 	DiscoveredUnsupported: "unsupported file",
+	DiscoveredTrashed:     "trashed asset",
+	DiscoveredArchived:    "archived asset",
+	DiscoveredPartner:     "partner's asset",
+	DiscoveredLocked:      "locked folder asset",
 
 	AnalysisAssociatedMetadata:        "associated metadata file",
 	AnalysisMissingAssociatedMetadata: "missing associated metadata file",
@@ -62,10 +76,16 @@ var _code = map[Code]string{
 	UploadNotSelected:     "file not selected",
 	UploadUpgraded:        "server's asset upgraded with the input",
 	UploadAddToAlbum:      "added to an album",
+	UploadRemoveFromAlbum: "removed from an album",
+	UploadAddToPerson:     "tagged with a person",
 	UploadServerDuplicate: "server has same asset",
 	UploadServerBetter:    "server has a better asset",
 	UploadAlbumCreated:    "album created/updated",
 	UploadServerError:     "upload error",
+	UploadResumed:         "already handled by a previous run",
+	UploadUpdated:         "server's asset updated",
+	UploadMovedToTrash:    "moved to the server's trash",
+	UploadLocalDelete:     "local file deleted after upload",
 	Uploaded:              "uploaded",
 
 	Stacked:   "Stacked",
@@ -88,6 +108,7 @@ type Recorder struct {
 	fileEvents map[string]map[Code]int
 	log        *slog.Logger
 	debug      bool
+	report     *fileReport // per file report, when enabled
 }
 
 func NewRecorder(l *slog.Logger, debug bool) *Recorder {
@@ -100,6 +121,7 @@ func NewRecorder(l *slog.Logger, debug bool) *Recorder {
 	return r
 }
 
+// Record the event of the file. The object is the file's asset, or the file's FS, or nil when unknown.
 func (r *Recorder) Record(ctx context.Context, code Code, object any, file string, args ...any) {
 	atomic.AddInt64(&r.counts[code], 1)
 	if r.debug && file != "" {
@@ -113,6 +135,9 @@ func (r *Recorder) Record(ctx context.Context, code Code, object any, file strin
 		r.fileEvents[file] = events
 		r.lock.Unlock()
 	}
+	if r.report != nil && file != "" {
+		r.report.record(code, reportFS(object), file, args)
+	}
 	if r.log != nil {
 		level := slog.LevelInfo
 		if file != "" {
@@ -125,10 +150,11 @@ func (r *Recorder) Record(ctx context.Context, code Code, object any, file strin
 		}
 		r.log.Log(ctx, level, code.String(), args...)
 	}
-	if a, ok := object.(*browser.LocalAssetFile); ok && a.LivePhoto != nil {
+	if a, ok := object.(*browser.LocalAssetFile); ok && a != nil && a.LivePhoto != nil {
 		arg2 := []any{}
 		for i := 0; i < len(args); i++ {
-			if args[i] == "file" {
+			if args[i] == "file" || args[i] == "id" {
+				// the live photo video has its own ID
 				i += 1
 				continue
 			}
@@ -157,6 +183,10 @@ func (r *Recorder) Report() {
 		AnalysisLocalDuplicate,
 		AnalysisAssociatedMetadata,
 		AnalysisMissingAssociatedMetadata,
+		DiscoveredTrashed,
+		DiscoveredArchived,
+		DiscoveredPartner,
+		DiscoveredLocked,
 	} {
 		sb.WriteString(fmt.Sprintf("%-40s: %7d\n", c.String(), r.counts[c]))
 	}
@@ -171,6 +201,12 @@ func (r *Recorder) Report() {
 		UploadUpgraded,
 		UploadServerDuplicate,
 		UploadServerBetter,
+		UploadResumed,
+		UploadUpdated,
+		UploadMovedToTrash,
+		UploadLocalDelete,
+		UploadRemoveFromAlbum,
+		UploadAddToPerson,
 	} {
 		sb.WriteString(fmt.Sprintf("%-40s: %7d\n", c.String(), r.counts[c]))
 	}
@@ -200,6 +236,7 @@ func (r *Recorder) WriteFileCounts(w io.Writer) error {
 		UploadUpgraded,
 		UploadServerBetter,
 		UploadServerDuplicate,
+		UploadResumed,
 		Uploaded,
 	}
 	fmt.Fprint(w, "File,")
@@ -251,6 +288,7 @@ func (r *Recorder) TotalProcessed(forcedMissingJSON bool) int64 {
 		atomic.LoadInt64(&r.counts[UploadUpgraded]) +
 		atomic.LoadInt64(&r.counts[UploadServerDuplicate]) +
 		atomic.LoadInt64(&r.counts[UploadServerBetter]) +
+		atomic.LoadInt64(&r.counts[UploadResumed]) +
 		atomic.LoadInt64(&r.counts[DiscoveredDiscarded]) +
 		atomic.LoadInt64(&r.counts[AnalysisLocalDuplicate])
 	if !forcedMissingJSON {
@@ -0,0 +1,284 @@
+package fileevent
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fshelper"
+)
+
+/*
+	The file report keeps what happened to each file during the run.
+
+	The files are identified by the name of their FS and their path. The events recorded without FS
+	go to the only file having the path, if any.
+
+	The outcome of a file is given by its most significant event. Events recorded on the same file
+	complete the record with the server's asset ID, the albums, the people, the stack, the reason and the error.
+	An error happening once the asset is on the server, like a failed album addition, doesn't change the outcome.
+*/
+
+// outcomeRank gives the significance of the events that determine the file's outcome.
+// Other events don't change the outcome.
+var outcomeRank = map[Code]int{
+	DiscoveredImage:                   1,
+	DiscoveredVideo:                   1,
+	DiscoveredSidecar:                 1,
+	AnalysisAssociatedMetadata:        1,
+	AnalysisMissingAssociatedMetadata: 1,
+	DiscoveredDiscarded:               2,
+	DiscoveredUnsupported:             2,
+	AnalysisLocalDuplicate:            2,
+	UploadNotSelected:                 2,
+	UploadResumed:                     3,
+	UploadServerDuplicate:             3,
+	UploadServerBetter:                3,
+	Uploaded:                          4,
+	UploadUpgraded:                    5,
+	UploadServerError:                 6,
+	Error:                             6,
+}
+
+// FileRecord is the report of a file
+type FileRecord struct {
+	FS      string   `json:"fs,omitempty"` // name of the file's FS
+	File    string   `json:"file"`
+	Outcome string   `json:"outcome"`
+	ID      string   `json:"id,omitempty"`     // server's asset ID
+	Albums  []string `json:"albums,omitempty"` // albums joined by the asset
+	People  []string `json:"people,omitempty"` // people tagged on the asset
+	Stack   string   `json:"stack,omitempty"`  // ID of the stack's cover
+	Reason  string   `json:"reason,omitempty"` // reason of the outcome
+	Error   string   `json:"error,omitempty"`
+	Events  []string `json:"events"`
+
+	rank int
+}
+
+type fileReport struct {
+	lock   sync.Mutex
+	files  map[reportKey]*FileRecord
+	byPath map[string][]*FileRecord // records by path, for the events without FS
+}
+
+type reportKey struct {
+	fs   string
+	file string
+}
+
+// reportFS gives the name of the FS of the event's object, nil when the object doesn't give the FS
+func reportFS(object any) *string {
+	var fsys fs.FS
+	switch o := object.(type) {
+	case *browser.LocalAssetFile:
+		if o == nil {
+			return nil
+		}
+		fsys = o.FSys
+	case fs.FS:
+		fsys = o
+	default:
+		return nil
+	}
+	name := ""
+	if n, ok := fsys.(fshelper.NameFS); ok {
+		name = n.Name()
+	}
+	return &name
+}
+
+// CollectFileReport enables the collection of the file report
+func (r *Recorder) CollectFileReport() {
+	r.report = &fileReport{files: map[reportKey]*FileRecord{}, byPath: map[string][]*FileRecord{}}
+}
+
+func (fr *fileReport) record(code Code, fsName *string, file string, args []any) {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+
+	var rec *FileRecord
+	key := reportKey{file: file}
+	if fsName != nil {
+		key.fs = *fsName
+		rec = fr.files[key]
+	} else if recs := fr.byPath[file]; len(recs) == 1 {
+		rec = recs[0]
+	}
+	if rec == nil {
+		rec = fr.files[key]
+	}
+	if rec == nil {
+		rec = &FileRecord{FS: key.fs, File: file}
+		fr.files[key] = rec
+		fr.byPath[file] = append(fr.byPath[file], rec)
+	}
+	rec.Events = append(rec.Events, code.String())
+
+	values := map[string]string{}
+	for i := 0; i+1 < len(args); i += 2 {
+		if k, ok := args[i].(string); ok {
+			values[k] = fmt.Sprint(args[i+1])
+		}
+	}
+
+	rank, ok := outcomeRank[code]
+	if code == Error && rec.rank >= outcomeRank[UploadResumed] {
+		// the asset is on the server, the error is on a later operation
+		ok = false
+	}
+	if ok && rank >= rec.rank {
+		rec.rank = rank
+		rec.Outcome = code.String()
+		rec.Reason = values["reason"]
+	}
+	if id := values["id"]; id != "" {
+		rec.ID = id
+	}
+	if album := values["album"]; album != "" && code == UploadAddToAlbum && !slices.Contains(rec.Albums, album) {
+		rec.Albums = append(rec.Albums, album)
+	}
+	if code == UploadRemoveFromAlbum {
+		rec.Albums = slices.DeleteFunc(rec.Albums, func(a string) bool { return a == values["album"] })
+	}
+	if person := values["person"]; person != "" && code == UploadAddToPerson && !slices.Contains(rec.People, person) {
+		rec.People = append(rec.People, person)
+	}
+	if stack := values["stack"]; stack != "" {
+		rec.Stack = stack
+	}
+	if e := values["error"]; e != "" {
+		rec.Error = e
+	}
+}
+
+// FileRecords returns the report of each file, sorted by FS and name
+func (r *Recorder) FileRecords() []FileRecord {
+	if r.report == nil {
+		return nil
+	}
+	r.report.lock.Lock()
+	defer r.report.lock.Unlock()
+	records := make([]FileRecord, 0, len(r.report.files))
+	for _, rec := range r.report.files {
+		records = append(records, *rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].FS != records[j].FS {
+			return records[i].FS < records[j].FS
+		}
+		return records[i].File < records[j].File
+	})
+	return records
+}
+
+// WriteFileReport writes the report of each file. The format is given by the file extension: .json, .csv or .html
+func (r *Recorder) WriteFileReport(w io.Writer, name string) error {
+	records := r.FileRecords()
+	switch ReportFormat(name) {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case "csv":
+		return writeCSVReport(w, records)
+	case "html":
+		return writeHTMLReport(w, records)
+	}
+	return fmt.Errorf("unsupported report format: %s", filepath.Ext(name))
+}
+
+// ReportFormat gives the format of the report after the file extension, or an empty string when not supported
+func ReportFormat(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return "json"
+	case ".csv":
+		return "csv"
+	case ".html", ".htm":
+		return "html"
+	}
+	return ""
+}
+
+func writeCSVReport(w io.Writer, records []FileRecord) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"file", "outcome", "id", "albums", "stack", "reason", "error", "people", "fs"})
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		err = cw.Write([]string{rec.File, rec.Outcome, rec.ID, strings.Join(rec.Albums, ";"), rec.Stack, rec.Reason, rec.Error, strings.Join(rec.People, ";"), rec.FS})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type outcomeCount struct {
+	Outcome string
+	Count   int
+}
+
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>immich-go report</title>
+<style>
+body { font-family: sans-serif; font-size: 0.9em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: left; vertical-align: top; }
+th { background: #eee; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>immich-go report</h1>
+<p>Generated on {{.Date}}, {{len .Records}} files.</p>
+<table>
+<tr><th>Outcome</th><th>Files</th></tr>
+{{range .Counts}}<tr><td>{{.Outcome}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+<h2>Files</h2>
+<table>
+<tr><th>File</th><th>Outcome</th><th>ID</th><th>Albums</th><th>Stack</th><th>Reason</th><th>Error</th><th>People</th><th>FS</th></tr>
+{{range .Records}}<tr><td>{{.File}}</td><td>{{.Outcome}}</td><td>{{.ID}}</td><td>{{range $i, $a := .Albums}}{{if $i}}, {{end}}{{$a}}{{end}}</td><td>{{.Stack}}</td><td>{{.Reason}}</td><td class="error">{{.Error}}</td><td>{{range $i, $p := .People}}{{if $i}}, {{end}}{{$p}}{{end}}</td><td>{{.FS}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func writeHTMLReport(w io.Writer, records []FileRecord) error {
+	counts := map[string]int{}
+	for _, rec := range records {
+		counts[rec.Outcome]++
+	}
+	outcomes := []outcomeCount{}
+	for o, c := range counts {
+		outcomes = append(outcomes, outcomeCount{Outcome: o, Count: c})
+	}
+	sort.Slice(outcomes, func(i, j int) bool { return outcomes[i].Outcome < outcomes[j].Outcome })
+
+	return htmlReport.Execute(w, struct {
+		Date    string
+		Records []FileRecord
+		Counts  []outcomeCount
+	}{
+		Date:    time.Now().Format(time.DateTime),
+		Records: records,
+		Counts:  outcomes,
+	})
+}
@@ -140,6 +140,20 @@ func (gw GlobWalkFS) Name() string {
 	return filepath.Base(gw.dir)
 }
 
+// FullPath gives the absolute path of the file on the host
+func (gw GlobWalkFS) FullPath(name string) string {
+	p, err := filepath.Abs(filepath.Join(gw.dir, filepath.FromSlash(name)))
+	if err != nil {
+		return filepath.Join(gw.dir, filepath.FromSlash(name))
+	}
+	return p
+}
+
+// Remove the file from the host
+func (gw GlobWalkFS) Remove(name string) error {
+	return os.Remove(filepath.Join(gw.dir, filepath.FromSlash(name)))
+}
+
 // FixedPathAndMagic split the path with the fixed part and the variable part
 func FixedPathAndMagic(name string) (string, string) {
 	if !HasMagic(name) {
@@ -204,3 +218,8 @@ func (f FSWithName) ReadFile(name string) ([]byte, error) {
 type NameFS interface {
 	Name() string
 }
+
+// FullPathFS is implemented by file systems knowing the full path of their files
+type FullPathFS interface {
+	FullPath(name string) string
+}
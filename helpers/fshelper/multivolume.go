@@ -0,0 +1,484 @@
+package fshelper
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+)
+
+/*
+	Archives split in several volumes:
+	- split archives (.zip.001, .zip.002...) are the archive cut into pieces. The volumes are read as if they were concatenated.
+	- spanned zip archives (.z01, .z02, ... .zip) are written volume per volume. The positions in the central directory are relative
+	  to the volume, they are translated into positions in the concatenated volumes.
+	- 7z archives, split or not, are read by github.com/bodgit/sevenzip
+*/
+
+var (
+	splitVolumeRe   = regexp.MustCompile(`(?i)^(.*\.(zip|7z))\.(\d{3})$`)
+	spannedVolumeRe = regexp.MustCompile(`(?i)^(.*)\.z(\d{2,})$`)
+	globMetaRe      = regexp.MustCompile(`[*?\[\\]`)
+)
+
+// archiveVolumeSet gives the name identifying the set of volumes of an archive, and the kind of the set.
+// The kind is empty when the file isn't part of a multi-volume archive.
+func archiveVolumeSet(name string) (string, string) {
+	if m := splitVolumeRe.FindStringSubmatch(name); m != nil {
+		return m[1], "split-" + strings.ToLower(m[2])
+	}
+	if m := spannedVolumeRe.FindStringSubmatch(name); m != nil {
+		return m[1], "spanned"
+	}
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		base := name[:len(name)-4]
+		if _, err := os.Stat(spannedVolumeName(base, 1, name[len(name)-3:])); err == nil {
+			return base, "spanned"
+		}
+	}
+	return "", ""
+}
+
+// spannedVolumeName gives the name of the nth volume, in the same case than the .zip extension
+func spannedVolumeName(base string, n int, ext string) string {
+	z := "z"
+	if ext == strings.ToUpper(ext) {
+		z = "Z"
+	}
+	return fmt.Sprintf("%s.%s%02d", base, z, n)
+}
+
+// openArchiveVolumeSet opens the multi-volume archive
+func openArchiveVolumeSet(base string, kind string) (fs.FS, error) {
+	switch kind {
+	case "split-7z":
+		return Open7z(base + ".001")
+	case "split-zip":
+		return OpenSplitZip(base)
+	case "spanned":
+		return OpenSpannedZip(base)
+	}
+	return nil, fmt.Errorf("unknown archive kind %s", kind)
+}
+
+// Open7z opens a 7z archive. The name ending with .001 is the first volume of a split archive.
+func Open7z(name string) (fs.FS, error) {
+	r, err := sevenzip.OpenReader(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(name), err)
+	}
+	return r, nil
+}
+
+// MultiVolumeZip is a zip archive made of several volumes
+type MultiVolumeZip struct {
+	*zip.Reader
+	volumes *multiReaderAt
+}
+
+func (z *MultiVolumeZip) Close() error {
+	return z.volumes.Close()
+}
+
+// OpenSplitZip opens the volumes base.001, base.002... as one zip archive
+func OpenSplitZip(base string) (*MultiVolumeZip, error) {
+	names, err := globVolumes(base+".", `\d{3}`)
+	if err != nil {
+		return nil, err
+	}
+	mr, err := openMultiReaderAt(names)
+	if err != nil {
+		return nil, err
+	}
+	r, err := zip.NewReader(mr, mr.size)
+	if err != nil {
+		mr.Close()
+		return nil, fmt.Errorf("%s: %w", filepath.Base(base), err)
+	}
+	return &MultiVolumeZip{Reader: r, volumes: mr}, nil
+}
+
+// OpenSpannedZip opens the volumes base.z01, base.z02... base.zip as one zip archive
+func OpenSpannedZip(base string) (*MultiVolumeZip, error) {
+	names, err := globVolumes(base+".", `[zZ]\d{2,}`)
+	if err != nil {
+		return nil, err
+	}
+	last := ""
+	for _, ext := range []string{".zip", ".ZIP", ".Zip"} {
+		if _, err := os.Stat(base + ext); err == nil {
+			last = base + ext
+			break
+		}
+	}
+	if last == "" {
+		return nil, fmt.Errorf("%s: the last volume %s is missing", filepath.Base(base), filepath.Base(base)+".zip")
+	}
+	names = append(names, last)
+
+	mr, err := openMultiReaderAt(names)
+	if err != nil {
+		return nil, err
+	}
+	err = mr.translateSpannedDirectory()
+	if err != nil {
+		mr.Close()
+		return nil, fmt.Errorf("%s: %w", filepath.Base(last), err)
+	}
+	r, err := zip.NewReader(mr, mr.size)
+	if err != nil {
+		mr.Close()
+		return nil, fmt.Errorf("%s: %w", filepath.Base(last), err)
+	}
+	return &MultiVolumeZip{Reader: r, volumes: mr}, nil
+}
+
+// globVolumes lists the volumes prefixNNN, sorted by number. The numbers must be consecutive and start at 1.
+func globVolumes(prefix string, numberRe string) ([]string, error) {
+	candidates, err := filepath.Glob(escapeGlob(prefix) + "*")
+	if err != nil {
+		return nil, err
+	}
+	re := regexp.MustCompile(`^` + regexp.QuoteMeta(prefix) + `(` + numberRe + `)$`)
+	type volume struct {
+		name string
+		n    int
+	}
+	volumes := []volume{}
+	for _, c := range candidates {
+		m := re.FindStringSubmatch(c)
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(strings.TrimLeft(m[1], "zZ"))
+		volumes = append(volumes, volume{name: c, n: n})
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].n < volumes[j].n })
+	names := []string{}
+	for i, v := range volumes {
+		if v.n != i+1 {
+			return nil, fmt.Errorf("%s: volume #%d is missing", filepath.Base(prefix), i+1)
+		}
+		names = append(names, v.name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s: no volume found", filepath.Base(prefix))
+	}
+	return names, nil
+}
+
+func escapeGlob(s string) string {
+	return globMetaRe.ReplaceAllString(s, `\$0`)
+}
+
+// multiReaderAt reads the volumes as if they were concatenated.
+// Additional data can be placed after the last volume.
+type multiReaderAt struct {
+	files  []*os.File
+	starts []int64 // position of each volume
+	size   int64
+	extra  []byte // data placed after the volumes
+}
+
+func openMultiReaderAt(names []string) (*multiReaderAt, error) {
+	mr := &multiReaderAt{}
+	for _, n := range names {
+		f, err := os.Open(n)
+		if err != nil {
+			mr.Close()
+			return nil, err
+		}
+		s, err := f.Stat()
+		if err != nil {
+			f.Close()
+			mr.Close()
+			return nil, err
+		}
+		mr.files = append(mr.files, f)
+		mr.starts = append(mr.starts, mr.size)
+		mr.size += s.Size()
+	}
+	return mr, nil
+}
+
+func (mr *multiReaderAt) volumesSize() int64 {
+	return mr.size - int64(len(mr.extra))
+}
+
+func (mr *multiReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	read := 0
+	for len(b) > 0 {
+		if off >= mr.size {
+			return read, io.EOF
+		}
+		var n int
+		var err error
+		if off >= mr.volumesSize() {
+			n = copy(b, mr.extra[off-mr.volumesSize():])
+		} else {
+			i := sort.Search(len(mr.starts), func(i int) bool { return mr.starts[i] > off }) - 1
+			end := mr.volumesSize()
+			if i+1 < len(mr.starts) {
+				end = mr.starts[i+1]
+			}
+			chunk := b[:min(int64(len(b)), end-off)]
+			n, err = mr.files[i].ReadAt(chunk, off-mr.starts[i])
+			if err != nil && !(errors.Is(err, io.EOF) && n == len(chunk)) {
+				return read + n, err
+			}
+		}
+		read += n
+		off += int64(n)
+		b = b[n:]
+	}
+	return read, nil
+}
+
+func (mr *multiReaderAt) Close() error {
+	var err error
+	for _, f := range mr.files {
+		err = errors.Join(err, f.Close())
+	}
+	mr.files = nil
+	return err
+}
+
+const (
+	zipDirectoryEndSig     = 0x06054b50
+	zipDirectory64LocSig   = 0x07064b50
+	zipDirectory64EndSig   = 0x06064b50
+	zipDirectoryHeaderSig  = 0x02014b50
+	zipDirectoryHeaderLen  = 46
+	zipDirectoryEndLen     = 22
+	zipDirectory64LocLen   = 20
+	zipDirectory64EndLen   = 56
+	zipZip64ExtraID        = 0x0001
+	zipUint32Max           = 0xffffffff
+	zipUint16Max           = 0xffff
+	zipMaxCommentSearchLen = 65535 + zipDirectoryEndLen
+)
+
+// translateSpannedDirectory reads the central directory of a spanned archive, and writes after the volumes
+// a new central directory where the positions are given in the concatenated volumes.
+func (mr *multiReaderAt) translateSpannedDirectory() error {
+	last := len(mr.files) - 1
+	lastStart := mr.starts[last]
+	lastSize := mr.size - lastStart
+
+	// Find the end of central directory in the last volume
+	searchLen := min(lastSize, zipMaxCommentSearchLen)
+	buf := make([]byte, searchLen)
+	_, err := mr.ReadAt(buf, mr.size-searchLen)
+	if err != nil {
+		return err
+	}
+	p := -1
+	for i := len(buf) - zipDirectoryEndLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(buf[i:]) == zipDirectoryEndSig {
+			p = i
+			break
+		}
+	}
+	if p < 0 {
+		return zip.ErrFormat
+	}
+	eocdPos := mr.size - searchLen + int64(p)
+	eocd := buf[p:]
+	cdDisk := int(binary.LittleEndian.Uint16(eocd[6:]))
+	records := uint64(binary.LittleEndian.Uint16(eocd[10:]))
+	cdSize := uint64(binary.LittleEndian.Uint32(eocd[12:]))
+	cdOffset := uint64(binary.LittleEndian.Uint32(eocd[16:]))
+
+	// Zip64 end of central directory
+	if eocdPos-zipDirectory64LocLen >= lastStart {
+		loc := make([]byte, zipDirectory64LocLen)
+		_, err = mr.ReadAt(loc, eocdPos-zipDirectory64LocLen)
+		if err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint32(loc) == zipDirectory64LocSig {
+			disk := int(binary.LittleEndian.Uint32(loc[4:]))
+			off := binary.LittleEndian.Uint64(loc[8:])
+			pos, err := mr.position(disk, off)
+			if err != nil {
+				return err
+			}
+			end := make([]byte, zipDirectory64EndLen)
+			_, err = mr.ReadAt(end, pos)
+			if err != nil {
+				return err
+			}
+			if binary.LittleEndian.Uint32(end) != zipDirectory64EndSig {
+				return zip.ErrFormat
+			}
+			cdDisk = int(binary.LittleEndian.Uint32(end[20:]))
+			records = binary.LittleEndian.Uint64(end[32:])
+			cdSize = binary.LittleEndian.Uint64(end[40:])
+			cdOffset = binary.LittleEndian.Uint64(end[48:])
+		}
+	}
+
+	cdPos, err := mr.position(cdDisk, cdOffset)
+	if err != nil {
+		return err
+	}
+	if cdPos+int64(cdSize) > mr.size {
+		return zip.ErrFormat
+	}
+	cd := make([]byte, cdSize)
+	_, err = mr.ReadAt(cd, cdPos)
+	if err != nil {
+		return err
+	}
+
+	// Translate each record of the directory
+	out := bytes.Buffer{}
+	for i := uint64(0); i < records; i++ {
+		if len(cd) < zipDirectoryHeaderLen || binary.LittleEndian.Uint32(cd) != zipDirectoryHeaderSig {
+			return zip.ErrFormat
+		}
+		nameLen := int(binary.LittleEndian.Uint16(cd[28:]))
+		extraLen := int(binary.LittleEndian.Uint16(cd[30:]))
+		commentLen := int(binary.LittleEndian.Uint16(cd[32:]))
+		recLen := zipDirectoryHeaderLen + nameLen + extraLen + commentLen
+		if len(cd) < recLen {
+			return zip.ErrFormat
+		}
+		err = mr.translateRecord(&out, cd[:recLen], nameLen, extraLen)
+		if err != nil {
+			return err
+		}
+		cd = cd[recLen:]
+	}
+
+	// Write the zip64 end of directory, its locator and the end of directory
+	newCDPos := uint64(mr.size)
+	newCDSize := uint64(out.Len())
+	end64Pos := newCDPos + newCDSize
+
+	end64 := make([]byte, zipDirectory64EndLen)
+	binary.LittleEndian.PutUint32(end64, zipDirectory64EndSig)
+	binary.LittleEndian.PutUint64(end64[4:], zipDirectory64EndLen-12)
+	binary.LittleEndian.PutUint16(end64[12:], 45)
+	binary.LittleEndian.PutUint16(end64[14:], 45)
+	binary.LittleEndian.PutUint64(end64[24:], records)
+	binary.LittleEndian.PutUint64(end64[32:], records)
+	binary.LittleEndian.PutUint64(end64[40:], newCDSize)
+	binary.LittleEndian.PutUint64(end64[48:], newCDPos)
+	out.Write(end64)
+
+	loc := make([]byte, zipDirectory64LocLen)
+	binary.LittleEndian.PutUint32(loc, zipDirectory64LocSig)
+	binary.LittleEndian.PutUint64(loc[8:], end64Pos)
+	binary.LittleEndian.PutUint32(loc[16:], 1)
+	out.Write(loc)
+
+	end := make([]byte, zipDirectoryEndLen)
+	binary.LittleEndian.PutUint32(end, zipDirectoryEndSig)
+	binary.LittleEndian.PutUint16(end[8:], zipUint16Max)
+	binary.LittleEndian.PutUint16(end[10:], zipUint16Max)
+	binary.LittleEndian.PutUint32(end[12:], zipUint32Max)
+	binary.LittleEndian.PutUint32(end[16:], zipUint32Max)
+	out.Write(end)
+
+	mr.extra = out.Bytes()
+	mr.size += int64(len(mr.extra))
+	return nil
+}
+
+// translateRecord writes the directory record with the position of the local header in the concatenated volumes
+func (mr *multiReaderAt) translateRecord(out *bytes.Buffer, rec []byte, nameLen, extraLen int) error {
+	usize := uint64(binary.LittleEndian.Uint32(rec[24:]))
+	csize := uint64(binary.LittleEndian.Uint32(rec[20:]))
+	disk := uint64(binary.LittleEndian.Uint16(rec[34:]))
+	offset := uint64(binary.LittleEndian.Uint32(rec[42:]))
+
+	// Read the zip64 values, and keep the other extra fields
+	extra := rec[zipDirectoryHeaderLen+nameLen : zipDirectoryHeaderLen+nameLen+extraLen]
+	kept := []byte{}
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			break
+		}
+		field := extra[4 : 4+size]
+		if id == zipZip64ExtraID {
+			if usize == zipUint32Max && len(field) >= 8 {
+				usize, field = binary.LittleEndian.Uint64(field), field[8:]
+			}
+			if csize == zipUint32Max && len(field) >= 8 {
+				csize, field = binary.LittleEndian.Uint64(field), field[8:]
+			}
+			if offset == zipUint32Max && len(field) >= 8 {
+				offset, field = binary.LittleEndian.Uint64(field), field[8:]
+			}
+			if disk == zipUint16Max && len(field) >= 4 {
+				disk = uint64(binary.LittleEndian.Uint32(field))
+			}
+		} else {
+			kept = append(kept, extra[:4+size]...)
+		}
+		extra = extra[4+size:]
+	}
+
+	pos, err := mr.position(int(disk), offset)
+	if err != nil {
+		return err
+	}
+
+	// Build the new zip64 field with the values that don't fit in the header
+	z64 := []byte{}
+	header := make([]byte, zipDirectoryHeaderLen)
+	copy(header, rec[:zipDirectoryHeaderLen])
+	if usize >= zipUint32Max {
+		z64 = binary.LittleEndian.AppendUint64(z64, usize)
+		usize = zipUint32Max
+	}
+	if csize >= zipUint32Max {
+		z64 = binary.LittleEndian.AppendUint64(z64, csize)
+		csize = zipUint32Max
+	}
+	if uint64(pos) >= zipUint32Max {
+		z64 = binary.LittleEndian.AppendUint64(z64, uint64(pos))
+		pos = zipUint32Max
+	}
+	if len(z64) > 0 {
+		z64 = append(binary.LittleEndian.AppendUint16(binary.LittleEndian.AppendUint16(nil, zipZip64ExtraID), uint16(len(z64))), z64...)
+	}
+	newExtra := append(z64, kept...)
+
+	binary.LittleEndian.PutUint32(header[20:], uint32(csize))
+	binary.LittleEndian.PutUint32(header[24:], uint32(usize))
+	binary.LittleEndian.PutUint16(header[30:], uint16(len(newExtra)))
+	binary.LittleEndian.PutUint16(header[34:], 0)
+	binary.LittleEndian.PutUint32(header[42:], uint32(pos))
+
+	out.Write(header)
+	out.Write(rec[zipDirectoryHeaderLen : zipDirectoryHeaderLen+nameLen])
+	out.Write(newExtra)
+	out.Write(rec[zipDirectoryHeaderLen+nameLen+extraLen:])
+	return nil
+}
+
+// position gives the position in the concatenated volumes of the offset in the volume
+func (mr *multiReaderAt) position(disk int, offset uint64) (int64, error) {
+	if disk < 0 || disk >= len(mr.starts) {
+		return 0, fmt.Errorf("volume #%d is missing", disk+1)
+	}
+	return mr.starts[disk] + int64(offset), nil
+}
@@ -0,0 +1,198 @@
+package fshelper
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var zipContent = map[string]string{
+	"Takeout/Google Photos/Album/photo.jpg":            strings.Repeat("a photo ", 200),
+	"Takeout/Google Photos/Album/photo.jpg.json":       `{"title":"photo.jpg"}`,
+	"Takeout/Google Photos/Photos from 2023/video.mp4": strings.Repeat("a video ", 500),
+	"Takeout/Google Photos/Photos from 2023/empty.jpg": "",
+}
+
+// writeZip returns a zip archive of zipContent. The data is stored to keep the archive large enough to be split.
+// The offset gives the size of the data written before the archive.
+func writeZip(t *testing.T, offset int64) []byte {
+	b := bytes.NewBuffer(make([]byte, offset))
+	w := zip.NewWriter(b)
+	w.SetOffset(offset)
+	for name, content := range zipContent {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func expectedZipFiles() []string {
+	files := []string{}
+	for name := range zipContent {
+		files = append(files, name)
+	}
+	return files
+}
+
+func writeVolumes(t *testing.T, names []string, volumes [][]byte) {
+	for i := range names {
+		err := os.WriteFile(names[i], volumes[i], 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// cutVolumes cuts the data in volumes of the given size
+func cutVolumes(b []byte, size int) [][]byte {
+	volumes := [][]byte{}
+	for len(b) > size {
+		volumes = append(volumes, b[:size])
+		b = b[size:]
+	}
+	return append(volumes, b)
+}
+
+func TestSplitZip(t *testing.T) {
+	tmp := t.TempDir()
+	volumes := cutVolumes(writeZip(t, 0), 1000)
+	names := []string{}
+	for i := range volumes {
+		names = append(names, filepath.Join(tmp, fmt.Sprintf("takeout.zip.%03d", i+1)))
+	}
+	writeVolumes(t, names, volumes)
+
+	// All volumes are given, the archive is opened once
+	fsyss, err := ParsePath(context.Background(), []string{filepath.Join(tmp, "takeout.zip.*")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseFSs(fsyss)
+	if len(fsyss) != 1 {
+		t.Fatalf("expected 1 FS, got %d", len(fsyss))
+	}
+	err = fstest.TestFS(fsyss[0], expectedZipFiles()...)
+	if err != nil {
+		t.Error(err)
+	}
+	b, err := fs.ReadFile(fsyss[0], "Takeout/Google Photos/Photos from 2023/video.mp4")
+	if err != nil || string(b) != zipContent["Takeout/Google Photos/Photos from 2023/video.mp4"] {
+		t.Errorf("unexpected content: %v", err)
+	}
+
+	// A missing volume is reported
+	err = os.Remove(names[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParsePath(context.Background(), []string{names[0]})
+	if err == nil {
+		t.Errorf("expected an error for the missing volume")
+	}
+}
+
+// spanZip cuts the archive in volumes like a spanned archive: the positions given in the
+// central directory are relative to the volume containing the local header.
+func spanZip(t *testing.T, b []byte, size int) [][]byte {
+	b = bytes.Clone(b)
+	eocd := b[len(b)-zipDirectoryEndLen:]
+	if binary.LittleEndian.Uint32(eocd) != zipDirectoryEndSig {
+		t.Fatal("unexpected end of directory")
+	}
+	records := int(binary.LittleEndian.Uint16(eocd[10:]))
+	cdOffset := int(binary.LittleEndian.Uint32(eocd[16:]))
+	lastDisk := (len(b) - 1) / size
+
+	p := cdOffset
+	for i := 0; i < records; i++ {
+		rec := b[p:]
+		offset := int(binary.LittleEndian.Uint32(rec[42:]))
+		binary.LittleEndian.PutUint16(rec[34:], uint16(offset/size))
+		binary.LittleEndian.PutUint32(rec[42:], uint32(offset%size))
+		p += zipDirectoryHeaderLen + int(binary.LittleEndian.Uint16(rec[28:])) + int(binary.LittleEndian.Uint16(rec[30:])) + int(binary.LittleEndian.Uint16(rec[32:]))
+	}
+	binary.LittleEndian.PutUint16(eocd[4:], uint16(lastDisk))
+	binary.LittleEndian.PutUint16(eocd[6:], uint16(cdOffset/size))
+	binary.LittleEndian.PutUint32(eocd[16:], uint32(cdOffset%size))
+	return cutVolumes(b, size)
+}
+
+func TestSpannedZip(t *testing.T) {
+	tmp := t.TempDir()
+
+	// The first volume starts with the spanning signature
+	b := writeZip(t, 4)
+	binary.LittleEndian.PutUint32(b, 0x08074b50)
+	volumes := spanZip(t, b, 1000)
+	names := []string{}
+	for i := range volumes[:len(volumes)-1] {
+		names = append(names, filepath.Join(tmp, fmt.Sprintf("takeout.z%02d", i+1)))
+	}
+	names = append(names, filepath.Join(tmp, "takeout.zip"))
+	writeVolumes(t, names, volumes)
+
+	// The archive is opened once, whatever the volume given
+	fsyss, err := ParsePath(context.Background(), []string{filepath.Join(tmp, "takeout.zip"), filepath.Join(tmp, "takeout.z01")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseFSs(fsyss)
+	if len(fsyss) != 1 {
+		t.Fatalf("expected 1 FS, got %d", len(fsyss))
+	}
+	err = fstest.TestFS(fsyss[0], expectedZipFiles()...)
+	if err != nil {
+		t.Error(err)
+	}
+	for name, content := range zipContent {
+		b, err := fs.ReadFile(fsyss[0], name)
+		if err != nil || string(b) != content {
+			t.Errorf("unexpected content for %s: %v", name, err)
+		}
+	}
+}
+
+func Test7z(t *testing.T) {
+	// The archives come from github.com/bodgit/sevenzip's test data
+	testCases := []struct {
+		name  string
+		files []string
+	}{
+		{name: "TESTDATA/archives/t0.7z", files: []string{"foo", "bar"}},
+		{name: "TESTDATA/archives/multi.7z.003", files: []string{"01", "05", "10"}},
+	}
+	for _, tc := range testCases {
+		t.Run(filepath.Base(tc.name), func(t *testing.T) {
+			fsyss, err := ParsePath(context.Background(), []string{tc.name})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer CloseFSs(fsyss)
+			if len(fsyss) != 1 {
+				t.Fatalf("expected 1 FS, got %d", len(fsyss))
+			}
+			err = fstest.TestFS(fsyss[0], tc.files...)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -2,25 +2,57 @@ package fshelper
 
 import (
 	"archive/zip"
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
 	"path/filepath"
 	"strings"
+
+	"github.com/simulot/immich-go/helpers/configuration"
 )
 
 // ParsePath return a list of FS bases on args
 //
-// Zip files are opened and returned as FS
+// Zip, 7z and tar files are opened and returned as FS
+// The volumes of a multi-volume archive are opened together, once
 // Manage wildcards in path
-//
-// TODO: Implement a tgz reader for non google-photos archives
+// The WebDAV, SFTP and S3 URLs are opened with the credentials of the remotes.
+// The context cancels the requests of the remote FSs.
 
-func ParsePath(args []string) ([]fs.FS, error) {
+func ParsePath(ctx context.Context, args []string, remotes ...configuration.Remote) ([]fs.FS, error) {
 	var errs error
 	fsyss := []fs.FS{}
+	volumeSets := map[string]bool{}
 
 	for _, a := range args {
+		if IsWebDAV(a) {
+			fsys, err := OpenWebDAV(ctx, a, remotes...)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			fsyss = append(fsyss, fsys)
+			continue
+		}
+		if IsS3(a) {
+			fsys, err := OpenS3(ctx, a, remotes...)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			fsyss = append(fsyss, fsys)
+			continue
+		}
+		if IsSFTP(a) {
+			fsys, err := OpenSFTP(ctx, a, remotes...)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			fsyss = append(fsyss, fsys)
+			continue
+		}
 		a = filepath.ToSlash(a)
 		files, err := expandNames(a)
 		if err != nil {
@@ -28,10 +60,36 @@ func ParsePath(args []string) ([]fs.FS, error) {
 		}
 
 		for _, f := range files {
+			if base, kind := archiveVolumeSet(f); kind != "" {
+				if volumeSets[base] {
+					continue
+				}
+				volumeSets[base] = true
+				fsys, err := openArchiveVolumeSet(base, kind)
+				if err != nil {
+					errs = errors.Join(errs, err)
+					continue
+				}
+				fsyss = append(fsyss, fsys)
+				continue
+			}
+
 			lowF := strings.ToLower(f)
 			switch {
-			case strings.HasSuffix(lowF, ".tgz") || strings.HasSuffix(lowF, ".tar.gz"):
-				errs = errors.Join(fmt.Errorf("immich-go cant use tgz archives: %s", filepath.Base(a)))
+			case strings.HasSuffix(lowF, ".7z"):
+				fsys, err := Open7z(f)
+				if err != nil {
+					errs = errors.Join(errs, err)
+					continue
+				}
+				fsyss = append(fsyss, fsys)
+			case strings.HasSuffix(lowF, ".tgz") || strings.HasSuffix(lowF, ".tar.gz") || strings.HasSuffix(lowF, ".tar"):
+				fsys, err := OpenTarFS(f)
+				if err != nil {
+					errs = errors.Join(errs, err)
+					continue
+				}
+				fsyss = append(fsyss, fsys)
 			case strings.HasSuffix(lowF, ".zip"):
 				fsys, err := zip.OpenReader(f)
 				if err != nil {
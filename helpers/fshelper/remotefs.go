@@ -0,0 +1,101 @@
+package fshelper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"path"
+	"time"
+)
+
+// remoteTimeout limits the connection to the servers of the remote FSs, the wait for their responses,
+// and each read of the files. The whole download of a file isn't limited: the videos can be large.
+var remoteTimeout = time.Minute
+
+// errStalled is given when the download of a file has stalled
+var errStalled = errors.New("the download has stalled")
+
+// newRemoteClient makes the HTTP client of the remote FSs
+func newRemoteClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: remoteTimeout, KeepAlive: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   remoteTimeout,
+			ResponseHeaderTimeout: remoteTimeout,
+			ExpectContinueTimeout: time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConnsPerHost:   10,
+		},
+	}
+}
+
+// stalledReader cancels the download of the body when a read waits longer than remoteTimeout
+type stalledReader struct {
+	body   io.ReadCloser
+	cancel context.CancelFunc // cancels the request
+}
+
+// newStalledReader watches the body of the request made with the context. The cancel function cancels the context.
+func newStalledReader(body io.ReadCloser, cancel context.CancelFunc) *stalledReader {
+	return &stalledReader{body: body, cancel: cancel}
+}
+
+func (r *stalledReader) Read(b []byte) (int, error) {
+	t := time.AfterFunc(remoteTimeout, r.cancel)
+	n, err := r.body.Read(b)
+	if !t.Stop() && err != nil && !errors.Is(err, io.EOF) {
+		err = errors.Join(errStalled, err)
+	}
+	return n, err
+}
+
+func (r *stalledReader) Close() error {
+	r.cancel()
+	return r.body.Close()
+}
+
+// remoteInfo is the information of a file of a remote FS
+type remoteInfo struct {
+	name    string
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+func (i *remoteInfo) Name() string {
+	if i.name == "." {
+		return "."
+	}
+	return path.Base(i.name)
+}
+func (i *remoteInfo) Size() int64 { return i.size }
+func (i *remoteInfo) Mode() fs.FileMode {
+	if i.isDir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+func (i *remoteInfo) ModTime() time.Time         { return i.modTime }
+func (i *remoteInfo) IsDir() bool                { return i.isDir }
+func (i *remoteInfo) Sys() any                   { return nil }
+func (i *remoteInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i *remoteInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+// readDirEntries gives the next n entries of a listed folder, as fs.ReadDirFile does
+func readDirEntries(entries *[]fs.DirEntry, n int) ([]fs.DirEntry, error) {
+	rest := *entries
+	if n <= 0 {
+		*entries = nil
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(rest))
+	*entries = rest[n:]
+	return rest[:n], nil
+}
@@ -1,6 +1,9 @@
 package fshelper
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -43,3 +46,37 @@ func (fsys dirRemoveFS) Remove(name string) error {
 func (fsys dirRemoveFS) Stat(name string) (fs.FileInfo, error) {
 	return os.Stat(filepath.Join(fsys.dir, name))
 }
+
+// MoveFile moves a file on the host. The file is copied when it can't be renamed,
+// for example when the destination is on another device.
+// An existing destination is never overwritten.
+func MoveFile(src, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("can't move %s: %w", dst, fs.ErrExist)
+	}
+	err := os.MkdirAll(filepath.Dir(dst), 0o700)
+	if err != nil {
+		return err
+	}
+	if os.Rename(src, dst) == nil {
+		return nil
+	}
+
+	s, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	d, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(d, s)
+	err = errors.Join(err, d.Close())
+	if err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	s.Close()
+	return os.Remove(src)
+}
@@ -0,0 +1,531 @@
+package fshelper
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/configuration"
+)
+
+/*
+	S3FS gives a read-only access to the objects of a S3 bucket, on AWS or on a compatible server like MinIO.
+
+	The folder is given by an URL: s3://bucket/prefix. The keys are split on / to get the folders.
+	The access key and the secret key are given by the URL (s3://key:secret@bucket/prefix),
+	by the remotes of the configuration file, or by the variables AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+	The server is given by the remote's endpoint or by AWS_ENDPOINT_URL, the default is AWS.
+
+	The folders are listed by pages. The objects are read with range requests: the first read gets the
+	beginning of the object only, enough for reading the metadata. The next reads get bigger ranges.
+
+	The requests are cancelled with the context given to OpenS3.
+*/
+
+const (
+	s3DefaultRegion = "us-east-1"
+	s3PageSize      = 1000
+	s3FirstRange    = 64 * 1024
+	s3MaxRange      = 8 * 1024 * 1024
+	s3EmptyHash     = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" // SHA-256 of an empty payload
+)
+
+// IsS3 tells if the argument is a S3 URL
+func IsS3(arg string) bool {
+	scheme, _, ok := strings.Cut(arg, "://")
+	return ok && strings.EqualFold(scheme, "s3")
+}
+
+type S3FS struct {
+	ctx       context.Context // the command's context
+	client    *http.Client
+	endpoint  *url.URL
+	region    string
+	accessKey string
+	secretKey string
+	bucket    string
+	prefix    string // the folder in the bucket, ending with /
+	pageSize  int    // number of keys by list request
+}
+
+// OpenS3 checks the access to the bucket's folder given by the URL
+func OpenS3(ctx context.Context, arg string, remotes ...configuration.Remote) (*S3FS, error) {
+	u, err := url.Parse(arg)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(u.Scheme, "s3") || u.Host == "" {
+		return nil, fmt.Errorf("%s isn't a S3 URL", arg)
+	}
+
+	s3 := &S3FS{
+		ctx:       ctx,
+		client:    newRemoteClient(),
+		region:    os.Getenv("AWS_REGION"),
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		bucket:    u.Host,
+		pageSize:  s3PageSize,
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+	if r, ok := configuration.FindRemote(remotes, u); ok {
+		if r.User != "" || r.Password != "" {
+			s3.accessKey, s3.secretKey = r.User, r.Password
+		}
+		if r.Endpoint != "" {
+			endpoint = r.Endpoint
+		}
+		if r.Region != "" {
+			s3.region = r.Region
+		}
+	}
+	if u.User != nil {
+		s3.accessKey = u.User.Username()
+		s3.secretKey, _ = u.User.Password()
+	}
+	if s3.region == "" {
+		s3.region = s3DefaultRegion
+	}
+	if endpoint == "" {
+		endpoint = "https://s3." + s3.region + ".amazonaws.com"
+	}
+	s3.endpoint, err = url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", arg, err)
+	}
+	if p := strings.Trim(u.Path, "/"); p != "" {
+		s3.prefix = p + "/"
+	}
+
+	l, err := s3.list(ctx, s3.prefix, "", 1)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s3.Name(), err)
+	}
+	if s3.prefix != "" && l.empty() {
+		return nil, fmt.Errorf("%s: %w", s3.Name(), fs.ErrNotExist)
+	}
+	return s3, nil
+}
+
+// Name gives the bucket and the folder
+func (s3 *S3FS) Name() string {
+	return strings.TrimSuffix(s3.bucket+"/"+s3.prefix, "/")
+}
+
+// key gives the key of the object
+func (s3 *S3FS) key(op string, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return s3.prefix, nil
+	}
+	return s3.prefix + name, nil
+}
+
+func (s3 *S3FS) Open(name string) (fs.File, error) {
+	info, err := s3.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &s3Dir{fsys: s3, info: info}, nil
+	}
+	return &s3File{fsys: s3, info: info, key: s3.prefix + name}, nil
+}
+
+func (s3 *S3FS) Stat(name string) (fs.FileInfo, error) {
+	return s3.stat("stat", name)
+}
+
+// stat gives the information of an object, or of a folder when some keys start with the name
+func (s3 *S3FS) stat(op string, name string) (*remoteInfo, error) {
+	key, err := s3.key(op, name)
+	if err != nil {
+		return nil, err
+	}
+	if name == "." {
+		return &remoteInfo{name: name, isDir: true}, nil
+	}
+	ctx := s3.ctx
+	resp, err := s3.do(ctx, http.MethodHead, key, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+		info := &remoteInfo{name: name, size: resp.ContentLength}
+		info.modTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+		return info, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	l, err := s3.list(ctx, key+"/", "", 1)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if l.empty() {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return &remoteInfo{name: name, isDir: true}, nil
+}
+
+func (s3 *S3FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	key, err := s3.key("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if name != "." {
+		key += "/"
+	}
+	ctx := s3.ctx
+	var entries []fs.DirEntry
+	token := ""
+	for {
+		l, err := s3.list(ctx, key, token, s3.pageSize)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+		}
+		for _, p := range l.CommonPrefixes {
+			entries = append(entries, &remoteInfo{name: s3.name(strings.TrimSuffix(p.Prefix, "/")), isDir: true})
+		}
+		for _, c := range l.Contents {
+			if c.Key == key {
+				continue // folder marker
+			}
+			info := &remoteInfo{name: s3.name(c.Key), size: c.Size}
+			info.modTime, _ = time.Parse(time.RFC3339, c.LastModified)
+			entries = append(entries, info)
+		}
+		if !l.IsTruncated || l.NextContinuationToken == "" {
+			break
+		}
+		token = l.NextContinuationToken
+	}
+	if len(entries) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// name gives the name in the FS of a key
+func (s3 *S3FS) name(key string) string {
+	return strings.TrimPrefix(key, s3.prefix)
+}
+
+// listResult is the response of a ListObjectsV2 request
+type listResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		Size         int64
+		LastModified string
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+}
+
+func (l *listResult) empty() bool {
+	return len(l.Contents) == 0 && len(l.CommonPrefixes) == 0
+}
+
+// list gives a page of the keys starting with the prefix, grouped by folder
+func (s3 *S3FS) list(ctx context.Context, prefix string, token string, maxKeys int) (*listResult, error) {
+	query := url.Values{
+		"list-type": {"2"},
+		"delimiter": {"/"},
+		"prefix":    {prefix},
+		"max-keys":  {strconv.Itoa(maxKeys)},
+	}
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+	resp, err := s3.do(ctx, http.MethodGet, "", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var l listResult
+	err = xml.NewDecoder(resp.Body).Decode(&l)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// s3Error is the body of an error response
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// do sends a signed request for the object given by the key, or for the bucket when the key is empty
+func (s3 *S3FS) do(ctx context.Context, method string, key string, query url.Values, header http.Header) (*http.Response, error) {
+	u := *s3.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s3.bucket + "/" + key
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = s3Query(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s3Sign(req, s3.accessKey, s3.secretKey, s3.region, time.Now())
+	resp, err := s3.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var e s3Error
+	_ = xml.NewDecoder(resp.Body).Decode(&e)
+	msg := resp.Status
+	if e.Code != "" {
+		msg = e.Code + ": " + e.Message
+	}
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, msg)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("%w: %s", fs.ErrPermission, msg)
+	}
+	return nil, fmt.Errorf("unexpected response: %s", msg)
+}
+
+// s3Sign adds the AWS signature version 4 to the request.
+// The host, the range and the x-amz-* headers are signed, the payload is empty.
+func s3Sign(req *http.Request, accessKey, secretKey, region string, t time.Time) {
+	date := t.UTC().Format("20060102T150405Z")
+	scope := date[:8] + "/" + region + "/s3/aws4_request"
+	req.Header.Set("X-Amz-Date", date)
+	if req.Header.Get("X-Amz-Content-Sha256") == "" {
+		req.Header.Set("X-Amz-Content-Sha256", s3EmptyHash)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if k == "range" || strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		uri,
+		s3Query(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	h := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + hex.EncodeToString(h[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, s := range []string{date[:8], region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// s3Query gives the query sorted and encoded as AWS expects
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape encodes all characters but the unreserved ones, and the / when it isn't a query
+func s3Escape(s string, query bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !query:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3File is an object, read by ranges
+type s3File struct {
+	fsys   *S3FS
+	info   *remoteInfo
+	key    string
+	offset int64
+	size   int64 // size of the next range
+	body   io.ReadCloser
+}
+
+func (f *s3File) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *s3File) Read(b []byte) (int, error) {
+	for {
+		if f.offset >= f.info.size {
+			return 0, io.EOF
+		}
+		if len(b) == 0 {
+			return 0, nil
+		}
+		if f.body == nil {
+			f.size = min(max(2*f.size, s3FirstRange), s3MaxRange)
+			body, err := f.get(f.offset, min(f.offset+f.size, f.info.size))
+			if err != nil {
+				return 0, err
+			}
+			f.body = body
+		}
+		n, err := f.body.Read(b)
+		f.offset += int64(n)
+		if errors.Is(err, io.EOF) {
+			f.body.Close()
+			f.body = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (f *s3File) ReadAt(b []byte, off int64) (int, error) {
+	if off >= f.info.size {
+		return 0, io.EOF
+	}
+	body, err := f.get(off, min(off+int64(len(b)), f.info.size))
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, b[:min(int64(len(b)), f.info.size-off)])
+	if err == nil && n < len(b) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *s3File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.name, Err: fs.ErrInvalid}
+	}
+	if offset != f.offset {
+		f.Close()
+		f.offset, f.size = offset, 0
+	}
+	return f.offset, nil
+}
+
+// get reads the bytes from start to end, excluded
+func (f *s3File) get(start, end int64) (io.ReadCloser, error) {
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", start, end-1)}}
+	ctx, cancel := context.WithCancel(f.fsys.ctx)
+	resp, err := f.fsys.do(ctx, http.MethodGet, f.key, nil, header)
+	if err != nil {
+		cancel()
+		return nil, &fs.PathError{Op: "read", Path: f.info.name, Err: err}
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		cancel()
+		return nil, &fs.PathError{Op: "read", Path: f.info.name, Err: fmt.Errorf("unexpected response: %s", resp.Status)}
+	}
+	return newStalledReader(resp.Body, cancel), nil
+}
+
+func (f *s3File) Close() error {
+	if f.body != nil {
+		err := f.body.Close()
+		f.body = nil
+		return err
+	}
+	return nil
+}
+
+// s3Dir is a folder, listed on the first ReadDir
+type s3Dir struct {
+	fsys    *S3FS
+	info    *remoteInfo
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *s3Dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *s3Dir) Close() error               { return nil }
+func (d *s3Dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *s3Dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.ReadDir(d.info.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+	return readDirEntries(&d.entries, n)
+}
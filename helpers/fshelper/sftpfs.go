@@ -0,0 +1,283 @@
+package fshelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/melbahja/goph"
+	"github.com/pkg/sftp"
+	"github.com/simulot/immich-go/helpers/configuration"
+	"github.com/simulot/immich-go/helpers/docker"
+)
+
+/*
+	SFTPFS gives a read-only access to the files of a remote server through SFTP.
+
+	The folder is given by an URL: sftp://user@host:port/path. The path is absolute, or relative
+	to the user's home folder when it starts with /~/.
+	The connection uses the SSH plumbing of the docker package: the user and the password are given by the URL,
+	or by the remotes of the configuration file. Without password, the private key ~/.ssh/id_rsa is used.
+	The server must be in the known hosts.
+
+	The requests of a stalled connection never end: the connection is closed when a request waits longer
+	than remoteTimeout, or when the command is cancelled.
+*/
+
+// IsSFTP tells if the argument is a SFTP URL
+func IsSFTP(arg string) bool {
+	scheme, _, ok := strings.Cut(arg, "://")
+	return ok && strings.EqualFold(scheme, "sftp")
+}
+
+type SFTPFS struct {
+	ctx    context.Context
+	stop   func() bool // stops closing the connection at the end of the context
+	ssh    *goph.Client
+	client *sftp.Client
+	root   string // the folder on the server
+	name   string
+}
+
+// OpenSFTP connects to the server, and checks the folder given by the URL.
+// The connection is closed when the context is done.
+func OpenSFTP(ctx context.Context, arg string, remotes ...configuration.Remote) (*SFTPFS, error) {
+	u, err := url.Parse(arg)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(u.Scheme, "sftp") {
+		return nil, fmt.Errorf("%s isn't a SFTP URL", arg)
+	}
+	if r, ok := configuration.FindRemote(remotes, u); ok {
+		user := u.User.Username()
+		if user == "" {
+			user = r.User
+		}
+		password, set := u.User.Password()
+		if !set && r.Password != "" {
+			password, set = r.Password, true
+		}
+		switch {
+		case set:
+			u.User = url.UserPassword(user, password)
+		case user != "":
+			u.User = url.User(user)
+		}
+	}
+	name := u.Host + u.Path
+
+	config, err := docker.SSHConfig(u)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	conn, err := goph.NewConn(config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	client, err := conn.NewSftp()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	root := u.Path
+	switch {
+	case root == "/~" || root == "":
+		root = "."
+	case strings.HasPrefix(root, "/~/"):
+		root = strings.TrimPrefix(root, "/~/")
+	}
+	sfs := &SFTPFS{ctx: ctx, ssh: conn, client: client, root: root, name: name}
+	sfs.stop = context.AfterFunc(ctx, func() { conn.Close() })
+	var info fs.FileInfo
+	err = sfs.watch(func() (err error) {
+		info, err = client.Stat(root)
+		return err
+	})
+	if err == nil && !info.IsDir() {
+		err = errors.New("not a folder")
+	}
+	if err != nil {
+		sfs.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return sfs, nil
+}
+
+// Name gives the server and the folder
+func (sfs *SFTPFS) Name() string {
+	return sfs.name
+}
+
+func (sfs *SFTPFS) Close() error {
+	sfs.stop()
+	return errors.Join(sfs.client.Close(), sfs.ssh.Close())
+}
+
+// watch runs the request, and closes the connection when the request has stalled
+func (sfs *SFTPFS) watch(request func() error) error {
+	t := time.AfterFunc(remoteTimeout, func() { sfs.ssh.Close() })
+	err := request()
+	if err == nil || err == io.EOF {
+		t.Stop()
+		return err
+	}
+	if !t.Stop() {
+		err = errors.Join(errStalled, err)
+	}
+	if sfs.ctx.Err() != nil {
+		err = errors.Join(sfs.ctx.Err(), err)
+	}
+	return err
+}
+
+// remote gives the path of the file on the server
+func (sfs *SFTPFS) remote(op string, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(sfs.root, name), nil
+}
+
+func (sfs *SFTPFS) Open(name string) (fs.File, error) {
+	r, err := sfs.remote("open", name)
+	if err != nil {
+		return nil, err
+	}
+	var info fs.FileInfo
+	err = sfs.watch(func() (err error) {
+		info, err = sfs.client.Stat(r)
+		return err
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if info.IsDir() {
+		return &sftpDir{fsys: sfs, name: name, info: sftpInfo{info, name}}, nil
+	}
+	var f *sftp.File
+	err = sfs.watch(func() (err error) {
+		f, err = sfs.client.Open(r)
+		return err
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &sftpFile{fsys: sfs, file: f, info: sftpInfo{info, name}}, nil
+}
+
+func (sfs *SFTPFS) Stat(name string) (fs.FileInfo, error) {
+	r, err := sfs.remote("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	var info fs.FileInfo
+	err = sfs.watch(func() (err error) {
+		info, err = sfs.client.Stat(r)
+		return err
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return sftpInfo{info, name}, nil
+}
+
+func (sfs *SFTPFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	r, err := sfs.remote("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	var infos []fs.FileInfo
+	err = sfs.watch(func() (err error) {
+		infos, err = sfs.client.ReadDir(r)
+		return err
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, i := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(i))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// sftpInfo gives the name of the file in the FS
+type sftpInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i sftpInfo) Name() string { return path.Base(i.name) }
+
+// sftpFile watches the reads of the file
+type sftpFile struct {
+	fsys *SFTPFS
+	file *sftp.File
+	info sftpInfo
+}
+
+func (f *sftpFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *sftpFile) Close() error               { return f.file.Close() }
+
+func (f *sftpFile) Read(b []byte) (int, error) {
+	var n int
+	err := f.fsys.watch(func() (err error) {
+		n, err = f.file.Read(b)
+		return err
+	})
+	return n, err
+}
+
+func (f *sftpFile) ReadAt(b []byte, off int64) (int, error) {
+	var n int
+	err := f.fsys.watch(func() (err error) {
+		n, err = f.file.ReadAt(b, off)
+		return err
+	})
+	return n, err
+}
+
+func (f *sftpFile) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	err := f.fsys.watch(func() (err error) {
+		pos, err = f.file.Seek(offset, whence)
+		return err
+	})
+	return pos, err
+}
+
+// sftpDir is a folder, listed on the first ReadDir
+type sftpDir struct {
+	fsys    *SFTPFS
+	name    string
+	info    sftpInfo
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *sftpDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *sftpDir) Close() error               { return nil }
+func (d *sftpDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *sftpDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+	return readDirEntries(&d.entries, n)
+}
@@ -0,0 +1,297 @@
+package fshelper
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/simulot/immich-go/helpers/configuration"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// newSFTPServer starts a SSH server with the SFTP subsystem, serving the local files.
+// The server's key is added to the known hosts of a temporary home folder.
+// The user someone is accepted with the password secret, or with the returned key.
+func newSFTPServer(t *testing.T) (string, ed25519.PrivateKey) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userPub, userKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized, err := ssh.NewPublicKey(userPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "someone" && string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if c.User() == "someone" && bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(stallingConn{conn}, config)
+		}
+	}()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	err = os.MkdirAll(filepath.Join(home, ".ssh"), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := knownhosts.Line([]string{l.Addr().String()}, signer.PublicKey())
+	err = os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(line+"\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l.Addr().String(), userKey
+}
+
+// sftpStalled makes the test servers stop answering
+var sftpStalled atomic.Bool
+
+// stallingConn holds the server's answers while sftpStalled is set
+type stallingConn struct {
+	net.Conn
+}
+
+func (c stallingConn) Write(b []byte) (int, error) {
+	for sftpStalled.Load() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return c.Conn.Write(b)
+}
+
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			_ = nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if ok {
+					server, err := sftp.NewServer(ch, sftp.ReadOnly())
+					if err != nil {
+						return
+					}
+					_ = server.Serve()
+					server.Close()
+				}
+			}
+		}()
+	}
+}
+
+func TestSFTPFS(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"Photos/2023/IMG_0001.jpg":       "a photo",
+		"Photos/2023/Paris/IMG 0002.jpg": "another photo",
+		"Photos/été/vidéo.mp4":           "a video",
+	} {
+		name = filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(name), 0o700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(name, []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	addr, _ := newSFTPServer(t)
+	folder := "sftp://someone@" + addr + filepath.ToSlash(filepath.Join(dir, "Photos"))
+
+	_, err := ParsePath(context.Background(), []string{folder})
+	if err == nil {
+		t.Errorf("expecting an error without password")
+	}
+
+	remotes := []configuration.Remote{{URL: "sftp://" + addr, User: "someone", Password: "secret"}}
+	fsyss, err := ParsePath(context.Background(), []string{folder}, remotes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseFSs(fsyss)
+	fsys := fsyss[0]
+
+	err = fstest.TestFS(fsys, "2023/IMG_0001.jpg", "2023/Paris/IMG 0002.jpg", "été/vidéo.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := fs.ReadFile(fsys, "2023/Paris/IMG 0002.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "another photo" {
+		t.Errorf("unexpected content %q", b)
+	}
+	if _, err = fs.Stat(fsys, "2023/missing.jpg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expecting a not exist error, got %v", err)
+	}
+
+	_, err = OpenSFTP(context.Background(), "sftp://someone:secret@"+addr+filepath.ToSlash(filepath.Join(dir, "Photos", "2023", "IMG_0001.jpg")))
+	if err == nil {
+		t.Errorf("expecting an error when the URL isn't a folder")
+	}
+}
+
+func TestSFTPKey(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "IMG_0001.jpg"), []byte("a photo"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, key := newSFTPServer(t)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(os.Getenv("HOME"), ".ssh", "id_rsa"), pem.EncodeToMemory(block), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	folder := filepath.ToSlash(dir)
+
+	tests := []struct {
+		name    string
+		url     string
+		remotes []configuration.Remote
+		ok      bool
+	}{
+		{name: "user of the URL", url: "sftp://someone@" + addr + folder, ok: true},
+		{name: "user of the remote", url: "sftp://" + addr + folder, remotes: []configuration.Remote{{URL: "sftp://" + addr, User: "someone"}}, ok: true},
+		{name: "URL's user first", url: "sftp://someone@" + addr + folder, remotes: []configuration.Remote{{URL: "sftp://" + addr, User: "other"}}, ok: true},
+		{name: "wrong user", url: "sftp://other@" + addr + folder, remotes: []configuration.Remote{{URL: "sftp://" + addr, User: "someone"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sfs, err := OpenSFTP(context.Background(), tt.url, tt.remotes...)
+			if !tt.ok {
+				if err == nil {
+					sfs.Close()
+					t.Errorf("expecting an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sfs.Close()
+			b, err := fs.ReadFile(sfs, "IMG_0001.jpg")
+			if err != nil || string(b) != "a photo" {
+				t.Errorf("unexpected content %q, error %v", b, err)
+			}
+		})
+	}
+}
+
+func TestSFTPStalled(t *testing.T) {
+	defer func(d time.Duration) { remoteTimeout = d }(remoteTimeout)
+	remoteTimeout = 200 * time.Millisecond
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "IMG_0001.jpg"), []byte("a photo"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := newSFTPServer(t)
+	folder := "sftp://someone:secret@" + addr + filepath.ToSlash(dir)
+
+	sfs, err := OpenSFTP(context.Background(), folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sfs.Close()
+	f, err := sfs.Open("IMG_0001.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// The server stops answering
+	sftpStalled.Store(true)
+	defer sftpStalled.Store(false)
+	start := time.Now()
+	_, err = io.ReadAll(f)
+	if !errors.Is(err, errStalled) {
+		t.Errorf("expecting a stalled read, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("the stalled read has been detected after %s", d)
+	}
+	sftpStalled.Store(false)
+
+	// The command is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	sfs, err = OpenSFTP(ctx, folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sfs.Close()
+	cancel()
+	// The connection is closed in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_, err = fs.ReadDir(sfs, ".")
+		if err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expecting a cancelled request, got %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+package fshelper
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	TarFS gives access to the content of tar archives, compressed or not.
+
+	A tar archive can only be read in sequence. The archive is indexed in a single pass, giving
+	the position of each file in the archive:
+	- an uncompressed archive is read in place
+	- a gzip compressed archive can't be read at a position. It is decompressed once more, when the files
+	  are read, into a temporary file. The decompression goes only as far as the files read until now,
+	  and the files are read in the temporary file in any order. The temporary file is removed when
+	  the FS is closed.
+*/
+
+type TarFS struct {
+	name    string
+	archive string   // archive's file name
+	f       *os.File // uncompressed archive
+	entries map[string]*tarEntry
+
+	lock   sync.Mutex
+	src    *os.File     // compressed archive
+	gz     *gzip.Reader // decompresses the archive into the spill file
+	spill  *os.File     // decompressed archive, up to filled
+	filled int64
+	closed bool
+}
+
+type tarEntry struct {
+	name     string // full name in the archive
+	offset   int64  // position of the data in the uncompressed archive
+	size     int64
+	mode     fs.FileMode
+	modTime  time.Time
+	children map[string]*tarEntry // content of a directory
+}
+
+// OpenTarFS indexes the tar archive. The gzip compression is detected automatically.
+func OpenTarFS(name string) (*TarFS, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	tfs := &TarFS{
+		name:    filepath.Base(name),
+		archive: name,
+		entries: map[string]*tarEntry{
+			".": {name: ".", mode: fs.ModeDir | 0o555, children: map[string]*tarEntry{}},
+		},
+	}
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(br)
+		if err == nil {
+			err = tfs.index(&countingReader{r: gz})
+			gz.Close()
+		}
+		f.Close()
+	} else {
+		_, err = f.Seek(0, io.SeekStart)
+		if err == nil {
+			tfs.f = f
+			err = tfs.index(&countingSeeker{countingReader{r: f}})
+		}
+	}
+	if err != nil {
+		_ = tfs.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return tfs, nil
+}
+
+// positionReader is a reader giving its position in the archive
+type positionReader interface {
+	io.Reader
+	position() int64
+}
+
+// index reads the headers of the archive
+func (tfs *TarFS) index(r positionReader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e := tfs.add(hdr)
+		if e == nil || e.mode.IsDir() {
+			continue
+		}
+		// The reader is positioned at the beginning of the file's data
+		e.offset, e.size = r.position(), hdr.Size
+	}
+}
+
+// add the header's entry and its parent directories into the index
+func (tfs *TarFS) add(hdr *tar.Header) *tarEntry {
+	name := path.Clean(strings.TrimPrefix(filepath.ToSlash(hdr.Name), "/"))
+	if name == "." || !fs.ValidPath(name) {
+		return nil
+	}
+	var e *tarEntry
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if e = tfs.entries[name]; e != nil && e.mode.IsDir() {
+			e.modTime = hdr.ModTime
+			return e
+		}
+		e = &tarEntry{name: name, mode: fs.ModeDir | hdr.FileInfo().Mode().Perm(), modTime: hdr.ModTime, children: map[string]*tarEntry{}}
+	case tar.TypeReg, '\x00': // '\x00' is the regular file of the old archives
+		e = &tarEntry{name: name, mode: hdr.FileInfo().Mode().Perm(), modTime: hdr.ModTime}
+	default:
+		// links, devices... are ignored
+		return nil
+	}
+	tfs.entries[name] = e
+	tfs.parent(name).children[path.Base(name)] = e
+	return e
+}
+
+// parent returns the parent directory of the name, and creates it when missing
+func (tfs *TarFS) parent(name string) *tarEntry {
+	dir := path.Dir(name)
+	if p, ok := tfs.entries[dir]; ok && p.mode.IsDir() {
+		return p
+	}
+	p := &tarEntry{name: dir, mode: fs.ModeDir | 0o555, children: map[string]*tarEntry{}}
+	tfs.entries[dir] = p
+	tfs.parent(dir).children[path.Base(dir)] = p
+	return p
+}
+
+// Name gives the archive's name
+func (tfs *TarFS) Name() string {
+	return tfs.name
+}
+
+func (tfs *TarFS) Open(name string) (fs.File, error) {
+	e, err := tfs.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.mode.IsDir() {
+		return &tarDir{e: e}, nil
+	}
+	var r io.ReaderAt = spillReader{tfs}
+	if tfs.f != nil {
+		r = tfs.f
+	}
+	return &tarFile{e: e, SectionReader: io.NewSectionReader(r, e.offset, e.size)}, nil
+}
+
+func (tfs *TarFS) Stat(name string) (fs.FileInfo, error) {
+	e, err := tfs.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (tfs *TarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := tfs.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return e.dirEntries(), nil
+}
+
+func (tfs *TarFS) lookup(op string, name string) (*tarEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := tfs.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return e, nil
+}
+
+// Close the archive, and removes the temporary file
+func (tfs *TarFS) Close() error {
+	tfs.lock.Lock()
+	defer tfs.lock.Unlock()
+	var err error
+	if tfs.f != nil {
+		err = tfs.f.Close()
+		tfs.f = nil
+	}
+	if tfs.gz != nil {
+		err = errors.Join(err, tfs.gz.Close(), tfs.src.Close())
+		tfs.gz, tfs.src = nil, nil
+	}
+	if tfs.spill != nil {
+		err = errors.Join(err, tfs.spill.Close(), os.Remove(tfs.spill.Name()))
+		tfs.spill = nil
+	}
+	tfs.closed = true
+	return err
+}
+
+// fill decompresses the archive into the temporary file up to the position end
+func (tfs *TarFS) fill(end int64) (*os.File, error) {
+	tfs.lock.Lock()
+	defer tfs.lock.Unlock()
+	if tfs.closed {
+		return nil, fs.ErrClosed
+	}
+	if end <= tfs.filled {
+		return tfs.spill, nil
+	}
+	if tfs.gz == nil {
+		f, err := os.Open(tfs.archive)
+		if err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(bufio.NewReader(f))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		tmp, err := os.CreateTemp("", "immich-go-*.tar")
+		if err != nil {
+			gz.Close()
+			f.Close()
+			return nil, err
+		}
+		tfs.src, tfs.gz, tfs.spill = f, gz, tmp
+	}
+	n, err := io.CopyN(tfs.spill, tfs.gz, end-tfs.filled)
+	tfs.filled += n
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return tfs.spill, err
+}
+
+// spillReader reads the decompressed archive in the temporary file
+type spillReader struct {
+	tfs *TarFS
+}
+
+func (r spillReader) ReadAt(b []byte, off int64) (int, error) {
+	spill, err := r.tfs.fill(off + int64(len(b)))
+	if err != nil {
+		return 0, err
+	}
+	return spill.ReadAt(b, off)
+}
+
+// tarEntry implements fs.FileInfo and fs.DirEntry
+func (e *tarEntry) Name() string               { return path.Base(e.name) }
+func (e *tarEntry) Size() int64                { return e.size }
+func (e *tarEntry) Mode() fs.FileMode          { return e.mode }
+func (e *tarEntry) ModTime() time.Time         { return e.modTime }
+func (e *tarEntry) IsDir() bool                { return e.mode.IsDir() }
+func (e *tarEntry) Sys() any                   { return nil }
+func (e *tarEntry) Type() fs.FileMode          { return e.mode.Type() }
+func (e *tarEntry) Info() (fs.FileInfo, error) { return e, nil }
+
+func (e *tarEntry) dirEntries() []fs.DirEntry {
+	names := make([]string, 0, len(e.children))
+	for n := range e.children {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	entries := make([]fs.DirEntry, 0, len(names))
+	for _, n := range names {
+		entries = append(entries, e.children[n])
+	}
+	return entries
+}
+
+type tarFile struct {
+	e *tarEntry
+	*io.SectionReader
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.e, nil }
+func (f *tarFile) Close() error               { return nil }
+
+type tarDir struct {
+	e       *tarEntry
+	entries []fs.DirEntry
+	pos     int
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) { return d.e, nil }
+func (d *tarDir) Close() error               { return nil }
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.e.name, Err: errors.New("is a directory")}
+}
+
+func (d *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		d.entries = d.e.dirEntries()
+	}
+	rest := d.entries[d.pos:]
+	if n <= 0 {
+		d.pos = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(rest))
+	d.pos += n
+	return rest[:n], nil
+}
+
+// countingReader gives the position in the archive
+type countingReader struct {
+	r   io.Reader
+	pos int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.pos += int64(n)
+	return n, err
+}
+
+func (c *countingReader) position() int64 { return c.pos }
+
+// countingSeeker implements io.Seeker to let the tar reader skip the file's data
+type countingSeeker struct {
+	countingReader
+}
+
+func (c *countingSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := c.r.(io.Seeker).Seek(offset, whence)
+	if err == nil {
+		c.pos = pos
+	}
+	return pos, err
+}
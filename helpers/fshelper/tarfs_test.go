@@ -0,0 +1,180 @@
+package fshelper
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var tarContent = []struct {
+	name    string
+	content string
+	dir     bool
+}{
+	{name: "./Takeout/", dir: true},
+	{name: "./Takeout/Google Photos/", dir: true},
+	{name: "./Takeout/Google Photos/Album/photo.jpg", content: "a photo"},
+	{name: "./Takeout/Google Photos/Album/photo.jpg.json", content: `{"title":"photo.jpg"}`},
+	{name: "Takeout/Google Photos/Photos from 2023/" + strings.Repeat("long name ", 12) + ".jpg", content: strings.Repeat("x", 1500)},
+	{name: "Takeout/Google Photos/Photos from 2023/empty.jpg", content: ""},
+	{name: "no/parent/folder.mp4", content: "a video"},
+}
+
+func writeTar(t *testing.T, name string, compressed bool) {
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	if compressed {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+	for _, c := range tarContent {
+		hdr := &tar.Header{Name: c.name, Mode: 0o644, Size: int64(len(c.content)), ModTime: time.Date(2023, 10, 6, 12, 0, 0, 0, time.UTC), Typeflag: tar.TypeReg}
+		if c.dir {
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0o755, 0
+		}
+		err = tw.WriteHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tw.Write([]byte(c.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = tw.WriteHeader(&tar.Header{Name: "link.jpg", Linkname: "no/parent/folder.mp4", Typeflag: tar.TypeSymlink})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTarFS(t *testing.T) {
+	for _, archive := range []string{"archive.tar", "archive.tgz", "archive.tar.gz"} {
+		t.Run(archive, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), archive)
+			writeTar(t, name, archive != "archive.tar")
+
+			fsyss, err := ParsePath(context.Background(), []string{name})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer CloseFSs(fsyss)
+			if len(fsyss) != 1 {
+				t.Fatalf("expected one FS, got %d", len(fsyss))
+			}
+			fsys := fsyss[0]
+
+			expected := []string{}
+			for _, c := range tarContent {
+				if !c.dir {
+					expected = append(expected, strings.TrimPrefix(c.name, "./"))
+				}
+			}
+			err = fstest.TestFS(fsys, expected...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, c := range tarContent {
+				if c.dir {
+					continue
+				}
+				b, err := fs.ReadFile(fsys, strings.TrimPrefix(c.name, "./"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != c.content {
+					t.Errorf("%s: unexpected content %q", c.name, b)
+				}
+			}
+			if _, err := fs.Stat(fsys, "link.jpg"); err == nil {
+				t.Errorf("links should be ignored")
+			}
+			if n, ok := fsys.(NameFS); !ok || n.Name() != archive {
+				t.Errorf("unexpected FS name")
+			}
+		})
+	}
+}
+
+func TestTarGzSpill(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "archive.tgz")
+	writeTar(t, name, true)
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	tfs, err := OpenTarFS(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	contents := map[string]string{}
+	for _, c := range tarContent {
+		if !c.dir {
+			files = append(files, strings.TrimPrefix(c.name, "./"))
+			contents[files[len(files)-1]] = c.content
+		}
+	}
+
+	// The archive is decompressed up to the file read
+	b, err := fs.ReadFile(tfs, files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != contents[files[0]] {
+		t.Errorf("%s: unexpected content %q", files[0], b)
+	}
+	first := tfs.entries[files[0]]
+	if tfs.filled != first.offset+first.size {
+		t.Errorf("the archive is decompressed up to %d, expected %d", tfs.filled, first.offset+first.size)
+	}
+
+	// Read the files backward, then forward, with two files opened at once
+	for i := len(files) - 1; i >= 0; i-- {
+		files = append(files, files[i])
+	}
+	for i, f := range files {
+		f1, err := tfs.Open(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f2, err := tfs.Open(files[(i+1)%len(files)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(f1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != contents[f] {
+			t.Errorf("%s: unexpected content %q", f, b)
+		}
+		f2.Close()
+		f1.Close()
+	}
+
+	err = tfs.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) > 0 {
+		t.Errorf("the temporary file is not removed: %v", entries)
+	}
+	if _, err = fs.ReadFile(tfs, files[0]); err == nil {
+		t.Errorf("a closed archive can't be read")
+	}
+}
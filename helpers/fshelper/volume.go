@@ -0,0 +1,90 @@
+package fshelper
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// VolumeSerial gives the serial number of the volume holding the folder, like 1234-ABCD for a memory card.
+// It's read from the system's disk identifiers, on Linux only. The result is empty when it can't be determined.
+func VolumeSerial(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err == nil {
+		dir, err = filepath.EvalSymlinks(dir)
+	}
+	if err != nil {
+		return ""
+	}
+	device := mountDevice(dir)
+	if device == "" {
+		return ""
+	}
+	device, err = filepath.EvalSymlinks(device)
+	if err != nil {
+		return ""
+	}
+	const byUUID = "/dev/disk/by-uuid"
+	entries, err := os.ReadDir(byUUID)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		d, err := filepath.EvalSymlinks(filepath.Join(byUUID, e.Name()))
+		if err == nil && d == device {
+			return e.Name()
+		}
+	}
+	return ""
+}
+
+// mountDevice gives the device mounted on the deepest mount point containing the folder
+func mountDevice(dir string) string {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	device, mountPoint := "", ""
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - vfat /dev/sdb1 rw
+		fields := strings.Fields(s.Text())
+		sep := -1
+		for i, f := range fields {
+			if f == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+		mp := unescapeMountInfo(fields[4])
+		if (dir == mp || strings.HasPrefix(dir, strings.TrimSuffix(mp, "/")+"/")) && len(mp) >= len(mountPoint) {
+			device, mountPoint = fields[sep+2], mp
+		}
+	}
+	if !strings.HasPrefix(device, "/dev/") {
+		return ""
+	}
+	return device
+}
+
+// unescapeMountInfo decodes the octal escapes of the mount points (\040 for a space)
+func unescapeMountInfo(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
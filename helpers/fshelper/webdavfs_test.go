@@ -0,0 +1,177 @@
+package fshelper
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/configuration"
+	"golang.org/x/net/webdav"
+)
+
+// newWebDAVServer starts a WebDAV server like Nextcloud's, with the files in memory
+func newWebDAVServer(t *testing.T, files map[string]string) *httptest.Server {
+	h := newWebDAVHandler(t, files)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "someone" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newWebDAVHandler serves the files in memory
+func newWebDAVHandler(t *testing.T, files map[string]string) http.Handler {
+	ctx := context.Background()
+	mfs := webdav.NewMemFS()
+	for name, content := range files {
+		parts := strings.Split(strings.Trim(name, "/"), "/")
+		for i := range parts[:len(parts)-1] {
+			err := mfs.Mkdir(ctx, "/"+strings.Join(parts[:i+1], "/"), 0o755)
+			if err != nil && !errors.Is(err, os.ErrExist) {
+				t.Fatal(err)
+			}
+		}
+		f, err := mfs.OpenFile(ctx, name, os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	return &webdav.Handler{
+		Prefix:     "/remote.php/dav/files/someone",
+		FileSystem: mfs,
+		LockSystem: webdav.NewMemLS(),
+	}
+}
+
+func TestWebDAVFS(t *testing.T) {
+	srv := newWebDAVServer(t, map[string]string{
+		"/Photos/2023/IMG_0001.jpg":           "a photo",
+		"/Photos/2023/Paris/IMG 0002.jpg":     "another photo",
+		"/Photos/2023/Paris/IMG_0002.jpg.xmp": "<xmp/>",
+		"/Photos/été/vidéo.mp4":               "a video",
+		"/Documents/notes.txt":                "not a photo",
+	})
+	host := strings.TrimPrefix(srv.URL, "http://")
+	share := "webdav://" + host + "/remote.php/dav/files/someone/Photos"
+
+	remotes := []configuration.Remote{
+		{URL: "http://" + host + "/remote.php/dav/files/someone", User: "wrong", Password: "wrong"},
+		{URL: "webdav://" + host + "/remote.php/dav/files/someone", User: "someone", Password: "secret"},
+		{URL: "webdav://" + host + "/remote.php/dav/files/someone/Documents", User: "wrong", Password: "wrong"},
+	}
+	fsyss, err := ParsePath(context.Background(), []string{share}, remotes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fsyss) != 1 {
+		t.Fatalf("expecting 1 FS, got %d", len(fsyss))
+	}
+	fsys := fsyss[0]
+
+	err = fstest.TestFS(fsys, "2023/IMG_0001.jpg", "2023/Paris/IMG 0002.jpg", "2023/Paris/IMG_0002.jpg.xmp", "été/vidéo.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := fs.ReadFile(fsys, "2023/Paris/IMG 0002.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "another photo" {
+		t.Errorf("unexpected content %q", b)
+	}
+	if _, err = fs.Stat(fsys, "2023/missing.jpg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expecting a not exist error, got %v", err)
+	}
+	if n, ok := fsys.(NameFS); !ok || n.Name() != host+"/remote.php/dav/files/someone/Photos" {
+		t.Errorf("unexpected FS name")
+	}
+}
+
+func TestWebDAVCredentials(t *testing.T) {
+	ctx := context.Background()
+	srv := newWebDAVServer(t, map[string]string{
+		"/Photos/IMG_0001.jpg": "a photo",
+	})
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	_, err := OpenWebDAV(ctx, "webdav://"+host+"/remote.php/dav/files/someone/Photos")
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expecting a permission error without credentials, got %v", err)
+	}
+	_, err = OpenWebDAV(ctx, "webdav://someone:secret@"+host+"/remote.php/dav/files/someone/Photos")
+	if err != nil {
+		t.Errorf("the credentials of the URL are refused: %s", err)
+	}
+	_, err = OpenWebDAV(ctx, "webdav://someone:secret@"+host+"/remote.php/dav/files/someone/Photos/IMG_0001.jpg")
+	if err == nil {
+		t.Errorf("expecting an error when the URL isn't a folder")
+	}
+}
+
+func TestWebDAVStalled(t *testing.T) {
+	defer func(d time.Duration) { remoteTimeout = d }(remoteTimeout)
+	remoteTimeout = 200 * time.Millisecond
+
+	h := newWebDAVHandler(t, map[string]string{
+		"/Photos/IMG_0001.jpg": "a photo",
+		"/Photos/VID_0002.mp4": "a video",
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, ".mp4") {
+			// Send the beginning of the video, then nothing
+			w.Header().Set("Content-Length", "1000")
+			_, _ = w.Write([]byte("a vid"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fsys, err := OpenWebDAV(ctx, "webdav://"+strings.TrimPrefix(srv.URL, "http://")+"/remote.php/dav/files/someone/Photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = fs.ReadFile(fsys, "VID_0002.mp4")
+	if !errors.Is(err, errStalled) {
+		t.Errorf("expecting a stalled download, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("the stalled download has been detected after %s", d)
+	}
+	b, err := fs.ReadFile(fsys, "IMG_0001.jpg")
+	if err != nil || string(b) != "a photo" {
+		t.Errorf("unexpected content %q, error %v", b, err)
+	}
+
+	// The command is cancelled
+	cancel()
+	if _, err = fs.ReadDir(fsys, "."); !errors.Is(err, context.Canceled) {
+		t.Errorf("expecting a cancelled request, got %v", err)
+	}
+	if _, err = fs.ReadFile(fsys, "IMG_0001.jpg"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expecting a cancelled download, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package myflag
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var bandwidthUnits = []struct {
+	suffix string
+	factor float64
+}{
+	// bits are given in decimal units, like network speeds
+	{"gbit", 1e9 / 8},
+	{"mbit", 1e6 / 8},
+	{"kbit", 1e3 / 8},
+	// bytes are given in binary units
+	{"gb", 1 << 30},
+	{"mb", 1 << 20},
+	{"kb", 1 << 10},
+	{"g", 1 << 30},
+	{"m", 1 << 20},
+	{"k", 1 << 10},
+	{"b", 1},
+}
+
+// BandwidthFlagFn returns a function for parsing a bandwidth in bytes per second.
+// The value accepts the units K, M, G for bytes and Kbit, Mbit, Gbit for bits, ex: 500K, 1.5MB, 10Mbit.
+// 0 means no limit.
+func BandwidthFlagFn(flag *int64, defaultValue int64) func(string) error {
+	*flag = defaultValue
+	return func(v string) error {
+		s := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(v)), "/s")
+		factor := 1.0
+		for _, u := range bandwidthUnits {
+			if strings.HasSuffix(s, u.suffix) {
+				s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+				factor = u.factor
+				break
+			}
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f < 0 {
+			return fmt.Errorf("can't parse the bandwidth parameter: %q", v)
+		}
+		*flag = int64(f * factor)
+		return nil
+	}
+}
@@ -0,0 +1,34 @@
+package myflag
+
+import "testing"
+
+func Test_BandwidthFn(t *testing.T) {
+	tc := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "0", want: 0},
+		{value: "1000", want: 1000},
+		{value: "500K", want: 500 * 1024},
+		{value: "1.5MB", want: 3 * 1024 * 1024 / 2},
+		{value: "2m/s", want: 2 * 1024 * 1024},
+		{value: "10Mbit", want: 1250000},
+		{value: "1 Gbit", want: 125000000},
+		{value: "fast", wantErr: true},
+		{value: "-1M", wantErr: true},
+	}
+	for _, c := range tc {
+		t.Run(c.value, func(t *testing.T) {
+			var got int64
+			fn := BandwidthFlagFn(&got, 42)
+			err := fn(c.value)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !c.wantErr && got != c.want {
+				t.Errorf("BandwidthFlagFn(%q)=%d, want %d", c.value, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Package sqlitedb opens a copy of the SQLite databases of the photo managers, leaving the original untouched.
+package sqlitedb
+
+import (
+	"database/sql"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	_ "modernc.org/sqlite" // SQLite driver
+)
+
+// DB is a copy of a database. The copy is removed when closed.
+type DB struct {
+	*sql.DB
+	dir string
+}
+
+// Open copies the database with its -wal and -shm files into a temporary folder, and opens the copy.
+// The database can't be altered, even when the photo manager is running.
+func Open(fsys fs.FS, name string) (*DB, error) {
+	dir, err := os.MkdirTemp("", "immich-go-db-*")
+	if err != nil {
+		return nil, err
+	}
+	base := path.Base(name)
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		b, err := fs.ReadFile(fsys, name+suffix)
+		if err != nil {
+			if suffix != "" && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			_ = os.RemoveAll(dir)
+			return nil, err
+		}
+		err = os.WriteFile(filepath.Join(dir, base+suffix), b, 0o600)
+		if err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+	db, err := sql.Open("sqlite", filepath.Join(dir, base))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	return &DB{DB: db, dir: dir}, nil
+}
+
+// OpenFile opens a copy of the database file
+func OpenFile(name string) (*DB, error) {
+	return Open(os.DirFS(filepath.Dir(name)), filepath.Base(name))
+}
+
+// Close closes the database and removes the copy
+func (db *DB) Close() error {
+	return errors.Join(db.DB.Close(), os.RemoveAll(db.dir))
+}
@@ -0,0 +1,65 @@
+package stacking
+
+import (
+	"path"
+	"strings"
+	"unicode/utf16"
+)
+
+// editedSuffixes are the suffixes given by Google Photos to the edited versions, in several languages
+var editedSuffixes = []string{
+	"-edited",     // en
+	"-modifié",    // fr
+	"-bearbeitet", // de
+	"-editado",    // es, pt
+	"-modificato", // it
+	"-bewerkt",    // nl
+	"-redigeret",  // da
+	"-redigerad",  // sv
+	"-redigert",   // no
+	"-muokattu",   // fi
+	"-edytowane",  // pl
+	"-upraveno",   // cs
+	"-изменено",   // ru
+	"-編集済み",       // ja
+}
+
+// truncatedLength is the length in UTF-16 chars of the names truncated by Google Photos, without the extension
+const truncatedLength = 47
+
+// EditedBase returns the name of the original without the extension when the file is an edited version
+//
+//	PXL_20220405_090123740.PORTRAIT-modifié.jpg -> PXL_20220405_090123740.PORTRAIT
+//
+// The suffix of a name truncated by Google Photos is truncated too:
+//
+//	Backyard_ceremony_wedding_photography_12345-edi.jpg -> Backyard_ceremony_wedding_photography_12345
+func EditedBase(name string) (string, bool) {
+	base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	if b, ok := trimSuffix(base, editedSuffixes); ok {
+		return b, true
+	}
+	if len(utf16.Encode([]rune(base))) != truncatedLength {
+		return "", false
+	}
+	// The dash and at least one char of the suffix are kept
+	for _, s := range editedSuffixes {
+		r := []rune(s)
+		for n := len(r) - 1; n >= 2; n-- {
+			if b, ok := trimSuffix(base, []string{string(r[:n])}); ok {
+				return b, true
+			}
+		}
+	}
+	return "", false
+}
+
+// trimSuffix removes the first suffix found at the end of the base, regardless of the case
+func trimSuffix(base string, suffixes []string) (string, bool) {
+	for _, s := range suffixes {
+		if len(base) > len(s) && strings.EqualFold(base[len(base)-len(s):], s) {
+			return base[:len(base)-len(s)], true
+		}
+	}
+	return "", false
+}
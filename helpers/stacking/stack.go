@@ -6,6 +6,7 @@ import (
 	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/simulot/immich-go/helpers/gen"
@@ -23,6 +24,7 @@ type Stack struct {
 	IDs       []string
 	Date      time.Time
 	Names     []string
+	FileNames []string // full names of the stacked files
 }
 
 type StackType int
@@ -30,12 +32,18 @@ type StackType int
 const (
 	StackRawJpg StackType = iota
 	StackBurst
+	StackEdited // Original and its edited versions
 )
 
 type StackBuilder struct {
+	lock           sync.Mutex       // ProcessAsset can be called by concurrent upload workers
 	dateRange      immich.DateRange // Set capture date range
 	stacks         map[Key]Stack
 	supportedMedia immich.SupportedMedia
+
+	editedStacks bool           // stack the edited versions with their original
+	editedCover  bool           // the edited version is the stack's cover
+	editedIDs    map[Key]string // ID of the edited version of the stacks
 }
 
 func NewStackBuilder(supportedMedia immich.SupportedMedia) *StackBuilder {
@@ -48,12 +56,22 @@ func NewStackBuilder(supportedMedia immich.SupportedMedia) *StackBuilder {
 	return &sb
 }
 
+// SetEditedStacks stacks the edited versions with their original.
+// The cover is the edited version when editedCover is true, the original otherwise.
+func (sb *StackBuilder) SetEditedStacks(editedCover bool) *StackBuilder {
+	sb.editedStacks = true
+	sb.editedCover = editedCover
+	sb.editedIDs = map[Key]string{}
+	return sb
+}
+
 func (sb *StackBuilder) ProcessAsset(id string, fileName string, captureDate time.Time) {
 	if !sb.dateRange.InRange(captureDate) {
 		return
 	}
 	cover := false
 	burst := false
+	edited := false
 	ext := path.Ext(fileName)
 	base := strings.TrimSuffix(path.Base(fileName), ext)
 	ext = strings.ToLower(ext)
@@ -68,6 +86,14 @@ func (sb *StackBuilder) ProcessAsset(id string, fileName string, captureDate tim
 		}
 	}
 
+	// Is this an edited version?
+	if !burst && sb.editedStacks {
+		if theBase, isEdited := EditedBase(fileName); isEdited {
+			base = theBase
+			edited = true
+		}
+	}
+
 	// may be .MP.jpg
 	if !burst {
 		ext := path.Ext(base)
@@ -80,17 +106,25 @@ func (sb *StackBuilder) ProcessAsset(id string, fileName string, captureDate tim
 		date:     captureDate.Round(time.Minute),
 		baseName: base,
 	}
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
 	s, ok := sb.stacks[k]
 	if !ok {
-		s.CoverID = id
 		s.Date = captureDate
 	}
+	if s.CoverID == "" && !edited {
+		s.CoverID = id
+	}
 	s.IDs = append(s.IDs, id)
 	s.Names = append(s.Names, path.Base(fileName))
+	s.FileNames = append(s.FileNames, fileName)
 	if burst {
 		s.StackType = StackBurst
 	}
-	if cover {
+	if edited {
+		s.StackType = StackEdited
+		sb.editedIDs[k] = id
+	} else if cover {
 		s.CoverID = id
 	} else if !burst && slices.Contains([]string{".jpeg", ".jpg", ".jpe"}, ext) {
 		s.CoverID = id
@@ -147,6 +181,8 @@ func nexusBurst(name string) (bool, string, bool) {
 }
 
 func (sb *StackBuilder) Stacks() []Stack {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
 	keys := gen.MapFilterKeys(sb.stacks, func(i Stack) bool {
 		return len(i.IDs) > 1
 	})
@@ -154,6 +190,9 @@ func (sb *StackBuilder) Stacks() []Stack {
 	stacks := make([]Stack, 0, len(keys))
 	for _, k := range keys {
 		s := sb.stacks[k]
+		if s.StackType == StackEdited && (sb.editedCover || s.CoverID == "") {
+			s.CoverID = sb.editedIDs[k]
+		}
 
 		// Exclude live photos
 		hasPhoto := 0
@@ -52,6 +52,7 @@ func Test_Stack(t *testing.T) {
 					IDs:       []string{"2"},
 					Date:      metadata.TakeTimeFromName("2023-10-01 10.15.00"),
 					Names:     []string{"IMG_1234.JPG", "IMG_1234.DNG"},
+					FileNames: []string{"IMG_1234.JPG", "IMG_1234.DNG"},
 					StackType: StackRawJpg,
 				},
 			},
@@ -70,6 +71,7 @@ func Test_Stack(t *testing.T) {
 					IDs:       []string{"3", "4"},
 					Date:      metadata.TakeTimeFromName("IMG_20231014_183246_BURST001_COVER.jpg"),
 					Names:     []string{"IMG_20231014_183246_BURST001_COVER.jpg", "IMG_20231014_183246_BURST002.jpg", "IMG_20231014_183246_BURST003.jpg"},
+					FileNames: []string{"IMG_20231014_183246_BURST001_COVER.jpg", "IMG_20231014_183246_BURST002.jpg", "IMG_20231014_183246_BURST003.jpg"},
 					StackType: StackBurst,
 				},
 			},
@@ -89,6 +91,7 @@ func Test_Stack(t *testing.T) {
 					IDs:       []string{"1"},
 					Date:      metadata.TakeTimeFromName("2023-10-01 10.15.00"),
 					Names:     []string{"3H2A0018.CR3", "3H2A0018.JPG"},
+					FileNames: []string{"3H2A0018.CR3", "3H2A0018.JPG"},
 					StackType: StackRawJpg,
 				},
 				{
@@ -96,6 +99,7 @@ func Test_Stack(t *testing.T) {
 					IDs:       []string{"3"},
 					Date:      metadata.TakeTimeFromName("2023-10-01 10.15.00"),
 					Names:     []string{"3H2A0019.CR3", "3H2A0019.JPG"},
+					FileNames: []string{"3H2A0019.CR3", "3H2A0019.JPG"},
 					StackType: StackRawJpg,
 				},
 			},
@@ -112,6 +116,7 @@ func Test_Stack(t *testing.T) {
 					IDs:       []string{"1"},
 					Date:      metadata.TakeTimeFromName("PXL_20231026_210642603.dng"),
 					Names:     []string{"PXL_20231026_210642603.dng", "PXL_20231026_210642603.jpg"},
+					FileNames: []string{"PXL_20231026_210642603.dng", "PXL_20231026_210642603.jpg"},
 					StackType: StackRawJpg,
 				},
 			},
@@ -128,6 +133,7 @@ func Test_Stack(t *testing.T) {
 					IDs:       []string{"3"},
 					Date:      metadata.TakeTimeFromName("20231026_205755225.MP.jpg"),
 					Names:     []string{"20231026_205755225.dng", "20231026_205755225.MP.jpg"},
+					FileNames: []string{"20231026_205755225.dng", "20231026_205755225.MP.jpg"},
 					StackType: StackRawJpg,
 				},
 			},
@@ -148,6 +154,7 @@ func Test_Stack(t *testing.T) {
 					IDs:       []string{"3"},
 					Date:      metadata.TakeTimeFromName("20231026_205755225.dng"),
 					Names:     []string{"20231026_205755225.dng", "20231026_205755225.MP.jpg"},
+					FileNames: []string{"20231026_205755225.dng", "20231026_205755225.MP.jpg"},
 					StackType: StackRawJpg,
 				},
 				{
@@ -155,6 +162,7 @@ func Test_Stack(t *testing.T) {
 					IDs:       []string{"5"},
 					Date:      metadata.TakeTimeFromName("PXL_20231207_032111247.RAW-02.ORIGINAL.dng"),
 					Names:     []string{"PXL_20231207_032111247.RAW-02.ORIGINAL.dng", "PXL_20231207_032111247.RAW-01.COVER.jpg"},
+					FileNames: []string{"PXL_20231207_032111247.RAW-02.ORIGINAL.dng", "PXL_20231207_032111247.RAW-01.COVER.jpg"},
 					StackType: StackBurst,
 				},
 				{
@@ -162,6 +170,7 @@ func Test_Stack(t *testing.T) {
 					IDs:       []string{"7"},
 					Date:      metadata.TakeTimeFromName("PXL_20231207_032108788.RAW-02.ORIGINAL.dng"),
 					Names:     []string{"PXL_20231207_032108788.RAW-02.ORIGINAL.dng", "PXL_20231207_032108788.RAW-01.MP.COVER.jpg"},
+					FileNames: []string{"PXL_20231207_032108788.RAW-02.ORIGINAL.dng", "PXL_20231207_032108788.RAW-01.MP.COVER.jpg"},
 					StackType: StackBurst,
 				},
 			},
@@ -180,6 +189,7 @@ func Test_Stack(t *testing.T) {
 					IDs:       []string{"2", "3", "4"},
 					Date:      metadata.TakeTimeFromName("20231207_101605_001.jpg"),
 					Names:     []string{"20231207_101605_001.jpg", "20231207_101605_002.jpg", "20231207_101605_003.jpg", "20231207_101605_004.jpg"},
+					FileNames: []string{"20231207_101605_001.jpg", "20231207_101605_002.jpg", "20231207_101605_003.jpg", "20231207_101605_004.jpg"},
 					StackType: StackBurst,
 				},
 			},
@@ -197,6 +207,7 @@ func Test_Stack(t *testing.T) {
 					IDs:       []string{"2", "3"},
 					Date:      metadata.TakeTimeFromName("00001IMG_00001_BURST20171111030039.jpg"),
 					Names:     []string{"00001IMG_00001_BURST20171111030039.jpg", "00002IMG_00002_BURST20171111030039.jpg", "00003IMG_00003_BURST20171111030039_COVER.jpg"},
+					FileNames: []string{"00001IMG_00001_BURST20171111030039.jpg", "00002IMG_00002_BURST20171111030039.jpg", "00003IMG_00003_BURST20171111030039_COVER.jpg"},
 					StackType: StackBurst,
 				},
 			},
@@ -221,3 +232,118 @@ func Test_Stack(t *testing.T) {
 		})
 	}
 }
+
+func Test_EditedStack(t *testing.T) {
+	date := metadata.TakeTimeFromName("2023-10-01 10.15.00")
+	input := []asset{
+		{ID: "1", FileName: "PXL_20231001_101500000-modifié.jpg", DateTaken: date},
+		{ID: "2", FileName: "PXL_20231001_101500000.jpg", DateTaken: date},
+		{ID: "3", FileName: "IMG_1234-edited.JPG", DateTaken: date},
+		{ID: "4", FileName: "IMG_1234.HEIC", DateTaken: date},
+	}
+	tc := []struct {
+		name        string
+		enabled     bool
+		editedCover bool
+		want        []Stack
+	}{
+		{
+			name: "not enabled",
+			want: []Stack{},
+		},
+		{
+			name:        "edited cover",
+			enabled:     true,
+			editedCover: true,
+			want: []Stack{
+				{
+					CoverID:   "1",
+					IDs:       []string{"2"},
+					Date:      date,
+					Names:     []string{"PXL_20231001_101500000-modifié.jpg", "PXL_20231001_101500000.jpg"},
+					FileNames: []string{"PXL_20231001_101500000-modifié.jpg", "PXL_20231001_101500000.jpg"},
+					StackType: StackEdited,
+				},
+				{
+					CoverID:   "3",
+					IDs:       []string{"4"},
+					Date:      date,
+					Names:     []string{"IMG_1234-edited.JPG", "IMG_1234.HEIC"},
+					FileNames: []string{"IMG_1234-edited.JPG", "IMG_1234.HEIC"},
+					StackType: StackEdited,
+				},
+			},
+		},
+		{
+			name:    "original cover",
+			enabled: true,
+			want: []Stack{
+				{
+					CoverID:   "2",
+					IDs:       []string{"1"},
+					Date:      date,
+					Names:     []string{"PXL_20231001_101500000-modifié.jpg", "PXL_20231001_101500000.jpg"},
+					FileNames: []string{"PXL_20231001_101500000-modifié.jpg", "PXL_20231001_101500000.jpg"},
+					StackType: StackEdited,
+				},
+				{
+					CoverID:   "4",
+					IDs:       []string{"3"},
+					Date:      date,
+					Names:     []string{"IMG_1234-edited.JPG", "IMG_1234.HEIC"},
+					FileNames: []string{"IMG_1234-edited.JPG", "IMG_1234.HEIC"},
+					StackType: StackEdited,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sb := NewStackBuilder(immich.DefaultSupportedMedia)
+			if tt.enabled {
+				sb.SetEditedStacks(tt.editedCover)
+			}
+			for _, a := range input {
+				sb.ProcessAsset(a.ID, a.FileName, a.DateTaken)
+			}
+
+			got := sb.Stacks()
+			sort.Slice(got, func(i, j int) bool {
+				return got[i].CoverID < got[j].CoverID
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("difference expected %+v got %+v", tt.want, got)
+				pretty.Ldiff(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_EditedBase(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantBase string
+		wantOK   bool
+	}{
+		{"IMG_1234.jpg", "", false},
+		{"IMG_1234-EDITED.JPG", "IMG_1234", true},
+		{"Photos from 2022/PXL_20220405_090123740.PORTRAIT-modifié.jpg", "PXL_20220405_090123740.PORTRAIT", true},
+		{"Backyard_ceremony_wedding_photography_12345-edi.jpg", "Backyard_ceremony_wedding_photography_12345", true},
+		{"Backyard_ceremony_wedding_photography_1234567-e.jpg", "Backyard_ceremony_wedding_photography_1234567", true},
+		{"Backyard_ceremony_wedding_photography_1234-изме.jpg", "Backyard_ceremony_wedding_photography_1234", true},
+		{"Backyard_ceremony_wedding_photography_123-edi.jpg", "", false},     // not truncated
+		{"Backyard_ceremony_wedding_photography_1234567890.jpg", "", false},  // truncated without suffix
+		{"Backyard_ceremony_wedding_photography_12345678-.jpg", "", false},   // only the dash
+		{"Backyard_ceremony_wedding_photography_123456-edit.jpg", "", false}, // 48 chars
+		{"Backyard_ceremony_wedding_photography_12345-edite.jpg", "", false}, // 48 chars
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, ok := EditedBase(tt.name)
+			if base != tt.wantBase || ok != tt.wantOK {
+				t.Errorf("EditedBase() = %q, %v, want %q, %v", base, ok, tt.wantBase, tt.wantOK)
+			}
+		})
+	}
+}
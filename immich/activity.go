@@ -0,0 +1,17 @@
+package immich
+
+import "context"
+
+// Activity is a comment or a like on a shared album, or on an asset of the album
+type Activity struct {
+	AlbumID string `json:"albumId"`
+	AssetID string `json:"assetId,omitempty"`
+	Type    string `json:"type"` // comment or like
+	Comment string `json:"comment,omitempty"`
+}
+
+// AddActivity posts the activity on the album
+func (ic *ImmichClient) AddActivity(ctx context.Context, a Activity) error {
+	return ic.newServerCall(ctx, EndPointAddActivity).do(
+		postRequest("/activities", "application/json", setAcceptJSON(), setJSONBody(a)))
+}
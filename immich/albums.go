@@ -36,6 +36,7 @@ type AlbumContent struct {
 	AlbumName   string            `json:"albumName"`
 	Description string            `json:"description"`
 	Shared      bool              `json:"shared"`
+	AlbumUsers  []AlbumUserInfo   `json:"albumUsers,omitempty"`
 	Assets      []AssetSimplified `json:"assets,omitempty"`
 	AssetIDs    []string          `json:"assetIds,omitempty"`
 	// CreatedAt                  time.Time `json:"createdAt"`
@@ -49,13 +50,13 @@ type AlbumContent struct {
 
 // immich Asset simplified
 type AssetSimplified struct {
-	ID            string `json:"id"`
-	DeviceAssetID string `json:"deviceAssetId"`
+	ID               string `json:"id"`
+	DeviceAssetID    string `json:"deviceAssetId"`
+	OriginalFileName string `json:"originalFileName"`
 	// // OwnerID          string `json:"ownerId"`
 	// DeviceID         string `json:"deviceId"`
 	// Type             string `json:"type"`
 	// OriginalPath     string `json:"originalPath"`
-	// OriginalFileName string `json:"originalFileName"`
 	// // Resized          bool      `json:"resized"`
 	// // Thumbhash        string    `json:"thumbhash"`
 	// FileCreatedAt time.Time `json:"fileCreatedAt"`
@@ -115,6 +116,22 @@ func (ic *ImmichClient) AddAssetToAlbum(ctx context.Context, albumID string, ass
 	return r, nil
 }
 
+// RemoveAssetFromAlbum removes the assets from the album. The assets are kept on the server.
+func (ic *ImmichClient) RemoveAssetFromAlbum(ctx context.Context, albumID string, assets []string) ([]UpdateAlbumResult, error) {
+	var r []UpdateAlbumResult
+	body := UpdateAlbum{
+		IDS: assets,
+	}
+	err := ic.newServerCall(ctx, EndPointRemoveAssetFromAlbum).do(
+		deleteRequest(fmt.Sprintf("/albums/%s/assets", albumID), setAcceptJSON(),
+			setJSONBody(body)),
+		responseJSON(&r))
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 func (ic *ImmichClient) CreateAlbum(ctx context.Context, name string, description string, assetsIDs []string) (AlbumSimplified, error) {
 	body := AlbumContent{
 		AlbumName:   name,
@@ -142,3 +159,26 @@ func (ic *ImmichClient) GetAssetAlbums(ctx context.Context, id string) ([]AlbumS
 func (ic *ImmichClient) DeleteAlbum(ctx context.Context, id string) error {
 	return ic.newServerCall(ctx, EndPointDeleteAlbum).do(deleteRequest("/albums/" + id))
 }
+
+// AlbumUser is a user sharing an album
+type AlbumUser struct {
+	UserID string `json:"userId"`
+	Role   string `json:"role"` // editor or viewer
+}
+
+// AlbumUserInfo is a user the album is shared with
+type AlbumUserInfo struct {
+	User User   `json:"user"`
+	Role string `json:"role"`
+}
+
+// AddUsersToAlbum shares the album with the users
+func (ic *ImmichClient) AddUsersToAlbum(ctx context.Context, albumID string, users []AlbumUser) error {
+	body := struct {
+		AlbumUsers []AlbumUser `json:"albumUsers"`
+	}{
+		AlbumUsers: users,
+	}
+	return ic.newServerCall(ctx, EndPointAddUsersToAlbum).do(
+		putRequest(fmt.Sprintf("/albums/%s/users", albumID), setAcceptJSON(), setJSONBody(body)))
+}
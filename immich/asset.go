@@ -67,7 +67,11 @@ func (ic *ImmichClient) AssetUpload(ctx context.Context, la *browser.LocalAssetF
 	}
 
 	body, pw := io.Pipe()
-	m := multipart.NewWriter(pw)
+	ctx, w, stop := ic.throttle(ctx, pw)
+	defer stop()
+	// The request's body is released when the upload is cancelled, even if the file's reading is blocked
+	defer context.AfterFunc(ctx, func() { body.CloseWithError(context.Cause(ctx)) })()
+	m := multipart.NewWriter(w)
 
 	go func() {
 		defer func() {
@@ -155,7 +159,7 @@ func (ic *ImmichClient) AssetUpload(ctx context.Context, la *browser.LocalAssetF
 			if err != nil {
 				return
 			}
-			err = la.SideCar.Write(part)
+			err = la.SideCar.WriteWithMetadata(part, la.Metadata)
 			if err != nil {
 				return
 			}
@@ -191,10 +195,14 @@ func (ic *ImmichClient) AssetUpload(ctx context.Context, la *browser.LocalAssetF
 		}
 	}
 
-	errCall := ic.newServerCall(ctx, "AssetUpload").
-		do(postRequest("/assets", m.FormDataContentType(), setContextValue(callValues), setAcceptJSON(), setBody(body)), responseJSON(&ar))
+	sc := ic.newServerCall(ctx, "AssetUpload")
+	sc.noTimeout = ic.throttled()
+	errCall := sc.do(postRequest("/assets", m.FormDataContentType(), setContextValue(callValues), setAcceptJSON(), setBody(body)), responseJSON(&ar))
 
 	err = errors.Join(err, errCall)
+	if errors.Is(context.Cause(ctx), ErrUploadStalled) {
+		err = errors.Join(err, ErrUploadStalled)
+	}
 	return ar, err
 }
 
@@ -242,6 +250,38 @@ func (o *GetAssetOptions) Values() url.Values {
 	return v
 }
 
+type BulkUploadCheckItem struct {
+	ID       string `json:"id"`       // Client's ID of the asset, returned as is in the results
+	Checksum string `json:"checksum"` // SHA-1 of the asset, base64 or hex encoded
+}
+
+type BulkUploadCheckResult struct {
+	ID        string `json:"id"`
+	Action    string `json:"action"` // accept or reject
+	Reason    string `json:"reason,omitempty"`
+	AssetID   string `json:"assetId,omitempty"` // ID of the server's asset having the same checksum
+	IsTrashed bool   `json:"isTrashed,omitempty"`
+}
+
+const (
+	BulkUploadAccept = "accept"
+	BulkUploadReject = "reject"
+)
+
+// CheckBulkUpload asks the server if it has already assets with the given checksums
+func (ic *ImmichClient) CheckBulkUpload(ctx context.Context, items []BulkUploadCheckItem) ([]BulkUploadCheckResult, error) {
+	req := struct {
+		Assets []BulkUploadCheckItem `json:"assets"`
+	}{
+		Assets: items,
+	}
+	var resp struct {
+		Results []BulkUploadCheckResult `json:"results"`
+	}
+	err := ic.newServerCall(ctx, EndPointCheckBulkUpload).do(postRequest("/assets/bulk-upload-check", "application/json", setAcceptJSON(), setJSONBody(req)), responseJSON(&resp))
+	return resp.Results, err
+}
+
 func (ic *ImmichClient) DeleteAssets(ctx context.Context, id []string, forceDelete bool) error {
 	req := struct {
 		Force bool     `json:"force"`
@@ -255,13 +295,8 @@ func (ic *ImmichClient) DeleteAssets(ctx context.Context, id []string, forceDele
 }
 
 func (ic *ImmichClient) GetAssetByID(ctx context.Context, id string) (*Asset, error) {
-	body := struct {
-		WithExif  bool   `json:"withExif,omitempty"`
-		IsVisible bool   `json:"isVisible,omitempty"`
-		ID        string `json:"id"`
-	}{WithExif: true, IsVisible: true, ID: id}
 	r := Asset{}
-	err := ic.newServerCall(ctx, "GetAssetByID").do(postRequest("/search/metadata", "application/json", setAcceptJSON(), setJSONBody(body)), responseJSON(&r))
+	err := ic.newServerCall(ctx, EndPointGetAssetByID).do(getRequest("/assets/"+id, setAcceptJSON()), responseJSON(&r))
 	return &r, err
 }
 
@@ -274,8 +309,8 @@ func (ic *ImmichClient) UpdateAssets(ctx context.Context, ids []string,
 		IDs           []string `json:"ids"`
 		IsArchived    bool     `json:"isArchived"`
 		IsFavorite    bool     `json:"isFavorite"`
-		Latitude      float64  `json:"latitude"`
-		Longitude     float64  `json:"longitude"`
+		Latitude      float64  `json:"latitude,omitempty"`  // not changed when 0
+		Longitude     float64  `json:"longitude,omitempty"` // not changed when 0
 		RemoveParent  bool     `json:"removeParent"`
 		StackParentID string   `json:"stackParentId,omitempty"`
 	}
@@ -20,6 +20,7 @@ const (
 	EndPointGetAllAlbums           = "GetAllAlbums"
 	EndPointGetAlbumInfo           = "GetAlbumInfo"
 	EndPointAddAsstToAlbum         = "AddAssetToAlbum"
+	EndPointRemoveAssetFromAlbum   = "RemoveAssetFromAlbum"
 	EndPointCreateAlbum            = "CreateAlbum"
 	EndPointGetAssetAlbums         = "GetAssetAlbums"
 	EndPointDeleteAlbum            = "DeleteAlbum"
@@ -29,6 +30,17 @@ const (
 	EndPointGetAssetStatistics     = "GetAssetStatistics"
 	EndPointGetSupportedMediaTypes = "GetSupportedMediaTypes"
 	EndPointGetAllAssets           = "GetAllAssets"
+	EndPointCheckBulkUpload        = "CheckBulkUpload"
+	EndPointGetAssetByID           = "GetAssetByID"
+	EndPointGetAllPeople           = "GetAllPeople"
+	EndPointCreatePerson           = "CreatePerson"
+	EndPointAddAssetToPerson       = "AddAssetToPerson"
+	EndPointGetAssetFaces          = "GetAssetFaces"
+	EndPointUpsertTags             = "UpsertTags"
+	EndPointTagAssets              = "TagAssets"
+	EndPointGetAllUsers            = "GetAllUsers"
+	EndPointAddUsersToAlbum        = "AddUsersToAlbum"
+	EndPointAddActivity            = "AddActivity"
 )
 
 type TooManyInternalError struct {
@@ -42,10 +54,11 @@ func (e TooManyInternalError) Is(target error) bool {
 
 // serverCall permit to decorate request and responses in one line
 type serverCall struct {
-	endPoint string
-	ic       *ImmichClient
-	err      error
-	ctx      context.Context
+	endPoint  string
+	ic        *ImmichClient
+	err       error
+	ctx       context.Context
+	noTimeout bool // the call isn't limited by the client's timeout, its context limits it
 }
 
 // callError represents errors returned by the server
@@ -205,7 +218,11 @@ func (sc *serverCall) do(fnRequest requestFunction, opts ...serverResponseOption
 		_ = sc.joinError(setTraceRequest()(sc, req))
 	}
 
-	resp, err = sc.ic.client.Do(req)
+	client := sc.ic.client
+	if sc.noTimeout {
+		client = &http.Client{Transport: client.Transport}
+	}
+	resp, err = client.Do(req)
 	// any non nil error must be returned
 	if err != nil {
 		_ = sc.joinError(err)
@@ -30,7 +30,8 @@ type ImmichClient struct {
 	Retries             int           // Number of attempts on 500 errors
 	RetriesDelay        time.Duration // Duration between retries
 	apiTraceWriter      io.Writer
-	supportedMediaTypes SupportedMedia // Server's list of supported medias
+	supportedMediaTypes SupportedMedia    // Server's list of supported medias
+	limiter             *bandwidthLimiter // Uploads bandwidth limiter, nil when unlimited
 }
 
 func (ic *ImmichClient) SetEndPoint(endPoint string) {
@@ -65,6 +66,16 @@ func OptionConnectionTimeout(d time.Duration) clientOption {
 	}
 }
 
+// OptionMaxBandwidth limits the bandwidth used by uploads, in bytes per second. 0 means no limit.
+func OptionMaxBandwidth(bytesPerSecond int64) clientOption {
+	return func(ic *ImmichClient) error {
+		if bytesPerSecond > 0 {
+			ic.limiter = newBandwidthLimiter(bytesPerSecond)
+		}
+		return nil
+	}
+}
+
 // Create a new ImmichClient
 func NewImmichClient(endPoint string, key string, options ...clientOption) (*ImmichClient, error) {
 	var err error
@@ -143,6 +154,13 @@ func (ic *ImmichClient) ValidateConnection(ctx context.Context) (User, error) {
 	return user, nil
 }
 
+// GetAllUsers returns the users of the server
+func (ic *ImmichClient) GetAllUsers(ctx context.Context) ([]User, error) {
+	var users []User
+	err := ic.newServerCall(ctx, EndPointGetAllUsers).do(getRequest("/users", setAcceptJSON()), responseJSON(&users))
+	return users, err
+}
+
 type ServerStatistics struct {
 	Photos      int   `json:"photos"`
 	Videos      int   `json:"videos"`
@@ -20,15 +20,19 @@ type ImmichInterface interface {
 	SetDeviceUUID(string)
 	PingServer(ctx context.Context) error
 	ValidateConnection(ctx context.Context) (User, error)
+	GetAllUsers(ctx context.Context) ([]User, error)
 	GetServerStatistics(ctx context.Context) (ServerStatistics, error)
 	GetAssetStatistics(ctx context.Context) (UserStatistics, error)
 
 	UpdateAsset(ctx context.Context, ID string, a *browser.LocalAssetFile) (*Asset, error)
 	GetAllAssets(ctx context.Context) ([]*Asset, error)
 	AddAssetToAlbum(context.Context, string, []string) ([]UpdateAlbumResult, error)
+	RemoveAssetFromAlbum(context.Context, string, []string) ([]UpdateAlbumResult, error)
 	UpdateAssets(ctx context.Context, IDs []string, isArchived bool, isFavorite bool, latitude float64, longitude float64, removeParent bool, stackParentID string) error
 	GetAllAssetsWithFilter(context.Context, func(*Asset) error) error
 	AssetUpload(context.Context, *browser.LocalAssetFile) (AssetResponse, error)
+	CheckBulkUpload(ctx context.Context, items []BulkUploadCheckItem) ([]BulkUploadCheckResult, error)
+	GetAssetByID(ctx context.Context, id string) (*Asset, error)
 	DeleteAssets(context.Context, []string, bool) error
 
 	GetAllAlbums(ctx context.Context) ([]AlbumSimplified, error)
@@ -36,9 +40,19 @@ type ImmichInterface interface {
 	CreateAlbum(ctx context.Context, tilte string, description string, ids []string) (AlbumSimplified, error)
 	GetAssetAlbums(ctx context.Context, ID string) ([]AlbumSimplified, error)
 	DeleteAlbum(ctx context.Context, id string) error
+	AddUsersToAlbum(ctx context.Context, albumID string, users []AlbumUser) error
+	AddActivity(ctx context.Context, a Activity) error
 
 	StackAssets(ctx context.Context, cover string, IDs []string) error
 
+	GetAllPeople(ctx context.Context) ([]Person, error)
+	CreatePerson(ctx context.Context, name string) (Person, error)
+	AddAssetToPerson(ctx context.Context, assetID string, personID string, region browser.FaceRegion) error
+	GetAssetFaces(ctx context.Context, assetID string) ([]Face, error)
+
+	UpsertTags(ctx context.Context, names []string) ([]Tag, error)
+	TagAssets(ctx context.Context, tagID string, assetIDs []string) error
+
 	SupportedMedia() SupportedMedia
 	GetJobs(ctx context.Context) (map[string]Job, error)
 }
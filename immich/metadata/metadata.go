@@ -4,20 +4,24 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Metadata struct {
+	Title       string
 	Description string
+	Keywords    []string
 	DateTaken   time.Time
 	Latitude    float64
 	Longitude   float64
 	Altitude    float64
+	Rating      int // 1 to 5 stars, 0 when not rated
 }
 
 func (m Metadata) IsSet() bool {
-	return m.Description != "" || !m.DateTaken.IsZero() || m.Latitude != 0 || m.Longitude != 0
+	return m.Title != "" || m.Description != "" || len(m.Keywords) > 0 || !m.DateTaken.IsZero() || m.Latitude != 0 || m.Longitude != 0 || m.Rating != 0
 }
 
 func (m Metadata) Write(w io.Writer) error {
@@ -25,16 +29,40 @@ func (m Metadata) Write(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	if m.Description != "" {
-		_, err = io.WriteString(w, descriptionHeader)
+	if m.Description != "" || m.Title != "" || len(m.Keywords) > 0 {
+		_, err = io.WriteString(w, dcHeader)
 		if err != nil {
 			return err
 		}
-		err = xml.EscapeText(w, []byte(m.Description))
-		if err != nil {
-			return err
+		if m.Title != "" {
+			err = writeTagged(w, titleHeader, m.Title, titleFooter)
+			if err != nil {
+				return err
+			}
+		}
+		if m.Description != "" {
+			err = writeTagged(w, descriptionHeader, m.Description, descriptionFooter)
+			if err != nil {
+				return err
+			}
 		}
-		_, err = io.WriteString(w, descriptionFooter)
+		if len(m.Keywords) > 0 {
+			_, err = io.WriteString(w, subjectHeader)
+			if err != nil {
+				return err
+			}
+			for _, k := range m.Keywords {
+				err = writeTagged(w, subjectItemHeader, k, subjectItemFooter)
+				if err != nil {
+					return err
+				}
+			}
+			_, err = io.WriteString(w, subjectFooter)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = io.WriteString(w, dcFooter)
 		if err != nil {
 			return err
 		}
@@ -67,6 +95,26 @@ func (m Metadata) Write(w io.Writer) error {
 			return err
 		}
 	}
+	if m.Rating != 0 {
+		err = writeTagged(w, xmpHeader, strconv.Itoa(m.Rating), xmpFooter)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, footer)
+	return err
+}
+
+// writeTagged writes the escaped text between the header and the footer
+func writeTagged(w io.Writer, header string, text string, footer string) error {
+	_, err := io.WriteString(w, header)
+	if err != nil {
+		return err
+	}
+	err = xml.EscapeText(w, []byte(text))
+	if err != nil {
+		return err
+	}
 	_, err = io.WriteString(w, footer)
 	return err
 }
@@ -82,16 +130,35 @@ const (
 <x:xmpmeta xmlns:x='adobe:ns:meta/' x:xmptk='Image::ExifTool 12.40'>
 <rdf:RDF xmlns:rdf='http://www.w3.org/1999/02/22-rdf-syntax-ns#'>
 `
-	descriptionHeader = ` <rdf:Description rdf:about=''
+	dcHeader = ` <rdf:Description rdf:about=''
   xmlns:dc='http://purl.org/dc/elements/1.1/'>
-  <dc:description>
+`
+	titleHeader = `  <dc:title>
+   <rdf:Alt>
+    <rdf:li xml:lang='x-default'>`
+
+	titleFooter = `</rdf:li>
+   </rdf:Alt>
+  </dc:title>
+`
+	descriptionHeader = `  <dc:description>
    <rdf:Alt>
     <rdf:li xml:lang='x-default'>`
 
 	descriptionFooter = `</rdf:li>
    </rdf:Alt>
   </dc:description>
- </rdf:Description>
+`
+	subjectHeader = `  <dc:subject>
+   <rdf:Bag>
+`
+	subjectItemHeader = `    <rdf:li>`
+	subjectItemFooter = `</rdf:li>
+`
+	subjectFooter = `   </rdf:Bag>
+  </dc:subject>
+`
+	dcFooter = ` </rdf:Description>
 `
 
 	exifHeader = ` <rdf:Description rdf:about=''
@@ -108,6 +175,12 @@ const (
 `
 	exifFooter = `  <exif:GPSVersionID>2.3.0.0</exif:GPSVersionID>
  </rdf:Description>
+`
+	xmpHeader = ` <rdf:Description rdf:about=''
+  xmlns:xmp='http://ns.adobe.com/xap/1.0/'>
+  <xmp:Rating>`
+	xmpFooter = `</xmp:Rating>
+ </rdf:Description>
 `
 	footer = `</rdf:RDF>
 </x:xmpmeta>
@@ -7,10 +7,13 @@ import (
 
 func TestMetadata_String(t *testing.T) {
 	type fields struct {
+		Title       string
 		Description string
+		Keywords    []string
 		DateTaken   time.Time
 		Latitude    float64
 		Longitude   float64
+		Rating      int
 	}
 	tests := []struct {
 		name   string
@@ -71,6 +74,38 @@ func TestMetadata_String(t *testing.T) {
  </rdf:Description>
 </rdf:RDF>
 </x:xmpmeta>
+<?xpacket end='w'?>`,
+		},
+		{
+			name: "TitleKeywordsAndRating",
+			fields: fields{
+				Title:    "Eiffel tower",
+				Keywords: []string{"travel", "rock & roll"},
+				Rating:   4,
+			},
+			want: `<?xpacket begin='?' id='W5M0MpCehiHzreSzNTczkc9d'?>
+<x:xmpmeta xmlns:x='adobe:ns:meta/' x:xmptk='Image::ExifTool 12.40'>
+<rdf:RDF xmlns:rdf='http://www.w3.org/1999/02/22-rdf-syntax-ns#'>
+ <rdf:Description rdf:about=''
+  xmlns:dc='http://purl.org/dc/elements/1.1/'>
+  <dc:title>
+   <rdf:Alt>
+    <rdf:li xml:lang='x-default'>Eiffel tower</rdf:li>
+   </rdf:Alt>
+  </dc:title>
+  <dc:subject>
+   <rdf:Bag>
+    <rdf:li>travel</rdf:li>
+    <rdf:li>rock &amp; roll</rdf:li>
+   </rdf:Bag>
+  </dc:subject>
+ </rdf:Description>
+ <rdf:Description rdf:about=''
+  xmlns:xmp='http://ns.adobe.com/xap/1.0/'>
+  <xmp:Rating>4</xmp:Rating>
+ </rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>
 <?xpacket end='w'?>`,
 		},
 		{
@@ -107,10 +142,13 @@ func TestMetadata_String(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			m := Metadata{
+				Title:       tt.fields.Title,
 				Description: tt.fields.Description,
+				Keywords:    tt.fields.Keywords,
 				DateTaken:   tt.fields.DateTaken,
 				Latitude:    tt.fields.Latitude,
 				Longitude:   tt.fields.Longitude,
+				Rating:      tt.fields.Rating,
 			}
 			if got := m.String(); got != tt.want {
 				t.Errorf("Meta.String() = %v, want %v", got, tt.want)
@@ -1,13 +1,50 @@
 package metadata
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"io/fs"
 )
 
+// SideCarPolicy tells how the metadata found by immich-go are combined with an existing sidecar
+type SideCarPolicy int
+
+const (
+	SideCarMerge   SideCarPolicy = iota // fill the sidecar's missing values with the metadata
+	SideCarKeep                         // upload the sidecar as is
+	SideCarReplace                      // override the sidecar's values with the metadata
+)
+
+func (p SideCarPolicy) String() string {
+	switch p {
+	case SideCarKeep:
+		return "keep"
+	case SideCarReplace:
+		return "replace"
+	default:
+		return "merge"
+	}
+}
+
+func (p *SideCarPolicy) Set(s string) error {
+	switch s {
+	case "merge":
+		*p = SideCarMerge
+	case "keep":
+		*p = SideCarKeep
+	case "replace":
+		*p = SideCarReplace
+	default:
+		return fmt.Errorf("invalid sidecar policy %q, expecting keep, merge or replace", s)
+	}
+	return nil
+}
+
 type SideCarFile struct {
 	FSys     fs.FS
 	FileName string
+	Policy   SideCarPolicy
 }
 
 func (m SideCarFile) Write(w io.Writer) error {
@@ -20,6 +57,26 @@ func (m SideCarFile) Write(w io.Writer) error {
 	return err
 }
 
+// WriteWithMetadata writes the sidecar combined with the metadata, according to the sidecar policy.
+// The sidecar is written as is when it can't be parsed.
+func (m SideCarFile) WriteWithMetadata(w io.Writer, md Metadata) error {
+	if m.Policy == SideCarKeep || !md.IsSet() {
+		return m.Write(w)
+	}
+	b, err := fs.ReadFile(m.FSys, m.FileName)
+	if err != nil {
+		return err
+	}
+	merged := bytes.NewBuffer(nil)
+	err = MergeXMP(merged, bytes.NewReader(b), md, m.Policy == SideCarReplace)
+	if err != nil {
+		_, err = w.Write(b)
+		return err
+	}
+	_, err = io.Copy(w, merged)
+	return err
+}
+
 func (m *SideCarFile) IsSet() bool {
 	if m == nil {
 		return false
@@ -0,0 +1,49 @@
+package metadata
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// The DJI drones write the flight log of their videos in a subtitle file beside the video.
+// Depending on the model, the position of each frame is written like:
+//
+//	[latitude: 48.858400] [longitude: 2.294500] [rel_alt: 1.200 abs_alt: 120.500]
+//
+// or
+//
+//	GPS(2.2945,48.8584,19) BAROMETER:120.5
+var (
+	srtLatitudeRe  = regexp.MustCompile(`\[latitude\s*:\s*(-?[0-9.]+)\]`)
+	srtLongitudeRe = regexp.MustCompile(`\[longitude\s*:\s*(-?[0-9.]+)\]`)
+	srtAltitudeRe  = regexp.MustCompile(`abs_alt\s*:\s*(-?[0-9.]+)`)
+	srtGPSRe       = regexp.MustCompile(`GPS\s*\(\s*(-?[0-9.]+)\s*,\s*(-?[0-9.]+)\s*,\s*(-?[0-9.]+)`)
+)
+
+// GetFromSRT gives the position of the first frame of a DJI flight log having a position.
+// The result is empty when the log has no position.
+func GetFromSRT(r io.Reader) (Metadata, error) {
+	var m Metadata
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if lat, lon := srtLatitudeRe.FindStringSubmatch(line), srtLongitudeRe.FindStringSubmatch(line); lat != nil && lon != nil {
+			m.Latitude, _ = strconv.ParseFloat(lat[1], 64)
+			m.Longitude, _ = strconv.ParseFloat(lon[1], 64)
+			if alt := srtAltitudeRe.FindStringSubmatch(line); alt != nil {
+				m.Altitude, _ = strconv.ParseFloat(alt[1], 64)
+			}
+		} else if gps := srtGPSRe.FindStringSubmatch(line); gps != nil {
+			m.Longitude, _ = strconv.ParseFloat(gps[1], 64)
+			m.Latitude, _ = strconv.ParseFloat(gps[2], 64)
+			m.Altitude, _ = strconv.ParseFloat(gps[3], 64)
+		}
+		if m.Latitude != 0 || m.Longitude != 0 {
+			return m, nil
+		}
+		m.Altitude = 0 // no fix yet
+	}
+	return Metadata{}, s.Err()
+}
@@ -0,0 +1,59 @@
+package metadata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetFromSRT(t *testing.T) {
+	tests := []struct {
+		name               string
+		srt                string
+		lat, lon, altitude float64
+	}{
+		{
+			name: "mini",
+			srt: `1
+00:00:00,000 --> 00:00:00,033
+<font size="28">FrameCnt: 1, DiffTime: 33ms
+2023-06-13 18:21:00.123
+[iso: 100] [shutter: 1/640.0] [fnum: 2.8] [ev: 0] [latitude: 0.000000] [longitude: 0.000000] [rel_alt: 0.000 abs_alt: 0.000] </font>
+
+2
+00:00:00,033 --> 00:00:00,066
+<font size="28">FrameCnt: 2, DiffTime: 33ms
+2023-06-13 18:21:00.156
+[iso: 100] [shutter: 1/640.0] [fnum: 2.8] [ev: 0] [latitude: 48.858400] [longitude: 2.294500] [rel_alt: 1.200 abs_alt: 120.500] </font>
+`,
+			lat: 48.8584, lon: 2.2945, altitude: 120.5,
+		},
+		{
+			name: "phantom",
+			srt: `1
+00:00:00,000 --> 00:00:01,000
+HOME(2.2950,48.8580) 2018.07.14 10:00:00
+GPS(2.2945,48.8584,19) BAROMETER:120.5
+ISO:100 Shutter:60 EV:0 Fnum:F2.8
+`,
+			lat: 48.8584, lon: 2.2945, altitude: 19,
+		},
+		{
+			name: "no position",
+			srt: `1
+00:00:00,000 --> 00:00:00,033
+[iso: 100] [latitude: 0.000000] [longitude: 0.000000] [rel_alt: 0.000 abs_alt: 95.000]
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := GetFromSRT(strings.NewReader(tt.srt))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Latitude != tt.lat || m.Longitude != tt.lon || m.Altitude != tt.altitude {
+				t.Errorf("want %f,%f,%f, got %f,%f,%f", tt.lat, tt.lon, tt.altitude, m.Latitude, m.Longitude, m.Altitude)
+			}
+		})
+	}
+}
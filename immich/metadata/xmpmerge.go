@@ -0,0 +1,482 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+	The XMP merge engine completes an existing sidecar with the metadata found by immich-go
+	(takeout JSON, file names...).
+
+	The sidecar is parsed as a tree keeping the prefixes, the namespace declarations and the
+	formatting of the original file. Only the date of capture, the GPS coordinates, the title, the description,
+	the keywords and the rating are touched, everything else is written back untouched.
+
+	The missing values are added in a new rdf:Description. When the values are overridden, existing
+	properties are updated in place.
+*/
+
+const (
+	nsRDF       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsExif      = "http://ns.adobe.com/exif/1.0/"
+	nsDC        = "http://purl.org/dc/elements/1.1/"
+	nsXMP       = "http://ns.adobe.com/xap/1.0/"
+	nsPhotoshop = "http://ns.adobe.com/photoshop/1.0/"
+	nsLightroom = "http://ns.adobe.com/lightroom/1.0/"
+	nsXML       = "http://www.w3.org/XML/1998/namespace"
+)
+
+type xmpProp struct {
+	uri   string
+	local string
+}
+
+var (
+	propDateTimeOriginal = xmpProp{nsExif, "DateTimeOriginal"}
+	propDateCreated      = xmpProp{nsPhotoshop, "DateCreated"}
+	propCreateDate       = xmpProp{nsXMP, "CreateDate"}
+	propGPSLatitude      = xmpProp{nsExif, "GPSLatitude"}
+	propGPSLongitude     = xmpProp{nsExif, "GPSLongitude"}
+	propTitle            = xmpProp{nsDC, "title"}
+	propDescription      = xmpProp{nsDC, "description"}
+	propSubject          = xmpProp{nsDC, "subject"}
+	propHierarchical     = xmpProp{nsLightroom, "hierarchicalSubject"}
+	propRating           = xmpProp{nsXMP, "Rating"}
+)
+
+// langAltProps are the language alternatives, their value is the default item
+var langAltProps = map[xmpProp]bool{propTitle: true, propDescription: true}
+
+// MergeXMP writes the XMP sidecar read from r completed with the metadata m.
+// When override is true, the values of m replace the ones of the sidecar.
+func MergeXMP(w io.Writer, r io.Reader, m Metadata, override bool) error {
+	doc, err := parseXMP(r)
+	if err != nil {
+		return err
+	}
+	root := doc.find(func(e *xmlElement) bool { return e.is(nsRDF, "RDF") })
+	if root == nil {
+		return errors.New("the sidecar has no rdf:RDF element")
+	}
+
+	var added []xmpValue
+	setValue := func(v xmpValue, present bool) {
+		switch {
+		case !present:
+			added = append(added, v)
+		case override:
+			if !root.setProperty(v) {
+				added = append(added, v)
+			}
+		}
+	}
+	set := func(p xmpProp, value string, present bool) {
+		setValue(xmpValue{prop: p, value: value}, present)
+	}
+
+	if !m.DateTaken.IsZero() {
+		present := root.hasProperty(propDateTimeOriginal) || root.hasProperty(propDateCreated) || root.hasProperty(propCreateDate)
+		set(propDateTimeOriginal, m.DateTaken.UTC().Format("2006-01-02T15:04:05Z"), present)
+	}
+	if m.Latitude != 0 || m.Longitude != 0 {
+		present := root.hasProperty(propGPSLatitude) && root.hasProperty(propGPSLongitude)
+		set(propGPSLatitude, fmt.Sprintf("%f", m.Latitude), present)
+		set(propGPSLongitude, fmt.Sprintf("%f", m.Longitude), present)
+	}
+	if m.Title != "" {
+		set(propTitle, m.Title, root.hasProperty(propTitle))
+	}
+	if m.Description != "" {
+		set(propDescription, m.Description, root.hasProperty(propDescription))
+	}
+	if len(m.Keywords) > 0 {
+		// The applications read the hierarchical keywords first, the levels are separated by |
+		present := root.hasProperty(propSubject) || root.hasProperty(propHierarchical)
+		hierarchical := make([]string, len(m.Keywords))
+		for i, k := range m.Keywords {
+			hierarchical[i] = strings.ReplaceAll(k, "/", "|")
+		}
+		setValue(xmpValue{prop: propSubject, items: m.Keywords}, present)
+		setValue(xmpValue{prop: propHierarchical, items: hierarchical}, present)
+	}
+	if m.Rating != 0 {
+		set(propRating, strconv.Itoa(m.Rating), root.hasProperty(propRating))
+	}
+
+	if len(added) > 0 {
+		root.addDescription(added)
+	}
+	return doc.write(w)
+}
+
+type xmpValue struct {
+	prop  xmpProp
+	value string
+	items []string // the items of a bag
+}
+
+// xmlElement is an element of the XMP tree. The names are kept with their prefix.
+// The content is made of *xmlElement, xml.CharData, xml.Comment, xml.ProcInst and xml.Directive.
+type xmlElement struct {
+	Name    xml.Name
+	Attr    []xml.Attr
+	Content []any
+	ns      map[string]string // namespaces in the scope of the element, by prefix
+}
+
+func parseXMP(r io.Reader) (*xmlElement, error) {
+	doc := &xmlElement{ns: map[string]string{"xml": nsXML}}
+	stack := []*xmlElement{doc}
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parent := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &xmlElement{Name: t.Name, Attr: t.Copy().Attr, ns: parent.ns}
+			copied := false
+			for _, a := range e.Attr {
+				prefix, isDecl := "", false
+				switch {
+				case a.Name.Space == "xmlns":
+					prefix, isDecl = a.Name.Local, true
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					isDecl = true
+				}
+				if isDecl {
+					if !copied {
+						e.ns, copied = copyMap(parent.ns), true
+					}
+					e.ns[prefix] = a.Value
+				}
+			}
+			parent.Content = append(parent.Content, e)
+			stack = append(stack, e)
+		case xml.EndElement:
+			if len(stack) < 2 {
+				return nil, errors.New("unexpected end element")
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			parent.Content = append(parent.Content, xml.CopyToken(t))
+		}
+	}
+	if len(stack) != 1 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return doc, nil
+}
+
+func copyMap(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m)+1)
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// is checks the element's namespace and local name
+func (e *xmlElement) is(uri, local string) bool {
+	return e.Name.Local == local && e.ns[e.Name.Space] == uri
+}
+
+// attrIs checks the attribute's namespace and local name
+func (e *xmlElement) attrIs(a xml.Attr, uri, local string) bool {
+	return a.Name.Space != "" && a.Name.Local == local && e.ns[a.Name.Space] == uri
+}
+
+// find returns the first element matching the function, depth first
+func (e *xmlElement) find(match func(*xmlElement) bool) *xmlElement {
+	for _, c := range e.Content {
+		if c, ok := c.(*xmlElement); ok {
+			if match(c) {
+				return c
+			}
+			if f := c.find(match); f != nil {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// descriptions returns the rdf:Description elements of the rdf:RDF element
+func (e *xmlElement) descriptions() []*xmlElement {
+	var l []*xmlElement
+	for _, c := range e.Content {
+		if c, ok := c.(*xmlElement); ok && c.is(nsRDF, "Description") {
+			l = append(l, c)
+		}
+	}
+	return l
+}
+
+// hasProperty checks if a rdf:Description has the property, as an attribute or as an element
+func (e *xmlElement) hasProperty(p xmpProp) bool {
+	for _, d := range e.descriptions() {
+		for _, a := range d.Attr {
+			if d.attrIs(a, p.uri, p.local) {
+				return true
+			}
+		}
+		for _, c := range d.Content {
+			if c, ok := c.(*xmlElement); ok && c.is(p.uri, p.local) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setProperty updates the existing property. It returns false when the property isn't found
+func (e *xmlElement) setProperty(v xmpValue) bool {
+	p := v.prop
+	for _, d := range e.descriptions() {
+		for i, a := range d.Attr {
+			if d.attrIs(a, p.uri, p.local) {
+				if v.items != nil {
+					// A bag can't be given as an attribute
+					d.Attr = append(d.Attr[:i], d.Attr[i+1:]...)
+					return false
+				}
+				d.Attr[i].Value = v.value
+				return true
+			}
+		}
+		for _, c := range d.Content {
+			if c, ok := c.(*xmlElement); ok && c.is(p.uri, p.local) {
+				if v.items != nil {
+					c.setItems(v.items)
+				} else {
+					c.setText(v.value)
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setItems replaces the items of a bag
+func (e *xmlElement) setItems(items []string) {
+	list := e.find(func(c *xmlElement) bool { return c.is(nsRDF, "Bag") || c.is(nsRDF, "Seq") })
+	if list != nil {
+		// Keep the indentation of the list
+		indent, end := "\n    ", "\n   "
+		if len(list.Content) > 1 {
+			if c, ok := list.Content[0].(xml.CharData); ok && strings.TrimSpace(string(c)) == "" {
+				indent = string(c)
+			}
+			if c, ok := list.Content[len(list.Content)-1].(xml.CharData); ok && strings.TrimSpace(string(c)) == "" {
+				end = string(c)
+			}
+		}
+		list.Content = liItems(list.Name.Space, list.ns, items, indent, end)
+		return
+	}
+	rdf := ""
+	for prefix, uri := range e.ns {
+		if uri == nsRDF {
+			rdf = prefix
+			break
+		}
+	}
+	e.Content = []any{xml.CharData("\n   "), rdfList(rdf, e.ns, "Bag", liItems(rdf, e.ns, items, "\n    ", "\n   ")), xml.CharData("\n  ")}
+}
+
+// rdfList makes a rdf:Bag, rdf:Seq or rdf:Alt element
+func rdfList(rdf string, ns map[string]string, kind string, content []any) *xmlElement {
+	return &xmlElement{Name: xml.Name{Space: rdf, Local: kind}, ns: ns, Content: content}
+}
+
+// liItems makes the rdf:li elements of a list, with their indentation
+func liItems(rdf string, ns map[string]string, items []string, indent string, end string) []any {
+	var content []any
+	for _, item := range items {
+		content = append(content, xml.CharData(indent), &xmlElement{
+			Name:    xml.Name{Space: rdf, Local: "li"},
+			Content: []any{xml.CharData(item)},
+			ns:      ns,
+		})
+	}
+	return append(content, xml.CharData(end))
+}
+
+// setText sets the value of a simple property, or the default item of a language alternative
+func (e *xmlElement) setText(value string) {
+	alt := e.find(func(c *xmlElement) bool { return c.is(nsRDF, "Alt") })
+	if alt == nil {
+		e.Content = []any{xml.CharData(value)}
+		return
+	}
+	var item *xmlElement
+	for _, c := range alt.Content {
+		if c, ok := c.(*xmlElement); ok && c.is(nsRDF, "li") {
+			if item == nil {
+				item = c
+			}
+			for _, a := range c.Attr {
+				if c.attrIs(a, nsXML, "lang") && a.Value == "x-default" {
+					item = c
+				}
+			}
+		}
+	}
+	if item == nil {
+		alt.Content = append(alt.Content, &xmlElement{
+			Name:    xml.Name{Space: alt.Name.Space, Local: "li"},
+			Attr:    []xml.Attr{{Name: xml.Name{Space: "xml", Local: "lang"}, Value: "x-default"}},
+			Content: []any{xml.CharData(value)},
+			ns:      alt.ns,
+		})
+		return
+	}
+	item.Content = []any{xml.CharData(value)}
+}
+
+// addDescription appends a rdf:Description with the values
+func (e *xmlElement) addDescription(values []xmpValue) {
+	rdf := e.Name.Space
+	d := &xmlElement{
+		Name: xml.Name{Space: rdf, Local: "Description"},
+		Attr: []xml.Attr{{Name: xml.Name{Space: rdf, Local: "about"}, Value: ""}},
+		ns:   copyMap(e.ns),
+	}
+	prefixes := map[string]string{}
+	for _, v := range values {
+		prefix, ok := prefixes[v.prop.uri]
+		if !ok {
+			prefix = d.declare(v.prop.uri)
+			prefixes[v.prop.uri] = prefix
+		}
+		prop := &xmlElement{Name: xml.Name{Space: prefix, Local: v.prop.local}, ns: d.ns}
+		switch {
+		case v.items != nil:
+			prop.Content = []any{
+				xml.CharData("\n   "),
+				rdfList(rdf, d.ns, "Bag", liItems(rdf, d.ns, v.items, "\n    ", "\n   ")),
+				xml.CharData("\n  "),
+			}
+		case langAltProps[v.prop]:
+			prop.Content = []any{
+				xml.CharData("\n   "),
+				rdfList(rdf, d.ns, "Alt", []any{
+					xml.CharData("\n    "),
+					&xmlElement{
+						Name:    xml.Name{Space: rdf, Local: "li"},
+						Attr:    []xml.Attr{{Name: xml.Name{Space: "xml", Local: "lang"}, Value: "x-default"}},
+						Content: []any{xml.CharData(v.value)},
+						ns:      d.ns,
+					},
+					xml.CharData("\n   "),
+				}),
+				xml.CharData("\n  "),
+			}
+		default:
+			prop.Content = []any{xml.CharData(v.value)}
+		}
+		d.Content = append(d.Content, xml.CharData("\n  "), prop)
+	}
+	d.Content = append(d.Content, xml.CharData("\n "))
+
+	// Insert the description after the last element of rdf:RDF
+	last := len(e.Content)
+	for i := len(e.Content) - 1; i >= 0; i-- {
+		if _, ok := e.Content[i].(*xmlElement); ok {
+			last = i + 1
+			break
+		}
+	}
+	content := append([]any{}, e.Content[:last]...)
+	content = append(content, xml.CharData("\n "), d)
+	e.Content = append(content, e.Content[last:]...)
+}
+
+var preferredPrefixes = map[string]string{
+	nsExif:      "exif",
+	nsDC:        "dc",
+	nsXMP:       "xmp",
+	nsPhotoshop: "photoshop",
+	nsLightroom: "lr",
+}
+
+// declare adds the namespace declaration on the element and returns its prefix
+func (e *xmlElement) declare(uri string) string {
+	prefix := preferredPrefixes[uri]
+	for i := 2; ; i++ {
+		if u, ok := e.ns[prefix]; !ok || u == uri {
+			break
+		}
+		prefix = fmt.Sprintf("%s%d", preferredPrefixes[uri], i)
+	}
+	e.ns[prefix] = uri
+	e.Attr = append(e.Attr, xml.Attr{Name: xml.Name{Space: "xmlns", Local: prefix}, Value: uri})
+	return prefix
+}
+
+func (e *xmlElement) write(w io.Writer) error {
+	b := bytes.Buffer{}
+	for _, c := range e.Content {
+		writeNode(&b, c)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func writeNode(b *bytes.Buffer, n any) {
+	switch n := n.(type) {
+	case *xmlElement:
+		name := rawName(n.Name)
+		b.WriteString("<" + name)
+		for _, a := range n.Attr {
+			b.WriteString(" " + rawName(a.Name) + `="`)
+			b.WriteString(attrEscaper.Replace(a.Value))
+			b.WriteString(`"`)
+		}
+		if len(n.Content) == 0 {
+			b.WriteString("/>")
+			return
+		}
+		b.WriteString(">")
+		for _, c := range n.Content {
+			writeNode(b, c)
+		}
+		b.WriteString("</" + name + ">")
+	case xml.CharData:
+		b.WriteString(textEscaper.Replace(string(n)))
+	case xml.Comment:
+		b.WriteString("<!--" + string(n) + "-->")
+	case xml.ProcInst:
+		b.WriteString("<?" + n.Target)
+		if len(n.Inst) > 0 {
+			b.WriteString(" " + string(n.Inst))
+		}
+		b.WriteString("?>")
+	case xml.Directive:
+		b.WriteString("<!" + string(n) + ">")
+	}
+}
+
+func rawName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "\n", "&#xA;", "\r", "&#xD;", "\t", "&#x9;")
+)
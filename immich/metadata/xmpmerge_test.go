@@ -0,0 +1,291 @@
+package metadata
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+const darktableSidecar = `<?xml version="1.0" encoding="UTF-8"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/" x:xmptk="XMP Core 4.4.0-Exiv2">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:darktable="http://darktable.sf.net/"
+    exif:DateTimeOriginal="2015:07:14 10:20:00"
+    darktable:xmp_version="5"
+    darktable:history_end="2">
+   <dc:description>
+    <rdf:Alt>
+     <rdf:li xml:lang="x-default">Sunset &amp; friends</rdf:li>
+    </rdf:Alt>
+   </dc:description>
+   <darktable:history>
+    <rdf:Seq>
+     <rdf:li darktable:operation="exposure" darktable:enabled="1"/>
+    </rdf:Seq>
+   </darktable:history>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+`
+
+var takeoutMetadata = Metadata{
+	Description: "From the takeout",
+	DateTaken:   time.Date(2015, 7, 14, 8, 0, 0, 0, time.UTC),
+	Latitude:    48.858370,
+	Longitude:   2.294481,
+}
+
+func TestMergeXMP(t *testing.T) {
+	tests := []struct {
+		name     string
+		md       Metadata
+		override bool
+		contains []string
+		excludes []string
+	}{
+		{
+			name: "nothing to merge",
+			md:   Metadata{},
+			contains: []string{
+				`<?xml version="1.0" encoding="UTF-8"?>`,
+				`exif:DateTimeOriginal="2015:07:14 10:20:00" darktable:xmp_version="5" darktable:history_end="2">`,
+				`<rdf:li xml:lang="x-default">Sunset &amp; friends</rdf:li>`,
+			},
+			excludes: []string{`<rdf:Description rdf:about="">`},
+		},
+		{
+			name: "merge",
+			md:   takeoutMetadata,
+			contains: []string{
+				`exif:DateTimeOriginal="2015:07:14 10:20:00"`,
+				`<rdf:li xml:lang="x-default">Sunset &amp; friends</rdf:li>`,
+				`<rdf:li darktable:operation="exposure" darktable:enabled="1"/>`,
+				`<rdf:Description rdf:about="" xmlns:exif="http://ns.adobe.com/exif/1.0/">`,
+				`<exif:GPSLatitude>48.858370</exif:GPSLatitude>`,
+				`<exif:GPSLongitude>2.294481</exif:GPSLongitude>`,
+			},
+			excludes: []string{
+				"From the takeout",
+				"2015-07-14T08:00:00Z",
+			},
+		},
+		{
+			name: "rating",
+			md:   Metadata{Rating: 3},
+			contains: []string{
+				`<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/">`,
+				`<xmp:Rating>3</xmp:Rating>`,
+			},
+		},
+		{
+			name: "title and keywords",
+			md:   Metadata{Title: "Sunset", Keywords: []string{"Travel", "Travel/France"}},
+			contains: []string{
+				`<rdf:li xml:lang="x-default">Sunset &amp; friends</rdf:li>`,
+				`xmlns:lr="http://ns.adobe.com/lightroom/1.0/"`,
+				"<dc:title>\n   <rdf:Alt>\n    <rdf:li xml:lang=\"x-default\">Sunset</rdf:li>",
+				"<dc:subject>\n   <rdf:Bag>\n    <rdf:li>Travel</rdf:li>\n    <rdf:li>Travel/France</rdf:li>\n   </rdf:Bag>\n  </dc:subject>",
+				"<lr:hierarchicalSubject>\n   <rdf:Bag>\n    <rdf:li>Travel</rdf:li>\n    <rdf:li>Travel|France</rdf:li>",
+			},
+		},
+		{
+			name:     "replace",
+			md:       takeoutMetadata,
+			override: true,
+			contains: []string{
+				`exif:DateTimeOriginal="2015-07-14T08:00:00Z"`,
+				`<rdf:li xml:lang="x-default">From the takeout</rdf:li>`,
+				`darktable:history_end="2"`,
+				`<exif:GPSLatitude>48.858370</exif:GPSLatitude>`,
+			},
+			excludes: []string{
+				"Sunset",
+				"2015:07:14 10:20:00",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := bytes.NewBuffer(nil)
+			err := MergeXMP(b, strings.NewReader(darktableSidecar), tt.md, tt.override)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := b.String()
+			for _, s := range tt.contains {
+				if !strings.Contains(got, s) {
+					t.Errorf("expecting %q in\n%s", s, got)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(got, s) {
+					t.Errorf("not expecting %q in\n%s", s, got)
+				}
+			}
+
+			// The result must be readable
+			err = MergeXMP(&bytes.Buffer{}, strings.NewReader(got), Metadata{}, false)
+			if err != nil {
+				t.Errorf("can't read the merged sidecar: %s", err)
+			}
+		})
+	}
+}
+
+const lightroomSidecar = `<x:xmpmeta xmlns:x="adobe:ns:meta/" x:xmptk="Adobe XMP Core 7.0-c000">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:lr="http://ns.adobe.com/lightroom/1.0/">
+   <dc:title>
+    <rdf:Alt>
+     <rdf:li xml:lang="x-default">Eiffel</rdf:li>
+    </rdf:Alt>
+   </dc:title>
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>Paris</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+   <lr:hierarchicalSubject>
+    <rdf:Bag>
+     <rdf:li>Places|Paris</rdf:li>
+    </rdf:Bag>
+   </lr:hierarchicalSubject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+`
+
+func TestMergeXMPTitleAndKeywords(t *testing.T) {
+	md := Metadata{Title: "From the takeout", Keywords: []string{"Travel", "Travel/France"}, Rating: 4}
+	tests := []struct {
+		name     string
+		sidecar  string
+		override bool
+		contains []string
+		excludes []string
+	}{
+		{
+			name:    "keep",
+			sidecar: lightroomSidecar,
+			contains: []string{
+				`<rdf:li xml:lang="x-default">Eiffel</rdf:li>`,
+				`<rdf:li>Paris</rdf:li>`,
+				`<rdf:li>Places|Paris</rdf:li>`,
+				`<xmp:Rating>4</xmp:Rating>`,
+			},
+			excludes: []string{"From the takeout", "Travel"},
+		},
+		{
+			name:     "replace",
+			sidecar:  lightroomSidecar,
+			override: true,
+			contains: []string{
+				`<rdf:li xml:lang="x-default">From the takeout</rdf:li>`,
+				"<dc:subject>\n    <rdf:Bag>\n     <rdf:li>Travel</rdf:li>\n     <rdf:li>Travel/France</rdf:li>\n    </rdf:Bag>",
+				"<lr:hierarchicalSubject>\n    <rdf:Bag>\n     <rdf:li>Travel</rdf:li>\n     <rdf:li>Travel|France</rdf:li>\n    </rdf:Bag>",
+			},
+			excludes: []string{"Eiffel", "Paris", "<dc2:", "<lr2:"},
+		},
+		{
+			name:     "replace the subject only",
+			sidecar:  strings.Replace(lightroomSidecar, "<lr:hierarchicalSubject>\n    <rdf:Bag>\n     <rdf:li>Places|Paris</rdf:li>\n    </rdf:Bag>\n   </lr:hierarchicalSubject>", "", 1),
+			override: true,
+			contains: []string{
+				"<dc:subject>\n    <rdf:Bag>\n     <rdf:li>Travel</rdf:li>",
+				`<rdf:Description rdf:about="" xmlns:lr="http://ns.adobe.com/lightroom/1.0/" xmlns:xmp="http://ns.adobe.com/xap/1.0/">`,
+				"<lr:hierarchicalSubject>\n   <rdf:Bag>\n    <rdf:li>Travel</rdf:li>\n    <rdf:li>Travel|France</rdf:li>",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := bytes.NewBuffer(nil)
+			err := MergeXMP(b, strings.NewReader(tt.sidecar), md, tt.override)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := b.String()
+			for _, s := range tt.contains {
+				if !strings.Contains(got, s) {
+					t.Errorf("expecting %q in\n%s", s, got)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(got, s) {
+					t.Errorf("not expecting %q in\n%s", s, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeXMPGeneratedSidecar(t *testing.T) {
+	// Complete a sidecar written by immich-go, where the exif prefix is taken by the description
+	sidecar := Metadata{DateTaken: time.Date(2000, 1, 2, 15, 32, 59, 0, time.UTC)}.String()
+	sidecar = strings.Replace(sidecar, "<rdf:RDF ", `<rdf:RDF xmlns:dc="urn:something:else" `, 1)
+
+	b := bytes.NewBuffer(nil)
+	err := MergeXMP(b, strings.NewReader(sidecar), takeoutMetadata, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+	for _, s := range []string{
+		`<exif:DateTimeOriginal>2000-01-02T15:32:59Z</exif:DateTimeOriginal>`,
+		`xmlns:dc2="http://purl.org/dc/elements/1.1/"`,
+		`<dc2:description>`,
+		`<rdf:li xml:lang="x-default">From the takeout</rdf:li>`,
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("expecting %q in\n%s", s, got)
+		}
+	}
+}
+
+func TestSideCarPolicy(t *testing.T) {
+	fsys := fstest.MapFS{
+		"photo.jpg.xmp": &fstest.MapFile{Data: []byte(darktableSidecar)},
+		"broken.xmp":    &fstest.MapFile{Data: []byte("<x:xmpmeta><rdf:RDF>")},
+	}
+	tests := []struct {
+		file     string
+		policy   string
+		contains string
+	}{
+		{"photo.jpg.xmp", "keep", "Sunset"},
+		{"photo.jpg.xmp", "merge", "<exif:GPSLatitude>48.858370</exif:GPSLatitude>"},
+		{"photo.jpg.xmp", "replace", "From the takeout"},
+		{"broken.xmp", "merge", "<x:xmpmeta><rdf:RDF>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file+"/"+tt.policy, func(t *testing.T) {
+			sc := SideCarFile{FSys: fsys, FileName: tt.file}
+			err := sc.Policy.Set(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := bytes.NewBuffer(nil)
+			err = sc.WriteWithMetadata(b, takeoutMetadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.policy == "keep" && b.String() != darktableSidecar {
+				t.Errorf("the sidecar has changed")
+			}
+			if !strings.Contains(b.String(), tt.contains) {
+				t.Errorf("expecting %q in\n%s", tt.contains, b.String())
+			}
+		})
+	}
+	var p SideCarPolicy
+	if p.Set("overwrite") == nil {
+		t.Errorf("expecting an error for an invalid policy")
+	}
+}
@@ -0,0 +1,97 @@
+package immich
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+
+	"github.com/simulot/immich-go/browser"
+)
+
+type Person struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	IsHidden bool   `json:"isHidden,omitempty"`
+}
+
+type peopleResponse struct {
+	People      []Person `json:"people"`
+	Total       int      `json:"total"`
+	HasNextPage bool     `json:"hasNextPage"`
+}
+
+// GetAllPeople returns the people known by the server, hidden people included
+func (ic *ImmichClient) GetAllPeople(ctx context.Context) ([]Person, error) {
+	var people []Person
+	for page := 1; ; page++ {
+		var r peopleResponse
+		err := ic.newServerCall(ctx, EndPointGetAllPeople).do(
+			getRequest(fmt.Sprintf("/people?withHidden=true&page=%d&size=500", page), setAcceptJSON()),
+			responseJSON(&r))
+		if err != nil {
+			return nil, err
+		}
+		people = append(people, r.People...)
+		if !r.HasNextPage || len(r.People) == 0 {
+			return people, nil
+		}
+	}
+}
+
+// CreatePerson creates a person with the given name
+func (ic *ImmichClient) CreatePerson(ctx context.Context, name string) (Person, error) {
+	var r Person
+	body := struct {
+		Name string `json:"name"`
+	}{
+		Name: name,
+	}
+	err := ic.newServerCall(ctx, EndPointCreatePerson).do(
+		postRequest("/people", "application/json", setAcceptJSON(), setJSONBody(body)),
+		responseJSON(&r))
+	return r, err
+}
+
+// Face is a face found on an asset
+type Face struct {
+	ID     string  `json:"id"`
+	Person *Person `json:"person"`
+}
+
+// faceScale is the size of the image given with the faces. The regions are given in fractions of the image's size.
+const faceScale = 10000
+
+// GetAssetFaces returns the faces of the asset
+func (ic *ImmichClient) GetAssetFaces(ctx context.Context, assetID string) ([]Face, error) {
+	var r []Face
+	err := ic.newServerCall(ctx, EndPointGetAssetFaces).do(
+		getRequest("/faces?id="+url.QueryEscape(assetID), setAcceptJSON()),
+		responseJSON(&r))
+	return r, err
+}
+
+// AddAssetToPerson tags the person on the asset, with the face found in the region
+func (ic *ImmichClient) AddAssetToPerson(ctx context.Context, assetID string, personID string, region browser.FaceRegion) error {
+	body := struct {
+		AssetID     string `json:"assetId"`
+		PersonID    string `json:"personId"`
+		ImageWidth  int    `json:"imageWidth"`
+		ImageHeight int    `json:"imageHeight"`
+		X           int    `json:"x"`
+		Y           int    `json:"y"`
+		Width       int    `json:"width"`
+		Height      int    `json:"height"`
+	}{
+		AssetID:     assetID,
+		PersonID:    personID,
+		ImageWidth:  faceScale,
+		ImageHeight: faceScale,
+		X:           int(math.Round(region.X * faceScale)),
+		Y:           int(math.Round(region.Y * faceScale)),
+		Width:       int(math.Round(region.Width * faceScale)),
+		Height:      int(math.Round(region.Height * faceScale)),
+	}
+	return ic.newServerCall(ctx, EndPointAddAssetToPerson).do(
+		postRequest("/faces", "application/json", setJSONBody(body)))
+}
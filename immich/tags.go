@@ -0,0 +1,48 @@
+package immich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+type Tag struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Value string `json:"value"` // the full name of the tag, with its parents
+}
+
+// UpsertTags returns the tags with the given names, and creates the missing ones.
+// The parents of a tag are given in its name: "parent/child".
+func (ic *ImmichClient) UpsertTags(ctx context.Context, names []string) ([]Tag, error) {
+	var r []Tag
+	body := struct {
+		Tags []string `json:"tags"`
+	}{
+		Tags: names,
+	}
+	err := ic.newServerCall(ctx, EndPointUpsertTags).do(
+		putRequest("/tags", setAcceptJSON(), setJSONBody(body)),
+		responseJSON(&r))
+	return r, err
+}
+
+// TagAssets adds the tag to the assets. The assets already tagged are ignored.
+func (ic *ImmichClient) TagAssets(ctx context.Context, tagID string, assetIDs []string) error {
+	var r []UpdateAlbumResult
+	body := UpdateAlbum{
+		IDS: assetIDs,
+	}
+	err := ic.newServerCall(ctx, EndPointTagAssets).do(
+		putRequest(fmt.Sprintf("/tags/%s/assets", tagID), setAcceptJSON(), setJSONBody(body)),
+		responseJSON(&r))
+	if err != nil {
+		return err
+	}
+	for _, res := range r {
+		if !res.Success && res.Error != "duplicate" {
+			err = errors.Join(err, fmt.Errorf("can't tag the asset %s: %s", res.ID, res.Error))
+		}
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package immich
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+/*
+	The bandwidth limiter is shared by all uploads of the client.
+	Each write reserves its time slot, and waits for it.
+
+	A throttled upload can last longer than the client's timeout: a 1 GB video takes 17 minutes at 1 MB/s.
+	The throttled uploads are done without the overall timeout, they are cancelled when no byte
+	has been sent during the timeout instead.
+*/
+
+// ErrUploadStalled is the error of a throttled upload that doesn't progress
+var ErrUploadStalled = errors.New("the upload is stalled")
+
+type bandwidthLimiter struct {
+	lock           sync.Mutex
+	bytesPerSecond int64
+	next           time.Time // when the next write can start
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	return &bandwidthLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// wait until the n bytes can be sent
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	l.lock.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	start := l.next
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.bytesPerSecond) * float64(time.Second)))
+	l.lock.Unlock()
+
+	d := start.Sub(now)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// throttledWriter limits the throughput of the writer
+type throttledWriter struct {
+	ctx      context.Context
+	w        io.Writer
+	l        *bandwidthLimiter
+	idle     time.Duration // the upload is cancelled when no byte is sent during this duration
+	watchdog *time.Timer
+}
+
+// throttleChunk is the largest amount of data sent at once
+const throttleChunk = 16 * 1024
+
+func (tw *throttledWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := b[:min(len(b), throttleChunk)]
+		err := tw.l.wait(tw.ctx, len(chunk))
+		if err != nil {
+			return written, err
+		}
+		n, err := tw.w.Write(chunk)
+		written += n
+		if tw.watchdog != nil {
+			tw.watchdog.Reset(tw.idle)
+		}
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// throttle limits the writer's bandwidth when a limit is set.
+// The returned context cancels the upload when it stalls, and stop releases it.
+func (ic *ImmichClient) throttle(ctx context.Context, w io.Writer) (_ context.Context, _ io.Writer, stop func()) {
+	if ic.limiter == nil {
+		return ctx, w, func() {}
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	tw := &throttledWriter{ctx: ctx, w: w, l: ic.limiter}
+	if ic.client != nil && ic.client.Timeout > 0 {
+		tw.idle = ic.client.Timeout
+		tw.watchdog = time.AfterFunc(tw.idle, func() { cancel(ErrUploadStalled) })
+	}
+	return ctx, tw, func() {
+		if tw.watchdog != nil {
+			tw.watchdog.Stop()
+		}
+		cancel(nil)
+	}
+}
+
+// throttled tells if the uploads are throttled
+func (ic *ImmichClient) throttled() bool {
+	return ic.limiter != nil
+}
@@ -0,0 +1,138 @@
+package immich
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+)
+
+func TestThrottledWriter(t *testing.T) {
+	ic := &ImmichClient{}
+	err := OptionMaxBandwidth(100 * 1024)(ic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two writers share the bandwidth: 2 x 32K at 100K/s take at least 0.48s (the first chunk is free)
+	buf := make([]byte, 32*1024)
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, w, stop := ic.throttle(context.Background(), io.Discard)
+			defer stop()
+			n, err := w.Write(buf)
+			if err != nil || n != len(buf) {
+				t.Errorf("write: n=%d, err=%v", n, err)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	if elapsed < 450*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("unexpected duration: %s", elapsed)
+	}
+}
+
+func TestThrottledWriterCancel(t *testing.T) {
+	ic := &ImmichClient{}
+	_ = OptionMaxBandwidth(1024)(ic)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, w, stop := ic.throttle(ctx, io.Discard)
+	defer stop()
+	_, err := w.Write(make([]byte, 64*1024))
+	if err == nil {
+		t.Errorf("the write should be cancelled")
+	}
+}
+
+func TestNoThrottle(t *testing.T) {
+	ic := &ImmichClient{}
+	_ = OptionMaxBandwidth(0)(ic)
+	if _, w, _ := ic.throttle(context.Background(), io.Discard); w != io.Discard {
+		t.Errorf("the writer shouldn't be throttled")
+	}
+}
+
+// stalledFile gives some bytes, then blocks until released
+type stalledFile struct {
+	fs.File
+	sent    int
+	release chan struct{}
+}
+
+func (f *stalledFile) Read(b []byte) (int, error) {
+	if f.sent > 1024 {
+		<-f.release
+		return 0, io.ErrUnexpectedEOF
+	}
+	n, err := f.File.Read(b[:min(len(b), 1024)])
+	f.sent += n
+	return n, err
+}
+
+type stalledFS struct {
+	fstest.MapFS
+	release chan struct{}
+}
+
+func (s stalledFS) Open(name string) (fs.File, error) {
+	f, err := s.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &stalledFile{File: f, release: s.release}, nil
+}
+
+func TestThrottledUploadTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"1234","status":"created"}`))
+	}))
+	defer server.Close()
+
+	ic, err := NewImmichClient(server.URL, "key", OptionConnectionTimeout(300*time.Millisecond), OptionMaxBandwidth(64*1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ic.supportedMediaTypes = DefaultSupportedMedia
+
+	// 96K at 64K/s takes longer than the client's timeout
+	fsys := fstest.MapFS{"photo.jpg": {Data: make([]byte, 96*1024)}}
+	a := &browser.LocalAssetFile{FSys: fsys, FileName: "photo.jpg", Title: "photo.jpg", FileSize: 96 * 1024}
+	start := time.Now()
+	r, err := ic.AssetUpload(context.Background(), a)
+	a.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != "1234" {
+		t.Errorf("unexpected response %+v", r)
+	}
+	if time.Since(start) < 300*time.Millisecond {
+		t.Errorf("the upload isn't throttled")
+	}
+
+	// A stalled upload is cancelled after the client's timeout
+	stalled := stalledFS{MapFS: fsys, release: make(chan struct{})}
+	defer close(stalled.release)
+	a = &browser.LocalAssetFile{FSys: stalled, FileName: "photo.jpg", Title: "photo.jpg", FileSize: 96 * 1024}
+	_, err = ic.AssetUpload(context.Background(), a)
+	if !errors.Is(err, ErrUploadStalled) {
+		t.Errorf("expecting a stalled upload, got %v", err)
+	}
+}
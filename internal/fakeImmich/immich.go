@@ -18,6 +18,14 @@ func (c *MockedCLient) AssetUpload(context.Context, *browser.LocalAssetFile) (im
 	return immich.AssetResponse{}, nil
 }
 
+func (c *MockedCLient) CheckBulkUpload(context.Context, []immich.BulkUploadCheckItem) ([]immich.BulkUploadCheckResult, error) {
+	return nil, nil
+}
+
+func (c *MockedCLient) GetAssetByID(context.Context, string) (*immich.Asset, error) {
+	return &immich.Asset{}, nil
+}
+
 func (c *MockedCLient) DeleteAssets(context.Context, []string, bool) error {
 	return nil
 }
@@ -30,6 +38,10 @@ func (c *MockedCLient) AddAssetToAlbum(context.Context, string, []string) ([]imm
 	return nil, nil
 }
 
+func (c *MockedCLient) RemoveAssetFromAlbum(context.Context, string, []string) ([]immich.UpdateAlbumResult, error) {
+	return nil, nil
+}
+
 func (c *MockedCLient) CreateAlbum(context.Context, string, string, []string) (immich.AlbumSimplified, error) {
 	return immich.AlbumSimplified{}, nil
 }
@@ -38,6 +50,42 @@ func (c *MockedCLient) UpdateAssets(ctx context.Context, ids []string, isArchive
 	return nil
 }
 
+func (c *MockedCLient) GetAllPeople(ctx context.Context) ([]immich.Person, error) {
+	return nil, nil
+}
+
+func (c *MockedCLient) CreatePerson(ctx context.Context, name string) (immich.Person, error) {
+	return immich.Person{}, nil
+}
+
+func (c *MockedCLient) AddAssetToPerson(ctx context.Context, assetID string, personID string, region browser.FaceRegion) error {
+	return nil
+}
+
+func (c *MockedCLient) GetAssetFaces(ctx context.Context, assetID string) ([]immich.Face, error) {
+	return nil, nil
+}
+
+func (c *MockedCLient) UpsertTags(ctx context.Context, names []string) ([]immich.Tag, error) {
+	return nil, nil
+}
+
+func (c *MockedCLient) TagAssets(ctx context.Context, tagID string, assetIDs []string) error {
+	return nil
+}
+
+func (c *MockedCLient) GetAllUsers(ctx context.Context) ([]immich.User, error) {
+	return nil, nil
+}
+
+func (c *MockedCLient) AddUsersToAlbum(ctx context.Context, albumID string, users []immich.AlbumUser) error {
+	return nil
+}
+
+func (c *MockedCLient) AddActivity(ctx context.Context, a immich.Activity) error {
+	return nil
+}
+
 func (c *MockedCLient) StackAssets(ctx context.Context, cover string, ids []string) error {
 	return nil
 }